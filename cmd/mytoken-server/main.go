@@ -13,7 +13,9 @@ import (
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/versionrepo"
 	configurationEndpoint "github.com/oidc-mytoken/server/internal/endpoints/configuration"
+	"github.com/oidc-mytoken/server/internal/endpoints/renewal"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings"
+	"github.com/oidc-mytoken/server/internal/jobs"
 	"github.com/oidc-mytoken/server/internal/jws"
 	"github.com/oidc-mytoken/server/internal/model/version"
 	notifier "github.com/oidc-mytoken/server/internal/notifier/client"
@@ -25,6 +27,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/utils/cache"
 	"github.com/oidc-mytoken/server/internal/utils/cookies"
 	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	loggerUtils "github.com/oidc-mytoken/server/internal/utils/logger"
 )
 
@@ -32,6 +35,7 @@ func main() {
 	handleSignals()
 	config.Load()
 	loggerUtils.Init()
+	i18n.Init()
 	cache.InitCache()
 	routes.Init()
 	provider2.Init()
@@ -45,6 +49,8 @@ func main() {
 	settings.InitSettings()
 	cookies.Init()
 	notifier.Init()
+	renewal.Init()
+	jobs.Start()
 	healthcheck.Start()
 	server.Start()
 }
@@ -71,8 +77,10 @@ func reload() {
 	loggerUtils.SetOutput()
 	loggerUtils.MustUpdateAccessLogger()
 	db.Connect()
+	provider2.Init()
 	jws.LoadMytokenSigningKey()
 	geoip.Init()
+	i18n.Init()
 	oidcfed.Discovery()
 }
 
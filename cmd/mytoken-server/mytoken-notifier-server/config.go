@@ -6,6 +6,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/oidc-mytoken/server/internal/config"
+	server "github.com/oidc-mytoken/server/internal/notifier/server"
 )
 
 var possibleConfigLocations = []string{
@@ -14,7 +15,9 @@ var possibleConfigLocations = []string{
 }
 
 type conff struct {
-	Email config.MailNotificationConf `yaml:"email"`
+	Email         config.MailNotificationConf `yaml:"email"`
+	Chat          config.ChatNotificationConf `yaml:"chat"`
+	MytokenServer server.AuthConf             `yaml:"mytoken_server"`
 }
 
 var conf conff
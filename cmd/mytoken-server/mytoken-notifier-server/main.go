@@ -6,5 +6,5 @@ import (
 
 func main() {
 	loadConfig()
-	server.InitStandalone(conf.Email)
+	server.InitStandalone(conf.Email, conf.Chat, conf.MytokenServer)
 }
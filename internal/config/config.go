@@ -1,10 +1,14 @@
 package config
 
 import (
+	"encoding/json"
+	"net"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/oidc-mytoken/utils/context"
@@ -13,6 +17,8 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	oidfed "github.com/zachmann/go-oidfed/pkg"
+	"github.com/zachmann/go-oidfed/pkg/constants"
+	"github.com/zachmann/go-oidfed/pkg/jwk"
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 
@@ -39,6 +45,13 @@ var defaultConfig = Config{
 			Window:      300,
 			AlwaysAllow: []string{"127.0.0.1"},
 		},
+		Jobs: jobsConf{
+			PollInterval:      5,
+			BatchSize:         20,
+			VisibilityTimeout: 300,
+			LeaderLease:       30,
+			MaxAttempts:       5,
+		},
 	},
 	DB: DBConf{
 		Hosts:             []string{"localhost"},
@@ -83,6 +96,11 @@ var defaultConfig = Config{
 			},
 		},
 		TokenRevocation: onlyEnable{true},
+		TokenSuspension: onlyEnable{true},
+		TokenRenewal: tokenRenewalConf{
+			Enabled:          true,
+			MaxTotalLifetime: 365 * 24 * 3600,
+		},
 		ShortTokens: shortTokenConfig{
 			Enabled: true,
 			Len:     64,
@@ -101,14 +119,31 @@ var defaultConfig = Config{
 			Tree:       onlyEnable{true},
 			List:       onlyEnable{true},
 		},
-		WebInterface: webConfig{Enabled: true},
+		WebInterface: webConfig{
+			Enabled: true,
+			WebAuthn: webAuthnConf{
+				Enabled:        false,
+				StepUpLifetime: 300,
+			},
+		},
 		SSH: sshConf{
-			Enabled: false,
+			Enabled:     false,
+			Listen:      []string{":2222"},
+			MaxTimeout:  30,
+			IdleTimeout: 10,
+			UserCertificates: SSHUserCertificatesConf{
+				DefaultLifetime: 3600,
+				MaxLifetime:     86400,
+				Principal:       "{sub}@{issuer}",
+			},
 		},
 		ServerProfiles: serverProfilesConf{
 			Enabled: true,
 			Groups:  make(map[string]string),
 		},
+		ClientRegistry: clientRegistryConf{
+			Admins: make(map[string]string),
+		},
 		Notifications: notificationConf{
 			Mail: MailNotificationConf{
 				Enabled: false,
@@ -116,7 +151,38 @@ var defaultConfig = Config{
 					Port: 587,
 				},
 			},
-			ICS: onlyEnable{true},
+			ICS: icsConf{
+				Enabled: true,
+				CalDAV:  onlyEnable{true},
+			},
+			Queue: notificationQueueConf{
+				PollInterval:     5,
+				MaxAttempts:      10,
+				RetryInterval:    60,
+				MaxRetryInterval: 60 * 60,
+			},
+		},
+		SuspiciousActivity: suspiciousActivityConf{
+			ImpossibleTravel: impossibleTravelConf{
+				MinTravelTime: 3600,
+			},
+			ATBurst: atBurstConf{
+				MaxRequests: 100,
+				Window:      60,
+			},
+		},
+		ProviderHealth: providerHealthConf{
+			RefreshInterval: 60 * 60,
+			ErrorRateWindow: 60 * 60,
+			CircuitBreaker: circuitBreakerConf{
+				Enabled:          true,
+				FailureThreshold: 5,
+				OpenDuration:     60,
+			},
+		},
+		AccessTokenCache: accessTokenCacheConf{
+			Enabled:              false,
+			MinRemainingLifetime: 60,
 		},
 		Federation: federationConf{
 			Enabled:                     false,
@@ -125,6 +191,9 @@ var defaultConfig = Config{
 				Alg:       jwa.ES512,
 				RSAKeyLen: 2048,
 			},
+			Authority: FederationAuthorityConf{
+				SubordinateStatementLifetime: 24 * 60 * 60,
+			},
 		},
 	},
 	API: apiConf{
@@ -136,6 +205,10 @@ var defaultConfig = Config{
 			CleanupInterval:   600,
 		},
 	},
+	I18n: i18nConf{
+		DefaultLanguage: "en",
+		Languages:       []string{"en", "de", "fr"},
+	},
 }
 
 // Config holds the server configuration
@@ -153,6 +226,23 @@ type Config struct {
 	Providers            []*ProviderConf     `yaml:"providers"`
 	ServiceOperator      ServiceOperatorConf `yaml:"service_operator"`
 	Caching              cacheConf           `yaml:"cache"`
+	I18n                 i18nConf            `yaml:"i18n"`
+}
+
+type i18nConf struct {
+	DefaultLanguage string   `yaml:"default_language"`
+	Languages       []string `yaml:"languages"`
+	OverwriteDir    string   `yaml:"overwrite_dir"`
+}
+
+func (c *i18nConf) validate() error {
+	if c.DefaultLanguage == "" {
+		c.DefaultLanguage = "en"
+	}
+	if !utils2.StringInSlice(c.DefaultLanguage, c.Languages) {
+		c.Languages = append([]string{c.DefaultLanguage}, c.Languages...)
+	}
+	return nil
 }
 
 type apiConf struct {
@@ -162,6 +252,8 @@ type apiConf struct {
 type featuresConf struct {
 	OIDCFlows               oidcFlowsConf           `yaml:"oidc_flows"`
 	TokenRevocation         onlyEnable              `yaml:"token_revocation"`
+	TokenSuspension         onlyEnable              `yaml:"token_suspension"`
+	TokenRenewal            tokenRenewalConf        `yaml:"token_renewal"`
 	ShortTokens             shortTokenConfig        `yaml:"short_tokens"`
 	TransferCodes           onlyEnable              `yaml:"transfer_codes"`
 	Polling                 pollingConf             `yaml:"polling_codes"`
@@ -174,6 +266,63 @@ type featuresConf struct {
 	Federation              federationConf          `yaml:"federation"`
 	GuestMode               onlyEnable              `yaml:"guest_mode"`
 	Notifications           notificationConf        `yaml:"notifications"`
+	SuspiciousActivity      suspiciousActivityConf  `yaml:"suspicious_activity"`
+	ProviderHealth          providerHealthConf      `yaml:"provider_health"`
+	AccessTokenCache        accessTokenCacheConf    `yaml:"access_token_cache"`
+	ClientRegistry          clientRegistryConf      `yaml:"client_registry"`
+}
+
+type tokenRenewalConf struct {
+	Enabled             bool     `yaml:"enabled"`
+	WebhookAllowedHosts []string `yaml:"webhook_allowed_hosts"`
+	MaxTotalLifetime    int64    `yaml:"max_total_lifetime"`
+}
+
+// validate validates the tokenRenewalConf; renewals are approved through a link in the expiration notifications, so
+// they are disabled if neither email nor chat notifications are enabled. Renewals must not extend a mytoken
+// indefinitely, so a positive max_total_lifetime is required.
+func (c *tokenRenewalConf) validate(notifications notificationConf) error {
+	if c.Enabled && !notifications.Mail.Enabled && !notifications.Chat.Enabled {
+		log.Warning("token_renewal requires email or chat notifications; disabling token renewal")
+		c.Enabled = false
+	}
+	if c.Enabled && c.MaxTotalLifetime <= 0 {
+		return errors.New("invalid config: token_renewal.max_total_lifetime must be positive")
+	}
+	return nil
+}
+
+type accessTokenCacheConf struct {
+	Enabled              bool  `yaml:"enabled"`
+	MinRemainingLifetime int64 `yaml:"min_remaining_lifetime"`
+}
+
+type providerHealthConf struct {
+	RefreshInterval int64              `yaml:"refresh_interval"`
+	ErrorRateWindow int64              `yaml:"error_rate_window"`
+	CircuitBreaker  circuitBreakerConf `yaml:"circuit_breaker"`
+}
+
+type circuitBreakerConf struct {
+	Enabled          bool  `yaml:"enabled"`
+	FailureThreshold int   `yaml:"failure_threshold"`
+	OpenDuration     int64 `yaml:"open_duration"`
+}
+
+func (c *providerHealthConf) validate() error {
+	if c.RefreshInterval < 0 {
+		return errors.New("invalid config: provider_health.refresh_interval must not be negative")
+	}
+	if c.ErrorRateWindow <= 0 {
+		c.ErrorRateWindow = 60 * 60
+	}
+	if c.CircuitBreaker.FailureThreshold <= 0 {
+		c.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.CircuitBreaker.OpenDuration <= 0 {
+		c.CircuitBreaker.OpenDuration = 60
+	}
+	return nil
 }
 
 func (c *featuresConf) validate() error {
@@ -192,6 +341,21 @@ func (c *featuresConf) validate() error {
 	if err := c.SSH.validate(); err != nil {
 		return err
 	}
+	if err := c.SuspiciousActivity.validate(); err != nil {
+		return err
+	}
+	if err := c.ProviderHealth.validate(); err != nil {
+		return err
+	}
+	if err := c.ClientRegistry.validate(); err != nil {
+		return err
+	}
+	if err := c.TokenRenewal.validate(c.Notifications); err != nil {
+		return err
+	}
+	if c.AccessTokenCache.MinRemainingLifetime < 0 {
+		return errors.New("invalid config: access_token_cache.min_remaining_lifetime must not be negative")
+	}
 	return nil
 }
 
@@ -227,16 +391,67 @@ func (c *authcodeWebClientsConf) validate() error {
 }
 
 type sshConf struct {
-	Enabled          bool         `yaml:"enabled"`
-	UseProxyProtocol bool         `yaml:"use_proxy_protocol"`
-	KeyFiles         []string     `yaml:"keys"`
-	PrivateKeys      []ssh.Signer `yaml:"-"`
+	Enabled          bool                    `yaml:"enabled"`
+	UseProxyProtocol bool                    `yaml:"use_proxy_protocol"`
+	Listen           []string                `yaml:"listen"`
+	MaxTimeout       int                     `yaml:"max_timeout"`
+	IdleTimeout      int                     `yaml:"idle_timeout"`
+	AdvertisedHost   string                  `yaml:"advertised_host"`
+	AdvertisedPort   int                     `yaml:"advertised_port"`
+	KeyFiles         []string                `yaml:"keys"`
+	PrivateKeys      []ssh.Signer            `yaml:"-"`
+	UserCertificates SSHUserCertificatesConf `yaml:"user_certificates"`
+}
+
+// SSHUserCertificatesConf holds the configuration for issuing ssh user certificates
+type SSHUserCertificatesConf struct {
+	Enabled         bool       `yaml:"enabled"`
+	CAKeyFile       string     `yaml:"ca_key"`
+	DefaultLifetime int64      `yaml:"default_lifetime"`
+	MaxLifetime     int64      `yaml:"max_lifetime"`
+	Principal       string     `yaml:"principal"`
+	CAKey           ssh.Signer `yaml:"-"`
+}
+
+func (c *SSHUserCertificatesConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CAKeyFile == "" {
+		return errors.New("invalid config: ssh user certificates enabled, but no ca key set")
+	}
+	pemBytes, err := os.ReadFile(c.CAKeyFile)
+	if err != nil {
+		return errors.Wrap(err, "reading ssh user ca key")
+	}
+	if c.CAKey, err = ssh.ParsePrivateKey(pemBytes); err != nil {
+		return errors.Wrap(err, "parsing ssh user ca key")
+	}
+	if c.MaxLifetime <= 0 {
+		return errors.New("invalid config: ssh user certificates max_lifetime must be positive")
+	}
+	if c.DefaultLifetime <= 0 || c.DefaultLifetime > c.MaxLifetime {
+		c.DefaultLifetime = c.MaxLifetime
+	}
+	if !strings.Contains(c.Principal, "{sub}") {
+		return errors.New("invalid config: ssh user certificates principal must contain '{sub}'")
+	}
+	return nil
 }
 
 func (c *sshConf) validate() error {
+	if err := c.UserCertificates.validate(); err != nil {
+		return err
+	}
 	if !c.Enabled {
 		return nil
 	}
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+	if c.MaxTimeout < 0 || c.IdleTimeout < 0 {
+		return errors.New("invalid config: ssh timeouts must not be negative")
+	}
 	if len(c.KeyFiles) == 0 {
 		return errors.New("invalid config: ssh feature enabled, but no ssh private key set")
 	}
@@ -254,6 +469,38 @@ func (c *sshConf) validate() error {
 	return nil
 }
 
+// validateListeners checks the listen addresses and sets the advertised host and port if they are not configured;
+// by default the host of the issuer url and the port of the first listener are advertised
+func (c *sshConf) validateListeners() error {
+	if len(c.Listen) == 0 {
+		return errors.New("invalid config: ssh feature enabled, but no listen address set")
+	}
+	var firstPort int
+	for i, l := range c.Listen {
+		_, portStr, err := net.SplitHostPort(l)
+		if err != nil {
+			return errors.Wrapf(err, "invalid config: ssh listen address '%s' not valid", l)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			return errors.Errorf("invalid config: ssh listen address '%s' has no valid port", l)
+		}
+		if i == 0 {
+			firstPort = port
+		}
+	}
+	if c.AdvertisedHost == "" {
+		c.AdvertisedHost = conf.Host
+	}
+	if c.AdvertisedPort == 0 {
+		c.AdvertisedPort = firstPort
+	}
+	if c.AdvertisedPort < 0 || c.AdvertisedPort > 65535 {
+		return errors.New("invalid config: ssh advertised_port not valid")
+	}
+	return nil
+}
+
 type serverProfilesConf struct {
 	Enabled bool                     `yaml:"enabled"`
 	Groups  profileGroupsCredentials `yaml:"groups"`
@@ -278,19 +525,72 @@ func (g profileGroupsCredentials) validate() error {
 	return nil
 }
 
+type clientRegistryConf struct {
+	Enabled bool              `yaml:"enabled"`
+	Admins  map[string]string `yaml:"admins"`
+}
+
+func (c clientRegistryConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	for u, pw := range c.Admins {
+		if u == "" {
+			return errors.New("invalid config: empty admin name in client_registry.admins")
+		}
+		if pw == "" {
+			return errors.Errorf("invalid config: password not set for client registry admin '%s'", u)
+		}
+	}
+	return nil
+}
+
 type notificationConf struct {
-	AnyEnabled     bool                 `yaml:"-"`
-	Mail           MailNotificationConf `yaml:"email"`
-	Websocket      onlyEnable           `yaml:"ws"`
-	ICS            onlyEnable           `yaml:"ics"`
-	NotifierServer string               `yaml:"notifier_server_url"`
+	AnyEnabled     bool                  `yaml:"-"`
+	Mail           MailNotificationConf  `yaml:"email"`
+	Websocket      onlyEnable            `yaml:"ws"`
+	ICS            icsConf               `yaml:"ics"`
+	Chat           ChatNotificationConf  `yaml:"chat"`
+	NotifierServer string                `yaml:"notifier_server_url"`
+	Queue          notificationQueueConf `yaml:"queue"`
+}
+
+type icsConf struct {
+	Enabled bool       `yaml:"enabled"`
+	CalDAV  onlyEnable `yaml:"caldav"`
+}
+
+type notificationQueueConf struct {
+	PollInterval     int `yaml:"poll_interval"`
+	MaxAttempts      int `yaml:"max_attempts"`
+	RetryInterval    int `yaml:"retry_interval"`
+	MaxRetryInterval int `yaml:"max_retry_interval"`
+}
+
+func (c *notificationQueueConf) validate() error {
+	if c.PollInterval <= 0 {
+		return errors.New("invalid config: notifications.queue.poll_interval must be positive")
+	}
+	if c.MaxAttempts <= 0 {
+		return errors.New("invalid config: notifications.queue.max_attempts must be positive")
+	}
+	if c.RetryInterval < 0 || c.MaxRetryInterval < c.RetryInterval {
+		return errors.New(
+			"invalid config: notifications.queue.retry_interval must not be negative and not be larger than " +
+				"max_retry_interval",
+		)
+	}
+	return nil
 }
 
 func (c *notificationConf) validate() error {
-	c.AnyEnabled = c.Mail.Enabled || c.Websocket.Enabled || c.ICS.Enabled
+	c.AnyEnabled = c.Mail.Enabled || c.Websocket.Enabled || c.ICS.Enabled || c.Chat.Enabled
 	if !c.AnyEnabled {
 		return nil
 	}
+	if err := c.Chat.validate(c.NotifierServer == ""); err != nil {
+		return err
+	}
 	if conf.Server.DistributedServers {
 		if c.NotifierServer == "" {
 			return errors.New("distributed deployment, but no notifier_server_url set")
@@ -302,6 +602,76 @@ func (c *notificationConf) validate() error {
 				"a standalone notifier server is used; however mail_server configuration is given here",
 			)
 		}
+		if conf.Signing.OIDC.KeyFile == "" || conf.Signing.OIDC.Alg == "" {
+			return errors.New(
+				"a standalone notifier server is used, but no OIDC signing key is set under signing.oidc; " +
+					"the key is required to authenticate requests to the notifier server",
+			)
+		}
+	}
+	return c.Queue.validate()
+}
+
+// Possible automated responses to suspicious activity
+const (
+	SuspiciousActionNone           = "none"
+	SuspiciousActionSuspend        = "suspend"
+	SuspiciousActionRevokeSubtree  = "revoke_subtree"
+	SuspiciousActionReauthenticate = "reauthenticate"
+)
+
+type suspiciousActivityConf struct {
+	Enabled          bool                 `yaml:"enabled"`
+	UnusualIP        suspiciousActionConf `yaml:"unusual_ip"`
+	ImpossibleTravel impossibleTravelConf `yaml:"impossible_travel"`
+	ATBurst          atBurstConf          `yaml:"at_burst"`
+}
+
+// suspiciousActionConf holds the automated response to a suspicious activity trigger
+type suspiciousActionConf struct {
+	Action string `yaml:"action"`
+}
+
+type impossibleTravelConf struct {
+	suspiciousActionConf `yaml:",inline"`
+	MinTravelTime        int `yaml:"min_travel_time"`
+}
+
+type atBurstConf struct {
+	suspiciousActionConf `yaml:",inline"`
+	MaxRequests          int `yaml:"max_requests"`
+	Window               int `yaml:"window"`
+}
+
+func (c *suspiciousActionConf) validate(trigger string) error {
+	switch c.Action {
+	case "":
+		c.Action = SuspiciousActionNone
+	case SuspiciousActionNone, SuspiciousActionSuspend, SuspiciousActionRevokeSubtree, SuspiciousActionReauthenticate:
+	default:
+		return errors.Errorf("invalid action '%s' for suspicious activity trigger '%s'", c.Action, trigger)
+	}
+	return nil
+}
+
+func (c *suspiciousActivityConf) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if err := c.UnusualIP.validate("unusual_ip"); err != nil {
+		return err
+	}
+	if err := c.ImpossibleTravel.validate("impossible_travel"); err != nil {
+		return err
+	}
+	if err := c.ATBurst.validate("at_burst"); err != nil {
+		return err
+	}
+	if c.ImpossibleTravel.Action != SuspiciousActionNone && c.ImpossibleTravel.MinTravelTime <= 0 {
+		return errors.New("impossible_travel: min_travel_time must be positive")
+	}
+	if c.ATBurst.Action != SuspiciousActionNone && (c.ATBurst.MaxRequests <= 0 || c.ATBurst.Window <= 0) {
+		return errors.New("at_burst: max_requests and window must be positive")
 	}
 	return nil
 }
@@ -313,6 +683,46 @@ type MailNotificationConf struct {
 	OverwriteDir string         `yaml:"overwrite_dir"`
 }
 
+// ChatNotificationConf holds the configuration for chat notifications
+type ChatNotificationConf struct {
+	Enabled bool            `yaml:"enabled"`
+	Matrix  MatrixConf      `yaml:"matrix"`
+	Webhook ChatWebhookConf `yaml:"webhook"`
+}
+
+// MatrixConf holds the configuration for posting chat notifications to matrix rooms
+type MatrixConf struct {
+	Enabled     bool   `yaml:"enabled"`
+	Homeserver  string `yaml:"homeserver"`
+	AccessToken string `yaml:"access_token"`
+}
+
+// ChatWebhookConf holds the configuration for posting chat notifications to Slack-compatible incoming webhooks
+type ChatWebhookConf struct {
+	Enabled       bool     `yaml:"enabled"`
+	AllowedHosts  []string `yaml:"allowed_hosts"`
+	EncryptionKey string   `yaml:"encryption_key"`
+}
+
+// validate validates the ChatNotificationConf; the matrix credentials are only required if the notifications are
+// posted by this instance, i.e. if the integrated notifier is used. The webhook urls are secrets and stored encrypted,
+// so an encryption key is always required for webhooks.
+func (c *ChatNotificationConf) validate(integrated bool) error {
+	if !c.Enabled {
+		return nil
+	}
+	if !c.Matrix.Enabled && !c.Webhook.Enabled {
+		return errors.New("invalid config: chat notifications enabled, but neither matrix nor webhook is enabled")
+	}
+	if integrated && c.Matrix.Enabled && (c.Matrix.Homeserver == "" || c.Matrix.AccessToken == "") {
+		return errors.New("invalid config: chat.matrix requires homeserver and access_token")
+	}
+	if c.Webhook.Enabled && len(c.Webhook.EncryptionKey) < 32 {
+		return errors.New("invalid config: chat.webhook requires an encryption_key of at least 32 characters")
+	}
+	return nil
+}
+
 // MailServerConf holds the configuration for the email server
 type MailServerConf struct {
 	Host        string `yaml:"host"`
@@ -331,8 +741,14 @@ type tokeninfoConfig struct {
 }
 
 type webConfig struct {
-	Enabled      bool   `yaml:"enabled"`
-	OverwriteDir string `yaml:"overwrite_dir"`
+	Enabled      bool         `yaml:"enabled"`
+	OverwriteDir string       `yaml:"overwrite_dir"`
+	WebAuthn     webAuthnConf `yaml:"webauthn"`
+}
+
+type webAuthnConf struct {
+	Enabled        bool  `yaml:"enabled"`
+	StepUpLifetime int64 `yaml:"step_up_lifetime"`
 }
 
 type shortTokenConfig struct {
@@ -418,11 +834,52 @@ type serverConf struct {
 	Limiter            limiterConf      `yaml:"request_limits"`
 	DistributedServers bool             `yaml:"distributed_servers"`
 	Healthcheck        healtcheckConfig `yaml:"healthcheck"`
+	Jobs               jobsConf         `yaml:"jobs"`
+}
+
+type jobsConf struct {
+	PollInterval      int64 `yaml:"poll_interval"`
+	BatchSize         int   `yaml:"batch_size"`
+	VisibilityTimeout int64 `yaml:"visibility_timeout"`
+	LeaderLease       int64 `yaml:"leader_lease"`
+	MaxAttempts       int   `yaml:"max_attempts"`
+}
+
+func (c *jobsConf) validate() error {
+	if c.PollInterval <= 0 {
+		return errors.New("invalid config: server.jobs.poll_interval must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return errors.New("invalid config: server.jobs.batch_size must be positive")
+	}
+	if c.VisibilityTimeout <= 0 {
+		return errors.New("invalid config: server.jobs.visibility_timeout must be positive")
+	}
+	if c.LeaderLease < 3 {
+		return errors.New("invalid config: server.jobs.leader_lease must be at least 3 seconds")
+	}
+	if c.MaxAttempts <= 0 {
+		return errors.New("invalid config: server.jobs.max_attempts must be positive")
+	}
+	return nil
 }
 
 type healtcheckConfig struct {
-	Enabled bool `yaml:"enabled"`
-	Port    int  `yaml:"port"`
+	Enabled bool              `yaml:"enabled"`
+	Port    int               `yaml:"port"`
+	Admins  map[string]string `yaml:"admins"`
+}
+
+func (c healtcheckConfig) validate() error {
+	for u, pw := range c.Admins {
+		if u == "" {
+			return errors.New("invalid config: empty admin name in healthcheck.admins")
+		}
+		if pw == "" {
+			return errors.Errorf("invalid config: password not set for healthcheck admin '%s'", u)
+		}
+	}
+	return nil
 }
 
 type limiterConf struct {
@@ -458,9 +915,116 @@ type ProviderConf struct {
 	Scopes               []string                 `yaml:"scopes"`
 	MytokensMaxLifetime  int64                    `yaml:"mytokens_max_lifetime"`
 	EnforcedRestrictions EnforcedRestrictionsConf `yaml:"enforced_restrictions"`
-	Endpoints            *oauth2x.Endpoints       `yaml:"-"`
 	Name                 string                   `yaml:"name"`
 	Audience             *model.AudienceConf      `yaml:"audience"`
+	Quotas               QuotasConf               `yaml:"quotas"`
+	Clients              []*ProviderClientConf    `yaml:"clients"`
+	// metadata is periodically refreshed while requests read it, therefore it is only accessed atomically
+	metadata atomic.Pointer[ProviderMetadata]
+}
+
+// ProviderMetadata holds the metadata of a provider that is obtained through discovery
+type ProviderMetadata struct {
+	Endpoints *oauth2x.Endpoints
+	JWKS      *jwk.JWKS
+}
+
+// Endpoints returns the endpoints of the provider
+func (p *ProviderConf) Endpoints() *oauth2x.Endpoints {
+	if m := p.metadata.Load(); m != nil {
+		return m.Endpoints
+	}
+	return nil
+}
+
+// JWKS returns the jwks of the provider; it is nil until it was fetched
+func (p *ProviderConf) JWKS() *jwk.JWKS {
+	if m := p.metadata.Load(); m != nil {
+		return m.JWKS
+	}
+	return nil
+}
+
+// SetMetadata replaces the metadata of the provider
+func (p *ProviderConf) SetMetadata(m *ProviderMetadata) {
+	p.metadata.Store(m)
+}
+
+// ProviderClientConf holds information about an additional client registered at a provider; the client is used
+// instead of the default client if it matches the requested scopes, audiences, or profiles
+type ProviderClientConf struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	Audiences    []string `yaml:"audiences"`
+	Profiles     []string `yaml:"profiles"`
+}
+
+// QuotaConf is a type for holding limits on the number of mytokens; a value of 0 means unlimited
+type QuotaConf struct {
+	MaxActiveMytokens     int `yaml:"max_active_mytokens"`
+	MaxTreeDepth          int `yaml:"max_tree_depth"`
+	MaxSubtokensPerParent int `yaml:"max_subtokens_per_parent"`
+}
+
+// QuotasConf is a type for holding the quota configuration of a provider
+type QuotasConf struct {
+	QuotaConf         `yaml:",inline"`
+	EntitlementsClaim string               `yaml:"entitlements_claim"`
+	Entitlements      map[string]QuotaConf `yaml:"entitlements"`
+}
+
+func (c *QuotasConf) validate() error {
+	if c.MaxActiveMytokens < 0 || c.MaxTreeDepth < 0 || c.MaxSubtokensPerParent < 0 {
+		return errors.New("invalid config: quota values must not be negative")
+	}
+	for e, q := range c.Entitlements {
+		if q.MaxActiveMytokens < 0 || q.MaxTreeDepth < 0 || q.MaxSubtokensPerParent < 0 {
+			return errors.Errorf("invalid config: quota values must not be negative (entitlement '%s')", e)
+		}
+	}
+	if len(c.Entitlements) > 0 && c.EntitlementsClaim == "" {
+		return errors.New("invalid config: quotas.entitlements_claim must be set if quotas.entitlements are given")
+	}
+	return nil
+}
+
+// ForEntitlements returns the QuotaConf that applies to a user with the passed entitlements; if multiple
+// entitlements have quotas configured, the most permissive value is used for each limit; if no entitlement matches,
+// the default quota is returned
+func (c QuotasConf) ForEntitlements(entitlements []string) QuotaConf {
+	var q QuotaConf
+	found := false
+	for _, e := range entitlements {
+		eq, ok := c.Entitlements[e]
+		if !ok {
+			continue
+		}
+		if !found {
+			q = eq
+			found = true
+			continue
+		}
+		q.MaxActiveMytokens = morePermissiveLimit(q.MaxActiveMytokens, eq.MaxActiveMytokens)
+		q.MaxTreeDepth = morePermissiveLimit(q.MaxTreeDepth, eq.MaxTreeDepth)
+		q.MaxSubtokensPerParent = morePermissiveLimit(q.MaxSubtokensPerParent, eq.MaxSubtokensPerParent)
+	}
+	if !found {
+		return c.QuotaConf
+	}
+	return q
+}
+
+// Unlimited checks if this QuotaConf does not set any limit
+func (q QuotaConf) Unlimited() bool {
+	return q.MaxActiveMytokens == 0 && q.MaxTreeDepth == 0 && q.MaxSubtokensPerParent == 0
+}
+
+func morePermissiveLimit(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
 }
 
 // EnforcedRestrictionsConf is a type for holding configuration for enforced restrictions
@@ -548,12 +1112,116 @@ func (so *ServiceOperatorConf) validate() error {
 }
 
 type federationConf struct {
-	Enabled                     bool                   `yaml:"enabled"`
-	TrustAnchors                oidfed.TrustAnchors    `yaml:"trust_anchors"`
-	AuthorityHints              []string               `yaml:"authority_hints"`
-	EntityConfigurationLifetime int64                  `yaml:"entity_configuration_lifetime"`
-	Signing                     signingConf            `yaml:"signing"`
-	Entity                      *oidfed.FederationLeaf `yaml:"-"`
+	Enabled                     bool                    `yaml:"enabled"`
+	TrustAnchors                oidfed.TrustAnchors     `yaml:"trust_anchors"`
+	AuthorityHints              []string                `yaml:"authority_hints"`
+	EntityConfigurationLifetime int64                   `yaml:"entity_configuration_lifetime"`
+	Signing                     signingConf             `yaml:"signing"`
+	OPPolicy                    FederationOPPolicyConf  `yaml:"op_policy"`
+	Authority                   FederationAuthorityConf `yaml:"authority"`
+	Quotas                      QuotasConf              `yaml:"quotas"`
+	Entity                      *oidfed.FederationLeaf  `yaml:"-"`
+}
+
+// FederationOPPolicyConf is a type holding the configuration which OPs from the federation are accepted
+type FederationOPPolicyConf struct {
+	RequiredTrustMarks []string            `yaml:"required_trust_marks"`
+	AllowedIssuers     []string            `yaml:"allowed_issuers"`
+	DeniedIssuers      []string            `yaml:"denied_issuers"`
+	RequiredMetadata   map[string][]string `yaml:"required_metadata"`
+}
+
+// FederationAuthorityConf is a type holding the configuration for acting as a federation intermediate or trust anchor
+type FederationAuthorityConf struct {
+	Enabled                      bool                         `yaml:"enabled"`
+	SubordinateStatementLifetime int64                        `yaml:"subordinate_statement_lifetime"`
+	MetadataPolicyFile           string                       `yaml:"metadata_policy_file"`
+	MetadataPolicy               *oidfed.MetadataPolicies     `yaml:"-"`
+	Subordinates                 []*FederationSubordinateConf `yaml:"subordinates"`
+}
+
+// FederationSubordinateConf is a type holding the configuration of an entity for which subordinate statements are
+// issued
+type FederationSubordinateConf struct {
+	EntityID           string                   `yaml:"entity_id"`
+	EntityTypes        []string                 `yaml:"entity_types"`
+	JWKSFile           string                   `yaml:"jwks_file"`
+	MetadataPolicyFile string                   `yaml:"metadata_policy_file"`
+	JWKS               *jwk.JWKS                `yaml:"-"`
+	MetadataPolicy     *oidfed.MetadataPolicies `yaml:"-"`
+}
+
+// HasEntityType checks if this subordinate has the passed entity type
+func (s FederationSubordinateConf) HasEntityType(entityType string) bool {
+	return utils2.StringInSlice(entityType, s.EntityTypes)
+}
+
+func readJSONFile(file string, v any) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "error reading file '%s'", file)
+	}
+	return errors.Wrapf(json.Unmarshal(content, v), "error parsing file '%s'", file)
+}
+
+func readMetadataPolicyFile(file string) (*oidfed.MetadataPolicies, error) {
+	if file == "" {
+		return nil, nil
+	}
+	var policy oidfed.MetadataPolicies
+	if err := readJSONFile(file, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (a *FederationAuthorityConf) validate() (err error) {
+	if !a.Enabled {
+		return nil
+	}
+	if a.SubordinateStatementLifetime <= 0 {
+		a.SubordinateStatementLifetime = 24 * 60 * 60
+	}
+	if a.MetadataPolicy, err = readMetadataPolicyFile(a.MetadataPolicyFile); err != nil {
+		return err
+	}
+	for _, sub := range a.Subordinates {
+		if sub.EntityID == "" {
+			return errors.New("invalid config: federation.authority.subordinates: entity_id not set")
+		}
+		if len(sub.EntityTypes) == 0 {
+			sub.EntityTypes = []string{constants.EntityTypeOpenIDProvider}
+		}
+		// The subordinate statements vouch for the subordinate's keys, so they must be pinned and not be taken from
+		// the subordinate's entity configuration
+		if sub.JWKSFile == "" {
+			return errors.Errorf(
+				"invalid config: federation.authority.subordinates: jwks_file not set for '%s'", sub.EntityID,
+			)
+		}
+		var jwks jwk.JWKS
+		if err = readJSONFile(sub.JWKSFile, &jwks); err != nil {
+			return err
+		}
+		sub.JWKS = &jwks
+		if sub.MetadataPolicy, err = readMetadataPolicyFile(sub.MetadataPolicyFile); err != nil {
+			return err
+		}
+		if sub.MetadataPolicy == nil {
+			sub.MetadataPolicy = a.MetadataPolicy
+		}
+	}
+	return nil
+}
+
+// GetSubordinate returns the FederationSubordinateConf for the passed entity id or nil if it is not a subordinate
+func (a FederationAuthorityConf) GetSubordinate(entityID string) *FederationSubordinateConf {
+	for _, sub := range a.Subordinates {
+		if sub.EntityID == entityID {
+			return sub
+		}
+	}
+	return nil
 }
 
 func (f *federationConf) validate() (err error) {
@@ -566,10 +1234,18 @@ func (f *federationConf) validate() (err error) {
 	if Get().Signing.OIDC.Alg == "" {
 		return errors.New("if federation is enabled an OIDC signing alg must be set under signing.oidc.alg")
 	}
-	if len(f.TrustAnchors) == 0 {
+	if err = f.Authority.validate(); err != nil {
+		return err
+	}
+	if err = f.Quotas.validate(); err != nil {
+		return err
+	}
+	// If mytoken acts as an authority itself, it is also a trust anchor, so trust anchors and authority hints are
+	// optional
+	if len(f.TrustAnchors) == 0 && !f.Authority.Enabled {
 		return errors.New("federation enabled, but no trust anchors specified")
 	}
-	if len(f.AuthorityHints) == 0 {
+	if len(f.AuthorityHints) == 0 && !f.Authority.Enabled {
 		return errors.New("federation enabled, but no authority hints specified")
 	}
 	if f.Signing.KeyFile == "" {
@@ -656,6 +1332,15 @@ func validateConfigSections() error {
 	if err := conf.ServiceOperator.validate(); err != nil {
 		return err
 	}
+	if err := conf.I18n.validate(); err != nil {
+		return err
+	}
+	if err := conf.Server.Jobs.validate(); err != nil {
+		return err
+	}
+	if err := conf.Server.Healthcheck.validate(); err != nil {
+		return err
+	}
 
 	return conf.Features.validate()
 }
@@ -680,14 +1365,18 @@ func validateProvider(p *ProviderConf, i int) error {
 	if err := p.EnforcedRestrictions.validate(); err != nil {
 		return err
 	}
+	if err := p.Quotas.validate(); err != nil {
+		return err
+	}
 	oc, err := oauth2x.NewConfig(context.Get(), p.Issuer)
 	if err != nil {
 		return errors.Errorf("error '%s' for provider.issuer '%s' (Index %d)", err, p.Issuer, i)
 	}
-	p.Endpoints, err = oc.Endpoints()
+	endpoints, err := oc.Endpoints()
 	if err != nil {
 		return errors.Errorf("error '%s' for provider.issuer '%s' (Index %d)", err, p.Issuer, i)
 	}
+	p.SetMetadata(&ProviderMetadata{Endpoints: endpoints})
 	if p.ClientID == "" {
 		return errors.Errorf("invalid config: provider.clientid not set (Index %d)", i)
 	}
@@ -697,6 +1386,26 @@ func validateProvider(p *ProviderConf, i int) error {
 	if len(p.Scopes) == 0 {
 		return errors.Errorf("invalid config: provider.scopes not set (Index %d)", i)
 	}
+	clientIDs := []string{p.ClientID}
+	for j, c := range p.Clients {
+		if c.ClientID == "" {
+			return errors.Errorf("invalid config: provider.clients.client_id not set (Index %d, Client %d)", i, j)
+		}
+		if c.ClientSecret == "" {
+			return errors.Errorf(
+				"invalid config: provider.clients.client_secret not set (Index %d, Client %d)", i, j,
+			)
+		}
+		if utils2.StringInSlice(c.ClientID, clientIDs) {
+			return errors.Errorf(
+				"invalid config: provider.clients.client_id '%s' used multiple times (Index %d)", c.ClientID, i,
+			)
+		}
+		clientIDs = append(clientIDs, c.ClientID)
+		if len(c.Scopes) == 0 {
+			c.Scopes = p.Scopes
+		}
+	}
 	if p.Audience == nil {
 		p.Audience = &model.AudienceConf{RFC8707: true}
 	}
@@ -715,11 +1424,15 @@ func addGuestModeProvider() {
 		Issuer: iss,
 		Name:   "Guest Mode",
 		Scopes: []string{"openid"},
-		Endpoints: &oauth2x.Endpoints{
-			Authorization: utils2.CombineURLPath(iss, "auth"),
-			Token:         utils2.CombineURLPath(iss, "token"),
-		},
 	}
+	p.SetMetadata(
+		&ProviderMetadata{
+			Endpoints: &oauth2x.Endpoints{
+				Authorization: utils2.CombineURLPath(iss, "auth"),
+				Token:         utils2.CombineURLPath(iss, "token"),
+			},
+		},
+	)
 	conf.Providers = append(conf.Providers, p)
 }
 
@@ -737,6 +1450,9 @@ func validateWebInterface() error {
 	if !conf.Features.TokenInfo.Introspect.Enabled && conf.Features.WebInterface.Enabled {
 		return errors.New("web interface requires tokeninfo.introspect to be enabled")
 	}
+	if conf.Features.WebInterface.WebAuthn.Enabled && !conf.Features.WebInterface.Enabled {
+		return errors.New("webauthn requires the web interface to be enabled")
+	}
 	conf.Features.TokenInfo.Enabled = utils.OR(
 		conf.Features.TokenInfo.Introspect.Enabled,
 		conf.Features.TokenInfo.History.Enabled,
@@ -28,22 +28,25 @@ func ConnectConfig(conf config.DBConf) {
 		db.Close()
 	}
 	db = cluster.NewFromConfig(conf)
+	// The db cleanup is run by the job runner, so the db event is not needed anymore
 	if err := db.Transact(
 		log.StandardLogger(), func(tx *sqlx.Tx) error {
-			var err error
-			if conf.EnableScheduledCleanup {
-				_, err = tx.Exec(`CALL cleanup_schedule_enable()`)
-				log.Debug("Enabled scheduled db cleanup")
-			} else {
-				_, err = tx.Exec(`CALL cleanup_schedule_disable()`)
-				log.Debug("Disabled scheduled db cleanup")
-			}
-			return err
+			_, err := tx.Exec(`CALL cleanup_schedule_disable()`)
+			return errors.WithStack(err)
 		},
 	); err != nil {
 		log.WithError(err).Error()
 	}
+}
 
+// Cleanup deletes expired entries from the database
+func Cleanup(rlog log.Ext1FieldLogger) error {
+	return Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Cleanup()`)
+			return errors.WithStack(err)
+		},
+	)
 }
 
 // NullString extends the sql.NullString
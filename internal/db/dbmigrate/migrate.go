@@ -32,13 +32,17 @@ var migrationScripts embed.FS
 
 func init() {
 	Versions = []string{}
+	seen := make(map[string]bool)
 	if err := fs.WalkDir(
 		fs.FS(migrationScripts), ".", func(path string, d fs.DirEntry, err error) error {
 			if d.IsDir() {
 				return nil
 			}
-			name := d.Name()
-			Versions = append(Versions, utils.RSplitN(name, ".", 3)[0])
+			v := utils.RSplitN(d.Name(), ".", 3)[0]
+			if !seen[v] { // a version can have a pre and a post file
+				seen[v] = true
+				Versions = append(Versions, v)
+			}
 			return nil
 		},
 	); err != nil {
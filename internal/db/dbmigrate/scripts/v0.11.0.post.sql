@@ -0,0 +1,23 @@
+### Procedures
+
+# The following procedures were replaced by versioned procedures in v0.11.0; they were only kept so that nodes running
+# an older version keep working during the update.
+DROP PROCEDURE IF EXISTS MTokens_GetAllForSameUser;
+DROP PROCEDURE IF EXISTS MTokens_GetForUser;
+DROP PROCEDURE IF EXISTS MTokens_GetSubtokens;
+DROP PROCEDURE IF EXISTS TransferCodeAttributes_UpdateSSHKey;
+DROP PROCEDURE IF EXISTS TransferCodes_GetStatus;
+DROP PROCEDURE IF EXISTS SSHInfo_Get;
+DROP PROCEDURE IF EXISTS SSHInfo_GetAll;
+DROP PROCEDURE IF EXISTS SSHInfo_Insert;
+DROP PROCEDURE IF EXISTS AuthInfo_Get;
+DROP PROCEDURE IF EXISTS AT_Insert;
+DROP PROCEDURE IF EXISTS Users_GetMail;
+DROP PROCEDURE IF EXISTS Notifications_GetForMT;
+DROP PROCEDURE IF EXISTS Notifications_GetForMTAndClass;
+DROP PROCEDURE IF EXISTS Notifications_GetForManagementCode;
+DROP PROCEDURE IF EXISTS PopOneDueScheduledNotification;
+DROP PROCEDURE IF EXISTS Calendar_GetByID;
+DROP PROCEDURE IF EXISTS Event_Insert;
+DROP PROCEDURE IF EXISTS EventHistory_Get;
+DROP PROCEDURE IF EXISTS EventHistory_GetChildren;
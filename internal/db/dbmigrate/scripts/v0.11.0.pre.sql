@@ -0,0 +1,1354 @@
+### Tables
+
+ALTER TABLE Users
+    ADD IF NOT EXISTS entitlements JSON NULL;
+
+ALTER TABLE MTokens
+    ADD IF NOT EXISTS suspended BOOL DEFAULT 0 NOT NULL;
+
+ALTER TABLE SSHPublicKeys
+    ADD IF NOT EXISTS ca BOOL DEFAULT 0 NOT NULL;
+ALTER TABLE SSHPublicKeys
+    ADD IF NOT EXISTS principals TEXT NULL;
+ALTER TABLE SSHPublicKeys
+    ADD IF NOT EXISTS key_restrictions JSON NULL;
+
+ALTER TABLE TransferCodesAttributes
+    ADD IF NOT EXISTS ssh_key_ca BOOL DEFAULT 0 NOT NULL;
+ALTER TABLE TransferCodesAttributes
+    ADD IF NOT EXISTS ssh_principals TEXT NULL;
+ALTER TABLE TransferCodesAttributes
+    ADD IF NOT EXISTS ssh_key_restrictions JSON NULL;
+
+CREATE OR REPLACE VIEW TransferCodes AS
+SELECT `pt`.`id`                  AS `id`,
+       `cs`.`crypt`               AS `jwt`,
+       `tca`.`created`            AS `created`,
+       `tca`.`expires_in`         AS `expires_in`,
+       `tca`.`expires_at`         AS `expires_at`,
+       `tca`.`revoke_MT`          AS `revoke_MT`,
+       `tca`.`response_type`      AS `response_type`,
+       `tca`.`max_token_len`      AS `max_token_len`,
+       `tca`.`consent_declined`   AS `consent_declined`,
+       `tca`.ssh_key_fp           AS `ssh_key_fp`,
+       `tca`.ssh_key_ca           AS `ssh_key_ca`,
+       `tca`.ssh_principals       AS `ssh_principals`,
+       `tca`.ssh_key_restrictions AS `ssh_key_restrictions`
+    FROM ((`ProxyTokens` `pt` JOIN `CryptStore` `cs` ON (`pt`.`jwt_crypt` = `cs`.`id`))
+             JOIN `TransferCodesAttributes` `tca` ON (`pt`.`id` = `tca`.`id`));
+
+CREATE TABLE IF NOT EXISTS SSHKeyEvents
+(
+    id           BIGINT UNSIGNED AUTO_INCREMENT
+        PRIMARY KEY,
+    key_id       BIGINT UNSIGNED                      NOT NULL,
+    request_type VARCHAR(64)                          NOT NULL,
+    ip           VARCHAR(128)                         NOT NULL,
+    user_agent   TEXT                                 NULL,
+    time         DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL,
+    CONSTRAINT SSHKeyEvents_FK
+        FOREIGN KEY (key_id) REFERENCES SSHPublicKeys (key_id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS OIDCFedClients
+(
+    issuer        VARCHAR(256)                         NOT NULL
+        PRIMARY KEY,
+    client_id     VARCHAR(512)                         NOT NULL,
+    expires_at    DATETIME                             NULL,
+    registered_at DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS RTClients
+(
+    rt_id     BIGINT UNSIGNED NOT NULL
+        PRIMARY KEY,
+    client_id VARCHAR(512)    NOT NULL,
+    CONSTRAINT RTClients_FK
+        FOREIGN KEY (rt_id) REFERENCES CryptStore (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+ALTER TABLE AuthInfo
+    ADD IF NOT EXISTS client_id VARCHAR(512) NULL;
+
+ALTER TABLE AccessTokens
+    ADD IF NOT EXISTS expires_at DATETIME NULL;
+ALTER TABLE AccessTokens
+    ADD IF NOT EXISTS cache_key VARCHAR(128) NULL;
+CREATE INDEX IF NOT EXISTS AccessTokens_cache_key ON AccessTokens (MT_id, cache_key);
+
+CREATE TABLE IF NOT EXISTS NotificationQueue
+(
+    id              BIGINT UNSIGNED AUTO_INCREMENT
+        PRIMARY KEY,
+    MT_id           VARCHAR(128)                                              NULL,
+    type            VARCHAR(32)                             DEFAULT 'mail'    NOT NULL,
+    subject         TEXT                                                      NOT NULL,
+    request         LONGTEXT                                                  NOT NULL,
+    status          ENUM ('pending', 'delivered', 'failed') DEFAULT 'pending' NOT NULL,
+    attempts        INT UNSIGNED                            DEFAULT 0         NOT NULL,
+    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP()                      NOT NULL,
+    last_attempt_at DATETIME                                                  NULL,
+    last_error      TEXT                                                      NULL,
+    claim           VARCHAR(128)                                              NULL,
+    claimed_until   DATETIME                                                  NULL,
+    created         DATETIME DEFAULT CURRENT_TIMESTAMP()                      NOT NULL
+);
+CREATE INDEX IF NOT EXISTS NotificationQueue_status ON NotificationQueue (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS NotificationQueue_MT_id ON NotificationQueue (MT_id);
+
+ALTER TABLE Users
+    ADD IF NOT EXISTS language VARCHAR(16) NULL;
+
+ALTER TABLE Notifications
+    ADD IF NOT EXISTS digest ENUM ('immediate', 'hourly', 'daily') DEFAULT 'immediate' NOT NULL;
+ALTER TABLE Notifications
+    ADD IF NOT EXISTS chat_target LONGTEXT COLLATE utf8mb4_bin NULL CHECK (JSON_VALID(`chat_target`));
+
+CREATE TABLE IF NOT EXISTS NotificationDigestEntries
+(
+    id              BIGINT UNSIGNED AUTO_INCREMENT
+        PRIMARY KEY,
+    notification_id BIGINT UNSIGNED                      NOT NULL,
+    MT_id           VARCHAR(128)                         NOT NULL,
+    class           VARCHAR(128)                         NOT NULL,
+    data            LONGTEXT COLLATE utf8mb4_bin         NULL
+        CHECK (JSON_VALID(`data`)),
+    due_time        DATETIME                             NOT NULL,
+    created         DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL,
+    CONSTRAINT NotificationDigestEntries_FK
+        FOREIGN KEY (notification_id) REFERENCES Notifications (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS NotificationDigestEntries_due_time ON NotificationDigestEntries (due_time);
+
+CREATE TABLE IF NOT EXISTS Jobs
+(
+    id            BIGINT UNSIGNED AUTO_INCREMENT
+        PRIMARY KEY,
+    type          VARCHAR(64)                                          NOT NULL,
+    payload       LONGTEXT COLLATE utf8mb4_bin                         NULL
+        CHECK (JSON_VALID(`payload`)),
+    status        ENUM ('pending', 'done', 'failed') DEFAULT 'pending' NOT NULL,
+    run_at        DATETIME DEFAULT CURRENT_TIMESTAMP()                 NOT NULL,
+    attempts      INT UNSIGNED                       DEFAULT 0         NOT NULL,
+    claim         VARCHAR(128)                                         NULL,
+    claimed_until DATETIME                                             NULL,
+    last_error    TEXT                                                 NULL,
+    created       DATETIME DEFAULT CURRENT_TIMESTAMP()                 NOT NULL,
+    finished      DATETIME                                             NULL
+);
+CREATE INDEX IF NOT EXISTS Jobs_status ON Jobs (status, run_at);
+CREATE INDEX IF NOT EXISTS Jobs_type ON Jobs (type, status);
+
+CREATE TABLE IF NOT EXISTS RecurringJobs
+(
+    type             VARCHAR(64)  NOT NULL
+        PRIMARY KEY,
+    interval_seconds INT UNSIGNED NOT NULL,
+    next_run         DATETIME     NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS JobsLeader
+(
+    name        VARCHAR(64)  NOT NULL
+        PRIMARY KEY,
+    holder      VARCHAR(128) NOT NULL,
+    lease_until DATETIME     NOT NULL
+);
+
+ALTER TABLE Calendars
+    ADD IF NOT EXISTS sync_token BIGINT UNSIGNED DEFAULT 0 NOT NULL;
+
+CREATE TABLE IF NOT EXISTS CalendarResources
+(
+    calendar_id VARCHAR(128)         NOT NULL,
+    resource    VARCHAR(128)         NOT NULL,
+    etag        VARCHAR(128)         NOT NULL,
+    sync_token  BIGINT UNSIGNED      NOT NULL,
+    deleted     BOOLEAN DEFAULT 0    NOT NULL,
+    PRIMARY KEY (calendar_id, resource),
+    CONSTRAINT CalendarResources_FK
+        FOREIGN KEY (calendar_id) REFERENCES Calendars (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+ALTER TABLE MTokens
+    ADD IF NOT EXISTS subtoken_limits JSON NULL;
+
+CREATE TABLE IF NOT EXISTS MytokenRenewals
+(
+    MT_id          VARCHAR(128)                               NOT NULL
+        PRIMARY KEY,
+    code_hash      VARCHAR(128)                               NOT NULL,
+    encryption_key TEXT                                       NOT NULL,
+    auth_time      DATETIME                                   NOT NULL,
+    channel        ENUM ('polling', 'webhook')                NOT NULL,
+    webhook_url    TEXT                                       NULL,
+    approved       DATETIME                                   NULL,
+    created        DATETIME DEFAULT CURRENT_TIMESTAMP()       NOT NULL,
+    CONSTRAINT MytokenRenewals_UN
+        UNIQUE (code_hash),
+    CONSTRAINT MytokenRenewals_FK
+        FOREIGN KEY (MT_id) REFERENCES MTokens (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+ALTER TABLE AuthInfo
+    ADD IF NOT EXISTS step_up_uid BIGINT UNSIGNED NULL;
+
+ALTER TABLE MT_Events
+    ADD IF NOT EXISTS auth_context VARCHAR(64) NULL;
+
+CREATE OR REPLACE VIEW EventHistory AS
+SELECT `me`.`time`         AS `time`,
+       `me`.`MT_id`        AS `MT_id`,
+       `e`.`event`         AS `event`,
+       `me`.`comment`      AS `comment`,
+       `me`.`ip`           AS `ip`,
+       `me`.`user_agent`   AS `user_agent`,
+       `me`.`auth_context` AS `auth_context`
+    FROM (`Events` `e` JOIN `MT_Events` `me` ON (`e`.`id` = `me`.`event_id`))
+    ORDER BY `me`.`time` DESC;
+
+CREATE TABLE IF NOT EXISTS WebAuthnCredentials
+(
+    id            BIGINT UNSIGNED AUTO_INCREMENT
+        PRIMARY KEY,
+    user_id       BIGINT UNSIGNED                      NOT NULL,
+    credential_id VARCHAR(512)                         NOT NULL,
+    public_key    TEXT                                 NOT NULL,
+    sign_count    INT UNSIGNED DEFAULT 0               NOT NULL,
+    name          VARCHAR(128)                         NULL,
+    created       DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL,
+    last_used     DATETIME                             NULL,
+    CONSTRAINT WebAuthnCredentials_UN
+        UNIQUE (credential_id),
+    CONSTRAINT WebAuthnCredentials_FK
+        FOREIGN KEY (user_id) REFERENCES Users (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS WebAuthnChallenges
+(
+    challenge  VARCHAR(128)                 NOT NULL
+        PRIMARY KEY,
+    purpose    ENUM ('register', 'step_up') NOT NULL,
+    MT_id      VARCHAR(128)                 NULL,
+    state_h    VARCHAR(128)                 NULL,
+    expires_at DATETIME                     NOT NULL,
+    CONSTRAINT WebAuthnChallenges_FK
+        FOREIGN KEY (MT_id) REFERENCES MTokens (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS WebAuthnStepUps
+(
+    MT_id      VARCHAR(128) NOT NULL
+        PRIMARY KEY,
+    expires_at DATETIME     NOT NULL,
+    CONSTRAINT WebAuthnStepUps_FK
+        FOREIGN KEY (MT_id) REFERENCES MTokens (id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS RegisteredClients
+(
+    client_id  VARCHAR(128)                         NOT NULL
+        PRIMARY KEY,
+    name       VARCHAR(128)                         NOT NULL,
+    logo_uri   TEXT                                 NULL,
+    homepage   TEXT                                 NULL,
+    public_key TEXT                                 NOT NULL,
+    created    DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL,
+    updated    DATETIME DEFAULT CURRENT_TIMESTAMP() NOT NULL
+);
+
+ALTER TABLE AuthInfo
+    ADD IF NOT EXISTS registered_client VARCHAR(128) NULL;
+ALTER TABLE AuthInfo
+    ADD CONSTRAINT AuthInfo_RegisteredClients_FK
+        FOREIGN KEY IF NOT EXISTS (registered_client) REFERENCES RegisteredClients (client_id)
+            ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS ClientAttestationIDs
+(
+    client_id  VARCHAR(128) NOT NULL,
+    jti_h      VARCHAR(128) NOT NULL,
+    expires_at DATETIME     NOT NULL,
+    PRIMARY KEY (client_id, jti_h),
+    CONSTRAINT ClientAttestationIDs_FK
+        FOREIGN KEY (client_id) REFERENCES RegisteredClients (client_id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+### Procedures
+
+DELIMITER ;;
+
+CREATE OR REPLACE PROCEDURE Users_SetEntitlements(IN SUB TEXT, IN ISS TEXT, IN ENTITLEMENTS_ TEXT)
+BEGIN
+    CALL Users_GetID(SUB, ISS, @UID);
+    UPDATE Users u SET u.entitlements=ENTITLEMENTS_ WHERE u.id = @UID;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetQuotaUsage(IN SUB TEXT, IN ISS TEXT, IN PARENT VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    CALL Users_GetID(SUB, ISS, @UID);
+    SELECT u.id INTO @UID FROM Users u WHERE u.id = @UID FOR UPDATE;
+    WITH RECURSIVE parents AS (
+        SELECT id, parent_id
+            FROM MTokens
+            WHERE id = PARENT
+        UNION ALL
+        SELECT mt.id, mt.parent_id
+            FROM MTokens mt
+                     INNER JOIN parents p
+            WHERE mt.id = p.parent_id
+    )
+    SELECT u.entitlements,
+           (SELECT COUNT(1)
+                FROM MTokens m
+                WHERE m.user_id = u.id
+                  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP())) AS active_mytokens,
+           (SELECT COUNT(1) FROM parents) AS depth,
+           (SELECT COUNT(1)
+                FROM MTokens m
+                WHERE m.parent_id = PARENT
+                  AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP())) AS siblings
+        FROM Users u
+        WHERE u.id = @UID;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_CountChildren(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT m.id INTO @MTID FROM MTokens m WHERE m.id = MTID FOR UPDATE;
+    SELECT COUNT(1)
+        FROM MTokens m
+        WHERE m.parent_id = MTID
+          AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP());
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetAllForSameUserWithCapabilities(IN MTID VARCHAR(128))
+BEGIN
+    SELECT m.id, m.parent_id, m.id AS mom_id, m.name, m.created, m.expires_at, m.ip_created AS ip, m.suspended,
+           m.capabilities
+        FROM MTokens m
+        WHERE m.user_id = (SELECT user_id FROM MTokens WHERE id = MTID)
+        ORDER BY m.created;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetDetailsForSameUser(IN MTID VARCHAR(128))
+BEGIN
+    SELECT m.id, m.capabilities, m.rotation, m.restrictions,
+           (SELECT MAX(e.time) FROM MT_Events e WHERE e.MT_id = m.id) AS last_used
+        FROM MTokens m
+        WHERE m.user_id = (SELECT user_id FROM MTokens WHERE id = MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE TokenUsages_GetForSameUser(IN MTID VARCHAR(128))
+BEGIN
+    SELECT u.MT_id, u.restriction_hash, u.usages_AT, u.usages_other
+        FROM TokenUsages u
+                 JOIN MTokens m ON u.MT_id = m.id
+        WHERE m.user_id = (SELECT user_id FROM MTokens WHERE id = MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_SetSubtokenLimits(IN MTID VARCHAR(128), IN LIMITS_ TEXT)
+BEGIN
+    UPDATE MTokens m SET m.subtoken_limits=LIMITS_ WHERE m.id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_SetSuspended(IN MTID VARCHAR(128), IN SUSPENDED_ BOOL)
+BEGIN
+    UPDATE MTokens m SET m.suspended=SUSPENDED_ WHERE m.id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_SetSuspendedRec(IN MTID VARCHAR(128), IN SUSPENDED_ BOOL)
+BEGIN
+    CREATE TEMPORARY TABLE IF NOT EXISTS effected_MTIDs (id VARCHAR(128));
+    TRUNCATE effected_MTIDs;
+    INSERT INTO effected_MTIDs
+    WITH RECURSIVE childs AS (SELECT id, parent_id
+                                  FROM MTokens
+                                  WHERE id = MTID
+                              UNION ALL
+                              SELECT mt.id, mt.parent_id
+                                  FROM MTokens mt
+                                           INNER JOIN childs c
+                                  WHERE mt.parent_id = c.id)
+    SELECT id
+        FROM childs;
+    UPDATE MTokens m SET m.suspended=SUSPENDED_ WHERE m.id IN (SELECT id FROM effected_MTIDs);
+    DROP TABLE effected_MTIDs;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_IsSuspended(IN MTID VARCHAR(128))
+BEGIN
+    SELECT m.suspended FROM MTokens m WHERE m.id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE Events_GetLast(IN MTID VARCHAR(128))
+BEGIN
+    SELECT me.ip, me.time FROM MT_Events me WHERE me.MT_id = MTID ORDER BY me.time DESC, me.id DESC LIMIT 1;
+END;;
+
+CREATE OR REPLACE PROCEDURE Events_CountSince(IN MTID VARCHAR(128), IN EVENT TEXT, IN SECONDS INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT COUNT(1)
+        FROM MT_Events me
+        WHERE me.MT_id = MTID
+          AND me.event_id = (SELECT e.id FROM Events e WHERE e.event = EVENT)
+          AND me.time > (CURRENT_TIMESTAMP() - INTERVAL SECONDS SECOND);
+END;;
+
+CREATE OR REPLACE PROCEDURE ActionCodes_AddResumeToken(IN MTID VARCHAR(128), IN CODE_ VARCHAR(128))
+BEGIN
+    DECLARE aid BIGINT UNSIGNED;
+    DECLARE id BIGINT UNSIGNED;
+    SET TIME_ZONE = "+0:00";
+    SELECT a.id FROM Actions a WHERE a.`action` = 'resume_token' INTO aid;
+    INSERT INTO ActionCodes (action, code) VALUES (aid, CODE_);
+    SELECT LAST_INSERT_ID() INTO id;
+    INSERT INTO ActionReferencesMytokens (action_id, MT_id) VALUES (id, MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE ActionCodes_GetResumeTokenMTID(IN CODE_ VARCHAR(128))
+BEGIN
+    SELECT arm.MT_id
+        FROM ActionReferencesMytokens arm
+                 JOIN ActionCodes ac ON arm.action_id = ac.id
+                 JOIN Actions a ON ac.action = a.id
+        WHERE ac.code = CODE_
+          AND a.`action` = 'resume_token';
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetAllForSameUser_v2(IN MTID VARCHAR(128))
+BEGIN
+    DECLARE UID BIGINT UNSIGNED;
+    SELECT user_id FROM MTokens WHERE id = MTID INTO UID;
+    CALL MTokens_GetForUser_v2(UID);
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetForUser_v2(IN UID BIGINT UNSIGNED)
+BEGIN
+    SELECT id, parent_id, id AS mom_id, name, created, expires_at, ip_created AS ip, suspended
+        FROM MTokens
+        WHERE user_id = UID
+        ORDER BY created;
+END;;
+
+CREATE OR REPLACE PROCEDURE MTokens_GetSubtokens_v2(IN MTID VARCHAR(128))
+BEGIN
+    CREATE TEMPORARY TABLE IF NOT EXISTS effected_MTIDs (id VARCHAR(128));
+    TRUNCATE effected_MTIDs;
+    INSERT INTO effected_MTIDs
+    WITH RECURSIVE childs AS (SELECT id, parent_id
+                                  FROM MTokens
+                                  WHERE id = MTID
+                              UNION ALL
+                              SELECT mt.id, mt.parent_id
+                                  FROM MTokens mt
+                                           INNER JOIN childs c
+                                  WHERE mt.parent_id = c.id)
+    SELECT id
+        FROM childs;
+    SELECT m.id, m.parent_id, m.id AS mom_id, m.name, m.created, m.expires_at, m.ip_created AS ip, m.suspended
+        FROM MTokens m
+        WHERE m.id IN
+              (SELECT id
+                   FROM effected_MTIDs);
+    DROP TABLE effected_MTIDs;
+END;;
+
+CREATE OR REPLACE PROCEDURE TransferCodeAttributes_UpdateSSHKey_v2(IN PCID VARCHAR(128), IN KEY_FP VARCHAR(128),
+                                                                   IN CA_ BOOL, IN PRINCIPALS_ TEXT,
+                                                                   IN KEY_RESTRICTIONS_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE TransferCodesAttributes
+    SET ssh_key_fp=KEY_FP,
+        ssh_key_ca=CA_,
+        ssh_principals=PRINCIPALS_,
+        ssh_key_restrictions=KEY_RESTRICTIONS_
+        WHERE id = PCID;
+END;;
+
+CREATE OR REPLACE PROCEDURE TransferCodes_GetStatus_v2(IN PCID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT 1                                AS found,
+           CURRENT_TIMESTAMP() > expires_at AS expired,
+           response_type,
+           consent_declined,
+           max_token_len,
+           ssh_key_fp,
+           ssh_key_ca,
+           ssh_principals,
+           ssh_key_restrictions
+        FROM TransferCodes
+        WHERE id = PCID;
+END;;
+
+CREATE OR REPLACE PROCEDURE SSHInfo_Get_v2(IN KeyHash VARCHAR(128), IN UserHash VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT spk.key_id,
+           spk.name,
+           spk.ssh_key_fp,
+           spk.ssh_user_hash,
+           spk.created,
+           spk.last_used,
+           spk.ca,
+           spk.principals,
+           spk.key_restrictions,
+           e.enabled,
+           ms.crypt AS MT_crypt
+        FROM ((SELECT * FROM SSHPublicKeys WHERE ssh_key_fp = KeyHash AND ssh_user_hash = UserHash) spk
+            JOIN (SELECT ug.user_id, ug.enabled
+                      FROM (UserGrants ug
+                               JOIN
+                               (SELECT * FROM Grants gg WHERE gg.grant_type = 'ssh') g
+                               ON ug.grant_id = g.id)
+            ) e
+            ON spk.`user` = e.user_id)
+                 JOIN MTCryptStore ms
+                      ON spk.MT_crypt = ms.id;
+END;;
+
+CREATE OR REPLACE PROCEDURE SSHInfo_GetAll_v2(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT s.ssh_key_fp, s.name, s.created, s.last_used, s.ca, s.principals, s.key_restrictions
+        FROM SSHPublicKeys s
+        WHERE s.`user` = (SELECT m.`user_id` FROM MTokens m WHERE m.id = MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE SSHInfo_Insert_v2(IN MTID VARCHAR(128), IN KEY_FP VARCHAR(128),
+                                              IN SSH_USER_H VARCHAR(128), IN NAME TEXT,
+                                              IN ENCRYPTED_MT TEXT, IN CA_ BOOL, IN PRINCIPALS_ TEXT,
+                                              IN KEY_RESTRICTIONS_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    CALL CryptStoreMT_Insert(ENCRYPTED_MT, @CRYPT_ID);
+    INSERT INTO SSHPublicKeys (user, ssh_key_fp, ssh_user_hash, name, MT_crypt, MT_id, ca, principals,
+                               key_restrictions)
+        VALUES ((SELECT m.user_id FROM MTokens m WHERE m.id = MTID), KEY_FP, SSH_USER_H, NAME, @CRYPT_ID, MTID, CA_,
+                PRINCIPALS_, KEY_RESTRICTIONS_);
+END;;
+
+CREATE OR REPLACE PROCEDURE SSHKeyEvents_Insert(IN KEY_ID_ BIGINT UNSIGNED, IN REQUEST_TYPE_ VARCHAR(64),
+                                                IN IP_ VARCHAR(128), IN USER_AGENT_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO SSHKeyEvents (key_id, request_type, ip, user_agent) VALUES (KEY_ID_, REQUEST_TYPE_, IP_, USER_AGENT_);
+END;;
+
+CREATE OR REPLACE PROCEDURE SSHKeyEvents_GetAll(IN MTID VARCHAR(128), IN LIMIT_ INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT ke.ssh_key_fp, ke.request_type, ke.ip, ke.user_agent, ke.time
+        FROM (SELECT s.ssh_key_fp,
+                     e.request_type,
+                     e.ip,
+                     e.user_agent,
+                     e.time,
+                     ROW_NUMBER() OVER (PARTITION BY e.key_id ORDER BY e.time DESC, e.id DESC) AS n
+                  FROM SSHKeyEvents e
+                           JOIN SSHPublicKeys s ON e.key_id = s.key_id
+                  WHERE s.`user` = (SELECT m.`user_id` FROM MTokens m WHERE m.id = MTID)) ke
+        WHERE ke.n <= LIMIT_
+        ORDER BY ke.time DESC;
+END;;
+
+CREATE OR REPLACE PROCEDURE OIDCFedClients_Get(IN ISS VARCHAR(256))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT c.client_id, c.expires_at
+        FROM OIDCFedClients c
+        WHERE c.issuer = ISS
+          AND (c.expires_at IS NULL OR c.expires_at > CURRENT_TIMESTAMP());
+END;;
+
+CREATE OR REPLACE PROCEDURE OIDCFedClients_Set(IN ISS VARCHAR(256), IN CLIENT_ID_ VARCHAR(512),
+                                               IN EXPIRES_AT_ DATETIME)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO OIDCFedClients (issuer, client_id, expires_at)
+        VALUES (ISS, CLIENT_ID_, EXPIRES_AT_)
+    ON DUPLICATE KEY UPDATE client_id     = CLIENT_ID_,
+                            expires_at    = EXPIRES_AT_,
+                            registered_at = CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE RTClients_Get(IN RTID BIGINT UNSIGNED)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT c.client_id FROM RTClients c WHERE c.rt_id = RTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE RTClients_Set(IN RTID BIGINT UNSIGNED, IN CLIENT_ID_ VARCHAR(512))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO RTClients (rt_id, client_id)
+        VALUES (RTID, CLIENT_ID_)
+    ON DUPLICATE KEY UPDATE client_id = CLIENT_ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE AuthInfo_Get_v2(IN STATE TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT state_h, request_json, polling_code, code_verifier, client_id, step_up_uid, registered_client
+        FROM AuthInfo
+        WHERE state_h = STATE
+          AND expires_at >= CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE AuthInfo_SetClientID(IN STATE TEXT, IN CLIENT_ID_ VARCHAR(512))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE AuthInfo SET client_id = CLIENT_ID_ WHERE state_h = STATE;
+END;;
+
+CREATE OR REPLACE PROCEDURE AT_Insert_v2(IN AT TEXT, IN IP TEXT, IN COMMENT TEXT, IN MT VARCHAR(128),
+                                         IN EXPIRES_AT_ DATETIME, IN CACHE_KEY_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    CALL CryptStoreAT_Insert(AT, @ATCryptID);
+    INSERT INTO AccessTokens (token_crypt, ip_created, comment, MT_id, expires_at, cache_key)
+        VALUES (@ATCryptID, IP, COMMENT, MT, EXPIRES_AT_, CACHE_KEY_);
+    SELECT LAST_INSERT_ID();
+END;;
+
+CREATE OR REPLACE PROCEDURE EncryptionKeys_GetRTKeyForMT(IN MTID VARCHAR(128))
+BEGIN
+    DECLARE rtid BIGINT UNSIGNED;
+    DECLARE keyid BIGINT UNSIGNED;
+    SET TIME_ZONE = "+0:00";
+    SELECT rt_id FROM MTokens WHERE id = MTID INTO rtid;
+    SELECT key_id FROM RT_EncryptionKeys WHERE MT_id = MTID AND rt_id = rtid INTO keyid;
+    SELECT ek.encryption_key, ek.id AS key_id, rt.crypt AS refresh_token, rt.id AS rt_id
+        FROM EncryptionKeys ek
+                 JOIN CryptStore rt ON rt.id = rtid
+        WHERE ek.id = keyid
+        FOR UPDATE;
+END;;
+
+CREATE OR REPLACE PROCEDURE AT_GetCached(IN MTID VARCHAR(128), IN CACHE_KEY_ VARCHAR(128), IN MIN_LIFETIME INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT cs.crypt AS token,
+           a.expires_at,
+           (SELECT GROUP_CONCAT(aa.attribute SEPARATOR ' ')
+                FROM AT_Attributes aa
+                         JOIN Attributes attr ON aa.attribute_id = attr.id
+                WHERE aa.AT_id = a.id
+                  AND attr.attribute = 'scope') AS scopes,
+           (SELECT GROUP_CONCAT(aa.attribute SEPARATOR ' ')
+                FROM AT_Attributes aa
+                         JOIN Attributes attr ON aa.attribute_id = attr.id
+                WHERE aa.AT_id = a.id
+                  AND attr.attribute = 'audience') AS audiences
+        FROM AccessTokens a
+                 JOIN CryptStore cs ON a.token_crypt = cs.id
+        WHERE a.MT_id = MTID
+          AND a.cache_key = CACHE_KEY_
+          AND a.expires_at > TIMESTAMPADD(SECOND, MIN_LIFETIME, CURRENT_TIMESTAMP())
+        ORDER BY a.expires_at DESC
+        LIMIT 1;
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationQueue_Insert(IN MTID VARCHAR(128), IN TYPE_ VARCHAR(32), IN SUBJECT_ TEXT,
+                                                     IN REQUEST_ LONGTEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO NotificationQueue (MT_id, type, subject, request) VALUES (MTID, TYPE_, SUBJECT_, REQUEST_);
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationQueue_Claim(IN CLAIM_ VARCHAR(128), IN BATCH_SIZE INT, IN LEASE INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE NotificationQueue
+        SET claim         = CLAIM_,
+            claimed_until = TIMESTAMPADD(SECOND, LEASE, CURRENT_TIMESTAMP())
+        WHERE status = 'pending'
+          AND next_attempt_at <= CURRENT_TIMESTAMP()
+          AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP())
+        ORDER BY next_attempt_at
+        LIMIT BATCH_SIZE;
+    SELECT id, type, request, attempts
+        FROM NotificationQueue
+        WHERE claim = CLAIM_ AND status = 'pending'
+        ORDER BY id;
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationQueue_Delivered(IN ID_ BIGINT UNSIGNED)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE NotificationQueue
+        SET status          = 'delivered',
+            attempts        = attempts + 1,
+            last_attempt_at = CURRENT_TIMESTAMP(),
+            last_error      = NULL,
+            claim           = NULL,
+            claimed_until   = NULL
+        WHERE id = ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationQueue_Failed(IN ID_ BIGINT UNSIGNED, IN ERR TEXT, IN RETRY_IN INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE NotificationQueue
+        SET status          = IF(RETRY_IN IS NULL, 'failed', 'pending'),
+            attempts        = attempts + 1,
+            last_attempt_at = CURRENT_TIMESTAMP(),
+            next_attempt_at = IF(RETRY_IN IS NULL, next_attempt_at,
+                                 TIMESTAMPADD(SECOND, RETRY_IN, CURRENT_TIMESTAMP())),
+            last_error      = ERR,
+            claim           = NULL,
+            claimed_until   = NULL
+        WHERE id = ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationQueue_GetForMT(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT id, subject, status, attempts, IFNULL(last_error, '') AS last_error, created, last_attempt_at,
+           next_attempt_at
+        FROM NotificationQueue
+        WHERE MT_id = MTID
+        ORDER BY id DESC;
+END;;
+
+CREATE OR REPLACE PROCEDURE Cleanup_NotificationQueue()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    DELETE
+        FROM NotificationQueue
+        WHERE status != 'pending'
+          AND last_attempt_at < TIMESTAMPADD(DAY, -30, CURRENT_TIMESTAMP());
+END;;
+
+CREATE OR REPLACE PROCEDURE Event_Insert_v2(IN MTID VARCHAR(128), IN EVENT TEXT, IN COMMENT TEXT,
+                                            IN IP TEXT, IN USERAGENT TEXT, IN AUTH_CONTEXT_ VARCHAR(64))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO MT_Events (MT_id, event_id, comment, ip, user_agent, auth_context)
+        VALUES (MTID, (SELECT e.id FROM Events e WHERE e.event = EVENT), COMMENT, IP, USERAGENT, AUTH_CONTEXT_);
+END;;
+
+CREATE OR REPLACE PROCEDURE EventHistory_Get_v2(IN MTID VARCHAR(128))
+BEGIN
+    SELECT MT_id, event, time, comment, ip, user_agent, auth_context FROM EventHistory WHERE MT_id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE EventHistory_GetChildren_v2(IN MTID VARCHAR(128))
+BEGIN
+    CREATE TEMPORARY TABLE IF NOT EXISTS child_MTIDs (id VARCHAR(128));
+    TRUNCATE child_MTIDs;
+    INSERT INTO child_MTIDs
+    WITH RECURSIVE childs AS (SELECT id, parent_id
+                                  FROM MTokens
+                                  WHERE id = MTID
+                              UNION ALL
+                              SELECT mt.id, mt.parent_id
+                                  FROM MTokens mt
+                                           INNER JOIN childs c
+                                  WHERE mt.parent_id = c.id)
+    SELECT id
+        FROM childs;
+    DELETE FROM child_MTIDs WHERE id = MTID;
+    SELECT MT_id, event, time, comment, ip, user_agent, auth_context
+        FROM EventHistory eh
+        WHERE eh.MT_id IN (SELECT id FROM child_MTIDs);
+    DROP TABLE child_MTIDs;
+END;;
+
+CREATE OR REPLACE PROCEDURE AuthInfo_SetStepUp(IN STATE TEXT, IN UID BIGINT UNSIGNED)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE AuthInfo SET step_up_uid = UID WHERE state_h = STATE;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_Insert(IN MTID VARCHAR(128), IN CREDENTIAL_ID_ VARCHAR(512),
+                                                       IN PUBLIC_KEY_ TEXT, IN SIGN_COUNT_ INT UNSIGNED,
+                                                       IN NAME_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO WebAuthnCredentials (user_id, credential_id, public_key, sign_count, name)
+        VALUES ((SELECT m.user_id FROM MTokens m WHERE m.id = MTID), CREDENTIAL_ID_, PUBLIC_KEY_, SIGN_COUNT_,
+                NAME_);
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_GetForMT(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT c.id, c.user_id, c.credential_id, c.public_key, c.sign_count, c.name, c.created, c.last_used
+        FROM WebAuthnCredentials c
+        WHERE c.user_id = (SELECT m.user_id FROM MTokens m WHERE m.id = MTID)
+        ORDER BY c.created;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_Get(IN CREDENTIAL_ID_ VARCHAR(512))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT c.id, c.user_id, c.credential_id, c.public_key, c.sign_count, c.name, c.created, c.last_used
+        FROM WebAuthnCredentials c
+        WHERE c.credential_id = CREDENTIAL_ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_CountForUser(IN SUB_ TEXT, IN ISS_ TEXT)
+BEGIN
+    SELECT u.id AS uid, COUNT(c.id) AS credentials
+        FROM Users u
+                 LEFT JOIN WebAuthnCredentials c ON c.user_id = u.id
+        WHERE u.sub = SUB_
+          AND u.iss = ISS_
+        GROUP BY u.id;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_Used(IN CREDENTIAL_ID_ VARCHAR(512), IN SIGN_COUNT_ INT UNSIGNED)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE WebAuthnCredentials
+    SET sign_count = SIGN_COUNT_,
+        last_used  = CURRENT_TIMESTAMP()
+        WHERE credential_id = CREDENTIAL_ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnCredentials_Delete(IN MTID VARCHAR(128), IN ID_ BIGINT UNSIGNED)
+BEGIN
+    DELETE
+        FROM WebAuthnCredentials
+        WHERE id = ID_
+          AND user_id = (SELECT m.user_id FROM MTokens m WHERE m.id = MTID);
+    SELECT ROW_COUNT();
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnChallenges_Insert(IN CHALLENGE_ VARCHAR(128), IN PURPOSE_ VARCHAR(16),
+                                                      IN MTID VARCHAR(128), IN STATE TEXT, IN EXPIRES_IN_ INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO WebAuthnChallenges (challenge, purpose, MT_id, state_h, expires_at)
+        VALUES (CHALLENGE_, PURPOSE_, MTID, STATE, TIMESTAMPADD(SECOND, EXPIRES_IN_, CURRENT_TIMESTAMP()));
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnChallenges_Pop(IN CHALLENGE_ VARCHAR(128), IN PURPOSE_ VARCHAR(16))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT c.MT_id, c.state_h
+        FROM WebAuthnChallenges c
+        WHERE c.challenge = CHALLENGE_
+          AND c.purpose = PURPOSE_
+          AND c.expires_at >= CURRENT_TIMESTAMP();
+    DELETE FROM WebAuthnChallenges WHERE challenge = CHALLENGE_;
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnStepUps_Insert(IN MTID VARCHAR(128), IN LIFETIME INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    REPLACE INTO WebAuthnStepUps (MT_id, expires_at)
+        VALUES (MTID, TIMESTAMPADD(SECOND, LIFETIME, CURRENT_TIMESTAMP()));
+END;;
+
+CREATE OR REPLACE PROCEDURE WebAuthnStepUps_Check(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT COUNT(1) FROM WebAuthnStepUps WHERE MT_id = MTID AND expires_at >= CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE Cleanup_WebAuthn()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    DELETE FROM WebAuthnChallenges WHERE expires_at < CURRENT_TIMESTAMP();
+    DELETE FROM WebAuthnStepUps WHERE expires_at < CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE Cleanup()
+BEGIN
+    CALL Cleanup_MTokens();
+    CALL Cleanup_AuthInfo();
+    CALL Cleanup_ProxyTokens();
+    CALL Cleanup_ActionCodes();
+    CALL Cleanup_NotificationQueue();
+    CALL Cleanup_Jobs();
+    CALL Cleanup_WebAuthn();
+    CALL Cleanup_ClientAttestationIDs();
+END;;
+
+CREATE OR REPLACE PROCEDURE Users_GetMail_v2(IN MTID VARCHAR(128))
+BEGIN
+    SELECT u.email, u.email_verified, u.prefer_html_mail, u.language
+        FROM Users u
+        WHERE u.id = (SELECT m.user_id FROM MTokens m WHERE m.id = MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE Users_SetLanguage(IN MTID VARCHAR(128), IN LANGUAGE_ VARCHAR(16))
+BEGIN
+    UPDATE Users u
+    SET u.language=LANGUAGE_
+        WHERE u.id = (SELECT m.user_id FROM MTokens m WHERE m.id = MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE Users_GetMailForUID(IN UID BIGINT UNSIGNED)
+BEGIN
+    SELECT u.email, u.email_verified, u.prefer_html_mail, u.language
+        FROM Users u
+        WHERE u.id = UID;
+END;;
+
+CREATE OR REPLACE PROCEDURE Notifications_GetForMT_v2(IN MTID VARCHAR(128))
+BEGIN
+    SELECT n.id, n.type, n.management_code, n.ws, n.user_wide, snc.class, n.uid, n.digest, n.chat_target
+        FROM ((SELECT *
+                   FROM Notifications
+                   WHERE id IN (
+                           (SELECT notification_id FROM MTNotificationsMapping WHERE MT_id = MTID))
+                      OR (user_wide = 1 AND uid = (SELECT user_id FROM MTokens m WHERE m.id = MTID))) n JOIN SubscribedNotificationClasses snc
+              ON n.id = snc.notificaton_id
+                 )
+        ORDER BY n.id DESC;
+END;;
+
+CREATE OR REPLACE PROCEDURE Notifications_GetForMTAndClass_v2(IN MTID VARCHAR(128), IN _CLASS VARCHAR(128))
+BEGIN
+    SELECT n.id, n.type, n.management_code, n.ws, n.user_wide, n.uid, n.digest, n.chat_target
+        FROM Notifications n
+        WHERE id IN (((SELECT notification_id FROM MTNotificationsMapping WHERE MT_id = MTID)
+                      UNION
+                      (SELECT id
+                           FROM Notifications
+                           WHERE user_wide = 1 AND uid = (SELECT user_id FROM MTokens WHERE id = MTID)))
+                     INTERSECT
+                     (SELECT notificaton_id FROM SubscribedNotificationClasses WHERE class = _CLASS));
+
+END;;
+
+CREATE OR REPLACE PROCEDURE Notifications_GetForManagementCode_v2(IN CODE VARCHAR(128))
+BEGIN
+    SELECT n.id, n.type, n.management_code, n.ws, n.user_wide, snc.class, n.uid, n.digest, n.chat_target
+        FROM ((SELECT *
+                   FROM Notifications
+                   WHERE management_code = CODE) n JOIN SubscribedNotificationClasses snc ON n.id = snc.notificaton_id
+                 );
+
+END;;
+
+CREATE OR REPLACE PROCEDURE Notifications_SetDigest(IN NID BIGINT UNSIGNED, IN DIGEST_ VARCHAR(16))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE Notifications SET digest=DIGEST_ WHERE id = NID;
+    UPDATE NotificationDigestEntries SET due_time=CURRENT_TIMESTAMP() WHERE notification_id = NID;
+END;;
+
+CREATE OR REPLACE PROCEDURE Notifications_SetChatTarget(IN NID BIGINT UNSIGNED, IN TARGET LONGTEXT)
+BEGIN
+    UPDATE Notifications SET chat_target=TARGET WHERE id = NID;
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationDigest_Add(IN NID BIGINT UNSIGNED, IN MTID VARCHAR(128), IN CLASS_ VARCHAR(128),
+                                                   IN DATA_ LONGTEXT, IN DUETIME DATETIME)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO NotificationDigestEntries (notification_id, MT_id, class, data, due_time)
+        VALUES (NID, MTID, CLASS_, DATA_, DUETIME);
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationDigest_PopDue()
+BEGIN
+    DECLARE NID BIGINT UNSIGNED;
+    SET TIME_ZONE = "+0:00";
+    # The notification is locked, so that concurrent instances skip it and do not send its digest again
+    SELECT n.id INTO NID
+        FROM Notifications n
+        WHERE EXISTS(SELECT 1
+                         FROM NotificationDigestEntries e
+                         WHERE e.notification_id = n.id
+                           AND e.due_time <= CURRENT_TIMESTAMP())
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED;
+    SELECT e.id AS entry_id, e.MT_id, e.class, e.data, e.created, n.id, n.`type`, n.management_code, n.ws,
+           n.user_wide, n.uid, n.digest
+        FROM NotificationDigestEntries e JOIN Notifications n ON e.notification_id = n.id
+        WHERE e.notification_id = NID AND e.due_time <= CURRENT_TIMESTAMP()
+        ORDER BY e.created, e.id;
+    DELETE FROM NotificationDigestEntries WHERE notification_id = NID AND due_time <= CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_Enqueue(IN TYPE_ VARCHAR(64), IN PAYLOAD_ LONGTEXT, IN RUN_AT DATETIME)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO Jobs (type, payload, run_at) VALUES (TYPE_, PAYLOAD_, IFNULL(RUN_AT, CURRENT_TIMESTAMP()));
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_ScheduleRecurring(IN TYPE_ VARCHAR(64), IN INTERVAL_ INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO RecurringJobs (type, interval_seconds, next_run)
+        VALUES (TYPE_, INTERVAL_, CURRENT_TIMESTAMP())
+        ON DUPLICATE KEY UPDATE interval_seconds = INTERVAL_;
+    IF (SELECT next_run FROM RecurringJobs WHERE type = TYPE_) <= CURRENT_TIMESTAMP() AND
+       NOT EXISTS(SELECT 1 FROM Jobs WHERE type = TYPE_ AND status = 'pending') THEN
+        INSERT INTO Jobs (type) VALUES (TYPE_);
+        UPDATE RecurringJobs SET next_run = TIMESTAMPADD(SECOND, INTERVAL_, CURRENT_TIMESTAMP()) WHERE type = TYPE_;
+    END IF;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_Claim(IN CLAIM_ VARCHAR(128), IN BATCH_SIZE INT, IN LEASE INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE Jobs
+        SET claim         = CLAIM_,
+            claimed_until = TIMESTAMPADD(SECOND, LEASE, CURRENT_TIMESTAMP()),
+            attempts      = attempts + 1
+        WHERE status = 'pending'
+          AND run_at <= CURRENT_TIMESTAMP()
+          AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP())
+        ORDER BY run_at
+        LIMIT BATCH_SIZE;
+    SELECT id, type, IFNULL(payload, 'null') AS payload, attempts
+        FROM Jobs
+        WHERE claim = CLAIM_
+          AND status = 'pending'
+        ORDER BY id;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_Done(IN ID_ BIGINT UNSIGNED, IN CLAIM_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE Jobs
+        SET status        = 'done',
+            finished      = CURRENT_TIMESTAMP(),
+            last_error    = NULL,
+            claim         = NULL,
+            claimed_until = NULL
+        WHERE id = ID_
+          AND claim = CLAIM_;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_Failed(IN ID_ BIGINT UNSIGNED, IN CLAIM_ VARCHAR(128), IN ERR TEXT,
+                                        IN RETRY_IN INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE Jobs
+        SET status        = IF(RETRY_IN IS NULL, 'failed', 'pending'),
+            finished      = IF(RETRY_IN IS NULL, CURRENT_TIMESTAMP(), NULL),
+            run_at        = IF(RETRY_IN IS NULL, run_at, TIMESTAMPADD(SECOND, RETRY_IN, CURRENT_TIMESTAMP())),
+            last_error    = ERR,
+            claim         = NULL,
+            claimed_until = NULL
+        WHERE id = ID_
+          AND claim = CLAIM_;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_GetStatistics()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT type,
+           SUM(status = 'pending' AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP())) AS pending,
+           SUM(status = 'pending' AND claimed_until >= CURRENT_TIMESTAMP())                           AS running,
+           SUM(status = 'done')                                                                       AS done,
+           SUM(status = 'failed')                                                                     AS failed,
+           MAX(finished)                                                                              AS last_finished
+        FROM Jobs
+        GROUP BY type
+        ORDER BY type;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_GetRecent(IN LIMIT_ INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT id, type,
+           IF(status = 'pending' AND claimed_until >= CURRENT_TIMESTAMP(), 'running', status) AS status,
+           attempts, IFNULL(last_error, '') AS last_error, created, run_at, finished
+        FROM Jobs
+        ORDER BY id DESC
+        LIMIT LIMIT_;
+END;;
+
+CREATE OR REPLACE PROCEDURE Jobs_GetRecurring()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT type, interval_seconds, next_run FROM RecurringJobs ORDER BY type;
+END;;
+
+CREATE OR REPLACE PROCEDURE Cleanup_Jobs()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    DELETE
+        FROM Jobs
+        WHERE status != 'pending'
+          AND finished < TIMESTAMPADD(DAY, -7, CURRENT_TIMESTAMP());
+END;;
+
+CREATE OR REPLACE PROCEDURE JobsLeader_Acquire(IN NAME_ VARCHAR(64), IN HOLDER_ VARCHAR(128), IN LEASE INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT IGNORE INTO JobsLeader (name, holder, lease_until)
+        VALUES (NAME_, HOLDER_, TIMESTAMPADD(SECOND, LEASE, CURRENT_TIMESTAMP()));
+    UPDATE JobsLeader
+        SET holder      = HOLDER_,
+            lease_until = TIMESTAMPADD(SECOND, LEASE, CURRENT_TIMESTAMP())
+        WHERE name = NAME_
+          AND (holder = HOLDER_ OR lease_until < CURRENT_TIMESTAMP());
+    SELECT holder = HOLDER_ AS leader FROM JobsLeader WHERE name = NAME_;
+END;;
+
+CREATE OR REPLACE PROCEDURE JobsLeader_Get(IN NAME_ VARCHAR(64))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT holder, lease_until FROM JobsLeader WHERE name = NAME_ AND lease_until >= CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE NotificationSchedule_PopDue(IN BATCH_SIZE INT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    CREATE OR REPLACE TEMPORARY TABLE DueNotificationSchedule AS
+        SELECT ns.id
+            FROM NotificationSchedule ns
+            WHERE ns.due_time <= CURRENT_TIMESTAMP()
+            ORDER BY ns.due_time
+            LIMIT BATCH_SIZE;
+    SELECT nss.*, n.`type`, n.management_code, n.ws, n.user_wide, n.uid, n.digest, n.chat_target
+        FROM NotificationSchedule nss
+                 JOIN Notifications n ON nss.notification_id = n.id
+        WHERE nss.id IN (SELECT id FROM DueNotificationSchedule)
+        ORDER BY nss.due_time;
+    DELETE FROM NotificationSchedule WHERE id IN (SELECT id FROM DueNotificationSchedule);
+    DROP TEMPORARY TABLE DueNotificationSchedule;
+END;;
+
+CREATE OR REPLACE PROCEDURE Calendar_GetByID_v2(IN CID VARCHAR(128))
+BEGIN
+    SELECT id, name, ics_path, ics, sync_token FROM Calendars WHERE id = CID;
+END;;
+
+CREATE OR REPLACE PROCEDURE Calendar_GetByIDForUpdate(IN CID VARCHAR(128))
+BEGIN
+    SELECT id, name, ics_path, ics, sync_token FROM Calendars WHERE id = CID FOR UPDATE;
+END;;
+
+CREATE OR REPLACE PROCEDURE Calendar_SetSyncToken(IN CID VARCHAR(128), IN TOKEN BIGINT UNSIGNED)
+BEGIN
+    UPDATE Calendars SET sync_token = TOKEN WHERE id = CID;
+END;;
+
+CREATE OR REPLACE PROCEDURE CalendarResources_Get(IN CID VARCHAR(128))
+BEGIN
+    SELECT resource, etag, sync_token, deleted FROM CalendarResources WHERE calendar_id = CID;
+END;;
+
+CREATE OR REPLACE PROCEDURE CalendarResources_Set(IN CID VARCHAR(128), IN RESOURCE_ VARCHAR(128),
+                                                  IN ETAG_ VARCHAR(128), IN TOKEN BIGINT UNSIGNED)
+BEGIN
+    INSERT INTO CalendarResources (calendar_id, resource, etag, sync_token)
+        VALUES (CID, RESOURCE_, ETAG_, TOKEN)
+        ON DUPLICATE KEY UPDATE etag = ETAG_, sync_token = TOKEN, deleted = 0;
+END;;
+
+CREATE OR REPLACE PROCEDURE CalendarResources_Delete(IN CID VARCHAR(128), IN RESOURCE_ VARCHAR(128),
+                                                     IN TOKEN BIGINT UNSIGNED)
+BEGIN
+    UPDATE CalendarResources
+        SET deleted    = 1,
+            sync_token = TOKEN
+        WHERE calendar_id = CID
+          AND resource = RESOURCE_;
+END;;
+
+CREATE OR REPLACE PROCEDURE ActionCodes_AddApproveRenewal(IN MTID VARCHAR(128), IN CODE_ VARCHAR(128),
+                                                          IN EXPIRES_IN INT)
+BEGIN
+    DECLARE aid BIGINT UNSIGNED;
+    DECLARE id BIGINT UNSIGNED;
+    SET TIME_ZONE = "+0:00";
+    SELECT a.id FROM Actions a WHERE a.`action` = 'approve_renewal' INTO aid;
+    INSERT INTO ActionCodes (action, code, expires_at)
+        VALUES (aid, CODE_, TIMESTAMPADD(SECOND, EXPIRES_IN, CURRENT_TIMESTAMP()));
+    SELECT LAST_INSERT_ID() INTO id;
+    INSERT INTO ActionReferencesMytokens (action_id, MT_id) VALUES (id, MTID);
+END;;
+
+CREATE OR REPLACE PROCEDURE ActionCodes_GetApproveRenewalMTID(IN CODE_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT arm.MT_id
+        FROM ActionReferencesMytokens arm
+                 JOIN ActionCodes ac ON arm.action_id = ac.id
+                 JOIN Actions a ON ac.action = a.id
+        WHERE ac.code = CODE_
+          AND a.`action` = 'approve_renewal'
+          AND ac.expires_at >= CURRENT_TIMESTAMP();
+END;;
+
+CREATE OR REPLACE PROCEDURE MytokenRenewals_Insert(IN MTID VARCHAR(128), IN CODE_HASH_ VARCHAR(128), IN KEY_ TEXT,
+                                                   IN AUTH_TIME_ DATETIME, IN CHANNEL_ VARCHAR(16),
+                                                   IN WEBHOOK_URL_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    REPLACE INTO MytokenRenewals (MT_id, code_hash, encryption_key, auth_time, channel, webhook_url)
+        VALUES (MTID, CODE_HASH_, KEY_, AUTH_TIME_, CHANNEL_, WEBHOOK_URL_);
+END;;
+
+CREATE OR REPLACE PROCEDURE MytokenRenewals_Get(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT r.MT_id,
+           r.channel,
+           r.webhook_url,
+           r.approved,
+           r.created,
+           m.suspended,
+           COALESCE(p.suspended, 0) AS parent_suspended
+        FROM MytokenRenewals r
+                 JOIN MTokens m ON r.MT_id = m.id
+                 LEFT JOIN MTokens p ON m.parent_id = p.id
+        WHERE r.MT_id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE MytokenRenewals_GetByCode(IN CODE_HASH_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT r.MT_id,
+           r.channel,
+           r.webhook_url,
+           r.approved,
+           r.created,
+           m.suspended,
+           COALESCE(p.suspended, 0) AS parent_suspended,
+           r.encryption_key,
+           r.auth_time,
+           m.parent_id,
+           m.rt_id,
+           m.name,
+           m.capabilities,
+           m.rotation,
+           m.restrictions,
+           m.created AS token_created,
+           m.subtoken_limits,
+           p.capabilities    AS parent_capabilities,
+           p.restrictions    AS parent_restrictions,
+           p.subtoken_limits AS parent_subtoken_limits,
+           u.iss,
+           u.sub
+        FROM MytokenRenewals r
+                 JOIN MTokens m ON r.MT_id = m.id
+                 LEFT JOIN MTokens p ON m.parent_id = p.id
+                 JOIN Users u ON m.user_id = u.id
+        WHERE r.code_hash = CODE_HASH_;
+END;;
+
+CREATE OR REPLACE PROCEDURE MytokenRenewals_Approve(IN MTID VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE MytokenRenewals SET approved = CURRENT_TIMESTAMP() WHERE MT_id = MTID AND approved IS NULL;
+    SELECT ROW_COUNT();
+END;;
+
+CREATE OR REPLACE PROCEDURE MytokenRenewals_Delete(IN MTID VARCHAR(128))
+BEGIN
+    DELETE FROM MytokenRenewals WHERE MT_id = MTID;
+END;;
+
+CREATE OR REPLACE PROCEDURE AuthInfo_SetRegisteredClient(IN STATE TEXT, IN CLIENT_ID_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE AuthInfo SET registered_client = CLIENT_ID_ WHERE state_h = STATE;
+END;;
+
+CREATE OR REPLACE PROCEDURE RegisteredClients_Insert(IN CLIENT_ID_ VARCHAR(128), IN NAME_ VARCHAR(128),
+                                                     IN LOGO_URI_ TEXT, IN HOMEPAGE_ TEXT, IN PUBLIC_KEY_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT INTO RegisteredClients (client_id, name, logo_uri, homepage, public_key)
+        VALUES (CLIENT_ID_, NAME_, LOGO_URI_, HOMEPAGE_, PUBLIC_KEY_);
+END;;
+
+CREATE OR REPLACE PROCEDURE RegisteredClients_Update(IN CLIENT_ID_ VARCHAR(128), IN NAME_ VARCHAR(128),
+                                                     IN LOGO_URI_ TEXT, IN HOMEPAGE_ TEXT, IN PUBLIC_KEY_ TEXT)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    UPDATE RegisteredClients
+    SET name       = NAME_,
+        logo_uri   = LOGO_URI_,
+        homepage   = HOMEPAGE_,
+        public_key = PUBLIC_KEY_,
+        updated    = CURRENT_TIMESTAMP()
+        WHERE client_id = CLIENT_ID_;
+    SELECT ROW_COUNT();
+END;;
+
+CREATE OR REPLACE PROCEDURE RegisteredClients_Get(IN CLIENT_ID_ VARCHAR(128))
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT client_id, name, logo_uri, homepage, public_key, created, updated
+        FROM RegisteredClients
+        WHERE client_id = CLIENT_ID_;
+END;;
+
+CREATE OR REPLACE PROCEDURE RegisteredClients_GetAll()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    SELECT client_id, name, logo_uri, homepage, public_key, created, updated
+        FROM RegisteredClients
+        ORDER BY client_id;
+END;;
+
+CREATE OR REPLACE PROCEDURE RegisteredClients_Delete(IN CLIENT_ID_ VARCHAR(128))
+BEGIN
+    DELETE FROM RegisteredClients WHERE client_id = CLIENT_ID_;
+    SELECT ROW_COUNT();
+END;;
+
+CREATE OR REPLACE PROCEDURE ClientAttestationIDs_Use(IN CLIENT_ID_ VARCHAR(128), IN JTI_H_ VARCHAR(128),
+                                                     IN EXPIRES_AT_ DATETIME)
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    INSERT IGNORE INTO ClientAttestationIDs (client_id, jti_h, expires_at) VALUES (CLIENT_ID_, JTI_H_, EXPIRES_AT_);
+    SELECT ROW_COUNT();
+END;;
+
+CREATE OR REPLACE PROCEDURE Cleanup_ClientAttestationIDs()
+BEGIN
+    SET TIME_ZONE = "+0:00";
+    DELETE FROM ClientAttestationIDs WHERE expires_at < CURRENT_TIMESTAMP();
+END;;
+
+DELIMITER ;
+
+# Values
+
+INSERT IGNORE INTO Events (event)
+    VALUES ('suspended');
+INSERT IGNORE INTO Events (event)
+    VALUES ('resumed');
+INSERT IGNORE INTO Events (event)
+    VALUES ('ssh_certificate_issued');
+INSERT IGNORE INTO Events (event)
+    VALUES ('language_changed');
+INSERT IGNORE INTO Events (event)
+    VALUES ('renewal_requested');
+INSERT IGNORE INTO Events (event)
+    VALUES ('renewal_approved');
+INSERT IGNORE INTO Events (event)
+    VALUES ('renewal_cancelled');
+INSERT IGNORE INTO Events (event)
+    VALUES ('renewed');
+INSERT IGNORE INTO Events (event)
+    VALUES ('passkeys_listed');
+INSERT IGNORE INTO Events (event)
+    VALUES ('passkey_added');
+INSERT IGNORE INTO Events (event)
+    VALUES ('passkey_removed');
+INSERT IGNORE INTO Events (event)
+    VALUES ('step_up');
+
+INSERT IGNORE INTO Actions (action)
+    VALUES ('resume_token');
+INSERT IGNORE INTO Actions (action)
+    VALUES ('approve_renewal');
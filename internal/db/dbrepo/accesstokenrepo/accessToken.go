@@ -1,7 +1,13 @@
 package accesstokenrepo
 
 import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -10,6 +16,7 @@ import (
 	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
 )
 
 // AccessToken holds database information about an access token
@@ -21,13 +28,20 @@ type AccessToken struct {
 
 	Scopes    []string
 	Audiences []string
+	// ExpiresIn is the lifetime of the access token in seconds, 0 if unknown
+	ExpiresIn int64
+	// CacheKey identifies the request the access token was obtained for; only access tokens with a cache key can be
+	// returned from the cache
+	CacheKey string
 }
 
 type accessToken struct {
-	Token   string
-	IP      string `db:"ip_created"`
-	Comment db.NullString
-	MTID    mtid.MTID `db:"MT_id"`
+	Token     string
+	IP        string `db:"ip_created"`
+	Comment   db.NullString
+	MTID      mtid.MTID `db:"MT_id"`
+	ExpiresAt sql.NullTime
+	CacheKey  db.NullString
 }
 
 func (t *AccessToken) toDBObject() (*accessToken, error) {
@@ -39,12 +53,17 @@ func (t *AccessToken) toDBObject() (*accessToken, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &accessToken{
-		Token:   token,
-		IP:      t.IP,
-		Comment: db.NewNullString(t.Comment),
-		MTID:    t.Mytoken.ID,
-	}, nil
+	dbAT := &accessToken{
+		Token:    token,
+		IP:       t.IP,
+		Comment:  db.NewNullString(t.Comment),
+		MTID:     t.Mytoken.ID,
+		CacheKey: db.NewNullString(t.CacheKey),
+	}
+	if t.ExpiresIn > 0 {
+		dbAT.ExpiresAt = db.NewNullTime(time.Now().Add(time.Duration(t.ExpiresIn) * time.Second))
+	}
+	return dbAT, nil
 }
 
 // Store stores the AccessToken in the database as well as the relevant attributes
@@ -56,7 +75,10 @@ func (t *AccessToken) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx) error {
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
 			var atID uint64
-			err = tx.Get(&atID, `CALL AT_Insert(?,?,?,?)`, store.Token, store.IP, store.Comment, store.MTID)
+			err = tx.Get(
+				&atID, `CALL AT_Insert_v2(?,?,?,?,?,?)`, store.Token, store.IP, store.Comment, store.MTID,
+				store.ExpiresAt, store.CacheKey,
+			)
 			if err != nil {
 				return errors.WithStack(err)
 			}
@@ -74,3 +96,70 @@ func (t *AccessToken) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx) error {
 		},
 	)
 }
+
+// CacheKey returns the cache key for an access token request with the passed scopes and audiences; the order of
+// scopes and audiences does not matter
+func CacheKey(scopes, audiences []string) string {
+	normalize := func(values []string) string {
+		var v []string
+		for _, s := range utils.UniqueSlice(values) {
+			if s != "" {
+				v = append(v, s)
+			}
+		}
+		sort.Strings(v)
+		return strings.Join(v, " ")
+	}
+	return hashutils.SHA3_256Str([]byte(normalize(scopes) + "|" + normalize(audiences)))
+}
+
+// CachedAccessToken is a still valid access token that can be returned instead of obtaining a new one
+type CachedAccessToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Scopes    []string
+	Audiences []string
+}
+
+type cachedAccessToken struct {
+	Token     string        `db:"token"`
+	ExpiresAt time.Time     `db:"expires_at"`
+	Scopes    db.NullString `db:"scopes"`
+	Audiences db.NullString `db:"audiences"`
+}
+
+// GetCached returns an access token issued for the passed mytoken and cache key that is still valid for at least
+// minLifetime seconds; if there is no such access token, nil is returned
+func GetCached(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken, cacheKey string, minLifetime int64,
+) (*CachedAccessToken, error) {
+	var dbAT cachedAccessToken
+	var found bool
+	if err := db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) (err error) {
+			found, err = db.ParseError(
+				errors.WithStack(tx.Get(&dbAT, `CALL AT_GetCached(?,?,?)`, mt.ID, cacheKey, minLifetime)),
+			)
+			return
+		},
+	); err != nil || !found {
+		return nil, err
+	}
+	jwt, err := mt.ToJWT()
+	if err != nil {
+		return nil, err
+	}
+	token, err := cryptutils.AES256Decrypt(dbAT.Token, jwt)
+	if err != nil {
+		// The access token was encrypted with a previous version of the mytoken, e.g. before it was rotated;
+		// it cannot be used from the cache
+		rlog.WithError(err).Debug("could not decrypt cached access token")
+		return nil, nil
+	}
+	return &CachedAccessToken{
+		Token:     token,
+		ExpiresAt: dbAT.ExpiresAt,
+		Scopes:    strings.Fields(dbAT.Scopes.String),
+		Audiences: strings.Fields(dbAT.Audiences.String),
+	}, nil
+}
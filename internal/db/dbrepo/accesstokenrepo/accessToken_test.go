@@ -0,0 +1,80 @@
+package accesstokenrepo
+
+import (
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := CacheKey([]string{"openid", "profile"}, []string{"https://a.example.com", "https://b.example.com"})
+	tests := []struct {
+		name      string
+		scopes    []string
+		audiences []string
+		equal     bool
+	}{
+		{
+			name:      "same request",
+			scopes:    []string{"openid", "profile"},
+			audiences: []string{"https://a.example.com", "https://b.example.com"},
+			equal:     true,
+		},
+		{
+			name:      "different order",
+			scopes:    []string{"profile", "openid"},
+			audiences: []string{"https://b.example.com", "https://a.example.com"},
+			equal:     true,
+		},
+		{
+			name:      "duplicates and empty values",
+			scopes:    []string{"openid", "", "profile", "openid"},
+			audiences: []string{"https://a.example.com", "https://b.example.com", "", "https://a.example.com"},
+			equal:     true,
+		},
+		{
+			name:      "fewer scopes",
+			scopes:    []string{"openid"},
+			audiences: []string{"https://a.example.com", "https://b.example.com"},
+			equal:     false,
+		},
+		{
+			name:      "additional scope",
+			scopes:    []string{"openid", "profile", "email"},
+			audiences: []string{"https://a.example.com", "https://b.example.com"},
+			equal:     false,
+		},
+		{
+			name:      "other audience",
+			scopes:    []string{"openid", "profile"},
+			audiences: []string{"https://a.example.com", "https://c.example.com"},
+			equal:     false,
+		},
+		{
+			name:      "no audiences",
+			scopes:    []string{"openid", "profile"},
+			audiences: nil,
+			equal:     false,
+		},
+		{
+			name:      "audiences as scopes",
+			scopes:    []string{"openid", "profile", "https://a.example.com", "https://b.example.com"},
+			audiences: nil,
+			equal:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				key := CacheKey(test.scopes, test.audiences)
+				if (key == base) != test.equal {
+					t.Errorf("expected equal cache keys: %v, but got '%s' and '%s'", test.equal, key, base)
+				}
+			},
+		)
+	}
+}
+
+func TestCacheKey_ScopesAndAudiencesAreSeparated(t *testing.T) {
+	if CacheKey([]string{"openid"}, nil) == CacheKey(nil, []string{"openid"}) {
+		t.Error("a scope and an audience with the same value must not result in the same cache key")
+	}
+}
@@ -31,6 +31,40 @@ func VerifyMail(rlog log.Ext1FieldLogger, tx *sqlx.Tx, code string) (verified bo
 	return
 }
 
+// UseResumeTokenCode returns the id of the mytoken linked to a resume_token code and then deletes the code
+func UseResumeTokenCode(rlog log.Ext1FieldLogger, tx *sqlx.Tx, code string) (
+	mtID mtid.MTID, found bool, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			found, err = db.ParseError(errors.WithStack(tx.Get(&mtID, `CALL ActionCodes_GetResumeTokenMTID(?)`, code)))
+			if err != nil || !found {
+				return err
+			}
+			return deleteCode(rlog, tx, code)
+		},
+	)
+	return
+}
+
+// UseApproveRenewalCode returns the id of the mytoken linked to an approve_renewal code and then deletes the code
+func UseApproveRenewalCode(rlog log.Ext1FieldLogger, tx *sqlx.Tx, code string) (
+	mtID mtid.MTID, found bool, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			found, err = db.ParseError(
+				errors.WithStack(tx.Get(&mtID, `CALL ActionCodes_GetApproveRenewalMTID(?)`, code)),
+			)
+			if err != nil || !found {
+				return err
+			}
+			return deleteCode(rlog, tx, code)
+		},
+	)
+	return
+}
+
 // deleteCode deletes a code
 func deleteCode(rlog log.Ext1FieldLogger, tx *sqlx.Tx, code string) error {
 	return db.RunWithinTransaction(
@@ -74,6 +108,36 @@ func AddRecreateTokenCode(
 	return
 }
 
+// AddResumeTokenCode adds a code for resuming a suspended token to the database
+func AddResumeTokenCode(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, code string,
+) (err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL ActionCodes_AddResumeToken(?,?)`, mtID, code)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return err
+		},
+	)
+	return
+}
+
+// AddApproveRenewalCode adds a code for approving the renewal of a mytoken to the database; the code expires after
+// the passed number of seconds
+func AddApproveRenewalCode(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, code string, expiresIn int,
+) (err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL ActionCodes_AddApproveRenewal(?,?,?)`, mtID, code, expiresIn)
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
 // AddRemoveFromCalendarCode adds a code for removing a token from a calendar to the database
 func AddRemoveFromCalendarCode(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, code, calendarName string,
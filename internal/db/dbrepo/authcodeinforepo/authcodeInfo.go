@@ -1,6 +1,8 @@
 package authcodeinforepo
 
 import (
+	"database/sql"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -26,8 +28,11 @@ type AuthFlowInfo struct {
 type AuthFlowInfoOut struct {
 	State *state.State
 	pkg.AuthCodeFlowRequest
-	PollingCode  bool
-	CodeVerifier string
+	PollingCode      bool
+	CodeVerifier     string
+	ClientID         string
+	StepUpUID        uint64
+	RegisteredClient string
 }
 
 type authFlowInfo struct {
@@ -35,6 +40,9 @@ type authFlowInfo struct {
 	pkg.AuthCodeFlowRequest `db:"request_json"`
 	PollingCode             db.BitBool    `db:"polling_code"`
 	CodeVerifier            db.NullString `db:"code_verifier"`
+	ClientID                db.NullString `db:"client_id"`
+	StepUpUID               sql.NullInt64 `db:"step_up_uid"`
+	RegisteredClient        db.NullString `db:"registered_client"`
 }
 
 func (i *AuthFlowInfo) toAuthFlowInfo() *authFlowInfo {
@@ -42,6 +50,7 @@ func (i *AuthFlowInfo) toAuthFlowInfo() *authFlowInfo {
 		State:               i.State,
 		AuthCodeFlowRequest: i.AuthCodeFlowRequest,
 		PollingCode:         i.PollingCode != nil,
+		RegisteredClient:    db.NewNullString(i.RegisteredClient),
 	}
 }
 
@@ -51,6 +60,9 @@ func (i *authFlowInfo) toAuthFlowInfo() *AuthFlowInfoOut {
 		AuthCodeFlowRequest: i.AuthCodeFlowRequest,
 		PollingCode:         bool(i.PollingCode),
 		CodeVerifier:        i.CodeVerifier.String,
+		ClientID:            i.ClientID.String,
+		StepUpUID:           uint64(i.StepUpUID.Int64),
+		RegisteredClient:    i.RegisteredClient.String,
 	}
 }
 
@@ -69,6 +81,10 @@ func (i *AuthFlowInfo) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx) error {
 				`CALL AuthInfo_Insert(?, ?, ?, ?)`, store.State, store.AuthCodeFlowRequest,
 				config.Get().Features.Polling.PollingCodeExpiresAfter, store.PollingCode,
 			)
+			if err != nil || !store.RegisteredClient.Valid {
+				return errors.WithStack(err)
+			}
+			_, err = tx.Exec(`CALL AuthInfo_SetRegisteredClient(?,?)`, store.State, store.RegisteredClient)
 			return errors.WithStack(err)
 		},
 	)
@@ -79,13 +95,14 @@ func GetAuthFlowInfoByState(rlog log.Ext1FieldLogger, tx *sqlx.Tx, state *state.
 	info := authFlowInfo{}
 	if err := db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			row := tx.QueryRowx(`CALL AuthInfo_Get(?)`, state)
+			row := tx.QueryRowx(`CALL AuthInfo_Get_v2(?)`, state)
 			if err := row.Err(); err != nil {
 				return errors.WithStack(err)
 			}
 			return errors.WithStack(
 				row.Scan(
-					&info.State, &info.AuthCodeFlowRequest, &info.PollingCode, &info.CodeVerifier,
+					&info.State, &info.AuthCodeFlowRequest, &info.PollingCode, &info.CodeVerifier, &info.ClientID,
+					&info.StepUpUID, &info.RegisteredClient,
 				),
 			)
 		},
@@ -140,3 +157,23 @@ func SetCodeVerifier(rlog log.Ext1FieldLogger, tx *sqlx.Tx, state *state.State,
 		},
 	)
 }
+
+// SetClientID stores the id of the client that is used for the authorization flow
+func SetClientID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, state *state.State, clientID string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL AuthInfo_SetClientID(?,?)`, state, clientID)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// SetStepUp records that a WebAuthn step-up of the user with the passed id was done for the authorization flow
+func SetStepUp(rlog log.Ext1FieldLogger, tx *sqlx.Tx, state *state.State, uid uint64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL AuthInfo_SetStepUp(?,?)`, state, uid)
+			return errors.WithStack(err)
+		},
+	)
+}
@@ -0,0 +1,115 @@
+package clientregistryrepo
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+)
+
+// Client is a verified client in the client registry
+type Client struct {
+	ClientID  string            `db:"client_id" json:"client_id"`
+	Name      string            `db:"name" json:"name"`
+	LogoURI   db.NullString     `db:"logo_uri" json:"logo_uri,omitempty"`
+	Homepage  db.NullString     `db:"homepage" json:"homepage,omitempty"`
+	PublicKey string            `db:"public_key" json:"public_key"`
+	Created   unixtime.UnixTime `db:"created" json:"created"`
+	Updated   unixtime.UnixTime `db:"updated" json:"updated"`
+}
+
+// Insert adds a new Client to the registry
+func Insert(rlog log.Ext1FieldLogger, tx *sqlx.Tx, c Client) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				`CALL RegisteredClients_Insert(?,?,?,?,?)`, c.ClientID, c.Name, c.LogoURI, c.Homepage, c.PublicKey,
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// Update updates an existing Client in the registry; if there is no such client found is false
+func Update(rlog log.Ext1FieldLogger, tx *sqlx.Tx, c Client) (found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var count int64
+			if err := errors.WithStack(
+				tx.Get(
+					&count, `CALL RegisteredClients_Update(?,?,?,?,?)`, c.ClientID, c.Name, c.LogoURI, c.Homepage,
+					c.PublicKey,
+				),
+			); err != nil {
+				return err
+			}
+			found = count > 0
+			return nil
+		},
+	)
+	return
+}
+
+// Get returns the Client with the passed client id; if there is no such client found is false
+func Get(rlog log.Ext1FieldLogger, tx *sqlx.Tx, clientID string) (c Client, found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&c, `CALL RegisteredClients_Get(?)`, clientID))
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// GetAll returns all registered Client
+func GetAll(rlog log.Ext1FieldLogger, tx *sqlx.Tx) (clients []Client, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Select(&clients, `CALL RegisteredClients_GetAll()`))
+		},
+	)
+	return
+}
+
+// Delete removes the Client with the passed client id from the registry; if there is no such client found is false
+func Delete(rlog log.Ext1FieldLogger, tx *sqlx.Tx, clientID string) (found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var count int64
+			if err := errors.WithStack(tx.Get(&count, `CALL RegisteredClients_Delete(?)`, clientID)); err != nil {
+				return err
+			}
+			found = count > 0
+			return nil
+		},
+	)
+	return
+}
+
+// UseAttestationID records that a client used an attestation with the passed jti; if the jti was already used by the
+// client, used is true. The id is stored in the database, so a replay is also detected by other mytoken instances.
+func UseAttestationID(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, clientID, jti string, expiresAt time.Time,
+) (used bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var count int64
+			if err := errors.WithStack(
+				tx.Get(
+					&count, `CALL ClientAttestationIDs_Use(?,?,?)`, clientID, hashutils.SHA512Str([]byte(jti)),
+					expiresAt,
+				),
+			); err != nil {
+				return err
+			}
+			used = count == 0
+			return nil
+		},
+	)
+	return
+}
@@ -39,7 +39,8 @@ func UpdateRefreshToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID
 	)
 }
 
-// GetRefreshToken returns the refresh token for a mytoken id
+// GetRefreshToken returns the latest refresh token for a mytoken id; the refresh token is locked until the
+// transaction ends
 func GetRefreshToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID, jwt string) (string, bool, error) {
 	var rt encryptionkeyrepo.RTCryptKeyDBRes
 	found, err := db.ParseError(
@@ -14,8 +14,9 @@ import (
 // EventDBObject holds information needed for storing an event in the database
 type EventDBObject struct {
 	api.Event
-	Comment string
-	MTID    mtid.MTID
+	Comment     string
+	MTID        mtid.MTID
+	AuthContext string
 	api.ClientMetaData
 }
 
@@ -24,8 +25,9 @@ func (e *EventDBObject) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx) error {
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
 			_, err := tx.Exec(
-				`CALL Event_Insert(?, ?, ?, ?, ?)`,
+				`CALL Event_Insert_v2(?, ?, ?, ?, ?, ?)`,
 				e.MTID, e.Event, e.Comment, e.ClientMetaData.IP, e.ClientMetaData.UserAgent,
+				db.NewNullString(e.AuthContext),
 			)
 			return errors.WithStack(err)
 		},
@@ -25,6 +25,7 @@ type EventEntry struct {
 	api.EventEntry `json:",inline"`
 	MOMID          mtid.MOMID        `db:"MT_id" json:"mom_id"`
 	Time           unixtime.UnixTime `db:"time" json:"time"`
+	AuthContext    *string           `db:"auth_context" json:"auth_context,omitempty"`
 }
 
 // GetEventHistory returns the stored EventHistory for a mytoken
@@ -36,7 +37,9 @@ func GetEventHistory(
 		rlog, tx, func(tx *sqlx.Tx) error {
 			for _, id := range ids {
 				var thisHistory EventHistory
-				if err = errors.WithStack(tx.Select(&thisHistory.Events, `CALL EventHistory_Get(?)`, id)); err != nil {
+				if err = errors.WithStack(
+					tx.Select(&thisHistory.Events, `CALL EventHistory_Get_v2(?)`, id),
+				); err != nil {
 					return err
 				}
 				history.Events = append(history.Events, thisHistory.Events...)
@@ -59,7 +62,7 @@ func GetEventHistoryChildren(
 ) (history EventHistory, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Select(&history.Events, `CALL EventHistory_GetChildren(?)`, id))
+			return errors.WithStack(tx.Select(&history.Events, `CALL EventHistory_GetChildren_v2(?)`, id))
 		},
 	)
 	if len(incomingEvents.Events) > 0 {
@@ -83,3 +86,32 @@ func GetPreviouslyUsedIPs(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID)
 	)
 	return
 }
+
+// LastEvent holds information about the last event of a mytoken
+type LastEvent struct {
+	IP   string            `db:"ip"`
+	Time unixtime.UnixTime `db:"time"`
+}
+
+// GetLastEvent returns the last event of a mytoken; if there is no event found is false
+func GetLastEvent(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (e LastEvent, found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&e, `CALL Events_GetLast(?)`, mtID))
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// CountEventsSince returns how often an event occurred for a mytoken within the last seconds
+func CountEventsSince(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, event api.Event, seconds int,
+) (count int, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&count, `CALL Events_CountSince(?,?,?)`, mtID, event.String(), seconds))
+		},
+	)
+	return
+}
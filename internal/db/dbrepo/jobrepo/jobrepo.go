@@ -0,0 +1,186 @@
+package jobrepo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+)
+
+// ClaimedJob is a job that was claimed from the job table for execution
+type ClaimedJob struct {
+	ID       uint64 `db:"id"`
+	Type     string `db:"type"`
+	Payload  string `db:"payload"`
+	Attempts int    `db:"attempts"`
+}
+
+// Job holds information about a job
+type Job struct {
+	ID        uint64            `db:"id" json:"id"`
+	Type      string            `db:"type" json:"type"`
+	Status    string            `db:"status" json:"status"`
+	Attempts  int               `db:"attempts" json:"attempts"`
+	LastError string            `db:"last_error" json:"last_error,omitempty"`
+	Created   unixtime.UnixTime `db:"created" json:"created"`
+	RunAt     unixtime.UnixTime `db:"run_at" json:"run_at"`
+	Finished  unixtime.UnixTime `db:"finished" json:"finished,omitempty"`
+}
+
+// TypeStatistics holds the number of jobs of a type per status
+type TypeStatistics struct {
+	Type         string            `db:"type" json:"type"`
+	Pending      int               `db:"pending" json:"pending"`
+	Running      int               `db:"running" json:"running"`
+	Done         int               `db:"done" json:"done"`
+	Failed       int               `db:"failed" json:"failed"`
+	LastFinished unixtime.UnixTime `db:"last_finished" json:"last_finished,omitempty"`
+}
+
+// RecurringJob holds information about a recurring job
+type RecurringJob struct {
+	Type     string            `db:"type" json:"type"`
+	Interval int64             `db:"interval_seconds" json:"interval"`
+	NextRun  unixtime.UnixTime `db:"next_run" json:"next_run"`
+}
+
+// Leader holds information about the current leader of the job runner
+type Leader struct {
+	Holder     string            `db:"holder" json:"holder"`
+	LeaseUntil unixtime.UnixTime `db:"lease_until" json:"lease_until"`
+}
+
+// Enqueue adds a job of the passed type to the job table; the job is run at runAt or as soon as possible if runAt
+// is the zero time
+func Enqueue(rlog log.Ext1FieldLogger, tx *sqlx.Tx, jobType string, payload any, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var at sql.NullTime
+	if !runAt.IsZero() {
+		at = sql.NullTime{
+			Time:  runAt.UTC(),
+			Valid: true,
+		}
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL Jobs_Enqueue(?,?,?)`, jobType, string(data), at)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// ScheduleRecurring enqueues a job of the passed type if the last one was enqueued at least interval seconds ago and
+// no job of this type is pending
+func ScheduleRecurring(rlog log.Ext1FieldLogger, tx *sqlx.Tx, jobType string, interval int64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Jobs_ScheduleRecurring(?,?)`, jobType, interval)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// Claim claims up to batchSize due jobs; the claim is valid for lease seconds, afterwards the jobs can be claimed
+// again
+func Claim(rlog log.Ext1FieldLogger, tx *sqlx.Tx, claim string, batchSize int, lease int64) (
+	jobs []ClaimedJob, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&jobs, `CALL Jobs_Claim(?,?,?)`, claim, batchSize, lease))
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// MarkDone marks a claimed job as done
+func MarkDone(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id uint64, claim string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Jobs_Done(?,?)`, id, claim)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// MarkFailed records a failed attempt for a claimed job; if retryIn is nil, the job is not retried, otherwise it is
+// retried after retryIn seconds
+func MarkFailed(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id uint64, claim, jobErr string, retryIn *int64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Jobs_Failed(?,?,?,?)`, id, claim, jobErr, retryIn)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// AcquireLeadership tries to acquire or renew the leadership with the passed name for lease seconds; it returns
+// true if holder is the leader
+func AcquireLeadership(rlog log.Ext1FieldLogger, tx *sqlx.Tx, name, holder string, lease int64) (
+	leader bool, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&leader, `CALL JobsLeader_Acquire(?,?,?)`, name, holder, lease))
+		},
+	)
+	return
+}
+
+// GetLeader returns the current Leader for the passed name or nil if there is none
+func GetLeader(rlog log.Ext1FieldLogger, tx *sqlx.Tx, name string) (leader *Leader, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var l Leader
+			found, err := db.ParseError(tx.Get(&l, `CALL JobsLeader_Get(?)`, name))
+			if found {
+				leader = &l
+			}
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// GetStatistics returns the TypeStatistics for all job types
+func GetStatistics(rlog log.Ext1FieldLogger, tx *sqlx.Tx) (stats []TypeStatistics, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&stats, `CALL Jobs_GetStatistics()`))
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// GetRecent returns the limit most recent jobs
+func GetRecent(rlog log.Ext1FieldLogger, tx *sqlx.Tx, limit int) (jobs []Job, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&jobs, `CALL Jobs_GetRecent(?)`, limit))
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// GetRecurring returns the RecurringJobs
+func GetRecurring(rlog log.Ext1FieldLogger, tx *sqlx.Tx) (jobs []RecurringJob, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&jobs, `CALL Jobs_GetRecurring()`))
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
@@ -35,6 +35,8 @@ type MytokenEntry struct {
 	IP                     string `db:"ip_created"`
 	networkData            api.ClientMetaData
 	expiresAt              unixtime.UnixTime
+	// AuthContext is recorded in the creation event of the mytoken
+	AuthContext string `db:"-"`
 }
 
 // InitRefreshToken links a refresh token to this MytokenEntry
@@ -115,6 +117,9 @@ func (mte *MytokenEntry) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx, comment st
 
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
+			if err = mte.checkQuotas(rlog, tx); err != nil {
+				return err
+			}
 			if mte.rtID == nil {
 				if _, err = tx.Exec(`CALL CryptStoreRT_Insert(?,@ID)`, mte.rtEncrypted); err != nil {
 					return errors.WithStack(err)
@@ -129,6 +134,11 @@ func (mte *MytokenEntry) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx, comment st
 			if err = steStore.Store(rlog, tx); err != nil {
 				return err
 			}
+			if !mte.Token.SubtokenLimits.Unlimited() {
+				if err = helper.SetSubtokenLimits(rlog, tx, mte.ID, mte.Token.SubtokenLimits); err != nil {
+					return err
+				}
+			}
 			if err = storeEncryptionKey(tx, mte.encryptionKeyEncrypted, steStore.RefreshTokenID, mte.ID); err != nil {
 				return err
 			}
@@ -137,6 +147,7 @@ func (mte *MytokenEntry) Store(rlog log.Ext1FieldLogger, tx *sqlx.Tx, comment st
 					Event:          api.EventMTCreated,
 					Comment:        comment,
 					MTID:           mte.ID,
+					AuthContext:    mte.AuthContext,
 					ClientMetaData: mte.networkData,
 				},
 			)
@@ -1,6 +1,8 @@
 package mytokenrepohelper
 
 import (
+	"encoding/json"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/pkg/errors"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/encryptionkeyrepo"
+	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/utils/hashutils"
 )
@@ -117,6 +120,30 @@ type MytokenDBMetadata struct {
 	Restrictions db.NullString
 }
 
+// SetSubtokenLimits stores the SubtokenLimits of a mytoken; they are part of the mytoken itself, but are also needed
+// when the mytoken is not at hand, e.g. when creating the successor of a renewed subtoken
+func SetSubtokenLimits(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id mtid.MTID, limits model.SubtokenLimits) error {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL MTokens_SetSubtokenLimits(?,?)`, id, string(data))
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// ParseSubtokenLimits parses the SubtokenLimits of a mytoken as stored by SetSubtokenLimits
+func ParseSubtokenLimits(data db.NullString) (limits model.SubtokenLimits, err error) {
+	if !data.Valid || data.String == "" {
+		return
+	}
+	err = errors.WithStack(json.Unmarshal([]byte(data.String), &limits))
+	return
+}
+
 // SetMetadata adds a mytoken's metadata (capabilities, rotation,
 // restrictions) to the database. This is needed for legacy mytokens where the metadata was not yet stored on
 // creation. token version <0.7
@@ -255,3 +282,49 @@ func CheckMytokensAreForSameUser(rlog log.Ext1FieldLogger, tx *sqlx.Tx, a, b int
 	)
 	return
 }
+
+// CountChildren returns the number of active direct subtokens of a mytoken; the mytoken's row is locked until the end
+// of the transaction
+func CountChildren(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id mtid.MTID) (count uint64, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&count, `CALL MTokens_CountChildren(?)`, id))
+		},
+	)
+	return
+}
+
+func setSuspended(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id any, recursive, suspended bool) error {
+	proc := `CALL MTokens_SetSuspended(?,?)`
+	if recursive {
+		proc = `CALL MTokens_SetSuspendedRec(?,?)`
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(proc, id, suspended)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// SuspendMT suspends the passed mytoken and depending on the recursive parameter also its children; a suspended
+// mytoken cannot be used until it is resumed
+func SuspendMT(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id any, recursive bool) error {
+	return setSuspended(rlog, tx, id, recursive, true)
+}
+
+// ResumeMT resumes the passed suspended mytoken and depending on the recursive parameter also its children
+func ResumeMT(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id any, recursive bool) error {
+	return setSuspended(rlog, tx, id, recursive, false)
+}
+
+// CheckTokenSuspended checks if a mytoken is suspended
+func CheckTokenSuspended(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id mtid.MTID) (suspended bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(errors.WithStack(tx.Get(&suspended, `CALL MTokens_IsSuspended(?)`, id)))
+			return err
+		},
+	)
+	return
+}
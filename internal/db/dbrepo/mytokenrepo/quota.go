@@ -0,0 +1,92 @@
+package mytokenrepo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/oidc/provider"
+)
+
+// QuotaExceededError is returned if storing a mytoken would exceed one of the configured quotas
+type QuotaExceededError struct {
+	Quota string
+	Limit int
+}
+
+// Error implements the error interface
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota '%s' exceeded: limit is %d", e.Quota, e.Limit)
+}
+
+// QuotaExceededErrorResponse returns an error response if the passed error is caused by a QuotaExceededError
+func QuotaExceededErrorResponse(err error) (*model.Response, bool) {
+	var quotaErr QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return nil, false
+	}
+	return &model.Response{
+		Status: fiber.StatusForbidden,
+		Response: model.QuotaExceededError(
+			fmt.Sprintf(
+				"the mytoken cannot be created, because this would exceed the '%s' quota of %d", quotaErr.Quota,
+				quotaErr.Limit,
+			),
+		),
+	}, true
+}
+
+type quotaUsage struct {
+	Entitlements   db.NullString `db:"entitlements"`
+	ActiveMytokens int           `db:"active_mytokens"`
+	Depth          int           `db:"depth"`
+	Siblings       int           `db:"siblings"`
+}
+
+// checkQuotas checks that storing this MytokenEntry does not exceed the quotas configured for the user; the user row is
+// locked until the end of the transaction, so concurrent requests cannot exceed the quotas
+func (mte *MytokenEntry) checkQuotas(rlog log.Ext1FieldLogger, tx *sqlx.Tx) error {
+	quotas := provider.GetQuotasByIssuer(mte.Token.OIDCIssuer)
+	if quotas.Unlimited() && len(quotas.Entitlements) == 0 {
+		return nil
+	}
+	var usage quotaUsage
+	if err := errors.WithStack(
+		tx.Get(
+			&usage, `CALL MTokens_GetQuotaUsage(?,?,?)`, mte.Token.OIDCSubject, mte.Token.OIDCIssuer, mte.ParentID,
+		),
+	); err != nil {
+		return err
+	}
+	var entitlements []string
+	if usage.Entitlements.Valid && usage.Entitlements.String != "" {
+		if err := json.Unmarshal([]byte(usage.Entitlements.String), &entitlements); err != nil {
+			rlog.WithError(err).Error("could not unmarshal stored user entitlements")
+		}
+	}
+	quota := quotas.ForEntitlements(entitlements)
+	rlog.WithField("quota", fmt.Sprintf("%+v", quota)).WithField(
+		"usage", fmt.Sprintf("%+v", usage),
+	).Trace("Checking mytoken quotas")
+	if quota.MaxActiveMytokens > 0 && usage.ActiveMytokens >= quota.MaxActiveMytokens {
+		return errors.WithStack(QuotaExceededError{Quota: "max_active_mytokens", Limit: quota.MaxActiveMytokens})
+	}
+	if quota.MaxTreeDepth > 0 && usage.Depth > quota.MaxTreeDepth {
+		return errors.WithStack(QuotaExceededError{Quota: "max_tree_depth", Limit: quota.MaxTreeDepth})
+	}
+	if !mte.Root() && quota.MaxSubtokensPerParent > 0 && usage.Siblings >= quota.MaxSubtokensPerParent {
+		return errors.WithStack(
+			QuotaExceededError{
+				Quota: "max_subtokens_per_parent",
+				Limit: quota.MaxSubtokensPerParent,
+			},
+		)
+	}
+	return nil
+}
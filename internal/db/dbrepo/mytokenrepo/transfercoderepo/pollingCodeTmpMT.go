@@ -13,6 +13,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/shorttokenrepo"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/model/sshkey"
 	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
 	"github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
@@ -20,12 +21,15 @@ import (
 
 // TransferCodeStatus holds information about the status of a polling code
 type TransferCodeStatus struct {
-	Found             bool               `db:"found"`
-	Expired           bool               `db:"expired"`
-	ResponseType      model.ResponseType `db:"response_type"`
-	ConsentDeclined   db.BitBool         `db:"consent_declined"`
-	MaxTokenLen       *int               `db:"max_token_len"`
-	SSHKeyFingerprint db.NullString      `db:"ssh_key_fp"`
+	Found              bool                `db:"found"`
+	Expired            bool                `db:"expired"`
+	ResponseType       model.ResponseType  `db:"response_type"`
+	ConsentDeclined    db.BitBool          `db:"consent_declined"`
+	MaxTokenLen        *int                `db:"max_token_len"`
+	SSHKeyFingerprint  db.NullString       `db:"ssh_key_fp"`
+	SSHKeyCA           bool                `db:"ssh_key_ca"`
+	SSHPrincipals      db.NullString       `db:"ssh_principals"`
+	SSHKeyRestrictions sshkey.Restrictions `db:"ssh_key_restrictions"`
 }
 
 // CheckTransferCode checks the passed polling code in the database
@@ -34,7 +38,7 @@ func CheckTransferCode(rlog log.Ext1FieldLogger, tx *sqlx.Tx, pollingCode string
 	var p TransferCodeStatus
 	err := db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			if err := tx.Get(&p, `CALL TransferCodes_GetStatus(?)`, pt.ID()); err != nil {
+			if err := tx.Get(&p, `CALL TransferCodes_GetStatus_v2(?)`, pt.ID()); err != nil {
 				if errors.Is(err, sql.ErrNoRows) {
 					err = nil  // polling code was not found, but this is fine
 					return err // p.Found is false
@@ -88,12 +92,20 @@ func LinkPollingCodeToMT(rlog log.Ext1FieldLogger, tx *sqlx.Tx, pollingCode, jwt
 	return pc.Update(rlog, tx)
 }
 
-// LinkPollingCodeToSSHKey links a pollingCode to an ssh public key
-func LinkPollingCodeToSSHKey(rlog log.Ext1FieldLogger, tx *sqlx.Tx, pollingCode, sshKeyHash string) error {
+// LinkPollingCodeToSSHKey links a pollingCode to an ssh public key; if ca is true the ssh key is a certificate
+// authority and principals are the principals accepted from certificates signed by it; keyRestrictions restrict the
+// usage of the ssh key
+func LinkPollingCodeToSSHKey(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, pollingCode, sshKeyHash string, ca bool, principals db.NullString,
+	keyRestrictions sshkey.Restrictions,
+) error {
 	pc := shorttokenrepo.CreateProxyToken(pollingCode)
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			_, err := tx.Exec(`CALL TransferCodeAttributes_UpdateSSHKey(?,?)`, pc.ID(), sshKeyHash)
+			_, err := tx.Exec(
+				`CALL TransferCodeAttributes_UpdateSSHKey_v2(?,?,?,?,?)`, pc.ID(), sshKeyHash, ca, principals,
+				keyRestrictions,
+			)
 			return errors.WithStack(err)
 		},
 	)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
 )
 
 // MytokenEntry holds the information of a MytokenEntry as stored in the
@@ -22,6 +23,16 @@ type MytokenEntry struct {
 	CreatedAt        unixtime.UnixTime `db:"created" json:"created"`
 	ExpiresAt        unixtime.UnixTime `db:"expires_at" json:"expires_at,omitempty"`
 	MOMID            string            `db:"mom_id" json:"mom_id"`
+	Suspended        bool              `db:"suspended" json:"suspended,omitempty"`
+	Details          *MytokenDetails   `db:"-" json:"details,omitempty"`
+}
+
+// MytokenDetails holds additional information about a mytoken, that is only included in a MytokenEntry if requested
+type MytokenDetails struct {
+	Capabilities api.Capabilities               `json:"capabilities,omitempty"`
+	Rotation     *api.Rotation                  `json:"rotation,omitempty"`
+	Restrictions []restrictions.UsedRestriction `json:"restrictions,omitempty"`
+	LastUsed     unixtime.UnixTime              `json:"last_used,omitempty"`
 }
 
 // MytokenEntryTree is a tree of MytokenEntry
@@ -51,7 +62,7 @@ func AllTokens(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID) ([]*Myt
 	var tokens []*MytokenEntry
 	if err := db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetAllForSameUser(?)`, tokenID))
+			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetAllForSameUser_v2(?)`, tokenID))
 		},
 	); err != nil {
 		return nil, err
@@ -59,11 +70,94 @@ func AllTokens(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID) ([]*Myt
 	return tokensToTrees(tokens), nil
 }
 
+type mytokenDetailsEntry struct {
+	ID           mtid.MTID                 `db:"id"`
+	Capabilities api.Capabilities          `db:"capabilities"`
+	Rotation     *api.Rotation             `db:"rotation"`
+	Restrictions restrictions.Restrictions `db:"restrictions"`
+	LastUsed     unixtime.UnixTime         `db:"last_used"`
+}
+
+// AddDetails adds the MytokenDetails to all entries of the passed trees; the trees must hold the mytokens of the
+// user linked to the passed mytoken, as returned by AllTokens
+func AddDetails(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID, trees []*MytokenEntryTree) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var entries []mytokenDetailsEntry
+			if err := errors.WithStack(
+				tx.Select(&entries, `CALL MTokens_GetDetailsForSameUser(?)`, tokenID),
+			); err != nil {
+				return err
+			}
+			var usageCounts []restrictions.UsageCount
+			if err := errors.WithStack(
+				tx.Select(&usageCounts, `CALL TokenUsages_GetForSameUser(?)`, tokenID),
+			); err != nil {
+				return err
+			}
+			usages := groupUsageCounts(usageCounts)
+			details := make(map[string]*MytokenDetails, len(entries))
+			for _, e := range entries {
+				usedRestrictions, err := e.Restrictions.ToUsedRestrictionsFromUsageCounts(usages[e.ID.Hash()])
+				if err != nil {
+					return err
+				}
+				details[e.ID.Hash()] = &MytokenDetails{
+					Capabilities: e.Capabilities,
+					Rotation:     e.Rotation,
+					Restrictions: usedRestrictions,
+					LastUsed:     e.LastUsed,
+				}
+			}
+			addDetailsToTrees(trees, details)
+			return nil
+		},
+	)
+}
+
+// groupUsageCounts groups restriction usage counts by the mytoken and then by the restriction they belong to
+func groupUsageCounts(usageCounts []restrictions.UsageCount) map[string]map[string]restrictions.UsageCount {
+	usages := make(map[string]map[string]restrictions.UsageCount)
+	for _, u := range usageCounts {
+		if usages[u.MTID] == nil {
+			usages[u.MTID] = make(map[string]restrictions.UsageCount)
+		}
+		usages[u.MTID][u.RestrictionHash] = u
+	}
+	return usages
+}
+
+func addDetailsToTrees(trees []*MytokenEntryTree, details map[string]*MytokenDetails) {
+	for _, t := range trees {
+		t.Token.Details = details[t.Token.ID.Hash()]
+		addDetailsToTrees(t.Children, details)
+	}
+}
+
+// MytokenEntryWithCapabilities extends a MytokenEntry with the mytoken's capabilities
+type MytokenEntryWithCapabilities struct {
+	MytokenEntry `json:",inline"`
+	Capabilities api.Capabilities `db:"capabilities" json:"-"`
+}
+
+// AllTokensWithCapabilities returns a flat list with information about all mytokens (including their capabilities)
+// for the user linked to the passed mytoken
+func AllTokensWithCapabilities(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID) (
+	tokens []*MytokenEntryWithCapabilities, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetAllForSameUserWithCapabilities(?)`, tokenID))
+		},
+	)
+	return
+}
+
 // AllTokensByUID returns information about all mytokens for a user
 func AllTokensByUID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, uid uint64) (tokens []*MytokenEntry, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetForUser(?)`, uid))
+			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetForUser_v2(?)`, uid))
 		},
 	)
 	return
@@ -74,7 +168,7 @@ func TokenSubTree(rlog log.Ext1FieldLogger, tx *sqlx.Tx, tokenID mtid.MTID) (Myt
 	var tokens []*MytokenEntry
 	if err := db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetSubtokens(?)`, tokenID))
+			return errors.WithStack(tx.Select(&tokens, `CALL MTokens_GetSubtokens_v2(?)`, tokenID))
 		},
 	); err != nil {
 		return MytokenEntryTree{}, err
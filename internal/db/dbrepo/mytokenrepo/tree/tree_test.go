@@ -0,0 +1,114 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
+)
+
+func newTestEntry(t *testing.T) *MytokenEntry {
+	id, err := mtid.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &MytokenEntry{ID: id}
+}
+
+func TestGroupUsageCounts(t *testing.T) {
+	one := int64(1)
+	two := int64(2)
+	usageCounts := []restrictions.UsageCount{
+		{MTID: "a", RestrictionHash: "r1", UsagesAT: &one},
+		{MTID: "a", RestrictionHash: "r2", UsagesOther: &two},
+		{MTID: "b", RestrictionHash: "r1", UsagesAT: &two},
+	}
+	usages := groupUsageCounts(usageCounts)
+	tests := []struct {
+		name        string
+		mtID        string
+		restriction string
+		found       bool
+		usagesAT    *int64
+		usagesOther *int64
+	}{
+		{name: "first mytoken first restriction", mtID: "a", restriction: "r1", found: true, usagesAT: &one},
+		{name: "first mytoken second restriction", mtID: "a", restriction: "r2", found: true, usagesOther: &two},
+		{name: "second mytoken", mtID: "b", restriction: "r1", found: true, usagesAT: &two},
+		{name: "restriction of other mytoken", mtID: "b", restriction: "r2", found: false},
+		{name: "unknown mytoken", mtID: "c", restriction: "r1", found: false},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				u, found := usages[test.mtID][test.restriction]
+				if found != test.found {
+					t.Fatalf("expected found %v, got %v", test.found, found)
+				}
+				if !found {
+					return
+				}
+				if u.UsagesAT != test.usagesAT {
+					t.Errorf("expected AT usages %v, got %v", test.usagesAT, u.UsagesAT)
+				}
+				if u.UsagesOther != test.usagesOther {
+					t.Errorf("expected other usages %v, got %v", test.usagesOther, u.UsagesOther)
+				}
+			},
+		)
+	}
+	if len(usages) != 2 {
+		t.Errorf("expected usages for 2 mytokens, got %d", len(usages))
+	}
+}
+
+func TestAddDetailsToTrees(t *testing.T) {
+	root := newTestEntry(t)
+	child := newTestEntry(t)
+	grandchild := newTestEntry(t)
+	otherRoot := newTestEntry(t)
+	withoutDetails := newTestEntry(t)
+	trees := []*MytokenEntryTree{
+		{
+			Token: root,
+			Children: []*MytokenEntryTree{
+				{
+					Token:    child,
+					Children: []*MytokenEntryTree{{Token: grandchild}},
+				},
+			},
+		},
+		{
+			Token:    otherRoot,
+			Children: []*MytokenEntryTree{{Token: withoutDetails}},
+		},
+	}
+	details := map[string]*MytokenDetails{
+		root.ID.Hash():       {Capabilities: api.Capabilities{api.CapabilityAT}},
+		child.ID.Hash():      {LastUsed: 1},
+		grandchild.ID.Hash(): {LastUsed: 2},
+		otherRoot.ID.Hash():  {LastUsed: 3},
+	}
+	addDetailsToTrees(trees, details)
+	tests := []struct {
+		name  string
+		entry *MytokenEntry
+	}{
+		{name: "root", entry: root},
+		{name: "child", entry: child},
+		{name: "grandchild", entry: grandchild},
+		{name: "other root", entry: otherRoot},
+		{name: "without details", entry: withoutDetails},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if expected := details[test.entry.ID.Hash()]; test.entry.Details != expected {
+					t.Errorf("expected details %+v, got %+v", expected, test.entry.Details)
+				}
+			},
+		)
+	}
+}
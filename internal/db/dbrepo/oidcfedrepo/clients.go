@@ -0,0 +1,46 @@
+package oidcfedrepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+)
+
+// ClientRegistration holds the client credentials obtained from an OP through explicit registration
+type ClientRegistration struct {
+	ClientID  string       `db:"client_id"`
+	ExpiresAt sql.NullTime `db:"expires_at"`
+}
+
+// GetClientRegistration returns the non-expired ClientRegistration for the passed issuer; if there is none, nil is
+// returned
+func GetClientRegistration(rlog log.Ext1FieldLogger, tx *sqlx.Tx, issuer string) (*ClientRegistration, error) {
+	var reg ClientRegistration
+	if err := db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&reg, `CALL OIDCFedClients_Get(?)`, issuer))
+		},
+	); err != nil {
+		_, err = db.ParseError(err) // if no rows found, that's not an error, but there is no registration
+		return nil, err
+	}
+	return &reg, nil
+}
+
+// StoreClientRegistration stores the client credentials obtained from the OP with the passed issuer; an existing
+// registration is replaced
+func StoreClientRegistration(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, issuer, clientID string, expiresAt time.Time,
+) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL OIDCFedClients_Set(?,?,?)`, issuer, clientID, db.NewNullTime(expiresAt))
+			return errors.WithStack(err)
+		},
+	)
+}
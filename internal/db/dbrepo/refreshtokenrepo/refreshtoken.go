@@ -28,3 +28,25 @@ func GetRTID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myID mtid.MTID) (rtID uint64
 	)
 	return
 }
+
+// SetClientID stores the id of the client that was used to obtain the refresh token with the passed id
+func SetClientID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, rtID uint64, clientID string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL RTClients_Set(?,?)`, rtID, clientID)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// GetClientID returns the id of the client that was used to obtain the refresh token with the passed id; if no
+// client is stored for the refresh token, an empty string is returned
+func GetClientID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, rtID uint64) (clientID string, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := db.ParseError(errors.WithStack(tx.Get(&clientID, `CALL RTClients_Get(?)`, rtID)))
+			return err
+		},
+	)
+	return
+}
@@ -0,0 +1,136 @@
+package renewalrepo
+
+import (
+	"database/sql"
+	"encoding/base64"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/encryptionkeyrepo"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+)
+
+// Channels through which a service learns about an approved renewal
+const (
+	ChannelPolling = "polling"
+	ChannelWebhook = "webhook"
+)
+
+// RenewalInfo holds the information about a requested renewal of a mytoken
+type RenewalInfo struct {
+	MTID       mtid.MTID         `db:"MT_id"`
+	Channel    string            `db:"channel"`
+	WebhookURL db.NullString     `db:"webhook_url"`
+	Approved   sql.NullTime      `db:"approved"`
+	Created    unixtime.UnixTime `db:"created"`
+	// Suspended and ParentSuspended indicate that the renewed mytoken or its parent is suspended
+	Suspended       bool `db:"suspended"`
+	ParentSuspended bool `db:"parent_suspended"`
+}
+
+// AnySuspended checks if the renewed mytoken or its parent is suspended; a suspended mytoken must not be renewed,
+// since the successor would not be suspended
+func (i RenewalInfo) AnySuspended() bool {
+	return i.Suspended || i.ParentSuspended
+}
+
+// Renewal holds a requested renewal together with everything needed to create the successor mytoken
+type Renewal struct {
+	RenewalInfo
+	EncryptionKey  encryptionkeyrepo.EncryptionKey `db:"encryption_key"`
+	AuthTime       unixtime.UnixTime               `db:"auth_time"`
+	ParentID       mtid.MTID                       `db:"parent_id"`
+	RTID           uint64                          `db:"rt_id"`
+	Name           db.NullString                   `db:"name"`
+	Capabilities   api.Capabilities                `db:"capabilities"`
+	Rotation       *api.Rotation                   `db:"rotation"`
+	Restrictions   restrictions.Restrictions       `db:"restrictions"`
+	TokenCreated   unixtime.UnixTime               `db:"token_created"`
+	Issuer         string                          `db:"iss"`
+	Subject        string                          `db:"sub"`
+	SubtokenLimits db.NullString                   `db:"subtoken_limits"`
+
+	// Capabilities, restrictions, and subtoken limits of the parent of the renewed mytoken, if it has one
+	ParentCapabilities   api.Capabilities          `db:"parent_capabilities"`
+	ParentRestrictions   restrictions.Restrictions `db:"parent_restrictions"`
+	ParentSubtokenLimits db.NullString             `db:"parent_subtoken_limits"`
+}
+
+// Register stores a renewal request for a mytoken; an existing request for the same mytoken is replaced. The
+// encryption key of the mytoken's refresh token is stored encrypted with the renewal code, so only the holder of the
+// code can create the successor; the code itself is only stored hashed.
+func Register(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, code string, key []byte, authTime unixtime.UnixTime,
+	channel, webhookURL string,
+) error {
+	encryptedKey, err := cryptutils.AES256Encrypt(base64.StdEncoding.EncodeToString(key), code)
+	if err != nil {
+		return err
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(
+				`CALL MytokenRenewals_Insert(?,?,?,?,?,?)`, mtID, hashutils.SHA3_512Str([]byte(code)), encryptedKey,
+				authTime, channel, db.NewNullString(webhookURL),
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// Get returns the RenewalInfo of the renewal requested for a mytoken
+func Get(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (info RenewalInfo, found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&info, `CALL MytokenRenewals_Get(?)`, mtID))
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// GetByCode returns the Renewal for a renewal code
+func GetByCode(rlog log.Ext1FieldLogger, tx *sqlx.Tx, code string) (r Renewal, found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(
+				tx.Get(&r, `CALL MytokenRenewals_GetByCode(?)`, hashutils.SHA3_512Str([]byte(code))),
+			)
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// Approve marks the renewal requested for a mytoken as approved; approved is false if there is no pending renewal
+func Approve(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (approved bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var rows int64
+			if err = errors.WithStack(tx.Get(&rows, `CALL MytokenRenewals_Approve(?)`, mtID)); err != nil {
+				return err
+			}
+			approved = rows > 0
+			return nil
+		},
+	)
+	return
+}
+
+// Delete deletes the renewal requested for a mytoken
+func Delete(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL MytokenRenewals_Delete(?)`, mtID)
+			return errors.WithStack(err)
+		},
+	)
+}
@@ -0,0 +1,67 @@
+package sshrepo
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+)
+
+// historyLimit is the maximum number of events returned per ssh key
+const historyLimit = 100
+
+// SSHKeyEvent describes a single usage of an ssh key
+type SSHKeyEvent struct {
+	RequestType string `json:"request_type"`
+	IP          string `json:"ip"`
+	UserAgent   string `json:"user_agent,omitempty"`
+	Time        int64  `json:"time"`
+}
+
+type sshKeyEventDB struct {
+	KeyFingerprint string        `db:"ssh_key_fp"`
+	RequestType    string        `db:"request_type"`
+	IP             string        `db:"ip"`
+	UserAgent      db.NullString `db:"user_agent"`
+	Time           time.Time     `db:"time"`
+}
+
+// LogEvent stores a usage of the ssh key with the passed key id
+func LogEvent(rlog log.Ext1FieldLogger, tx *sqlx.Tx, keyID, requestType, ip, userAgent string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				`CALL SSHKeyEvents_Insert(?,?,?,?)`, keyID, requestType, ip, db.NewNullString(userAgent),
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// getAllEvents returns the most recent events for all ssh keys of a user grouped by the ssh key fingerprint
+func getAllEvents(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID) (map[string][]SSHKeyEvent, error) {
+	var dbEvents []sshKeyEventDB
+	if err := db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Select(&dbEvents, `CALL SSHKeyEvents_GetAll(?,?)`, myid, historyLimit))
+		},
+	); err != nil {
+		return nil, err
+	}
+	events := make(map[string][]SSHKeyEvent)
+	for _, e := range dbEvents {
+		events[e.KeyFingerprint] = append(
+			events[e.KeyFingerprint], SSHKeyEvent{
+				RequestType: e.RequestType,
+				IP:          e.IP,
+				UserAgent:   e.UserAgent.String,
+				Time:        e.Time.Unix(),
+			},
+		)
+	}
+	return events, nil
+}
@@ -2,6 +2,7 @@ package sshrepo
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,6 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/model/sshkey"
 	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
@@ -20,37 +22,76 @@ import (
 func GetSSHInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, keyFP, userHash string) (info SSHInfo, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Get(&info, `CALL SSHInfo_Get(?,?)`, keyFP, userHash))
+			return errors.WithStack(tx.Get(&info, `CALL SSHInfo_Get_v2(?,?)`, keyFP, userHash))
 		},
 	)
 	return
 }
 
+// SSHKeyInfo extends api.SSHKeyInfo with information about trusted ssh certificate authorities, the restrictions of
+// the ssh key, and its usage history
+type SSHKeyInfo struct {
+	api.SSHKeyInfo
+	CA              bool                 `json:"ca,omitempty"`
+	Principals      []string             `json:"principals,omitempty"`
+	KeyRestrictions *sshkey.Restrictions `json:"key_restrictions,omitempty"`
+	History         []SSHKeyEvent        `json:"history,omitempty"`
+}
+
 // GetAllSSHInfo returns the SSHInfo for all ssh keys for a given user
-func GetAllSSHInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID) (info []api.SSHKeyInfo, err error) {
+func GetAllSSHInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID) (info []SSHKeyInfo, err error) {
 	var dbInfo []SSHInfo
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Select(&dbInfo, `CALL SSHInfo_GetAll(?)`, myid))
+			return errors.WithStack(tx.Select(&dbInfo, `CALL SSHInfo_GetAll_v2(?)`, myid))
 		},
 	)
 	if err != nil {
 		return
 	}
 	for _, i := range dbInfo {
-		apiI := api.SSHKeyInfo{
-			Name:              i.Name.String,
-			SSHKeyFingerprint: i.KeyFingerprint,
-			Created:           i.Created.Unix(),
+		apiI := SSHKeyInfo{
+			SSHKeyInfo: api.SSHKeyInfo{
+				Name:              i.Name.String,
+				SSHKeyFingerprint: i.KeyFingerprint,
+				Created:           i.Created.Unix(),
+			},
+			CA:         i.CA,
+			Principals: i.AllowedPrincipals(),
 		}
 		if i.LastUsed.Valid {
 			apiI.LastUsed = utils.NewInt64(i.LastUsed.Time.Unix())
 		}
+		if !i.KeyRestrictions.Empty() {
+			r := i.KeyRestrictions
+			apiI.KeyRestrictions = &r
+		}
 		info = append(info, apiI)
 	}
 	return
 }
 
+// GetAllSSHInfoWithHistory returns the SSHInfo including the usage history for all ssh keys for a given user
+func GetAllSSHInfoWithHistory(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID) (info []SSHKeyInfo, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			info, err = GetAllSSHInfo(rlog, tx, myid)
+			if err != nil {
+				return err
+			}
+			history, err := getAllEvents(rlog, tx, myid)
+			if err != nil {
+				return err
+			}
+			for i, k := range info {
+				info[i].History = history[k.SSHKeyFingerprint]
+			}
+			return nil
+		},
+	)
+	return
+}
+
 // SSHInfo is a type holding the information stored in the database related to an ssh key
 type SSHInfo struct {
 	KeyID          string        `db:"key_id"`
@@ -61,6 +102,29 @@ type SSHInfo struct {
 	LastUsed       sql.NullTime  `db:"last_used"`
 	Enabled        db.BitBool    `db:"enabled"`
 	EncryptedMT    string        `db:"MT_crypt"`
+	CA             bool          `db:"ca"`
+	Principals     db.NullString `db:"principals"`
+	// KeyRestrictions restrict the usage of this ssh key
+	KeyRestrictions sshkey.Restrictions `db:"key_restrictions"`
+}
+
+// AllowedPrincipals returns the principals that are accepted in certificates signed by this ssh key if it is a
+// certificate authority; if no principals are returned, a certificate must be valid for the ssh user
+func (i SSHInfo) AllowedPrincipals() []string {
+	return SplitPrincipals(i.Principals)
+}
+
+// SplitPrincipals splits principals as they are stored in the database
+func SplitPrincipals(principals db.NullString) []string {
+	if !principals.Valid || principals.String == "" {
+		return nil
+	}
+	return strings.Split(principals.String, ",")
+}
+
+// JoinPrincipals joins principals so they can be stored in the database
+func JoinPrincipals(principals []string) db.NullString {
+	return db.NewNullString(strings.Join(principals, ","))
 }
 
 // Decrypt decrypts the encrypted mytoken linked to this ssh key with the passed password
@@ -89,6 +153,10 @@ type SSHInfoIn struct {
 	KeyFingerprint string        `db:"ssh_key_fp"`
 	UserHash       string        `db:"ssh_user_hash"`
 	EncryptedMT    string        `db:"MT_crypt"`
+	CA             bool          `db:"ca"`
+	Principals     db.NullString `db:"principals"`
+	// KeyRestrictions restrict the usage of this ssh key
+	KeyRestrictions sshkey.Restrictions `db:"key_restrictions"`
 }
 
 // Insert inserts an ssh public key for the given user (given by the mytoken) into the database
@@ -96,8 +164,9 @@ func Insert(rlog log.Ext1FieldLogger, tx *sqlx.Tx, data SSHInfoIn) error {
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
 			_, err := tx.Exec(
-				`CALL SSHInfo_Insert(?,?,?,?,?)`,
-				data.MTID, data.KeyFingerprint, data.UserHash, data.Name, data.EncryptedMT,
+				`CALL SSHInfo_Insert_v2(?,?,?,?,?,?,?,?)`,
+				data.MTID, data.KeyFingerprint, data.UserHash, data.Name, data.EncryptedMT, data.CA, data.Principals,
+				data.KeyRestrictions,
 			)
 			return errors.WithStack(err)
 		},
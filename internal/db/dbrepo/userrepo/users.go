@@ -1,6 +1,8 @@
 package userrepo
 
 import (
+	"encoding/json"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
@@ -10,6 +12,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 )
 
 // MailInfo holds information about a user's mail settings
@@ -17,13 +20,29 @@ type MailInfo struct {
 	Mail           db.NullString `db:"email"`
 	MailVerified   bool          `db:"email_verified"`
 	PreferHTMLMail bool          `db:"prefer_html_mail"`
+	Language       db.NullString `db:"language"`
+}
+
+// Lang returns the supported language that should be used for mails to the user
+func (i MailInfo) Lang() string {
+	return i18n.Match(i.Language.String)
 }
 
 // GetMail returns the mail address and verification status for a user linked to a mytoken
 func GetMail(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (data MailInfo, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Get(&data, `CALL Users_GetMail(?)`, mtID))
+			return errors.WithStack(tx.Get(&data, `CALL Users_GetMail_v2(?)`, mtID))
+		},
+	)
+	return
+}
+
+// GetMailForUser returns the mail address and verification status for a user
+func GetMailForUser(rlog log.Ext1FieldLogger, tx *sqlx.Tx, uid uint64) (data MailInfo, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&data, `CALL Users_GetMailForUID(?)`, uid))
 		},
 	)
 	return
@@ -80,6 +99,16 @@ func ChangePreferredMailType(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MT
 	)
 }
 
+// SetLanguage sets the user's preferred language
+func SetLanguage(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, language string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Users_SetLanguage(?,?)`, mtID, db.NewNullString(language))
+			return errors.WithStack(err)
+		},
+	)
+}
+
 // SetEmail sets a user's email address
 func SetEmail(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, mail string, mailVerified bool) error {
 	return db.RunWithinTransaction(
@@ -89,3 +118,17 @@ func SetEmail(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, mail string
 		},
 	)
 }
+
+// SetEntitlements stores a user's entitlements as obtained from the OpenID provider
+func SetEntitlements(rlog log.Ext1FieldLogger, tx *sqlx.Tx, sub, iss string, entitlements []string) error {
+	data, err := json.Marshal(entitlements)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL Users_SetEntitlements(?,?,?)`, sub, iss, string(data))
+			return errors.WithStack(err)
+		},
+	)
+}
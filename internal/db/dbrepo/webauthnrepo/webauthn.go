@@ -0,0 +1,191 @@
+package webauthnrepo
+
+import (
+	"encoding/base64"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+)
+
+// Purposes of WebAuthn challenges
+const (
+	PurposeRegister = "register"
+	PurposeStepUp   = "step_up"
+)
+
+// Credential is a WebAuthn credential (passkey) registered for a user
+type Credential struct {
+	ID           uint64            `db:"id" json:"id"`
+	UserID       uint64            `db:"user_id" json:"-"`
+	CredentialID string            `db:"credential_id" json:"credential_id"`
+	PublicKey    string            `db:"public_key" json:"-"`
+	SignCount    uint32            `db:"sign_count" json:"-"`
+	Name         db.NullString     `db:"name" json:"name,omitempty"`
+	Created      unixtime.UnixTime `db:"created" json:"created"`
+	LastUsed     unixtime.UnixTime `db:"last_used" json:"last_used,omitempty"`
+}
+
+// PublicKeyBytes returns the COSE encoded public key of the Credential
+func (c Credential) PublicKeyBytes() ([]byte, error) {
+	pk, err := base64.StdEncoding.DecodeString(c.PublicKey)
+	return pk, errors.WithStack(err)
+}
+
+// ChallengeBinding holds what a WebAuthn challenge was issued for; either a mytoken or an authorization flow
+type ChallengeBinding struct {
+	MTID  mtid.MTID    `db:"MT_id"`
+	State *state.State `db:"state_h"`
+}
+
+// InsertCredential stores a new Credential for the user of the passed mytoken
+func InsertCredential(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, credentialID string, publicKey []byte, signCount uint32,
+	name string,
+) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				`CALL WebAuthnCredentials_Insert(?,?,?,?,?)`, mtID, credentialID,
+				base64.StdEncoding.EncodeToString(publicKey), signCount, db.NewNullString(name),
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// GetCredentials returns all Credential registered for the user of the passed mytoken
+func GetCredentials(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (creds []Credential, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Select(&creds, `CALL WebAuthnCredentials_GetForMT(?)`, mtID))
+		},
+	)
+	return
+}
+
+// GetCredential returns the Credential with the passed credential id; if there is no such credential found is false
+func GetCredential(rlog log.Ext1FieldLogger, tx *sqlx.Tx, credentialID string) (
+	cred Credential, found bool, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&cred, `CALL WebAuthnCredentials_Get(?)`, credentialID))
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// UserCredentialsInfo holds the user id and the number of registered credentials of a user
+type UserCredentialsInfo struct {
+	UserID      uint64 `db:"uid"`
+	Credentials int    `db:"credentials"`
+}
+
+// GetUserCredentialsInfo returns the UserCredentialsInfo for the user identified by subject and issuer; for unknown
+// users an empty UserCredentialsInfo is returned
+func GetUserCredentialsInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, sub, iss string) (
+	info UserCredentialsInfo, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&info, `CALL WebAuthnCredentials_CountForUser(?,?)`, sub, iss))
+		},
+	)
+	_, err = db.ParseError(err)
+	return
+}
+
+// CredentialUsed updates the signature counter and last usage of a Credential
+func CredentialUsed(rlog log.Ext1FieldLogger, tx *sqlx.Tx, credentialID string, signCount uint32) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL WebAuthnCredentials_Used(?,?)`, credentialID, signCount)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// DeleteCredential deletes the Credential with the passed id if it belongs to the user of the passed mytoken; if
+// there is no such credential found is false
+func DeleteCredential(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, id uint64) (found bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var count int64
+			if err := errors.WithStack(tx.Get(&count, `CALL WebAuthnCredentials_Delete(?,?)`, mtID, id)); err != nil {
+				return err
+			}
+			found = count > 0
+			return nil
+		},
+	)
+	return
+}
+
+// InsertChallenge stores a WebAuthn challenge that is bound to either a mytoken or an authorization flow
+func InsertChallenge(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, challenge, purpose string, mtID *mtid.MTID, oState *state.State,
+	expiresIn int64,
+) error {
+	var mtIDValue any
+	if mtID != nil {
+		mtIDValue = *mtID
+	}
+	var stateValue any
+	if oState != nil {
+		stateValue = oState
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				`CALL WebAuthnChallenges_Insert(?,?,?,?,?)`, challenge, purpose, mtIDValue, stateValue, expiresIn,
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// PopChallenge returns the ChallengeBinding of a valid challenge and deletes the challenge so that it cannot be used
+// again; if there is no valid challenge found is false
+func PopChallenge(rlog log.Ext1FieldLogger, tx *sqlx.Tx, challenge, purpose string) (
+	binding ChallengeBinding, found bool, err error,
+) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&binding, `CALL WebAuthnChallenges_Pop(?,?)`, challenge, purpose))
+		},
+	)
+	found, err = db.ParseError(err)
+	return
+}
+
+// InsertStepUp records a successful step-up for the passed mytoken that is valid for lifetime seconds
+func InsertStepUp(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, lifetime int64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL WebAuthnStepUps_Insert(?,?)`, mtID, lifetime)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// HasValidStepUp checks if there is a valid step-up for the passed mytoken
+func HasValidStepUp(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (valid bool, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var count int
+			if err := errors.WithStack(tx.Get(&count, `CALL WebAuthnStepUps_Check(?)`, mtID)); err != nil {
+				return err
+			}
+			valid = count > 0
+			return nil
+		},
+	)
+	return
+}
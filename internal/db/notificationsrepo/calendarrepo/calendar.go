@@ -17,6 +17,16 @@ type CalendarInfo struct {
 	Name    string `db:"name" json:"name"`
 	ICSPath string `db:"ics_path" json:"ics_path"`
 	ICS     string `db:"ics" json:"-"`
+	// SyncToken is only set by GetByID
+	SyncToken uint64 `db:"sync_token" json:"-"`
+}
+
+// Resource is a type holding the sync state of a single CalDAV resource, i.e. the event for one mytoken, of a calendar
+type Resource struct {
+	Name      string `db:"resource"`
+	ETag      string `db:"etag"`
+	SyncToken uint64 `db:"sync_token"`
+	Deleted   bool   `db:"deleted"`
 }
 
 // Insert inserts a calendar for the given user (given by the mytoken) into the database
@@ -83,7 +93,17 @@ func Get(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID any, name string) (info Cal
 func GetByID(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id string) (info CalendarInfo, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return errors.WithStack(tx.Get(&info, `CALL Calendar_GetByID(?)`, id))
+			return errors.WithStack(tx.Get(&info, `CALL Calendar_GetByID_v2(?)`, id))
+		},
+	)
+	return
+}
+
+// GetByIDForUpdate is like GetByID, but locks the calendar until the transaction ends
+func GetByIDForUpdate(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id string) (info CalendarInfo, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Get(&info, `CALL Calendar_GetByIDForUpdate(?)`, id))
 		},
 	)
 	return
@@ -179,3 +199,45 @@ func AddMytokenToCalendar(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID,
 		},
 	)
 }
+
+// GetResources returns the sync state of all CalDAV resources of a calendar, including deleted ones
+func GetResources(rlog log.Ext1FieldLogger, tx *sqlx.Tx, calendarID string) (resources []Resource, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return errors.WithStack(tx.Select(&resources, `CALL CalendarResources_Get(?)`, calendarID))
+		},
+	)
+	return
+}
+
+// SetResource stores that a CalDAV resource of a calendar was added or changed with the passed sync token
+func SetResource(rlog log.Ext1FieldLogger, tx *sqlx.Tx, calendarID string, resource Resource) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(
+				`CALL CalendarResources_Set(?,?,?,?)`, calendarID, resource.Name, resource.ETag, resource.SyncToken,
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// DeleteResource stores that a CalDAV resource of a calendar was deleted with the passed sync token
+func DeleteResource(rlog log.Ext1FieldLogger, tx *sqlx.Tx, calendarID, resource string, syncToken uint64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL CalendarResources_Delete(?,?,?)`, calendarID, resource, syncToken)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// SetSyncToken updates the sync token of a calendar
+func SetSyncToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, calendarID string, syncToken uint64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Calendar_SetSyncToken(?,?)`, calendarID, syncToken)
+			return errors.WithStack(err)
+		},
+	)
+}
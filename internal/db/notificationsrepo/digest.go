@@ -0,0 +1,99 @@
+package notificationsrepo
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+)
+
+// Possible digest settings of a notification
+const (
+	DigestImmediate = "immediate"
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+)
+
+// Digests holds all valid digest settings
+var Digests = []string{DigestImmediate, DigestHourly, DigestDaily}
+
+// Constants for DigestEntry data keys
+const (
+	DigestDataKeyIP             = "ip"
+	DigestDataKeyUserAgent      = "user_agent"
+	DigestDataKeyEvent          = "event"
+	DigestDataKeyComment        = "comment"
+	DigestDataKeyAdditionalData = "additional_data"
+)
+
+// DigestEntry is a notification that was collected for a digest
+type DigestEntry struct {
+	EntryID uint64    `db:"entry_id"`
+	MTID    mtid.MTID `db:"MT_id"`
+	Class   string    `db:"class"`
+	Data    jsonMap   `db:"data"`
+	Created time.Time `db:"created"`
+	NotificationInfoBase
+}
+
+// DigestDueTime returns the time at which a digest collected at the passed time is sent, i.e. the start of the next
+// hour for hourly digests and the start of the next day (UTC) for daily digests
+func DigestDueTime(digest string, now time.Time) time.Time {
+	now = now.UTC()
+	switch digest {
+	case DigestHourly:
+		return now.Truncate(time.Hour).Add(time.Hour)
+	case DigestDaily:
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return now
+	}
+}
+
+// AddDigestEntry adds a notification to the digest of the passed notification subscription
+func AddDigestEntry(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, n NotificationInfoBase, mtID mtid.MTID, class string,
+	data map[string]any,
+) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			dataValue, err := jsonMap(data).Value()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			_, err = tx.Exec(
+				`CALL NotificationDigest_Add(?,?,?,?,?)`, n.NotificationID, mtID, class, dataValue,
+				DigestDueTime(n.Digest, time.Now()),
+			)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// PopDueDigest pops all due DigestEntry for one notification subscription from the database; if no digest is due,
+// no entries are returned
+func PopDueDigest(rlog log.Ext1FieldLogger, tx *sqlx.Tx) (entries []DigestEntry, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&entries, `CALL NotificationDigest_PopDue()`))
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// SetDigest sets how often notifications are sent for a notification subscription; already collected notifications
+// are sent with the next digest
+func SetDigest(rlog log.Ext1FieldLogger, tx *sqlx.Tx, nid uint64, digest string) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Notifications_SetDigest(?,?)`, nid, digest)
+			return errors.WithStack(err)
+		},
+	)
+}
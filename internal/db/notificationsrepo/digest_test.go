@@ -0,0 +1,56 @@
+package notificationsrepo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestDueTime(t *testing.T) {
+	now := time.Date(2024, 2, 29, 23, 41, 12, 0, time.UTC)
+	tests := []struct {
+		name     string
+		digest   string
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			name:     "Hourly",
+			digest:   DigestHourly,
+			now:      now,
+			expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Hourly at full hour",
+			digest:   DigestHourly,
+			now:      time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 2, 29, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Daily",
+			digest:   DigestDaily,
+			now:      now,
+			expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Daily other zone",
+			digest:   DigestDaily,
+			now:      time.Date(2024, 3, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)),
+			expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Immediate",
+			digest:   DigestImmediate,
+			now:      now,
+			expected: now,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := DigestDueTime(test.digest, test.now); !got.Equal(test.expected) {
+					t.Errorf("Expected '%s', but got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
@@ -1,15 +1,19 @@
 package notificationsrepo
 
 import (
+	"encoding/json"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/notificationsrepo/calendarrepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/notification/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	notifierpkg "github.com/oidc-mytoken/server/internal/notifier/pkg"
 )
 
 // ExpandNotificationsToChildrenIfApplicable checks if there is a notification subscription for the parent token that
@@ -34,12 +38,33 @@ type NotificationInfoBase struct {
 	api.NotificationInfoBase
 	WebSocketPath db.NullString `db:"ws" json:"ws,omitempty"`
 	UID           uint64        `db:"uid" json:"-"`
+	Digest        string        `db:"digest" json:"digest,omitempty"`
+	ChatTarget    db.NullString `db:"chat_target" json:"-"`
+}
+
+// Chat returns the notifierpkg.ChatTarget chat notifications are posted to or nil if none is set
+func (n NotificationInfoBase) Chat() *notifierpkg.ChatTarget {
+	if !n.ChatTarget.Valid {
+		return nil
+	}
+	var target notifierpkg.ChatTarget
+	if err := json.Unmarshal([]byte(n.ChatTarget.String), &target); err != nil {
+		return nil
+	}
+	target, err := target.Decrypted(config.Get().Features.Notifications.Chat.Webhook.EncryptionKey)
+	if err != nil {
+		log.WithError(err).Error("could not decrypt chat target")
+		return nil
+	}
+	return &target
 }
 
 // ManagementCodeNotificationInfoResponse extens api.ManagementCodeNotificationInfoResponse with an uid (not for json)
 type ManagementCodeNotificationInfoResponse struct {
 	api.ManagementCodeNotificationInfoResponse
-	UID uint64 `db:"uid" json:"-"`
+	UID        uint64                  `db:"uid" json:"-"`
+	Digest     string                  `db:"digest" json:"digest"`
+	ChatTarget *notifierpkg.ChatTarget `db:"-" json:"chat_target,omitempty"`
 }
 
 // GetNotificationsForMTAndClass checks for and returns the found notifications for a certain mytoken and
@@ -47,21 +72,19 @@ type ManagementCodeNotificationInfoResponse struct {
 func GetNotificationsForMTAndClass(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID,
 	class *api.NotificationClass,
-) (notifications []api.NotificationInfoBase, err error) {
+) (notifications []NotificationInfoBase, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			var dbNotifications []NotificationInfoBase
 			_, err = db.ParseError(
 				tx.Select(
-					&dbNotifications, `CALL Notifications_GetForMTAndClass(?,?)`, mtID, class.Name,
+					&notifications, `CALL Notifications_GetForMTAndClass_v2(?,?)`, mtID, class.Name,
 				),
 			)
 			if err != nil {
 				return errors.WithStack(err)
 			}
-			for _, n := range dbNotifications {
-				n.NotificationInfoBase.WebSocketPath = n.WebSocketPath.String
-				notifications = append(notifications, n.NotificationInfoBase)
+			for i, n := range notifications {
+				notifications[i].NotificationInfoBase.WebSocketPath = n.WebSocketPath.String
 			}
 			return nil
 		},
@@ -75,7 +98,7 @@ func GetNotificationsForMT(
 ) (notifications []NotificationInfoBaseWithClass, err error) {
 	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			_, err = db.ParseError(tx.Select(&notifications, `CALL Notifications_GetForMT(?)`, mtID))
+			_, err = db.ParseError(tx.Select(&notifications, `CALL Notifications_GetForMT_v2(?)`, mtID))
 			return errors.WithStack(err)
 		},
 	)
@@ -176,7 +199,7 @@ func GetNotificationForManagementCode(
 			var withClass []NotificationInfoBaseWithClass
 			found, err := db.ParseError(
 				tx.Select(
-					&withClass, `CALL Notifications_GetForManagementCode(?)`,
+					&withClass, `CALL Notifications_GetForManagementCode_v2(?)`,
 					managementCode,
 				),
 			)
@@ -194,7 +217,12 @@ func GetNotificationForManagementCode(
 						NotificationInfoBase: withClass[0].NotificationInfoBase.NotificationInfoBase,
 					},
 				},
-				UID: withClass[0].UID,
+				UID:    withClass[0].UID,
+				Digest: withClass[0].Digest,
+			}
+			if target := withClass[0].Chat(); target != nil {
+				masked := target.Masked()
+				info.ChatTarget = &masked
 			}
 			for _, n := range withClass {
 				info.Classes = append(info.Classes, api.NewNotificationClass(n.Class))
@@ -243,7 +271,13 @@ func newUserWideNotification(
 			); err != nil {
 				return err
 			}
-			return linkNotificationClasses(rlog, tx, nid, req.NotificationClasses)
+			if err := linkNotificationClasses(rlog, tx, nid, req.NotificationClasses); err != nil {
+				return err
+			}
+			if err := SetChatTarget(rlog, tx, nid, req.ChatTarget); err != nil {
+				return err
+			}
+			return setDigestIfNotDefault(rlog, tx, nid, req.Digest)
 		},
 	)
 }
@@ -263,11 +297,24 @@ func newMTNotification(
 			); err != nil {
 				return err
 			}
-			return linkNotificationClasses(rlog, tx, nid, req.NotificationClasses)
+			if err := linkNotificationClasses(rlog, tx, nid, req.NotificationClasses); err != nil {
+				return err
+			}
+			if err := SetChatTarget(rlog, tx, nid, req.ChatTarget); err != nil {
+				return err
+			}
+			return setDigestIfNotDefault(rlog, tx, nid, req.Digest)
 		},
 	)
 }
 
+func setDigestIfNotDefault(rlog log.Ext1FieldLogger, tx *sqlx.Tx, nid uint64, digest string) error {
+	if digest == "" || digest == DigestImmediate {
+		return nil
+	}
+	return SetDigest(rlog, tx, nid, digest)
+}
+
 func linkNotificationClasses(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, nid uint64, classes api.NotificationClasses,
 ) error {
@@ -331,6 +378,51 @@ func UpdateNotificationClasses(
 	return
 }
 
+// GetChatTargetForManagementCode returns the notifierpkg.ChatTarget of the notification with the passed management
+// code or nil if there is none
+func GetChatTargetForManagementCode(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, managementCode string,
+) (target *notifierpkg.ChatTarget, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			var withClass []NotificationInfoBaseWithClass
+			if err := tx.Select(
+				&withClass, `CALL Notifications_GetForManagementCode_v2(?)`, managementCode,
+			); err != nil {
+				return errors.WithStack(err)
+			}
+			if len(withClass) > 0 {
+				target = withClass[0].Chat()
+			}
+			return nil
+		},
+	)
+	return
+}
+
+// SetChatTarget sets the notifierpkg.ChatTarget chat notifications for a notification are posted to; if target is
+// nil, the chat target is removed. Webhook urls are stored encrypted.
+func SetChatTarget(rlog log.Ext1FieldLogger, tx *sqlx.Tx, notificationID uint64, target *notifierpkg.ChatTarget) error {
+	var value db.NullString
+	if target != nil {
+		encrypted, err := target.Encrypted(config.Get().Features.Notifications.Chat.Webhook.EncryptionKey)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(encrypted)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		value = db.NewNullString(string(data))
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL Notifications_SetChatTarget(?,?)`, notificationID, value)
+			return errors.WithStack(err)
+		},
+	)
+}
+
 // Delete deletes the notification for a managementCode
 func Delete(rlog log.Ext1FieldLogger, tx *sqlx.Tx, managementCode string) error {
 	return db.RunWithinTransaction(
@@ -0,0 +1,130 @@
+package notificationsrepo
+
+import (
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+)
+
+// Possible delivery states of a queued notification
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Types of queued notifications
+const (
+	QueueTypeMail = "mail"
+	QueueTypeChat = "chat"
+)
+
+// QueuedNotification is a notification request that was claimed from the outbound notification queue for delivery
+type QueuedNotification struct {
+	ID       uint64 `db:"id"`
+	Type     string `db:"type"`
+	Request  string `db:"request"`
+	Attempts int    `db:"attempts"`
+}
+
+// Delivery holds information about the delivery of a notification sent for a mytoken
+type Delivery struct {
+	ID            uint64            `db:"id" json:"id"`
+	Subject       string            `db:"subject" json:"subject"`
+	Status        string            `db:"status" json:"status"`
+	Attempts      int               `db:"attempts" json:"attempts"`
+	LastError     string            `db:"last_error" json:"last_error,omitempty"`
+	Created       unixtime.UnixTime `db:"created" json:"created"`
+	LastAttemptAt unixtime.UnixTime `db:"last_attempt_at" json:"last_attempt_at,omitempty"`
+	NextAttemptAt unixtime.UnixTime `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+}
+
+// EnqueueNotification adds an email notification request to the outbound notification queue; the request is
+// delivered asynchronously to the notifier server
+func EnqueueNotification(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, subject string, req any,
+) error {
+	return enqueue(rlog, tx, mtID, QueueTypeMail, subject, req)
+}
+
+// EnqueueChatNotification adds a chat notification request to the outbound notification queue; the request is
+// delivered asynchronously to the notifier server
+func EnqueueChatNotification(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, subject string, req any,
+) error {
+	return enqueue(rlog, tx, mtID, QueueTypeChat, subject, req)
+}
+
+func enqueue(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, queueType, subject string, req any) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = tx.Exec(`CALL NotificationQueue_Insert(?,?,?,?)`, mtID, queueType, subject, string(data))
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// ClaimQueuedNotifications claims up to batchSize due notifications from the outbound notification queue; the
+// claim is valid for lease seconds, afterwards the notifications can be claimed again
+func ClaimQueuedNotifications(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, claim string, batchSize, lease int,
+) (notifications []QueuedNotification, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(
+				tx.Select(&notifications, `CALL NotificationQueue_Claim(?,?,?)`, claim, batchSize, lease),
+			)
+			return errors.WithStack(err)
+		},
+	)
+	return
+}
+
+// MarkNotificationDelivered marks a queued notification as delivered
+func MarkNotificationDelivered(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id uint64) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL NotificationQueue_Delivered(?)`, id)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// MarkNotificationFailed records a failed delivery attempt for a queued notification; if retryIn is nil,
+// the notification is not retried, otherwise it is retried after retryIn seconds
+func MarkNotificationFailed(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, id uint64, deliveryErr string, retryIn *int,
+) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(`CALL NotificationQueue_Failed(?,?,?)`, id, deliveryErr, retryIn)
+			return errors.WithStack(err)
+		},
+	)
+}
+
+// GetDeliveriesForMT returns the Delivery information for all notifications sent for a mytoken
+func GetDeliveriesForMT(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID any) (deliveries []Delivery, err error) {
+	err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			_, err = db.ParseError(tx.Select(&deliveries, `CALL NotificationQueue_GetForMT(?)`, mtID))
+			return errors.WithStack(err)
+		},
+	)
+	for i, d := range deliveries {
+		if d.Status != DeliveryStatusPending {
+			deliveries[i].NextAttemptAt = 0
+		}
+	}
+	return
+}
@@ -59,22 +59,19 @@ type ScheduledNotification struct {
 	NotificationInfoBase
 }
 
-// PopOneScheduledNotification pops one ScheduledNotification from the database that is due
-func PopOneScheduledNotification(rlog log.Ext1FieldLogger, tx *sqlx.Tx) (*ScheduledNotification, error) {
-	n := &ScheduledNotification{}
-	err := db.RunWithinTransaction(
+// PopDueScheduledNotifications pops up to batchSize ScheduledNotification from the database that are due
+func PopDueScheduledNotifications(rlog log.Ext1FieldLogger, tx *sqlx.Tx, batchSize int) (
+	notifications []*ScheduledNotification, err error,
+) {
+	err = db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			err := errors.WithStack(tx.Get(n, `CALL PopOneDueScheduledNotification()`))
-			if err != nil {
-				_, err = db.ParseError(err)
-				if err == nil {
-					n = nil
-				}
-			}
-			return err
+			_, err = db.ParseError(
+				tx.Select(&notifications, `CALL NotificationSchedule_PopDue(?)`, batchSize),
+			)
+			return errors.WithStack(err)
 		},
 	)
-	return n, err
+	return
 }
 
 var notificationIntervalsBeforeExpiration = []uint64{
@@ -5,17 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/actionrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	helper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/actions/pkg"
+	renewalpkg "github.com/oidc-mytoken/server/internal/endpoints/renewal/pkg"
+	"github.com/oidc-mytoken/server/internal/jobs"
 	"github.com/oidc-mytoken/server/internal/model"
+	eventpkg "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
@@ -34,6 +44,10 @@ func HandleActions(ctx *fiber.Ctx) error {
 		return handleRemoveFromCalendar(ctx, actionInfo.Code)
 	case pkg.ActionUnsubscribeScheduled:
 		return handleUnsubscribeScheduled(ctx, actionInfo.Code)
+	case pkg.ActionResumeToken:
+		return handleResumeToken(ctx, actionInfo.Code)
+	case pkg.ActionApproveRenewal:
+		return handleApproveRenewal(ctx, actionInfo.Code)
 	}
 	return ctxutils.RenderErrorPage(
 		ctx, fiber.StatusBadRequest, model.BadRequestError("unknown action").
@@ -52,36 +66,8 @@ func handleRecreate(ctx *fiber.Ctx, code string) (err error) {
 			if err != nil || !found {
 				return err
 			}
-			var req api.GeneralMytokenRequest
-			req.Issuer = data.Issuer
-			if data.Name.Valid {
-				req.Name = data.Name.String
-			}
-			req.Rotation = data.Rotation
-			req.Capabilities = data.Capabilities
-			if data.Restrictions != nil {
-				restr := make(api.Restrictions, len(data.Restrictions))
-				created := data.Created
-				now := unixtime.Now()
-				diff := now - created
-				for i, r := range data.Restrictions {
-					apiR := r.Restriction
-					if r.NotBefore != 0 {
-						apiR.NotBefore = int64(r.NotBefore + diff)
-					}
-					if r.ExpiresAt != 0 {
-						apiR.ExpiresAt = int64(r.ExpiresAt + diff)
-					}
-					restr[i] = &apiR
-				}
-				req.Restrictions = restr
-			}
-			j, err := json.Marshal(req)
-			if err != nil {
-				return err
-			}
-			baseRequest = base64.RawURLEncoding.EncodeToString(j)
-			return nil
+			baseRequest, err = recreateRequest(data)
+			return err
 		},
 	)
 	if err != nil {
@@ -93,6 +79,44 @@ func handleRecreate(ctx *fiber.Ctx, code string) (err error) {
 	return ctx.Redirect(fmt.Sprintf("/?r=%s#mt", baseRequest), fiber.StatusSeeOther)
 }
 
+// recreateRequest returns the encoded mytoken request for recreating a mytoken from the passed
+// actionrepo.RecreateData; restrictions are moved in time, so that they are relative to now as they were relative to
+// the creation of the original mytoken
+func recreateRequest(data actionrepo.RecreateData) (string, error) {
+	var req api.GeneralMytokenRequest
+	req.Issuer = data.Issuer
+	if data.Name.Valid {
+		req.Name = data.Name.String
+	}
+	req.Rotation = data.Rotation
+	req.Capabilities = data.Capabilities
+	if data.Restrictions != nil {
+		shifted := data.Restrictions.Shift(unixtime.Now() - data.Created)
+		restr := make(api.Restrictions, len(shifted))
+		for i, r := range shifted {
+			apiR := r.Restriction
+			restr[i] = &apiR
+		}
+		req.Restrictions = restr
+	}
+	j, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(j), nil
+}
+
+// RecreateURL returns an url to the web interface that is pre-filled for creating a mytoken with the properties
+// from the passed actionrepo.RecreateData; unlike CreateRecreateToken this does not need the original mytoken to
+// still exist
+func RecreateURL(data actionrepo.RecreateData) (string, error) {
+	baseRequest, err := recreateRequest(data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s?r=%s#mt", utils.CombineURLPath(config.Get().IssuerURL, "/"), baseRequest), nil
+}
+
 func handleVerifyEmail(ctx *fiber.Ctx, code string) error {
 	rlog := logger.GetRequestLogger(ctx)
 	verified, err := actionrepo.VerifyMail(rlog, nil, code)
@@ -130,6 +154,102 @@ func handleUnsubscribeScheduled(ctx *fiber.Ctx, code string) error {
 	)
 }
 
+func handleResumeToken(ctx *fiber.Ctx, code string) error {
+	rlog := logger.GetRequestLogger(ctx)
+	var found bool
+	err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			var mtID mtid.MTID
+			var err error
+			mtID, found, err = actionrepo.UseResumeTokenCode(rlog, tx, code)
+			if err != nil || !found {
+				return err
+			}
+			if err = helper.ResumeMT(rlog, tx, mtID, false); err != nil {
+				return err
+			}
+			return (&eventrepo.EventDBObject{
+				Event:          eventpkg.EventResumed,
+				MTID:           mtID,
+				Comment:        "via email link",
+				ClientMetaData: *ctxutils.ClientMetaData(ctx),
+			}).Store(rlog, tx)
+		},
+	)
+	if err != nil {
+		return ctxutils.RenderInternalServerErrorPage(ctx, err)
+	}
+	if !found {
+		return ctxutils.RenderErrorPage(ctx, http.StatusBadRequest, "code not valid")
+	}
+	return ctxutils.RenderErrorPage(
+		ctx, http.StatusOK, "The mytoken was successfully resumed and can be used again.", "Token Resumed",
+	)
+}
+
+func handleApproveRenewal(ctx *fiber.Ctx, code string) error {
+	rlog := logger.GetRequestLogger(ctx)
+	var found, approved, suspended bool
+	err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			var mtID mtid.MTID
+			var err error
+			mtID, found, err = actionrepo.UseApproveRenewalCode(rlog, tx, code)
+			if err != nil || !found {
+				return err
+			}
+			info, renewalFound, err := renewalrepo.Get(rlog, tx, mtID)
+			if err != nil || !renewalFound {
+				return err
+			}
+			if suspended = info.AnySuspended(); suspended {
+				// Keep the code, so the renewal can still be approved once the mytoken is resumed
+				return errors.New("rollback")
+			}
+			approved, err = renewalrepo.Approve(rlog, tx, mtID)
+			if err != nil || !approved {
+				return err
+			}
+			if info.Channel == renewalrepo.ChannelWebhook {
+				if err = jobs.Enqueue(
+					rlog, tx, renewalpkg.JobTypeRenewalWebhook,
+					renewalpkg.WebhookJobPayload{MOMID: mtid.MOMID{MTID: mtID}}, time.Time{},
+				); err != nil {
+					return err
+				}
+			}
+			return (&eventrepo.EventDBObject{
+				Event:          eventpkg.EventRenewalApproved,
+				MTID:           mtID,
+				Comment:        "via notification link",
+				ClientMetaData: *ctxutils.ClientMetaData(ctx),
+			}).Store(rlog, tx)
+		},
+	)
+	if suspended {
+		return ctxutils.RenderErrorPage(
+			ctx, http.StatusForbidden,
+			"The mytoken or its parent is suspended. The renewal can only be approved once the mytoken is resumed.",
+		)
+	}
+	if err != nil {
+		return ctxutils.RenderInternalServerErrorPage(ctx, err)
+	}
+	if !found {
+		return ctxutils.RenderErrorPage(ctx, http.StatusBadRequest, "code not valid")
+	}
+	if !approved {
+		return ctxutils.RenderErrorPage(
+			ctx, http.StatusBadRequest, "There is no pending renewal for this mytoken; it might have been cancelled.",
+		)
+	}
+	return ctxutils.RenderErrorPage(
+		ctx, http.StatusOK,
+		"The renewal was approved. The service that requested it can now obtain the successor of the mytoken.",
+		"Renewal Approved",
+	)
+}
+
 // CreateVerifyEmail creates an action url for verifying a mail address
 func CreateVerifyEmail(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (string, error) {
 	code := pkg.ActionInfo{
@@ -154,6 +274,34 @@ func CreateRecreateToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID)
 	return routes.ActionsURL(code), nil
 }
 
+// CreateResumeToken creates an action url for resuming a suspended mytoken
+func CreateResumeToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (string, error) {
+	code := pkg.ActionInfo{
+		Action: pkg.ActionResumeToken,
+		Code:   pkg.NewCode(),
+	}
+	if err := actionrepo.AddResumeTokenCode(rlog, tx, mtID, code.Code); err != nil {
+		return "", err
+	}
+	return routes.ActionsURL(code), nil
+}
+
+// CreateApproveRenewal creates an action url for approving the requested renewal of a mytoken; the url is valid
+// until the mytoken expires at the passed time
+func CreateApproveRenewal(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, exp unixtime.UnixTime) (
+	string, error,
+) {
+	code := pkg.ActionInfo{
+		Action: pkg.ActionApproveRenewal,
+		Code:   pkg.NewCode(),
+	}
+	expiresIn := int(time.Until(exp.Time()).Seconds())
+	if err := actionrepo.AddApproveRenewalCode(rlog, tx, mtID, code.Code, expiresIn); err != nil {
+		return "", err
+	}
+	return routes.ActionsURL(code), nil
+}
+
 // CreateRemoveFromCalendar creates an action url for removing a token from a calendar
 func CreateRemoveFromCalendar(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, calendarName string) (
 	string,
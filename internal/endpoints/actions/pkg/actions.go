@@ -11,6 +11,8 @@ const (
 	ActionVerifyEmail          = "verify_email"
 	ActionRemoveFromCalendar   = "remove_from_calendar"
 	ActionUnsubscribeScheduled = "unsubscribe_scheduled"
+	ActionResumeToken          = "resume_token"
+	ActionApproveRenewal       = "approve_renewal"
 )
 
 // CodeLifetimes holds the default lifetime of the different action codes
@@ -19,6 +21,8 @@ var CodeLifetimes = map[string]int{
 	ActionRecreate:             0,
 	ActionRemoveFromCalendar:   0,
 	ActionUnsubscribeScheduled: 0,
+	ActionResumeToken:          0,
+	ActionApproveRenewal:       0,
 }
 
 // ActionInfo is type for associating an Action with a Code
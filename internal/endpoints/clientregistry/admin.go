@@ -0,0 +1,176 @@
+package clientregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/clientregistryrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// ClientRequest is the request to add or update a Client in the registry
+type ClientRequest struct {
+	ClientID  string `json:"client_id"`
+	Name      string `json:"name"`
+	LogoURI   string `json:"logo_uri,omitempty"`
+	Homepage  string `json:"homepage,omitempty"`
+	PublicKey string `json:"public_key"`
+}
+
+func checkHTTPSURL(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("'%s' must be an https url", name)
+	}
+	return nil
+}
+
+func (r ClientRequest) toClient() (clientregistryrepo.Client, error) {
+	if r.ClientID == "" {
+		return clientregistryrepo.Client{}, errors.New("required parameter 'client_id' missing")
+	}
+	if r.Name == "" {
+		return clientregistryrepo.Client{}, errors.New("required parameter 'name' missing")
+	}
+	if r.PublicKey == "" {
+		return clientregistryrepo.Client{}, errors.New("required parameter 'public_key' missing")
+	}
+	if _, err := ParsePublicKey(r.PublicKey); err != nil {
+		return clientregistryrepo.Client{}, err
+	}
+	if err := checkHTTPSURL("logo_uri", r.LogoURI); err != nil {
+		return clientregistryrepo.Client{}, err
+	}
+	if err := checkHTTPSURL("homepage", r.Homepage); err != nil {
+		return clientregistryrepo.Client{}, err
+	}
+	return clientregistryrepo.Client{
+		ClientID:  r.ClientID,
+		Name:      r.Name,
+		LogoURI:   db.NewNullString(r.LogoURI),
+		Homepage:  db.NewNullString(r.Homepage),
+		PublicKey: r.PublicKey,
+	}, nil
+}
+
+func notFoundResponse(clientID string) *model.Response {
+	return &model.Response{
+		Status:   fiber.StatusNotFound,
+		Response: model.BadRequestError(fmt.Sprintf("unknown client '%s'", clientID)),
+	}
+}
+
+// HandleList handles requests to list all registered clients
+func HandleList(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	clients, err := clientregistryrepo.GetAll(rlog, nil)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if clients == nil {
+		clients = []clientregistryrepo.Client{}
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: clients,
+	}
+}
+
+// HandleGet handles requests to get a registered client
+func HandleGet(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	clientID := ctx.Params("client_id")
+	client, found, err := clientregistryrepo.Get(rlog, nil, clientID)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !found {
+		return notFoundResponse(clientID)
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: client,
+	}
+}
+
+// HandleAdd handles requests to add a client to the registry
+func HandleAdd(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	var req ClientRequest
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	client, err := req.toClient()
+	if err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	_, found, err := clientregistryrepo.Get(rlog, nil, client.ClientID)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if found {
+		return &model.Response{
+			Status:   fiber.StatusConflict,
+			Response: model.BadRequestError(fmt.Sprintf("client '%s' already registered", client.ClientID)),
+		}
+	}
+	if err = clientregistryrepo.Insert(rlog, nil, client); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	rlog.WithField("client_id", client.ClientID).Info("Added client to client registry")
+	return &model.Response{Status: fiber.StatusCreated}
+}
+
+// HandleUpdate handles requests to update a registered client
+func HandleUpdate(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	var req ClientRequest
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	req.ClientID = ctx.Params("client_id")
+	client, err := req.toClient()
+	if err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	found, err := clientregistryrepo.Update(rlog, nil, client)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !found {
+		return notFoundResponse(client.ClientID)
+	}
+	rlog.WithField("client_id", client.ClientID).Info("Updated client in client registry")
+	return &model.Response{Status: fiber.StatusNoContent}
+}
+
+// HandleDelete handles requests to remove a client from the registry
+func HandleDelete(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	clientID := ctx.Params("client_id")
+	found, err := clientregistryrepo.Delete(rlog, nil, clientID)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !found {
+		return notFoundResponse(clientID)
+	}
+	rlog.WithField("client_id", clientID).Info("Removed client from client registry")
+	return &model.Response{Status: fiber.StatusNoContent}
+}
@@ -0,0 +1,160 @@
+package clientregistry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/clientregistryrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+)
+
+// AttestationHeader is the http header in which a registered client passes the jwt that attests a mytoken request
+const AttestationHeader = "Mytoken-Client-Attestation"
+
+// MaxAttestationLifetime is the maximum lifetime of a client attestation jwt
+const MaxAttestationLifetime = 5 * time.Minute
+
+// AttestationClaims holds the claims of the jwt with which a registered client attests a mytoken request; the jwt is
+// signed with the client's registered key, issued by the client id for this mytoken instance, and bound to the
+// request body through the body hash
+type AttestationClaims struct {
+	jwt.StandardClaims
+	BodyHash string `json:"body_hash"`
+}
+
+// ParsePublicKey parses a pem encoded RSA, EC, or Ed25519 public key
+func ParsePublicKey(pemKey string) (crypto.PublicKey, error) {
+	data := []byte(pemKey)
+	if pk, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return pk, nil
+	}
+	if pk, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return pk, nil
+	}
+	if pk, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return pk, nil
+	}
+	return nil, errors.New("could not parse public key; must be a pem encoded RSA, EC, or Ed25519 key")
+}
+
+func keyFunc(pk crypto.PublicKey) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		var ok bool
+		switch pk.(type) {
+		case *rsa.PublicKey:
+			switch t.Method.(type) {
+			case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+				ok = true
+			}
+		case *ecdsa.PublicKey:
+			_, ok = t.Method.(*jwt.SigningMethodECDSA)
+		case ed25519.PublicKey:
+			_, ok = t.Method.(*jwt.SigningMethodEd25519)
+		}
+		if !ok {
+			return nil, errors.Errorf("unexpected signing method '%s'", t.Method.Alg())
+		}
+		return pk, nil
+	}
+}
+
+// attestationIssuer returns the client id of an attestation jwt without verifying it
+func attestationIssuer(token string) (string, error) {
+	claims := &AttestationClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if claims.Issuer == "" {
+		return "", errors.New("no issuer")
+	}
+	return claims.Issuer, nil
+}
+
+// verifyAttestation verifies an attestation and returns its claims; it does not check for replays
+func verifyAttestation(client clientregistryrepo.Client, token string, body []byte) (*AttestationClaims, error) {
+	pk, err := ParsePublicKey(client.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	claims := &AttestationClaims{}
+	if _, err = jwt.ParseWithClaims(token, claims, keyFunc(pk)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !claims.VerifyAudience(config.Get().IssuerURL, true) {
+		return nil, errors.New("invalid audience")
+	}
+	if claims.IssuedAt == 0 || claims.ExpiresAt == 0 ||
+		time.Unix(claims.ExpiresAt, 0).Sub(time.Unix(claims.IssuedAt, 0)) > MaxAttestationLifetime {
+		return nil, errors.New("invalid attestation lifetime")
+	}
+	if claims.BodyHash != hashutils.SHA512Str(body) {
+		return nil, errors.New("body hash does not match")
+	}
+	if claims.Id == "" {
+		return nil, errors.New("no jti")
+	}
+	return claims, nil
+}
+
+func invalidAttestationResponse(rlog log.Ext1FieldLogger, err error) *model.Response {
+	rlog.WithError(err).Warn("rejected mytoken request with invalid client attestation")
+	return &model.Response{
+		Status: fiber.StatusUnauthorized,
+		Response: api.Error{
+			Error:            api.ErrorStrInvalidClient,
+			ErrorDescription: "client attestation could not be verified",
+		},
+	}
+}
+
+// VerifyAttestation verifies the client attestation of a mytoken request and returns the attested client. If the
+// client registry is disabled or the request carries no attestation, nil is returned, i.e. the client is unverified.
+// An attestation that cannot be verified results in an error response.
+func VerifyAttestation(rlog log.Ext1FieldLogger, ctx *fiber.Ctx) (*clientregistryrepo.Client, *model.Response) {
+	if !config.Get().Features.ClientRegistry.Enabled {
+		return nil, nil
+	}
+	token := ctx.Get(AttestationHeader)
+	if token == "" {
+		return nil, nil
+	}
+	clientID, err := attestationIssuer(token)
+	if err != nil {
+		return nil, invalidAttestationResponse(rlog, err)
+	}
+	client, found, err := clientregistryrepo.Get(rlog, nil, clientID)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return nil, model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !found {
+		return nil, invalidAttestationResponse(rlog, errors.Errorf("unknown client '%s'", clientID))
+	}
+	claims, err := verifyAttestation(client, token, ctx.Body())
+	if err != nil {
+		return nil, invalidAttestationResponse(rlog, err)
+	}
+	used, err := clientregistryrepo.UseAttestationID(
+		rlog, nil, client.ClientID, claims.Id, time.Unix(claims.ExpiresAt, 0),
+	)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return nil, model.ErrorToInternalServerErrorResponse(err)
+	}
+	if used {
+		return nil, invalidAttestationResponse(rlog, errors.New("attestation replayed"))
+	}
+	return &client, nil
+}
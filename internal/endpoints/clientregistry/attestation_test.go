@@ -0,0 +1,81 @@
+package clientregistry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/clientregistryrepo"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+)
+
+func testAttestation(t *testing.T, key *ecdsa.PrivateKey, jti string, body []byte) string {
+	now := time.Now()
+	token, err := jwt.NewWithClaims(
+		jwt.SigningMethodES256, AttestationClaims{
+			StandardClaims: jwt.StandardClaims{
+				Audience:  config.Get().IssuerURL,
+				ExpiresAt: now.Add(time.Minute).Unix(),
+				Id:        jti,
+				IssuedAt:  now.Unix(),
+				Issuer:    "client",
+			},
+			BodyHash: hashutils.SHA512Str(body),
+		},
+	).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyAttestation(t *testing.T) {
+	issuer := config.Get().IssuerURL
+	t.Cleanup(func() { config.Get().IssuerURL = issuer })
+	config.Get().IssuerURL = "https://mytoken.example.com"
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := clientregistryrepo.Client{
+		ClientID:  "client",
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+	body := []byte(`{"grant_type":"oidc_flow"}`)
+
+	token := testAttestation(t, key, "1", body)
+	if iss, err := attestationIssuer(token); err != nil || iss != "client" {
+		t.Fatalf("unexpected issuer '%s': %v", iss, err)
+	}
+	claims, err := verifyAttestation(client, token, body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if claims.Id != "1" {
+		t.Errorf("unexpected jti '%s'", claims.Id)
+	}
+	if _, err = verifyAttestation(client, testAttestation(t, key, "", body), body); err == nil {
+		t.Error("expected error for attestation without jti")
+	}
+	if _, err = verifyAttestation(client, testAttestation(t, key, "2", body), []byte(`{}`)); err == nil {
+		t.Error("expected error for other body")
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = verifyAttestation(client, testAttestation(t, other, "3", body), body); err == nil {
+		t.Error("expected error for attestation signed with another key")
+	}
+}
@@ -1,6 +1,8 @@
 package configuration
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/utils"
@@ -11,28 +13,31 @@ import (
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/model/version"
 	"github.com/oidc-mytoken/server/internal/oidc/oidcfed"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 	"github.com/oidc-mytoken/server/internal/server/paths"
 )
 
 // SupportedProviders returns a list of all the api.
 // SupportedProviderConfig including providers specified in the config file as well as possible oidc fed providers
 func SupportedProviders() []api.SupportedProviderConfig {
-	if config.Get().Features.Federation.Enabled {
-		mytokenConfig.ProvidersSupported = append(getProvidersFromConfig(), oidcfed.SupportedProviders()...)
-	} else {
-		mytokenConfig.ProvidersSupported = getProvidersFromConfig()
+	if !config.Get().Features.Federation.Enabled {
+		return getProvidersFromConfig()
 	}
-	return mytokenConfig.ProvidersSupported
+	return append(
+		append([]api.SupportedProviderConfig{}, getProvidersFromConfig()...),
+		oidcfed.SupportedProviders()...,
+	)
 }
 
-// HandleConfiguration handles calls to the configuration endpoint
+// HandleConfiguration handles calls to the configuration endpoint; the shared configuration is not modified, the
+// dynamic parts are set on a copy for each request
 func HandleConfiguration(*fiber.Ctx) *model.Response {
-	if config.Get().Features.Federation.Enabled {
-		mytokenConfig.ProvidersSupported = append(getProvidersFromConfig(), oidcfed.SupportedProviders()...)
-	}
+	res := *mytokenConfig
+	res.ProvidersSupported = SupportedProviders()
+	res.ProvidersHealth = providerhealth.All()
 	return &model.Response{
 		Status:   fiber.StatusOK,
-		Response: mytokenConfig,
+		Response: &res,
 	}
 }
 
@@ -60,11 +65,15 @@ func getProvidersFromConfig() []api.SupportedProviderConfig {
 func Init() {
 	mytokenConfig = basicConfiguration()
 	addTokenRevocation(mytokenConfig)
+	addTokenSuspension(mytokenConfig)
+	addTokenRenewal(mytokenConfig)
+	addStepUp(mytokenConfig)
 	addShortTokens(mytokenConfig)
 	addTransferCodes(mytokenConfig)
 	addPollingCodes(mytokenConfig)
 	addTokenInfo(mytokenConfig)
 	addSSHGrant(mytokenConfig)
+	addSSHCertificates(mytokenConfig)
 }
 
 func basicConfiguration() *pkg.MytokenConfiguration {
@@ -107,6 +116,30 @@ func addTokenRevocation(mytokenConfig *pkg.MytokenConfiguration) {
 		)
 	}
 }
+func addTokenSuspension(mytokenConfig *pkg.MytokenConfiguration) {
+	if config.Get().Features.TokenSuspension.Enabled {
+		mytokenConfig.SuspensionEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL,
+			paths.GetCurrentAPIPaths().SuspensionEndpoint,
+		)
+	}
+}
+func addTokenRenewal(mytokenConfig *pkg.MytokenConfiguration) {
+	if config.Get().Features.TokenRenewal.Enabled {
+		mytokenConfig.RenewalEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL,
+			paths.GetCurrentAPIPaths().RenewalEndpoint,
+		)
+	}
+}
+func addStepUp(mytokenConfig *pkg.MytokenConfiguration) {
+	if config.Get().Features.WebInterface.WebAuthn.Enabled {
+		mytokenConfig.StepUpEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL,
+			paths.GetCurrentAPIPaths().StepUpEndpoint,
+		)
+	}
+}
 func addShortTokens(mytokenConfig *pkg.MytokenConfiguration) {
 	if config.Get().Features.ShortTokens.Enabled {
 		model.ResponseTypeShortToken.AddToSliceIfNotFound(&mytokenConfig.ResponseTypesSupported)
@@ -149,6 +182,21 @@ func addSSHGrant(mytokenconfig *pkg.MytokenConfiguration) {
 	if config.Get().Features.SSH.Enabled {
 		model.GrantTypeSSH.AddToSliceIfNotFound(&mytokenconfig.MytokenEndpointGrantTypesSupported)
 		mytokenconfig.SSHKeys = createSSHKeyInfos()
+		mytokenconfig.SSHHost = config.Get().Features.SSH.AdvertisedHost
+		mytokenconfig.SSHPort = config.Get().Features.SSH.AdvertisedPort
+	}
+}
+
+func addSSHCertificates(mytokenConfig *pkg.MytokenConfiguration) {
+	certConf := config.Get().Features.SSH.UserCertificates
+	if certConf.Enabled {
+		mytokenConfig.SSHCertificateEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL,
+			paths.GetCurrentAPIPaths().SSHCertificateEndpoint,
+		)
+		mytokenConfig.SSHUserCAPublicKey = strings.TrimSpace(
+			string(gossh.MarshalAuthorizedKey(certConf.CAKey.PublicKey())),
+		)
 	}
 }
 
@@ -0,0 +1,41 @@
+package configuration
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/endpoints/configuration/pkg"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
+)
+
+func TestHandleConfiguration_DoesNotModifySharedConfiguration(t *testing.T) {
+	shared := &pkg.MytokenConfiguration{}
+	orig := mytokenConfig
+	mytokenConfig = shared
+	t.Cleanup(func() { mytokenConfig = orig })
+	providerhealth.RecordRefresh("https://op.example.com", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := HandleConfiguration(nil)
+			conf, ok := res.Response.(*pkg.MytokenConfiguration)
+			if !ok {
+				t.Errorf("unexpected response type %T", res.Response)
+				return
+			}
+			if conf == shared {
+				t.Error("the shared configuration was returned")
+			}
+			if len(conf.ProvidersHealth) == 0 {
+				t.Error("the provider health is missing")
+			}
+		}()
+	}
+	wg.Wait()
+	if shared.ProvidersHealth != nil {
+		t.Error("the shared configuration was modified")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/oidc-mytoken/api/v0"
 
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 )
 
 // MytokenConfiguration holds information about a mytoken instance
@@ -16,4 +17,12 @@ type MytokenConfiguration struct {
 	ResponseTypesSupported                 []model.ResponseType    `json:"response_types_supported"`
 	RestrictionClaimsSupported             model.RestrictionClaims `json:"restriction_claims_supported"`
 	TokenEndpoint                          string                  `json:"token_endpoint"` // For compatibility with OIDC
+	SuspensionEndpoint                     string                  `json:"suspension_endpoint,omitempty"`
+	RenewalEndpoint                        string                  `json:"renewal_endpoint,omitempty"`
+	StepUpEndpoint                         string                  `json:"step_up_endpoint,omitempty"`
+	SSHHost                                string                  `json:"ssh_host,omitempty"`
+	SSHPort                                int                     `json:"ssh_port,omitempty"`
+	SSHCertificateEndpoint                 string                  `json:"ssh_certificate_endpoint,omitempty"`
+	SSHUserCAPublicKey                     string                  `json:"ssh_user_ca_public_key,omitempty"`
+	ProvidersHealth                        []providerhealth.Status `json:"providers_health,omitempty"`
 }
@@ -30,6 +30,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/clientregistryrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/consent/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
@@ -37,10 +38,13 @@ import (
 	"github.com/oidc-mytoken/server/internal/utils"
 )
 
-// handleConsent displays a consent page
-func handleConsent(ctx *fiber.Ctx, info *pkg2.OIDCFlowRequest, includeConsentCallbacks bool) error {
+// handleConsent displays a consent page; client is the verified client that started the flow or nil if the client
+// is not verified
+func handleConsent(
+	ctx *fiber.Ctx, info *pkg2.OIDCFlowRequest, client *clientregistryrepo.Client, includeConsentCallbacks bool,
+) error {
 	c := info.Capabilities
-	binding := map[string]interface{}{
+	binding := fiber.Map{
 		templating.MustacheKeyConsent:             true,
 		templating.MustacheKeyConsentSend:         includeConsentCallbacks,
 		templating.MustacheKeyEmptyNavbar:         true,
@@ -55,10 +59,23 @@ func handleConsent(ctx *fiber.Ctx, info *pkg2.OIDCFlowRequest, includeConsentCal
 		templating.MustacheKeyRotation:    info.Rotation,
 		templating.MustacheKeyApplication: info.ApplicationName,
 	}
-	var scopes []string
-	if p := provider2.GetProvider(info.Issuer); p != nil {
-		scopes = p.Scopes()
+	if includeConsentCallbacks && config.Get().Features.ClientRegistry.Enabled {
+		if client != nil {
+			binding[templating.MustacheKeyApplication] = client.Name
+			binding[templating.MustacheKeyVerifiedClient] = map[string]string{
+				templating.MustacheKeyName:     client.Name,
+				templating.MustacheKeyLogo:     client.LogoURI.String,
+				templating.MustacheKeyHomepage: client.Homepage.String,
+			}
+		} else {
+			binding[templating.MustacheKeyUnverifiedClient] = true
+		}
 	}
+	if includeConsentCallbacks && config.Get().Features.WebInterface.WebAuthn.Enabled {
+		binding[templating.MustacheKeyStepUp] = true
+		binding[templating.MustacheKeyDangerCapabilities] = webentities.HighDangerCapabilities()
+	}
+	scopes := provider2.GetSupportedScopes(info.Issuer)
 	binding[templating.MustacheKeySupportedScopes] = strings.Join(scopes, " ")
 	if !includeConsentCallbacks {
 		iss := config.Get().IssuerURL
@@ -107,7 +124,7 @@ func HandleCreateConsent(ctx *fiber.Ctx) error {
 		},
 	}
 	info.Rotation = req.Rotation
-	return handleConsent(ctx, info, false)
+	return handleConsent(ctx, info, nil, false)
 }
 
 // HandleConsent displays a consent page
@@ -118,7 +135,18 @@ func HandleConsent(ctx *fiber.Ctx) error {
 		// Don't log error here, it was already logged
 		return err
 	}
-	return handleConsent(ctx, &(authInfo.AuthCodeFlowRequest.OIDCFlowRequest), true)
+	var client *clientregistryrepo.Client
+	if authInfo.RegisteredClient != "" {
+		c, found, err := clientregistryrepo.Get(rlog, nil, authInfo.RegisteredClient)
+		if err != nil {
+			rlog.Errorf("%s", errorfmt.Full(err))
+			return err
+		}
+		if found {
+			client = &c
+		}
+	}
+	return handleConsent(ctx, &(authInfo.AuthCodeFlowRequest.OIDCFlowRequest), client, true)
 }
 
 func handleConsentDecline(
@@ -157,14 +185,16 @@ func handleConsentDecline(
 // handleConsentAccept handles the acceptance of a consent code
 func handleConsentAccept(
 	rlog log.Ext1FieldLogger, req *pkg.ConsentApprovalRequest,
-	oState *state.State,
+	oState *state.State, profiles []string,
 ) *model.Response {
 	for _, c := range req.Capabilities {
-		if !api.AllCapabilities.Has(c) {
+		if !model.AllCapabilities().Has(c) {
 			return model.BadRequestErrorResponse(fmt.Sprintf("unknown capability '%s'", c))
 		}
 	}
-	p := provider2.GetProvider(req.Issuer)
+	p := provider2.GetProviderForRequest(
+		req.Issuer, req.Restrictions.GetScopes(), req.Restrictions.GetAudiences(), profiles,
+	)
 	if p == nil {
 		if !utils2.StringInSlice(req.Issuer, oidcfed.Issuers()) {
 			return &model.Response{
@@ -212,5 +242,5 @@ func HandleConsentPost(ctx *fiber.Ctx) *model.Response {
 	if err = json.Unmarshal(ctx.Body(), &req); err != nil {
 		return model.ErrorToBadRequestErrorResponse(err)
 	}
-	return handleConsentAccept(rlog, &req, oState)
+	return handleConsentAccept(rlog, &req, oState, authInfo.Profiles)
 }
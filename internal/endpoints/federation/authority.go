@@ -0,0 +1,243 @@
+package federation
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	oidfed "github.com/zachmann/go-oidfed/pkg"
+	"github.com/zachmann/go-oidfed/pkg/constants"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/jws"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/server/paths"
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+type resolveResponse []byte
+
+// Send sends this response using the passed fiber.Ctx
+func (r resolveResponse) Send(ctx *fiber.Ctx) error {
+	ctx.Set("content-type", constants.ContentTypeResolveResponse)
+	return ctx.Status(fasthttp.StatusOK).Send(r)
+}
+
+func sendFederationError(ctx *fiber.Ctx, status int, oidfedErr oidfed.Error) error {
+	return model.Response{
+		Status:   status,
+		Response: oidfedErr,
+	}.Send(ctx)
+}
+
+func sendFederationServerError(ctx *fiber.Ctx, err error) error {
+	logger.GetRequestLogger(ctx).Errorf("%s", errorfmt.Full(err))
+	return sendFederationError(ctx, fiber.StatusInternalServerError, oidfed.ErrorServerError(errorfmt.Error(err)))
+}
+
+// subordinateStatementPayload returns the payload of the subordinate statement for a subordinate; the statement
+// includes the subordinate's jwks as pinned in the config
+func subordinateStatementPayload(sub *config.FederationSubordinateConf) *oidfed.EntityStatementPayload {
+	now := time.Now()
+	lifetime := time.Duration(config.Get().Features.Federation.Authority.SubordinateStatementLifetime) * time.Second
+	return &oidfed.EntityStatementPayload{
+		Issuer:         config.Get().Features.Federation.Entity.EntityID,
+		Subject:        sub.EntityID,
+		IssuedAt:       oidfed.Unixtime{Time: now},
+		ExpiresAt:      oidfed.Unixtime{Time: now.Add(lifetime)},
+		JWKS:           *sub.JWKS,
+		MetadataPolicy: sub.MetadataPolicy,
+		SourceEndpoint: utils.CombineURLPath(
+			config.Get().IssuerURL, paths.GetGeneralPaths().FederationFetchEndpoint,
+		),
+	}
+}
+
+// HandleFetch handles calls to the federation fetch endpoint and returns subordinate statements for the configured
+// subordinates
+func HandleFetch(ctx *fiber.Ctx) error {
+	entity := config.Get().Features.Federation.Entity
+	iss := ctx.Query("iss")
+	sub := ctx.Query("sub")
+	if iss != "" && iss != entity.EntityID {
+		return sendFederationError(
+			ctx, fiber.StatusNotFound,
+			oidfed.ErrorInvalidIssuer("cannot fetch entity statements for this issuer from this endpoint"),
+		)
+	}
+	if sub == "" {
+		return sendFederationError(
+			ctx, fiber.StatusBadRequest, oidfed.ErrorInvalidRequest("required parameter 'sub' not given"),
+		)
+	}
+	subConf := config.Get().Features.Federation.Authority.GetSubordinate(sub)
+	if subConf == nil {
+		return sendFederationError(
+			ctx, fiber.StatusNotFound, oidfed.ErrorNotFound("the requested entity identifier is not found"),
+		)
+	}
+	jwt, err := entity.SignEntityStatement(*subordinateStatementPayload(subConf))
+	if err != nil {
+		return sendFederationServerError(ctx, errors.Wrap(err, "could not create subordinate statement JWT"))
+	}
+	return entityStatementResponse(jwt).Send(ctx)
+}
+
+// HandleSubordinateListing handles calls to the federation list endpoint
+func HandleSubordinateListing(ctx *fiber.Ctx) error {
+	for _, p := range []string{
+		"trust_marked",
+		"trust_mark_id",
+		"intermediate",
+	} {
+		if ctx.Query(p) != "" {
+			return sendFederationError(
+				ctx, fiber.StatusBadRequest, oidfed.ErrorUnsupportedParameter("parameter '"+p+"' is not supported"),
+			)
+		}
+	}
+	entityType := ctx.Query("entity_type")
+	entityIDs := []string{}
+	for _, sub := range config.Get().Features.Federation.Authority.Subordinates {
+		if entityType == "" || sub.HasEntityType(entityType) {
+			entityIDs = append(entityIDs, sub.EntityID)
+		}
+	}
+	return ctx.JSON(entityIDs)
+}
+
+// maxResolveCacheLifetime is the maximum time a resolve response is cached
+const maxResolveCacheLifetime = time.Hour
+
+// configuredTrustAnchor returns the configured trust anchor with the passed entity id or nil if there is no such
+// trust anchor; mytoken itself is a trust anchor if it acts as an authority
+func configuredTrustAnchor(anchor string) *oidfed.TrustAnchor {
+	federation := config.Get().Features.Federation
+	if anchor == federation.Entity.EntityID {
+		return &oidfed.TrustAnchor{
+			EntityID: anchor,
+			JWKS:     jws.GetJWKS(jws.KeyUsageFederation),
+		}
+	}
+	for _, ta := range federation.TrustAnchors {
+		if ta.EntityID == anchor {
+			return &ta
+		}
+	}
+	return nil
+}
+
+// trustAnchorForResolve returns the configured trust anchor and its entity configuration; if no jwks is configured
+// for the trust anchor, the keys from its entity configuration are used
+func trustAnchorForResolve(ta *oidfed.TrustAnchor) (*oidfed.EntityStatementPayload, error) {
+	entity := config.Get().Features.Federation.Entity
+	if ta.EntityID == entity.EntityID {
+		return entity.EntityConfigurationPayload(), nil
+	}
+	anchorConfiguration, err := oidfed.GetEntityConfiguration(ta.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if ta.JWKS.Set == nil || ta.JWKS.Len() == 0 {
+		ta.JWKS = anchorConfiguration.JWKS
+	}
+	return &anchorConfiguration.EntityStatementPayload, nil
+}
+
+// checkResolveRequest checks that a resolve request is for one of the configured subordinates and trust anchors, so
+// the resolve endpoint cannot be used to make this server fetch arbitrary urls; it returns the trust anchor or the
+// status and error to send
+func checkResolveRequest(sub, anchor string) (*oidfed.TrustAnchor, int, *oidfed.Error) {
+	var e oidfed.Error
+	if sub == "" {
+		e = oidfed.ErrorInvalidRequest("required parameter 'sub' not given")
+		return nil, fiber.StatusBadRequest, &e
+	}
+	if anchor == "" {
+		e = oidfed.ErrorInvalidRequest("required parameter 'anchor' not given")
+		return nil, fiber.StatusBadRequest, &e
+	}
+	if config.Get().Features.Federation.Authority.GetSubordinate(sub) == nil {
+		e = oidfed.ErrorNotFound("the requested entity identifier is not a subordinate of this entity")
+		return nil, fiber.StatusNotFound, &e
+	}
+	ta := configuredTrustAnchor(anchor)
+	if ta == nil {
+		e = oidfed.ErrorNotFound("the requested trust anchor is not supported")
+		return nil, fiber.StatusNotFound, &e
+	}
+	return ta, 0, nil
+}
+
+// HandleResolve handles calls to the federation resolve endpoint; only the configured subordinates can be resolved
+// to the configured trust anchors. Resolve responses are cached until the trust chain expires, but at most for
+// maxResolveCacheLifetime.
+func HandleResolve(ctx *fiber.Ctx) error {
+	sub := ctx.Query("sub")
+	anchor := ctx.Query("anchor")
+	entityType := ctx.Query("type")
+	ta, status, oidfedErr := checkResolveRequest(sub, anchor)
+	if oidfedErr != nil {
+		return sendFederationError(ctx, status, *oidfedErr)
+	}
+	cacheKey := sub + " " + anchor + " " + entityType
+	var cached []byte
+	if found, err := cache.Get(cache.FederationResolveResponses, cacheKey, &cached); err != nil {
+		logger.GetRequestLogger(ctx).WithError(err).Error("could not get resolve response from cache")
+	} else if found {
+		return resolveResponse(cached).Send(ctx)
+	}
+	taPayload, err := trustAnchorForResolve(ta)
+	if err != nil {
+		return sendFederationError(
+			ctx, fiber.StatusBadRequest,
+			oidfed.ErrorInvalidRequest("could not obtain entity configuration for trust anchor"),
+		)
+	}
+	resolver := oidfed.TrustResolver{
+		TrustAnchors:   oidfed.TrustAnchors{*ta},
+		StartingEntity: sub,
+		Type:           entityType,
+	}
+	chains := resolver.ResolveToValidChains().Filter(oidfed.TrustChainsFilterMinPathLength)
+	if len(chains) == 0 {
+		return sendFederationError(
+			ctx, fiber.StatusNotFound, oidfed.ErrorNotFound("no valid trust path between sub and anchor found"),
+		)
+	}
+	chain := chains[0]
+	// ResolveToValidChains only returns chains with valid metadata, so this cannot fail
+	metadata, _ := chain.Metadata()
+	var trustMarks []oidfed.TrustMarkInfo
+	for _, tm := range chain[0].TrustMarks {
+		if err = tm.VerifyFederation(taPayload); err == nil {
+			trustMarks = append(trustMarks, tm)
+		}
+	}
+	res := oidfed.ResolveResponse{
+		Issuer:     config.Get().Features.Federation.Entity.EntityID,
+		Subject:    sub,
+		IssuedAt:   oidfed.Unixtime{Time: time.Now()},
+		ExpiresAt:  chain.ExpiresAt(),
+		Metadata:   metadata,
+		TrustMarks: trustMarks,
+		TrustChain: chain.Messages(),
+	}
+	jwt, err := oidfed.NewResolveResponseSigner(
+		jws.GetSigningKey(jws.KeyUsageFederation), config.Get().Features.Federation.Signing.Alg,
+	).JWT(res)
+	if err != nil {
+		return sendFederationServerError(ctx, errors.Wrap(err, "could not create resolve response JWT"))
+	}
+	cacheLifetime := min(time.Until(res.ExpiresAt.Time), maxResolveCacheLifetime)
+	if cacheLifetime > 0 {
+		if err = cache.Set(cache.FederationResolveResponses, cacheKey, jwt, cacheLifetime); err != nil {
+			logger.GetRequestLogger(ctx).WithError(err).Error("could not cache resolve response")
+		}
+	}
+	return resolveResponse(jwt).Send(ctx)
+}
@@ -0,0 +1,98 @@
+package federation
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	oidfed "github.com/zachmann/go-oidfed/pkg"
+	"github.com/zachmann/go-oidfed/pkg/jwk"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func setTestFederationConfig(t *testing.T) {
+	federation := config.Get().Features.Federation
+	t.Cleanup(func() { config.Get().Features.Federation = federation })
+	jwks := jwk.NewJWKS()
+	config.Get().Features.Federation.Entity = &oidfed.FederationLeaf{
+		FederationEntity: oidfed.FederationEntity{EntityID: "https://mytoken.example.com"},
+	}
+	config.Get().Features.Federation.TrustAnchors = oidfed.TrustAnchors{{EntityID: "https://ta.example.com"}}
+	config.Get().Features.Federation.Authority = config.FederationAuthorityConf{
+		Enabled:                      true,
+		SubordinateStatementLifetime: 3600,
+		Subordinates: []*config.FederationSubordinateConf{
+			{
+				EntityID: "https://op.example.com",
+				JWKS:     &jwks,
+			},
+		},
+	}
+}
+
+func TestCheckResolveRequest(t *testing.T) {
+	setTestFederationConfig(t)
+	tests := []struct {
+		name      string
+		sub       string
+		anchor    string
+		expStatus int
+	}{
+		{name: "own trust anchor", sub: "https://op.example.com", anchor: "https://mytoken.example.com"},
+		{name: "configured trust anchor", sub: "https://op.example.com", anchor: "https://ta.example.com"},
+		{name: "no sub", anchor: "https://ta.example.com", expStatus: fiber.StatusBadRequest},
+		{name: "no anchor", sub: "https://op.example.com", expStatus: fiber.StatusBadRequest},
+		{
+			name:      "unknown sub",
+			sub:       "https://internal.example.com",
+			anchor:    "https://ta.example.com",
+			expStatus: fiber.StatusNotFound,
+		},
+		{
+			name:      "unknown anchor",
+			sub:       "https://op.example.com",
+			anchor:    "https://other-ta.example.com",
+			expStatus: fiber.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				ta, status, oidfedErr := checkResolveRequest(test.sub, test.anchor)
+				if test.expStatus == 0 {
+					if oidfedErr != nil {
+						t.Fatalf("unexpected error: %+v", *oidfedErr)
+					}
+					if ta.EntityID != test.anchor {
+						t.Errorf("expected trust anchor '%s', got '%s'", test.anchor, ta.EntityID)
+					}
+					return
+				}
+				if oidfedErr == nil {
+					t.Fatal("expected an error")
+				}
+				if status != test.expStatus {
+					t.Errorf("expected status %d, got %d", test.expStatus, status)
+				}
+			},
+		)
+	}
+}
+
+func TestSubordinateStatementPayload(t *testing.T) {
+	setTestFederationConfig(t)
+	sub := config.Get().Features.Federation.Authority.Subordinates[0]
+	payload := subordinateStatementPayload(sub)
+	if payload.Issuer != "https://mytoken.example.com" {
+		t.Errorf("unexpected issuer '%s'", payload.Issuer)
+	}
+	if payload.Subject != sub.EntityID {
+		t.Errorf("unexpected subject '%s'", payload.Subject)
+	}
+	if payload.JWKS.Set != sub.JWKS.Set {
+		t.Error("expected the pinned jwks of the subordinate")
+	}
+	if lifetime := payload.ExpiresAt.Sub(payload.IssuedAt.Time); lifetime.Seconds() != 3600 {
+		t.Errorf("unexpected lifetime %s", lifetime)
+	}
+}
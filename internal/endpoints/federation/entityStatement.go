@@ -7,6 +7,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 	oidfed "github.com/zachmann/go-oidfed/pkg"
+	"github.com/zachmann/go-oidfed/pkg/constants"
 
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/jws"
@@ -24,10 +25,36 @@ func InitEntityConfiguration() {
 	privacyURI := utils.CombineURLPath(config.Get().IssuerURL, otherPaths.Privacy)
 	var err error
 	jwks := jws.GetJWKS(jws.KeyUsageOIDCSigning)
+	trustAnchors := config.Get().Features.Federation.TrustAnchors
+	federationEntityMetadata := &oidfed.FederationEntityMetadata{
+		OrganizationName: config.Get().ServiceOperator.Name,
+		Contacts:         []string{config.Get().ServiceOperator.Contact},
+		LogoURI:          utils.CombineURLPath(config.Get().IssuerURL, "static/img/mytoken.png"),
+		PolicyURI:        privacyURI,
+		HomepageURI:      "https://mytoken-docs.data.kit.edu",
+	}
+	if config.Get().Features.Federation.Authority.Enabled {
+		federationEntityMetadata.FederationFetchEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL, otherPaths.FederationFetchEndpoint,
+		)
+		federationEntityMetadata.FederationListEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL, otherPaths.FederationListEndpoint,
+		)
+		federationEntityMetadata.FederationResolveEndpoint = utils.CombineURLPath(
+			config.Get().IssuerURL, otherPaths.FederationResolveEndpoint,
+		)
+		// mytoken anchors trust for its subordinates, so it is a trust anchor for itself
+		trustAnchors = append(
+			trustAnchors, oidfed.TrustAnchor{
+				EntityID: config.Get().IssuerURL,
+				JWKS:     jws.GetJWKS(jws.KeyUsageFederation),
+			},
+		)
+	}
 	config.Get().Features.Federation.Entity, err = oidfed.NewFederationLeaf(
 		config.Get().IssuerURL,
 		config.Get().Features.Federation.AuthorityHints,
-		config.Get().Features.Federation.TrustAnchors,
+		trustAnchors,
 		&oidfed.Metadata{
 			RelyingParty: &oidfed.OpenIDRelyingPartyMetadata{
 				RedirectURIS: []string{
@@ -39,26 +66,24 @@ func InitEntityConfiguration() {
 					"refresh_token",
 					"authorization_code",
 				},
-				ApplicationType:         "web",
-				Contacts:                []string{config.Get().ServiceOperator.Contact},
-				ClientName:              "mytoken",
-				LogoURI:                 utils.CombineURLPath(config.Get().IssuerURL, "static/img/mytoken.png"),
-				ClientURI:               config.Get().IssuerURL,
-				PolicyURI:               privacyURI,
-				TOSURI:                  privacyURI,
-				JWKS:                    &jwks,
-				SoftwareID:              version.SOFTWAREID,
-				SoftwareVersion:         version.VERSION,
-				OrganizationName:        config.Get().ServiceOperator.Name,
-				ClientRegistrationTypes: []string{oidfed.ClientRegistrationTypeAutomatic},
-			},
-			FederationEntity: &oidfed.FederationEntityMetadata{
-				OrganizationName: config.Get().ServiceOperator.Name,
+				ApplicationType:  "web",
 				Contacts:         []string{config.Get().ServiceOperator.Contact},
+				ClientName:       "mytoken",
 				LogoURI:          utils.CombineURLPath(config.Get().IssuerURL, "static/img/mytoken.png"),
+				ClientURI:        config.Get().IssuerURL,
 				PolicyURI:        privacyURI,
-				HomepageURI:      "https://mytoken-docs.data.kit.edu",
+				TOSURI:           privacyURI,
+				JWKS:             &jwks,
+				SoftwareID:       version.SOFTWAREID,
+				SoftwareVersion:  version.VERSION,
+				OrganizationName: config.Get().ServiceOperator.Name,
+				ClientRegistrationTypes: []string{
+					oidfed.ClientRegistrationTypeAutomatic,
+					oidfed.ClientRegistrationTypeExplicit,
+				},
+				TokenEndpointAuthMethod: "private_key_jwt",
 			},
+			FederationEntity: federationEntityMetadata,
 		},
 		oidfed.NewEntityStatementSigner(
 			jws.GetSigningKey(jws.KeyUsageFederation),
@@ -77,7 +102,7 @@ type entityStatementResponse []byte
 
 // Send sends this response using the passed fiber.Ctx
 func (r entityStatementResponse) Send(ctx *fiber.Ctx) error {
-	ctx.Set("content-type", "application/entity-statement+jwt")
+	ctx.Set("content-type", constants.ContentTypeEntityStatement)
 	return ctx.Status(fasthttp.StatusOK).Send(r)
 }
 
@@ -0,0 +1,552 @@
+package calendar
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo/calendarrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// Additional http methods used by (Cal)DAV
+const (
+	MethodPropfind   = "PROPFIND"
+	MethodProppatch  = "PROPPATCH"
+	MethodReport     = "REPORT"
+	MethodMkcol      = "MKCOL"
+	MethodMkcalendar = "MKCALENDAR"
+)
+
+// CalDAVMethods are the non-standard http methods that must be accepted by the server for CalDAV
+var CalDAVMethods = []string{MethodPropfind, MethodProppatch, MethodReport, MethodMkcol, MethodMkcalendar}
+
+// CalDAVWriteMethods are the methods that would modify a calendar; since calendars are read-only via CalDAV, these
+// are rejected
+var CalDAVWriteMethods = []string{
+	fiber.MethodPut, fiber.MethodDelete, fiber.MethodPost, MethodProppatch, MethodMkcol, MethodMkcalendar,
+}
+
+const calDAVAllow = "OPTIONS, GET, HEAD, PROPFIND, REPORT"
+
+const contentTypeCalendarResource = "text/calendar; charset=utf-8; component=VEVENT"
+
+// davResource is a single CalDAV resource of a calendar, i.e. a calendar holding the event for one mytoken
+type davResource struct {
+	name  string
+	etag  string
+	data  string
+	start time.Time
+}
+
+func newDAVResource(event *ics.VEvent) *davResource {
+	cal := ics.NewCalendar()
+	cal.AddVEvent(event)
+	data := cal.Serialize()
+	start, _ := event.GetStartAt()
+	sum := sha256.Sum256([]byte(data))
+	// The event ids are base64 encoded hashes which are not safe to be used in a path
+	id := sha256.Sum256([]byte(event.Id()))
+	return &davResource{
+		name:  fmt.Sprintf("%x.ics", id[:16]),
+		etag:  fmt.Sprintf(`"%x"`, sum[:16]),
+		data:  data,
+		start: start,
+	}
+}
+
+// davCalendar is a calendar as it is served via CalDAV
+type davCalendar struct {
+	info      calendarrepo.CalendarInfo
+	names     []string
+	resources map[string]*davResource
+	// states holds the sync state of all resources that were ever part of the calendar
+	states []calendarrepo.Resource
+}
+
+func (c *davCalendar) etag() string {
+	return fmt.Sprintf(`"%d"`, c.info.SyncToken)
+}
+
+func (c *davCalendar) href() string {
+	return utils.CombineURLPath(calDAVBasePath(), c.info.ID) + "/"
+}
+
+func (c *davCalendar) resourceHref(name string) string {
+	return c.href() + name
+}
+
+func calDAVBasePath() string {
+	u, err := url.Parse(routes.CalDAVEndpoint)
+	if err != nil {
+		return routes.CalDAVEndpoint
+	}
+	return u.Path
+}
+
+func syncTokenPrefix() string {
+	return utils.CombineURLPath(routes.CalDAVEndpoint, "sync") + "/"
+}
+
+func formatSyncToken(t uint64) string {
+	return syncTokenPrefix() + strconv.FormatUint(t, 10)
+}
+
+func parseSyncToken(s string) (uint64, bool) {
+	if !strings.HasPrefix(s, syncTokenPrefix()) {
+		return 0, false
+	}
+	t, err := strconv.ParseUint(strings.TrimPrefix(s, syncTokenPrefix()), 10, 64)
+	return t, err == nil
+}
+
+// loadDAVCalendar loads the calendar with the passed id and updates the sync state of its resources; if the calendar
+// does not exist nil is returned
+func loadDAVCalendar(rlog logrus.Ext1FieldLogger, id string) (cal *davCalendar, err error) {
+	err = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			// The calendar is locked, so concurrent requests do not derive the same next sync token for different
+			// changes
+			info, err := calendarrepo.GetByIDForUpdate(rlog, tx, id)
+			if err != nil {
+				return err
+			}
+			if err = pruneICS(rlog, tx, &info); err != nil {
+				return err
+			}
+			cal, err = syncDAVResources(rlog, tx, info)
+			return err
+		},
+	)
+	if err != nil {
+		if found, e := db.ParseError(err); !found && e == nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return
+}
+
+// syncDAVResources compares the events of a calendar with the stored sync state of its resources and stores the
+// changes; the database is only written if an event was added, changed, or removed
+func syncDAVResources(rlog logrus.Ext1FieldLogger, tx *sqlx.Tx, info calendarrepo.CalendarInfo) (
+	*davCalendar, error,
+) {
+	states, err := calendarrepo.GetResources(rlog, tx, info.ID)
+	if err != nil {
+		return nil, err
+	}
+	cal, changes, err := diffDAVResources(info, states)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return cal, nil
+	}
+	for _, s := range changes {
+		if s.Deleted {
+			err = calendarrepo.DeleteResource(rlog, tx, info.ID, s.Name, s.SyncToken)
+		} else {
+			err = calendarrepo.SetResource(rlog, tx, info.ID, s)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = calendarrepo.SetSyncToken(rlog, tx, info.ID, cal.info.SyncToken); err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// diffDAVResources compares the events of a calendar with the passed sync state of its resources; if an event was
+// added, changed, or removed, the sync token of the returned calendar is increased and the changed resource states,
+// which carry the new sync token, are returned
+func diffDAVResources(info calendarrepo.CalendarInfo, states []calendarrepo.Resource) (
+	*davCalendar, []calendarrepo.Resource, error,
+) {
+	parsed, err := ics.ParseCalendar(strings.NewReader(info.ICS))
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	cal := &davCalendar{
+		info:      info,
+		resources: make(map[string]*davResource),
+		states:    states,
+	}
+	for _, e := range parsed.Events() {
+		r := newDAVResource(e)
+		cal.resources[r.name] = r
+		cal.names = append(cal.names, r.name)
+	}
+	sort.Strings(cal.names)
+	next := info.SyncToken + 1
+	var changes []calendarrepo.Resource
+	known := make(map[string]bool)
+	for i, s := range cal.states {
+		known[s.Name] = true
+		r, current := cal.resources[s.Name]
+		if current && (s.Deleted || s.ETag != r.etag) {
+			cal.states[i] = calendarrepo.Resource{
+				Name:      s.Name,
+				ETag:      r.etag,
+				SyncToken: next,
+			}
+			changes = append(changes, cal.states[i])
+		} else if !current && !s.Deleted {
+			cal.states[i].Deleted = true
+			cal.states[i].SyncToken = next
+			changes = append(changes, cal.states[i])
+		}
+	}
+	for _, name := range cal.names {
+		if known[name] {
+			continue
+		}
+		s := calendarrepo.Resource{
+			Name:      name,
+			ETag:      cal.resources[name].etag,
+			SyncToken: next,
+		}
+		cal.states = append(cal.states, s)
+		changes = append(changes, s)
+	}
+	if len(changes) > 0 {
+		cal.info.SyncToken = next
+	}
+	return cal, changes, nil
+}
+
+// syncCollectionResponses returns the responses for a sync-collection report for the changes since the passed sync
+// token; for an initial sync (since is 0) deleted resources are omitted
+func (c *davCalendar) syncCollectionResponses(since uint64, names []xml.Name) []davResponse {
+	var responses []davResponse
+	for _, s := range c.states {
+		if s.SyncToken <= since {
+			continue
+		}
+		if s.Deleted {
+			if since > 0 {
+				responses = append(responses, c.notFoundResponse(s.Name))
+			}
+			continue
+		}
+		responses = append(responses, c.resourceResponse(c.resources[s.Name], names, false))
+	}
+	return responses
+}
+
+func collectionPropNames() []xml.Name {
+	return []xml.Name{
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "displayname"},
+		{Space: nsDAV, Local: "getetag"},
+		{Space: nsDAV, Local: "sync-token"},
+		{Space: nsDAV, Local: "current-user-principal"},
+		{Space: nsDAV, Local: "current-user-privilege-set"},
+		{Space: nsDAV, Local: "supported-report-set"},
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"},
+		{Space: nsCalendarServer, Local: "getctag"},
+	}
+}
+
+func resourcePropNames() []xml.Name {
+	return []xml.Name{
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "getetag"},
+		{Space: nsDAV, Local: "getcontenttype"},
+		{Space: nsDAV, Local: "getcontentlength"},
+	}
+}
+
+func (c *davCalendar) collectionProp(name xml.Name) (string, bool) {
+	switch name {
+	case xml.Name{Space: nsDAV, Local: "resourcetype"}:
+		return fmt.Sprintf(`<collection/><calendar xmlns=%q/>`, nsCalDAV), true
+	case xml.Name{Space: nsDAV, Local: "displayname"}:
+		return escapeXML(c.info.Name), true
+	case xml.Name{Space: nsDAV, Local: "getetag"}:
+		return escapeXML(c.etag()), true
+	case xml.Name{Space: nsDAV, Local: "sync-token"}:
+		return escapeXML(formatSyncToken(c.info.SyncToken)), true
+	case xml.Name{Space: nsDAV, Local: "current-user-principal"}:
+		// Calendars are accessed by their secret url and not by an authenticated user
+		return `<unauthenticated/>`, true
+	case xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}:
+		return `<privilege><read/></privilege>`, true
+	case xml.Name{Space: nsDAV, Local: "supported-report-set"}:
+		return fmt.Sprintf(
+			`<supported-report><report><sync-collection/></report></supported-report>`+
+				`<supported-report><report><calendar-multiget xmlns=%q/></report></supported-report>`+
+				`<supported-report><report><calendar-query xmlns=%q/></report></supported-report>`,
+			nsCalDAV, nsCalDAV,
+		), true
+	case xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}:
+		return `<comp name="VEVENT"/>`, true
+	case xml.Name{Space: nsCalendarServer, Local: "getctag"}:
+		return escapeXML(c.etag()), true
+	}
+	return "", false
+}
+
+func resourceProp(r *davResource, name xml.Name) (string, bool) {
+	switch name {
+	case xml.Name{Space: nsDAV, Local: "resourcetype"}:
+		return "", true
+	case xml.Name{Space: nsDAV, Local: "getetag"}:
+		return escapeXML(r.etag), true
+	case xml.Name{Space: nsDAV, Local: "getcontenttype"}:
+		return contentTypeCalendarResource, true
+	case xml.Name{Space: nsDAV, Local: "getcontentlength"}:
+		return strconv.Itoa(len(r.data)), true
+	case xml.Name{Space: nsCalDAV, Local: "calendar-data"}:
+		return escapeXML(r.data), true
+	}
+	return "", false
+}
+
+// propstats returns the propstat elements for the passed property names; properties that cannot be obtained are
+// returned as not found. If namesOnly is set, the properties are returned without values.
+func propstats(names []xml.Name, prop func(xml.Name) (string, bool), namesOnly bool) []davPropstat {
+	var found, missing []davProp
+	for _, n := range names {
+		v, ok := prop(n)
+		if !ok {
+			missing = append(missing, davProp{XMLName: n})
+			continue
+		}
+		if namesOnly {
+			v = ""
+		}
+		found = append(
+			found, davProp{
+				XMLName: n,
+				Value:   v,
+			},
+		)
+	}
+	var stats []davPropstat
+	if len(found) > 0 {
+		stats = append(
+			stats, davPropstat{
+				Prop:   davPropList{Props: found},
+				Status: davStatusOK,
+			},
+		)
+	}
+	if len(missing) > 0 {
+		stats = append(
+			stats, davPropstat{
+				Prop:   davPropList{Props: missing},
+				Status: davStatusNotFound,
+			},
+		)
+	}
+	return stats
+}
+
+func (c *davCalendar) collectionResponse(names []xml.Name, namesOnly bool) davResponse {
+	return davResponse{
+		Href:      c.href(),
+		Propstats: propstats(names, c.collectionProp, namesOnly),
+	}
+}
+
+func (c *davCalendar) resourceResponse(r *davResource, names []xml.Name, namesOnly bool) davResponse {
+	return davResponse{
+		Href: c.resourceHref(r.name),
+		Propstats: propstats(
+			names, func(n xml.Name) (string, bool) {
+				return resourceProp(r, n)
+			}, namesOnly,
+		),
+	}
+}
+
+func (c *davCalendar) notFoundResponse(name string) davResponse {
+	return davResponse{
+		Href:   c.resourceHref(name),
+		Status: davStatusNotFound,
+	}
+}
+
+func sendXML(ctx *fiber.Ctx, status int, v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(errors.WithStack(err)).Send(ctx)
+	}
+	ctx.Status(status)
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+	return ctx.Send(append([]byte(xml.Header), data...))
+}
+
+func sendDAVError(ctx *fiber.Ctx, status int, condition xml.Name) error {
+	return sendXML(ctx, status, davError{Condition: davProp{XMLName: condition}})
+}
+
+// sendWithETag sends the passed content with an ETag header; if the client already has the current content, only
+// the status 304 is returned
+func sendWithETag(ctx *fiber.Ctx, etag, contentType, content string) error {
+	ctx.Set(fiber.HeaderETag, etag)
+	if match := ctx.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, m := range strings.Split(match, ",") {
+			if m = strings.TrimSpace(m); m == etag || m == "*" {
+				return ctx.SendStatus(fiber.StatusNotModified)
+			}
+		}
+	}
+	ctx.Set(fiber.HeaderContentType, contentType)
+	return ctx.SendString(content)
+}
+
+// calDAVRequestCalendar loads the calendar of a CalDAV request; if nil is returned the response was already sent
+func calDAVRequestCalendar(ctx *fiber.Ctx, rlog logrus.Ext1FieldLogger) (*davCalendar, error) {
+	cal, err := loadDAVCalendar(rlog, ctx.Params("id"))
+	if err != nil {
+		return nil, model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+	}
+	if cal == nil {
+		return nil, ctx.SendStatus(fiber.StatusNotFound)
+	}
+	return cal, nil
+}
+
+// requestResource returns the name of the requested resource or an empty string if the collection is requested
+func requestResource(ctx *fiber.Ctx) string {
+	name, _ := url.PathUnescape(ctx.Params("resource"))
+	return name
+}
+
+// HandleCalDAVOptions handles an OPTIONS request for a CalDAV calendar or resource
+func HandleCalDAVOptions(ctx *fiber.Ctx) error {
+	ctx.Set("DAV", "1, 3, calendar-access")
+	ctx.Set(fiber.HeaderAllow, calDAVAllow)
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// HandleCalDAVReadOnly rejects requests that would modify a calendar
+func HandleCalDAVReadOnly(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderAllow, calDAVAllow)
+	return ctx.SendStatus(fiber.StatusMethodNotAllowed)
+}
+
+// HandleCalDAVGet returns a single resource of a calendar or the whole calendar if the collection is requested
+func HandleCalDAVGet(ctx *fiber.Ctx) error {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle caldav get request")
+	cal, err := calDAVRequestCalendar(ctx, rlog)
+	if cal == nil {
+		return err
+	}
+	name := requestResource(ctx)
+	if name == "" {
+		return sendWithETag(ctx, cal.etag(), "text/calendar", cal.info.ICS)
+	}
+	r, ok := cal.resources[name]
+	if !ok {
+		return ctx.SendStatus(fiber.StatusNotFound)
+	}
+	return sendWithETag(ctx, r.etag, contentTypeCalendarResource, r.data)
+}
+
+// HandleCalDAVPropfind handles a PROPFIND request for a CalDAV calendar or resource
+func HandleCalDAVPropfind(ctx *fiber.Ctx) error {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle caldav propfind request")
+	var req davPropfind
+	if len(ctx.Body()) > 0 {
+		if err := xml.Unmarshal(ctx.Body(), &req); err != nil {
+			return model.ErrorToBadRequestErrorResponse(errors.WithStack(err)).Send(ctx)
+		}
+	}
+	cal, err := calDAVRequestCalendar(ctx, rlog)
+	if cal == nil {
+		return err
+	}
+	namesOnly := req.PropName != nil
+	var responses []davResponse
+	if name := requestResource(ctx); name != "" {
+		r, ok := cal.resources[name]
+		if !ok {
+			return ctx.SendStatus(fiber.StatusNotFound)
+		}
+		responses = append(responses, cal.resourceResponse(r, requested(req.Prop, resourcePropNames), namesOnly))
+	} else {
+		responses = append(responses, cal.collectionResponse(requested(req.Prop, collectionPropNames), namesOnly))
+		if ctx.Get("Depth") != "0" {
+			names := requested(req.Prop, resourcePropNames)
+			for _, n := range cal.names {
+				responses = append(responses, cal.resourceResponse(cal.resources[n], names, namesOnly))
+			}
+		}
+	}
+	return sendXML(ctx, fiber.StatusMultiStatus, davMultistatus{Responses: responses})
+}
+
+// HandleCalDAVReport handles a REPORT request for a CalDAV calendar; the calendar-multiget, calendar-query, and
+// sync-collection reports are supported
+func HandleCalDAVReport(ctx *fiber.Ctx) error {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle caldav report request")
+	var req davReport
+	if err := xml.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(errors.WithStack(err)).Send(ctx)
+	}
+	cal, err := calDAVRequestCalendar(ctx, rlog)
+	if cal == nil {
+		return err
+	}
+	names := requested(req.Prop, resourcePropNames)
+	var ms davMultistatus
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			p, err := url.PathUnescape(href)
+			if err != nil {
+				p = href
+			}
+			name := path.Base(p)
+			if r, ok := cal.resources[name]; ok {
+				ms.Responses = append(ms.Responses, cal.resourceResponse(r, names, false))
+			} else {
+				ms.Responses = append(ms.Responses, cal.notFoundResponse(name))
+			}
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		for _, n := range cal.names {
+			if r := cal.resources[n]; req.Filter.matches(r.start) {
+				ms.Responses = append(ms.Responses, cal.resourceResponse(r, names, false))
+			}
+		}
+	case xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		var since uint64
+		if req.SyncToken != "" {
+			var ok bool
+			since, ok = parseSyncToken(req.SyncToken)
+			if !ok || since > cal.info.SyncToken {
+				return sendDAVError(ctx, fiber.StatusForbidden, xml.Name{Space: nsDAV, Local: "valid-sync-token"})
+			}
+		}
+		ms.Responses = cal.syncCollectionResponses(since, names)
+		ms.SyncToken = formatSyncToken(cal.info.SyncToken)
+	default:
+		return sendDAVError(ctx, fiber.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+	}
+	return sendXML(ctx, fiber.StatusMultiStatus, ms)
+}
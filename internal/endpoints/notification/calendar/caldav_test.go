@@ -0,0 +1,170 @@
+package calendar
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo/calendarrepo"
+)
+
+func TestDavFilter_matches(t *testing.T) {
+	expiration := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	filter := func(compName string, tr *davTimeRange) *davFilter {
+		return &davFilter{
+			CompFilter: davCompFilter{
+				Name: "VCALENDAR",
+				CompFilters: []davCompFilter{
+					{
+						Name:      compName,
+						TimeRange: tr,
+					},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		filter   *davFilter
+		expected bool
+	}{
+		{name: "no filter", expected: true},
+		{name: "events", filter: filter("VEVENT", nil), expected: true},
+		{name: "todos", filter: filter("VTODO", nil), expected: false},
+		{
+			name:     "within range",
+			filter:   filter("VEVENT", &davTimeRange{Start: "20240501T000000Z", End: "20240601T000000Z"}),
+			expected: true,
+		},
+		{
+			name:     "before range",
+			filter:   filter("VEVENT", &davTimeRange{Start: "20240511T000000Z", End: "20240601T000000Z"}),
+			expected: false,
+		},
+		{
+			name:     "end of range is exclusive",
+			filter:   filter("VEVENT", &davTimeRange{Start: "20240501T000000Z", End: "20240510T120000Z"}),
+			expected: false,
+		},
+		{
+			name:     "open range",
+			filter:   filter("VEVENT", &davTimeRange{Start: "20240510T120000Z"}),
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := test.filter.matches(expiration); got != test.expected {
+					t.Errorf("Expected %v, but got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestDavReport_unmarshal(t *testing.T) {
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<D:sync-collection xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:sync-token>http://example.com/caldav/sync/3</D:sync-token>
+  <D:sync-level>1</D:sync-level>
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+</D:sync-collection>`
+	var req davReport
+	if err := xml.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.XMLName != (xml.Name{Space: nsDAV, Local: "sync-collection"}) {
+		t.Errorf("Unexpected report '%v'", req.XMLName)
+	}
+	if req.SyncToken != "http://example.com/caldav/sync/3" {
+		t.Errorf("Unexpected sync token '%s'", req.SyncToken)
+	}
+	names := requested(req.Prop, resourcePropNames)
+	expected := []xml.Name{{Space: nsDAV, Local: "getetag"}, {Space: nsCalDAV, Local: "calendar-data"}}
+	if len(names) != len(expected) || names[0] != expected[0] || names[1] != expected[1] {
+		t.Errorf("Expected properties %v, but got %v", expected, names)
+	}
+}
+
+func testICS(events map[string]time.Time) string {
+	cal := ics.NewCalendar()
+	for id, start := range events {
+		e := cal.AddEvent(id)
+		e.SetStartAt(start)
+		e.SetDtStampTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	return cal.Serialize()
+}
+
+func TestDiffDAVResources(t *testing.T) {
+	start := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	info := calendarrepo.CalendarInfo{
+		ID:  "cal",
+		ICS: testICS(map[string]time.Time{"a": start, "b": start}),
+	}
+	cal, changes, err := diffDAVResources(info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || cal.info.SyncToken != 1 {
+		t.Fatalf("expected two added resources with sync token 1, got %+v and %d", changes, cal.info.SyncToken)
+	}
+
+	info.SyncToken = cal.info.SyncToken
+	_, changes, err = diffDAVResources(info, cal.states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes for an unchanged calendar, got %+v", changes)
+	}
+
+	// "b" changed and "a" was removed
+	info.ICS = testICS(map[string]time.Time{"b": start.Add(time.Hour)})
+	cal, changes, err = diffDAVResources(info, cal.states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || cal.info.SyncToken != 2 {
+		t.Fatalf("expected two changed resources with sync token 2, got %+v and %d", changes, cal.info.SyncToken)
+	}
+	deleted := 0
+	for _, c := range changes {
+		if c.SyncToken != 2 {
+			t.Errorf("change %+v does not carry the new sync token", c)
+		}
+		if c.Deleted {
+			deleted++
+		}
+	}
+	if deleted != 1 {
+		t.Errorf("expected one deleted resource, got %d", deleted)
+	}
+
+	// Initial sync omits deleted resources, an incremental sync reports them
+	if responses := cal.syncCollectionResponses(0, nil); len(responses) != 1 || responses[0].Status != "" {
+		t.Errorf("unexpected responses for an initial sync: %+v", responses)
+	}
+	responses := cal.syncCollectionResponses(1, nil)
+	if len(responses) != 2 {
+		t.Fatalf("expected two responses for an incremental sync, got %+v", responses)
+	}
+	notFound := 0
+	for _, r := range responses {
+		if r.Status == davStatusNotFound {
+			notFound++
+		}
+	}
+	if notFound != 1 {
+		t.Errorf("expected one deleted resource in an incremental sync, got %d", notFound)
+	}
+	if responses = cal.syncCollectionResponses(2, nil); len(responses) != 0 {
+		t.Errorf("expected no responses for the current sync token, got %+v", responses)
+	}
+}
@@ -0,0 +1,148 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+)
+
+// XML namespaces used by CalDAV
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// Status lines used in multistatus responses
+const (
+	davStatusOK       = "HTTP/1.1 200 OK"
+	davStatusNotFound = "HTTP/1.1 404 Not Found"
+)
+
+// davTimeFormat is the format of the times in a CalDAV time-range filter
+const davTimeFormat = "20060102T150405Z"
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"response"`
+	SyncToken string        `xml:"sync-token,omitempty"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"href"`
+	Propstats []davPropstat `xml:"propstat,omitempty"`
+	Status    string        `xml:"status,omitempty"`
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"prop"`
+	Status string      `xml:"status"`
+}
+
+type davPropList struct {
+	Props []davProp
+}
+
+// davProp is a property in a multistatus response; the element name is taken from XMLName, Value must already be
+// valid xml
+type davProp struct {
+	XMLName xml.Name
+	Value   string `xml:",innerxml"`
+}
+
+type davError struct {
+	XMLName   xml.Name `xml:"DAV: error"`
+	Condition davProp
+}
+
+type davPropfind struct {
+	XMLName  xml.Name      `xml:"DAV: propfind"`
+	AllProp  *struct{}     `xml:"DAV: allprop"`
+	PropName *struct{}     `xml:"DAV: propname"`
+	Prop     *davPropNames `xml:"DAV: prop"`
+}
+
+type davPropNames struct {
+	Names []davAnyElement `xml:",any"`
+}
+
+type davAnyElement struct {
+	XMLName xml.Name
+}
+
+// davReport holds the elements of all supported REPORT requests; which ones are set depends on the report
+type davReport struct {
+	XMLName   xml.Name
+	AllProp   *struct{}     `xml:"DAV: allprop"`
+	Prop      *davPropNames `xml:"DAV: prop"`
+	Hrefs     []string      `xml:"DAV: href"`
+	SyncToken string        `xml:"DAV: sync-token"`
+	Filter    *davFilter    `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type davFilter struct {
+	CompFilter davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type davCompFilter struct {
+	Name        string          `xml:"name,attr"`
+	TimeRange   *davTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type davTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// requested returns the names of the properties requested with the passed prop element; if no properties are
+// requested, all returns the properties of the allprop request
+func requested(prop *davPropNames, all func() []xml.Name) []xml.Name {
+	if prop == nil {
+		return all()
+	}
+	names := make([]xml.Name, len(prop.Names))
+	for i, n := range prop.Names {
+		names[i] = n.XMLName
+	}
+	return names
+}
+
+// matches checks if an event starting at start matches the filter; since calendars only contain events, only
+// time-range filters on VEVENTs are evaluated
+func (f *davFilter) matches(start time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.CompFilter.Name != "VCALENDAR" {
+		return false
+	}
+	for _, cf := range f.CompFilter.CompFilters {
+		if cf.Name != "VEVENT" {
+			return false
+		}
+		if cf.TimeRange != nil && !cf.TimeRange.contains(start) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains checks if the passed time lies within the time range; events are instantaneous so this is the overlap
+// check of RFC 4791 for events with a zero duration
+func (r davTimeRange) contains(t time.Time) bool {
+	if start, err := time.Parse(davTimeFormat, r.Start); err == nil && t.Before(start) {
+		return false
+	}
+	if end, err := time.Parse(davTimeFormat, r.End); err == nil && !t.Before(end) {
+		return false
+	}
+	return true
+}
+
+// escapeXML escapes a string, so it can be used as the value of a davProp
+func escapeXML(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package calendar
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"strings"
@@ -31,6 +32,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/internal/utils/auth"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	"github.com/oidc-mytoken/server/internal/utils/logger"
 	"github.com/oidc-mytoken/server/internal/utils/mytokenutils"
 )
@@ -50,39 +52,68 @@ func HandleGetICS(ctx *fiber.Ctx) error {
 			if err != nil {
 				return err
 			}
+			return pruneICS(rlog, tx, &info)
+		},
+	); err != nil {
+		_, e := db.ParseError(err)
+		if e != nil {
+			return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+		}
+		return calendarNotFoundError.Send(ctx)
+	}
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename=%q`, info.Name))
+	sum := sha256.Sum256([]byte(info.ICS))
+	return sendWithETag(ctx, fmt.Sprintf(`"%x"`, sum[:16]), "text/calendar", info.ICS)
+}
 
-			cal, err := ics.ParseCalendar(strings.NewReader(info.ICS))
-			if err != nil {
-				return err
-			}
-			mtids, err := calendarrepo.GetMTsInCalendar(rlog, tx, info.ID)
+// pruneICS removes the events of mytokens that are no longer part of the calendar from the calendar's ics
+func pruneICS(rlog logrus.Ext1FieldLogger, tx *sqlx.Tx, info *calendarrepo.CalendarInfo) error {
+	cal, err := ics.ParseCalendar(strings.NewReader(info.ICS))
+	if err != nil {
+		return err
+	}
+	mtids, err := calendarrepo.GetMTsInCalendar(rlog, tx, info.ID)
+	if err != nil {
+		return err
+	}
+	for _, e := range cal.Events() {
+		id := e.Id()
+		if !utils.StringInSlice(id, mtids) {
+			cal.RemoveEvent(id)
+			cal.SetLastModified(time.Now())
+		}
+	}
+	newICS := cal.Serialize()
+	if newICS != info.ICS {
+		info.ICS = newICS
+		return calendarrepo.UpdateInternal(rlog, tx, *info)
+	}
+	return nil
+}
+
+// GetICSByName returns the calendar with the passed name for the user of a mytoken
+func GetICSByName(rlog logrus.Ext1FieldLogger, mtID mtid.MTID, name string) (
+	*calendarrepo.CalendarInfo,
+	*model.Response,
+) {
+	var info calendarrepo.CalendarInfo
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			var err error
+			info, err = calendarrepo.Get(rlog, tx, mtID, name)
 			if err != nil {
 				return err
 			}
-			for _, e := range cal.Events() {
-				id := e.Id()
-				if !utils.StringInSlice(id, mtids) {
-					cal.RemoveEvent(id)
-					cal.SetLastModified(time.Now())
-				}
-			}
-			newICS := cal.Serialize()
-			if newICS != info.ICS {
-				info.ICS = newICS
-				return calendarrepo.UpdateInternal(rlog, tx, info)
-			}
-			return nil
+			return pruneICS(rlog, tx, &info)
 		},
 	); err != nil {
 		_, e := db.ParseError(err)
 		if e != nil {
-			return model.ErrorToInternalServerErrorResponse(err).Send(ctx)
+			return nil, model.ErrorToInternalServerErrorResponse(err)
 		}
-		return calendarNotFoundError.Send(ctx)
+		return nil, calendarNotFoundError
 	}
-	ctx.Set(fiber.HeaderContentType, "text/calendar")
-	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename=%q`, info.Name))
-	return ctx.SendString(info.ICS)
+	return &info, nil
 }
 
 // HandleAdd handles a request to create a new calendar
@@ -228,9 +259,16 @@ func HandleList(ctx *fiber.Ctx) *model.Response {
 	if errRes != nil {
 		return errRes
 	}
+	return ListCalendars(rlog, mt, &umt, ctxutils.ClientMetaData(ctx))
+}
+
+// ListCalendars lists all calendars for the user of an already validated mytoken
+func ListCalendars(
+	rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken, umt *universalmytoken.UniversalMytoken,
+	clientMetadata *api.ClientMetaData,
+) *model.Response {
 	usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
-		rlog, nil, mt,
-		ctxutils.ClientMetaData(ctx), api.CapabilityNotifyAnyTokenRead,
+		rlog, nil, mt, clientMetadata, api.CapabilityNotifyAnyTokenRead,
 	)
 	if errRes != nil {
 		return errRes
@@ -248,7 +286,7 @@ func HandleList(ctx *fiber.Ctx) *model.Response {
 			}
 			var rollback bool
 			res, rollback = mytokenutils.DoAfterRequestThingsOther(
-				rlog, tx, res, mt, *ctxutils.ClientMetaData(ctx),
+				rlog, tx, res, mt, *clientMetadata,
 				api.EventCalendarListed, "", usedRestriction, umt.JWT, umt.OriginalTokenType,
 			)
 			if rollback {
@@ -264,14 +302,13 @@ func HandleList(ctx *fiber.Ctx) *model.Response {
 
 // HandleCalendarEntryViaMail creates a calendar entry for a mytoken and sends it via mail
 func HandleCalendarEntryViaMail(
-	ctx *fiber.Ctx, rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken,
-	req pkg4.SubscribeNotificationRequest,
+	rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken, req pkg4.SubscribeNotificationRequest,
+	clientMetadata *api.ClientMetaData,
 ) *model.Response {
 	rlog.Debug("Handle calendar entry via mail request")
 	var res *model.Response
 	_ = db.Transact(
 		rlog, func(tx *sqlx.Tx) error {
-			clientMetadata := ctxutils.ClientMetaData(ctx)
 			id := mt.ID
 			momMode := req.MomID.Hash() != id.Hash()
 			if momMode {
@@ -313,16 +350,20 @@ func HandleCalendarEntryViaMail(
 			if filename == "" {
 				filename = id.Hash()
 			}
-			notifier.SendICSMail(
-				mailInfo.Mail.String,
-				fmt.Sprintf("Mytoken Expiration Calendar Reminder for '%s'", filename),
-				"You can add the event to your calendar to be notified before the mytoken expires.",
+			lang := mailInfo.Lang()
+			if err = notifier.SendICSMail(
+				rlog, tx, id, mailInfo,
+				i18n.Translatef(lang, "mail.subject.calendar_invite", filename),
+				i18n.Translate(lang, "mail.calendar_invite.text"),
 				mailing.Attachment{
 					Reader:      strings.NewReader(calText),
 					Filename:    filename + ".ics",
 					ContentType: "text/calendar",
 				},
-			)
+			); err != nil {
+				res = model.ErrorToInternalServerErrorResponse(err)
+				return err
+			}
 
 			mytokenEvent := api.EventNotificationSubscribed
 			if momMode {
@@ -332,7 +373,7 @@ func HandleCalendarEntryViaMail(
 			res, rollback = mytokenutils.DoAfterRequestThingsOther(
 				rlog, tx, &model.Response{
 					Status: http.StatusNoContent,
-				}, mt, *ctxutils.ClientMetaData(ctx), mytokenEvent, "email calendar entry", usedRestriction,
+				}, mt, *clientMetadata, mytokenEvent, "email calendar entry", usedRestriction,
 				req.Mytoken.JWT, req.Mytoken.OriginalTokenType,
 			)
 			if rollback {
@@ -23,15 +23,18 @@ import (
 	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
 	notifier "github.com/oidc-mytoken/server/internal/notifier/client"
+	notifierpkg "github.com/oidc-mytoken/server/internal/notifier/pkg"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/internal/utils/auth"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	"github.com/oidc-mytoken/server/internal/utils/logger"
 	"github.com/oidc-mytoken/server/internal/utils/mytokenutils"
 )
 
 var managementCodeNotValidError = model.NotFoundErrorResponse("management_code not valid")
 var missingManagementCodeError = model.BadRequestErrorResponse("missing management_code")
+var invalidDigestError = model.BadRequestErrorResponse("invalid digest; must be one of 'immediate', 'hourly', 'daily'")
 
 // HandleGetByManagementCode returns the api.NotificationInfo for the notification linked to a management code
 func HandleGetByManagementCode(ctx *fiber.Ctx) *model.Response {
@@ -56,7 +59,7 @@ func HandleGetByManagementCode(ctx *fiber.Ctx) *model.Response {
 			}
 			res = &model.Response{
 				Status:   fiber.StatusOK,
-				Response: info.ManagementCodeNotificationInfoResponse,
+				Response: info,
 			}
 			return nil
 		},
@@ -89,9 +92,16 @@ func HandleGet(ctx *fiber.Ctx) *model.Response {
 	if errRes != nil {
 		return errRes
 	}
+	return ListNotifications(rlog, mt, &umt, ctxutils.ClientMetaData(ctx))
+}
+
+// ListNotifications returns a list of all notifications for the user of an already validated mytoken
+func ListNotifications(
+	rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken, umt *universalmytoken.UniversalMytoken,
+	clientMetadata *api.ClientMetaData,
+) *model.Response {
 	usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
-		rlog, nil, mt,
-		ctxutils.ClientMetaData(ctx), api.CapabilityNotifyAnyTokenRead,
+		rlog, nil, mt, clientMetadata, api.CapabilityNotifyAnyTokenRead,
 	)
 	if errRes != nil {
 		return errRes
@@ -113,7 +123,7 @@ func HandleGet(ctx *fiber.Ctx) *model.Response {
 			}
 			var rollback bool
 			res, rollback = mytokenutils.DoAfterRequestThingsOther(
-				rlog, tx, res, mt, *ctxutils.ClientMetaData(ctx),
+				rlog, tx, res, mt, *clientMetadata,
 				api.EventNotificationListed, "", usedRestriction, umt.JWT, umt.OriginalTokenType,
 			)
 			if rollback {
@@ -139,12 +149,37 @@ func HandlePost(ctx *fiber.Ctx) *model.Response {
 	if errRes != nil {
 		return errRes
 	}
+	return Subscribe(rlog, mt, req, ctxutils.ClientMetaData(ctx))
+}
+
+// Subscribe creates a new notification subscription with an already validated mytoken
+func Subscribe(
+	rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken, req pkg.SubscribeNotificationRequest,
+	clientMetadata *api.ClientMetaData,
+) *model.Response {
 	managementCode := utils.RandASCIIString(64)
+	if req.ChatTarget != nil {
+		if err := req.ChatTarget.Validate(config.Get().Features.Notifications.Chat); err != nil {
+			return model.BadRequestErrorResponse(err.Error())
+		}
+		req.ChatTarget.PrepareVerification()
+	}
 	switch req.NotificationType {
 	case api.NotificationTypeICSInvite:
-		return calendar.HandleCalendarEntryViaMail(ctx, rlog, mt, req)
+		return calendar.HandleCalendarEntryViaMail(rlog, mt, req, clientMetadata)
 	case api.NotificationTypeMail:
-		return handleNewMailNotification(ctx, rlog, mt, req, managementCode)
+		if req.Digest != "" && !utils.StringInSlice(req.Digest, notificationsrepo.Digests) {
+			return invalidDigestError
+		}
+		return handleNewNotification(rlog, mt, req, managementCode, clientMetadata)
+	case notifierpkg.NotificationTypeChat:
+		if req.ChatTarget == nil {
+			return model.BadRequestErrorResponse("chat_target required for chat notifications")
+		}
+		if req.Digest != "" && req.Digest != notificationsrepo.DigestImmediate {
+			return model.BadRequestErrorResponse("digests are only supported for mail notifications")
+		}
+		return handleNewNotification(rlog, mt, req, managementCode, clientMetadata)
 	case api.NotificationTypeWebsocket:
 		return &model.ResponseNYI
 	default:
@@ -152,9 +187,9 @@ func HandlePost(ctx *fiber.Ctx) *model.Response {
 	}
 }
 
-func handleNewMailNotification(
-	ctx *fiber.Ctx, rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken,
-	req pkg.SubscribeNotificationRequest, managementCode string,
+func handleNewNotification(
+	rlog logrus.Ext1FieldLogger, mt *mytoken.Mytoken, req pkg.SubscribeNotificationRequest, managementCode string,
+	clientMetadata *api.ClientMetaData,
 ) *model.Response {
 	var res *model.Response
 	if err := db.Transact(
@@ -168,7 +203,7 @@ func handleNewMailNotification(
 			}
 			var usedRestriction *restrictions.Restriction
 			usedRestriction, res = auth.RequireCapabilityAndRestrictionOther(
-				rlog, tx, mt, ctxutils.ClientMetaData(ctx), requiredCapability,
+				rlog, tx, mt, clientMetadata, requiredCapability,
 			)
 			if res != nil {
 				return errors.New("rollback")
@@ -179,7 +214,7 @@ func handleNewMailNotification(
 			if req.NotificationClasses.Contains(api.NotificationClassExpiration) {
 				var withClass []notificationsrepo.NotificationInfoBaseWithClass
 				if err = tx.Select(
-					&withClass, `CALL Notifications_GetForManagementCode(?)`, managementCode,
+					&withClass, `CALL Notifications_GetForManagementCode_v2(?)`, managementCode,
 				); err != nil {
 					return err
 				}
@@ -189,17 +224,10 @@ func handleNewMailNotification(
 					return err
 				}
 			}
-			emailInfo, errRes, err := userrepo.GetAndCheckMail(rlog, tx, mt.ID)
-			if err != nil {
-				res = errRes
+			if res, err = sendWelcome(rlog, tx, mt, req, welcomeData); err != nil {
 				return err
 			}
 
-			notifier.SendTemplateEmail(
-				emailInfo.Mail.String, "New Mytoken Notification Subscription",
-				emailInfo.PreferHTMLMail, "notification-welcome", welcomeData,
-			)
-
 			res = &model.Response{
 				Status: fiber.StatusCreated,
 				Response: &pkg.NotificationsCreateResponse{
@@ -214,7 +242,7 @@ func handleNewMailNotification(
 			}
 			var rollback bool
 			res, rollback = mytokenutils.DoAfterRequestThingsOther(
-				rlog, tx, res, mt, *ctxutils.ClientMetaData(ctx), e, "",
+				rlog, tx, res, mt, *clientMetadata, e, "",
 				usedRestriction, req.Mytoken.JWT, req.Mytoken.OriginalTokenType,
 			)
 			if rollback {
@@ -228,6 +256,75 @@ func handleNewMailNotification(
 	return res
 }
 
+// sendWelcome sends the welcome message for a new notification subscription via mail and / or to the chat target
+func sendWelcome(
+	rlog logrus.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken, req pkg.SubscribeNotificationRequest,
+	welcomeData map[string]interface{},
+) (*model.Response, error) {
+	if req.NotificationType == api.NotificationTypeMail {
+		emailInfo, errRes, err := userrepo.GetAndCheckMail(rlog, tx, mt.ID)
+		if err != nil {
+			return errRes, err
+		}
+		if err = notifier.SendTemplateEmail(
+			rlog, tx, mt.ID, emailInfo, i18n.Translate(emailInfo.Lang(), "mail.subject.notification_welcome"),
+			"notification-welcome", welcomeData,
+		); err != nil {
+			return model.ErrorToInternalServerErrorResponse(err), err
+		}
+	}
+	if req.ChatTarget == nil {
+		return nil, nil
+	}
+	mailInfo, err := userrepo.GetMail(rlog, tx, mt.ID)
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err), err
+	}
+	if req.ChatTarget.RequiresVerification() {
+		if err = sendChatVerification(
+			rlog, tx, mt.ID, *req.ChatTarget, mailInfo.Lang(), welcomeData["management-url"].(string),
+		); err != nil {
+			return model.ErrorToInternalServerErrorResponse(err), err
+		}
+		return nil, nil
+	}
+	classes := make([]string, len(req.NotificationClasses))
+	for i, nc := range req.NotificationClasses {
+		classes[i] = nc.Name
+	}
+	chatData := map[string]any{
+		"notification-classes": classes,
+	}
+	for k, v := range welcomeData {
+		if k != "notification_classes" {
+			chatData[k] = v
+		}
+	}
+	lang := mailInfo.Lang()
+	if err = notifier.SendChatNotification(
+		rlog, tx, mt.ID, *req.ChatTarget, lang, i18n.Translate(lang, "mail.subject.notification_welcome"),
+		"notification-welcome", chatData,
+	); err != nil {
+		return model.ErrorToInternalServerErrorResponse(err), err
+	}
+	return nil, nil
+}
+
+// sendChatVerification posts the verification code of a chat target to it; notifications are only posted to the
+// chat target after the code was confirmed
+func sendChatVerification(
+	rlog logrus.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, target notifierpkg.ChatTarget, lang, managementURL string,
+) error {
+	return notifier.SendChatNotification(
+		rlog, tx, mtID, target, lang, i18n.Translate(lang, "mail.subject.chat_verification"), "chat-verification",
+		map[string]any{
+			"verification-code": target.VerificationCode,
+			"management-url":    managementURL,
+			"issuer-url":        config.Get().IssuerURL,
+		},
+	)
+}
+
 func prepareNotificationWelcomeData(
 	rlog logrus.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken,
 	req pkg.SubscribeNotificationRequest, managementCode string,
@@ -324,6 +421,168 @@ func HandleNotificationUpdateClasses(ctx *fiber.Ctx) *model.Response {
 	return res
 }
 
+// HandleNotificationUpdateDigest handles requests to change how often notifications are sent for a notification
+func HandleNotificationUpdateDigest(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle notification update digest request")
+	managementCode := ctx.Params("code")
+	if managementCode == "" {
+		return missingManagementCodeError
+	}
+	var req pkg.NotificationUpdateDigestRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if !utils.StringInSlice(req.Digest, notificationsrepo.Digests) {
+		return invalidDigestError
+	}
+	var res *model.Response
+	err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			info, err := notificationsrepo.GetNotificationForManagementCode(rlog, tx, managementCode)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				res = managementCodeNotValidError
+				return errors.New("rollback")
+			}
+			if info.Type != api.NotificationTypeMail {
+				res = model.BadRequestErrorResponse("digests are only supported for mail notifications")
+				return errors.New("rollback")
+			}
+			return notificationsrepo.SetDigest(rlog, tx, info.NotificationID, req.Digest)
+		},
+	)
+	if err != nil && res == nil {
+		res = model.ErrorToInternalServerErrorResponse(err)
+	}
+	if res == nil {
+		res = &model.Response{Status: fiber.StatusNoContent}
+	}
+	return res
+}
+
+// HandleNotificationUpdateChatTarget handles requests to set the chat target chat notifications are posted to for a
+// notification
+func HandleNotificationUpdateChatTarget(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle notification update chat target request")
+	var target notifierpkg.ChatTarget
+	if err := ctx.BodyParser(&target); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if err := target.Validate(config.Get().Features.Notifications.Chat); err != nil {
+		return model.BadRequestErrorResponse(err.Error())
+	}
+	target.PrepareVerification()
+	return setChatTarget(rlog, ctx.Params("code"), &target)
+}
+
+// HandleNotificationDeleteChatTarget handles requests to remove the chat target of a notification
+func HandleNotificationDeleteChatTarget(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle notification delete chat target request")
+	return setChatTarget(rlog, ctx.Params("code"), nil)
+}
+
+func setChatTarget(rlog logrus.Ext1FieldLogger, managementCode string, target *notifierpkg.ChatTarget) *model.Response {
+	if managementCode == "" {
+		return missingManagementCodeError
+	}
+	var res *model.Response
+	err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			info, err := notificationsrepo.GetNotificationForManagementCode(rlog, tx, managementCode)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				res = managementCodeNotValidError
+				return errors.New("rollback")
+			}
+			if info.Type != api.NotificationTypeMail && info.Type != notifierpkg.NotificationTypeChat {
+				res = model.BadRequestErrorResponse("chat targets are only supported for mail and chat notifications")
+				return errors.New("rollback")
+			}
+			if target == nil && info.Type == notifierpkg.NotificationTypeChat {
+				res = model.BadRequestErrorResponse(
+					"the chat target of a chat notification cannot be removed; delete the notification instead",
+				)
+				return errors.New("rollback")
+			}
+			if err = notificationsrepo.SetChatTarget(rlog, tx, info.NotificationID, target); err != nil {
+				return err
+			}
+			if target == nil || !target.RequiresVerification() {
+				return nil
+			}
+			mailInfo, err := userrepo.GetMailForUser(rlog, tx, info.UID)
+			if err != nil {
+				return err
+			}
+			return sendChatVerification(
+				rlog, tx, mtid.MTID{}, *target, mailInfo.Lang(), routes.NotificationManagementURL(managementCode),
+			)
+		},
+	)
+	if err != nil && res == nil {
+		res = model.ErrorToInternalServerErrorResponse(err)
+	}
+	if res == nil {
+		res = &model.Response{Status: fiber.StatusNoContent}
+	}
+	return res
+}
+
+// HandleNotificationVerifyChatTarget handles requests to confirm the chat target of a notification with the
+// verification code that was posted to it
+func HandleNotificationVerifyChatTarget(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle notification verify chat target request")
+	managementCode := ctx.Params("code")
+	if managementCode == "" {
+		return missingManagementCodeError
+	}
+	var req pkg.NotificationVerifyChatTargetRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	var res *model.Response
+	err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			info, err := notificationsrepo.GetNotificationForManagementCode(rlog, tx, managementCode)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				res = managementCodeNotValidError
+				return errors.New("rollback")
+			}
+			target, err := notificationsrepo.GetChatTargetForManagementCode(rlog, tx, managementCode)
+			if err != nil {
+				return err
+			}
+			if target == nil || target.Verified || !target.RequiresVerification() {
+				res = model.BadRequestErrorResponse("the notification has no chat target that must be verified")
+				return errors.New("rollback")
+			}
+			if !target.Verify(req.Code) {
+				res = model.BadRequestErrorResponse("invalid verification code")
+				return errors.New("rollback")
+			}
+			return notificationsrepo.SetChatTarget(rlog, tx, info.NotificationID, target)
+		},
+	)
+	if err != nil && res == nil {
+		res = model.ErrorToInternalServerErrorResponse(err)
+	}
+	if res == nil {
+		res = &model.Response{Status: fiber.StatusNoContent}
+	}
+	return res
+}
+
 // HandleNotificationAddToken handles requests to add a mytoken to a notification
 func HandleNotificationAddToken(ctx *fiber.Ctx) *model.Response {
 	rlog := logger.GetRequestLogger(ctx)
@@ -353,7 +612,8 @@ func HandleNotificationAddToken(ctx *fiber.Ctx) *model.Response {
 				mt, errRes := auth.RequireValidMytoken(rlog, tx, &req.Mytoken, nil)
 				if errRes != nil {
 					res = errRes
-					return errors.New("rollback")
+					// Don't roll back, so an automated response to suspicious activity is kept
+					return nil
 				}
 				mtID = mtid.MOMID{MTID: mt.ID}
 				expiresAt = mt.ExpiresAt
@@ -412,7 +672,8 @@ func HandleNotificationRemoveToken(ctx *fiber.Ctx) *model.Response {
 				mt, errRes := auth.RequireValidMytoken(rlog, tx, &req.Mytoken, nil)
 				if errRes != nil {
 					res = errRes
-					return errors.New("rollback")
+					// Don't roll back, so an automated response to suspicious activity is kept
+					return nil
 				}
 				mtID = mtid.MOMID{MTID: mt.ID}
 			}
@@ -6,13 +6,27 @@ import (
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+	notifierpkg "github.com/oidc-mytoken/server/internal/notifier/pkg"
 )
 
 // SubscribeNotificationRequest is type holding the request to create different notifications
 type SubscribeNotificationRequest struct {
 	api.SubscribeNotificationRequest
-	Mytoken universalmytoken.UniversalMytoken `json:"mytoken" xml:"mytoken" form:"mytoken"`
-	MomID   mtid.MOMID                        `json:"mom_id" xml:"mom_id" form:"mom_id"`
+	Mytoken    universalmytoken.UniversalMytoken `json:"mytoken" xml:"mytoken" form:"mytoken"`
+	MomID      mtid.MOMID                        `json:"mom_id" xml:"mom_id" form:"mom_id"`
+	Digest     string                            `json:"digest,omitempty" xml:"digest" form:"digest"`
+	ChatTarget *notifierpkg.ChatTarget           `json:"chat_target,omitempty" xml:"chat_target" form:"chat_target"`
+}
+
+// NotificationUpdateDigestRequest is a request object for changing how often notifications are sent
+type NotificationUpdateDigestRequest struct {
+	Digest string `json:"digest" xml:"digest" form:"digest"`
+}
+
+// NotificationVerifyChatTargetRequest is a type holding the request to confirm a chat target with the verification
+// code that was posted to it
+type NotificationVerifyChatTargetRequest struct {
+	Code string `json:"code" xml:"code" form:"code"`
 }
 
 // NotificationsListResponse is a type holding the response to a notification list request
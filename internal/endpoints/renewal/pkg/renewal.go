@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
+	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+// RenewalRequest is a request to register the renewal of a mytoken
+type RenewalRequest struct {
+	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+	// Channel is how the service learns that the renewal was approved; either 'polling' or 'webhook'
+	Channel    string `json:"channel"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// Validate checks that the channel of the RenewalRequest is valid and, for webhooks, that the webhook url is allowed;
+// webhooks must not point to internal hosts
+func (r RenewalRequest) Validate() error {
+	switch r.Channel {
+	case renewalrepo.ChannelPolling:
+		if r.WebhookURL != "" {
+			return errors.New("'webhook_url' must only be given for the 'webhook' channel")
+		}
+	case renewalrepo.ChannelWebhook:
+		u, err := url.Parse(r.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return errors.New("invalid 'webhook_url'; must be an https url")
+		}
+		if err = iputils.CheckPublicHost(u.Hostname()); err != nil {
+			return errors.Wrap(err, "invalid 'webhook_url'")
+		}
+		allowed := config.Get().Features.TokenRenewal.WebhookAllowedHosts
+		if len(allowed) > 0 && !utils.StringInSlice(strings.ToLower(u.Hostname()), allowed) {
+			return errors.Errorf("webhooks on host '%s' are not allowed", u.Hostname())
+		}
+	default:
+		return errors.New("unknown channel; must be one of 'polling', 'webhook'")
+	}
+	return nil
+}
+
+// RenewalResponse is the response to a RenewalRequest; the RenewalCode is needed to collect the successor mytoken
+type RenewalResponse struct {
+	RenewalCode string              `json:"renewal_code"`
+	Interval    int64               `json:"interval,omitempty"`
+	TokenUpdate *my.MytokenResponse `json:"token_update,omitempty"`
+}
+
+// RenewalCancelRequest is a request to cancel the requested renewal of a mytoken
+type RenewalCancelRequest struct {
+	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+}
+
+// RenewalCollectRequest is a request to collect the successor mytoken of an approved renewal
+type RenewalCollectRequest struct {
+	RenewalCode  string             `json:"renewal_code"`
+	ResponseType model.ResponseType `json:"response_type"`
+	MaxTokenLen  int                `json:"max_token_len"`
+}
+
+// WebhookPayload is posted to the webhook of a renewal once the renewal was approved
+type WebhookPayload struct {
+	Event string `json:"event"`
+	MOMID string `json:"mom_id"`
+}
+
+// JobTypeRenewalWebhook is the job type for posting a WebhookPayload to the webhook of an approved renewal
+const JobTypeRenewalWebhook = "renewal_webhook"
+
+// WebhookJobPayload is the payload of a JobTypeRenewalWebhook job
+type WebhookJobPayload struct {
+	MOMID mtid.MOMID `json:"mom_id"`
+}
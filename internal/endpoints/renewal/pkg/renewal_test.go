@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
+)
+
+func TestRenewalRequest_Validate(t *testing.T) {
+	config.Get().Features.TokenRenewal.WebhookAllowedHosts = []string{"services.example.com"}
+	t.Cleanup(func() { config.Get().Features.TokenRenewal.WebhookAllowedHosts = nil })
+	tests := []struct {
+		name  string
+		req   RenewalRequest
+		valid bool
+	}{
+		{name: "polling", req: RenewalRequest{Channel: renewalrepo.ChannelPolling}, valid: true},
+		{
+			name: "polling with webhook url",
+			req:  RenewalRequest{Channel: renewalrepo.ChannelPolling, WebhookURL: "https://services.example.com/x"},
+		},
+		{
+			name:  "webhook",
+			req:   RenewalRequest{Channel: renewalrepo.ChannelWebhook, WebhookURL: "https://Services.example.com/x"},
+			valid: true,
+		},
+		{name: "webhook without url", req: RenewalRequest{Channel: renewalrepo.ChannelWebhook}},
+		{
+			name: "webhook http",
+			req:  RenewalRequest{Channel: renewalrepo.ChannelWebhook, WebhookURL: "http://services.example.com/x"},
+		},
+		{
+			name: "webhook other host",
+			req:  RenewalRequest{Channel: renewalrepo.ChannelWebhook, WebhookURL: "https://localhost/x"},
+		},
+		{name: "unknown channel", req: RenewalRequest{Channel: "mail"}},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				err := test.req.Validate()
+				if test.valid && err != nil {
+					t.Errorf("Expected request to be valid, but got: %s", err)
+				}
+				if !test.valid && err == nil {
+					t.Error("Expected request to be invalid")
+				}
+			},
+		)
+	}
+}
+
+func TestRenewalRequest_ValidateNoAllowedHosts(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://services.example.com/x", valid: true},
+		{url: "https://localhost/x"},
+		{url: "https://127.0.0.1/x"},
+		{url: "https://10.0.0.1/x"},
+		{url: "https://169.254.169.254/latest/meta-data"},
+		{url: "https://[::1]/x"},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.url, func(t *testing.T) {
+				err := RenewalRequest{Channel: renewalrepo.ChannelWebhook, WebhookURL: test.url}.Validate()
+				if test.valid && err != nil {
+					t.Errorf("Expected request to be valid, but got: %s", err)
+				}
+				if !test.valid && err == nil {
+					t.Error("Expected request to be invalid")
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,387 @@
+package renewal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/encryptionkeyrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/renewal/pkg"
+	"github.com/oidc-mytoken/server/internal/jobs"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	eventpkg "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/internal/mytoken/rotation"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+	"github.com/oidc-mytoken/server/internal/utils/cookies"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/internal/utils/webhookclient"
+)
+
+// renewalCodeLen is the length of the renewal codes handed out to services
+const renewalCodeLen = 64
+
+// Init registers the job for notifying services about approved renewals
+func Init() {
+	if !config.Get().Features.TokenRenewal.Enabled {
+		return
+	}
+	jobs.Register(pkg.JobTypeRenewalWebhook, postWebhook)
+}
+
+// HandleRegister handles requests to register the renewal of a mytoken; the mytoken must have the renewal
+// capability. The successor can be collected with the returned renewal code once the owner approved the renewal.
+func HandleRegister(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle renewal request")
+	req := pkg.RenewalRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if err := req.Validate(); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	clientMetadata := ctxutils.ClientMetaData(ctx)
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	code := utils.RandASCIIString(renewalCodeLen)
+	renewalRes := pkg.RenewalResponse{RenewalCode: code}
+	if req.Channel == renewalrepo.ChannelPolling {
+		renewalRes.Interval = config.Get().Features.Polling.PollingInterval
+	}
+	var res *model.Response
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
+				rlog, tx, mt, clientMetadata, model.CapabilityRenewal,
+			)
+			if errRes != nil {
+				res = errRes
+				return errors.New("rollback")
+			}
+			key, _, err := encryptionkeyrepo.GetEncryptionKey(rlog, tx, mt.ID, req.Mytoken.JWT)
+			if err != nil {
+				return err
+			}
+			if err = renewalrepo.Register(
+				rlog, tx, mt.ID, code, key, mt.AuthTime, req.Channel, req.WebhookURL,
+			); err != nil {
+				return err
+			}
+			if err = eventService.LogEvent(
+				rlog, tx, eventpkg.MTEvent{
+					Event:          eventpkg.EventRenewalRequested,
+					MTID:           mt.ID,
+					Comment:        fmt.Sprintf("channel: %s", req.Channel),
+					ClientMetaData: *clientMetadata,
+				},
+			); err != nil {
+				return err
+			}
+			if usedRestriction != nil {
+				if err = usedRestriction.UsedOther(rlog, tx, mt.ID); err != nil {
+					return err
+				}
+			}
+			renewalRes.TokenUpdate, err = rotation.RotateMytokenAfterOtherForResponse(
+				rlog, tx, req.Mytoken.JWT, mt, *clientMetadata, req.Mytoken.OriginalTokenType,
+			)
+			return err
+		},
+	); err != nil {
+		if res != nil {
+			return res
+		}
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	res = &model.Response{
+		Status:   fiber.StatusOK,
+		Response: renewalRes,
+	}
+	if renewalRes.TokenUpdate != nil {
+		res.Cookies = []*fiber.Cookie{cookies.MytokenCookie(renewalRes.TokenUpdate.Mytoken)}
+	}
+	return res
+}
+
+// HandleCancel handles requests to cancel the requested renewal of a mytoken
+func HandleCancel(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle renewal cancellation")
+	req := pkg.RenewalCancelRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	var found bool
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) (err error) {
+			_, found, err = renewalrepo.Get(rlog, tx, mt.ID)
+			if err != nil || !found {
+				return err
+			}
+			if err = renewalrepo.Delete(rlog, tx, mt.ID); err != nil {
+				return err
+			}
+			return eventService.LogEvent(
+				rlog, tx, eventpkg.MTEvent{
+					Event:          eventpkg.EventRenewalCancelled,
+					MTID:           mt.ID,
+					ClientMetaData: *ctxutils.ClientMetaData(ctx),
+				},
+			)
+		},
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !found {
+		return &model.Response{
+			Status:   fiber.StatusNotFound,
+			Response: api.Error{Error: api.ErrorStrInvalidRequest, ErrorDescription: "no renewal requested"},
+		}
+	}
+	return &model.Response{Status: fiber.StatusNoContent}
+}
+
+// HandleCollect handles requests to collect the successor mytoken of an approved renewal; as long as the renewal is
+// not approved an authorization_pending error is returned
+func HandleCollect(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle renewal collection")
+	req := pkg.RenewalCollectRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if req.RenewalCode == "" {
+		return model.BadRequestErrorResponse("'renewal_code' required")
+	}
+	clientMetadata := ctxutils.ClientMetaData(ctx)
+	var res *model.Response
+	var successor *mytoken.Mytoken
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			r, found, err := renewalrepo.GetByCode(rlog, tx, req.RenewalCode)
+			if err != nil {
+				return err
+			}
+			if !found {
+				res = &model.Response{
+					Status:   fiber.StatusUnauthorized,
+					Response: api.Error{Error: api.ErrorStrInvalidGrant, ErrorDescription: "unknown renewal code"},
+				}
+				return nil
+			}
+			if res = checkNotSuspended(r.RenewalInfo); res != nil {
+				return nil
+			}
+			if !r.Approved.Valid {
+				res = &model.Response{
+					Status:   fiber.StatusPreconditionRequired,
+					Response: api.ErrorAuthorizationPending,
+				}
+				return nil
+			}
+			successor, res, err = createSuccessor(rlog, tx, r, req.RenewalCode, *clientMetadata)
+			return err
+		},
+	); err != nil {
+		if errRes, ok := mytokenrepo.QuotaExceededErrorResponse(err); ok {
+			return errRes
+		}
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if res != nil {
+		return res
+	}
+	tokenRes, err := successor.ToTokenResponse(rlog, req.ResponseType, req.MaxTokenLen, *clientMetadata, "")
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: tokenRes,
+	}
+}
+
+// checkNotSuspended checks that neither the renewed mytoken nor its parent is suspended; otherwise the renewal
+// would hand out a successor that is not suspended
+func checkNotSuspended(info renewalrepo.RenewalInfo) *model.Response {
+	if !info.AnySuspended() {
+		return nil
+	}
+	return &model.Response{
+		Status: fiber.StatusForbidden,
+		Response: model.TokenSuspendedError(
+			"the mytoken or its parent is suspended; it cannot be renewed until it is resumed",
+		),
+	}
+}
+
+func usageRestrictedResponse(description string) *model.Response {
+	return &model.Response{
+		Status: fiber.StatusForbidden,
+		Response: api.Error{
+			Error:            api.ErrorStrUsageRestricted,
+			ErrorDescription: description,
+		},
+	}
+}
+
+// successorRestrictions returns the restrictions for the successor of a renewed mytoken. The restrictions of the
+// renewed mytoken are moved in time, so that they are relative to now as they were relative to the creation of the
+// renewed mytoken. They are tightened to the restrictions of the parent and capped by the maximum total lifetime,
+// which is counted from the authentication that started the chain of renewals.
+func successorRestrictions(rlog log.Ext1FieldLogger, r renewalrepo.Renewal) (
+	restrictions.Restrictions, *model.Response,
+) {
+	maxExpiresAt := r.AuthTime + unixtime.UnixTime(config.Get().Features.TokenRenewal.MaxTotalLifetime)
+	if maxExpiresAt <= unixtime.Now() {
+		return nil, usageRestrictedResponse(
+			"the mytoken reached its maximum total lifetime and cannot be renewed anymore; " +
+				"a new mytoken must be obtained",
+		)
+	}
+	rs := r.Restrictions.Shift(unixtime.Now() - r.TokenCreated)
+	if r.ParentID.HashValid() {
+		rs, _ = restrictions.Tighten(rlog, r.ParentRestrictions, rs)
+	}
+	rs.EnforceMaxLifetime(r.Issuer)
+	rs.EnforceMaxExpiresAt(maxExpiresAt)
+	return rs, nil
+}
+
+// createSuccessor creates and stores the successor mytoken for a renewal; the successor has the same name,
+// capabilities, subtoken limits, rotation policy, and parent as the renewed mytoken and shares its refresh token. Its
+// restrictions are computed by successorRestrictions. A subtoken's successor is handled like any other subtoken, i.e.
+// it is limited by the parent's capabilities and must not exceed the parent's maximum number of direct subtokens.
+func createSuccessor(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, r renewalrepo.Renewal, code string, clientMetadata api.ClientMetaData,
+) (*mytoken.Mytoken, *model.Response, error) {
+	key, err := r.EncryptionKey.Decrypt(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, errRes := successorRestrictions(rlog, r)
+	if errRes != nil {
+		return nil, errRes, nil
+	}
+	capabilities := r.Capabilities
+	if r.ParentID.HashValid() {
+		capabilities = api.TightenCapabilities(r.ParentCapabilities, capabilities)
+		if len(capabilities) == 0 {
+			return nil, usageRestrictedResponse("the parent mytoken does not allow any of the mytoken's capabilities"),
+				nil
+		}
+		parentLimits, err := dbhelper.ParseSubtokenLimits(r.ParentSubtokenLimits)
+		if err != nil {
+			return nil, nil, err
+		}
+		if parentLimits.MaxDirectChildren != nil {
+			children, err := dbhelper.CountChildren(rlog, tx, r.ParentID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !parentLimits.AllowsMoreChildren(children) {
+				return nil, usageRestrictedResponse(
+					fmt.Sprintf(
+						"the parent mytoken already has the maximum number of %d direct subtokens",
+						*parentLimits.MaxDirectChildren,
+					),
+				), nil
+			}
+		}
+	}
+	limits, err := dbhelper.ParseSubtokenLimits(r.SubtokenLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	successor, err := mytoken.NewMytoken(
+		r.Subject, r.Issuer, r.Name.String, rs, capabilities, r.Rotation, r.AuthTime,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	successor.SubtokenLimits = limits
+	mte := mytokenrepo.NewMytokenEntry(successor, r.Name.String, clientMetadata)
+	mte.ParentID = r.ParentID
+	if err = mte.SetRefreshToken(r.RTID, key); err != nil {
+		return nil, nil, err
+	}
+	if err = mte.Store(rlog, tx, fmt.Sprintf("Renewal of %s", r.MTID.Hash())); err != nil {
+		return nil, nil, err
+	}
+	if err = notificationsrepo.ScheduleExpirationNotificationsIfNeeded(
+		rlog, tx, successor.ID, successor.ExpiresAt, successor.IssuedAt,
+	); err != nil {
+		return nil, nil, err
+	}
+	if err = renewalrepo.Delete(rlog, tx, r.MTID); err != nil {
+		return nil, nil, err
+	}
+	return successor, nil, eventService.LogEvent(
+		rlog, tx, eventpkg.MTEvent{
+			Event:          eventpkg.EventRenewed,
+			MTID:           r.MTID,
+			Comment:        fmt.Sprintf("Successor %s", successor.ID.Hash()),
+			ClientMetaData: clientMetadata,
+		},
+	)
+}
+
+// postWebhook posts a pkg.WebhookPayload to the webhook of an approved renewal; the job fails and is retried if the
+// webhook is not reachable
+func postWebhook(rlog log.Ext1FieldLogger, payload []byte) error {
+	var p pkg.WebhookJobPayload
+	if err := errors.WithStack(json.Unmarshal(payload, &p)); err != nil {
+		return err
+	}
+	info, found, err := renewalrepo.Get(rlog, nil, p.MOMID.MTID)
+	if err != nil {
+		return err
+	}
+	if !found || !info.WebhookURL.Valid {
+		// The renewal was collected or cancelled in the meantime
+		return nil
+	}
+	res, err := webhookclient.Do().R().
+		SetBody(
+			pkg.WebhookPayload{
+				Event: eventpkg.EventRenewalApproved.String(),
+				MOMID: p.MOMID.Hash(),
+			},
+		).
+		Post(info.WebhookURL.String)
+	if err != nil {
+		return errors.New("could not reach renewal webhook")
+	}
+	if res.IsError() {
+		return errors.Errorf("renewal webhook responded with status %d", res.StatusCode())
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package renewal
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/unixtime"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
+)
+
+func TestSuccessorRestrictions(t *testing.T) {
+	config.Get().Features.TokenRenewal.MaxTotalLifetime = 1000
+	t.Cleanup(func() { config.Get().Features.TokenRenewal.MaxTotalLifetime = 365 * 24 * 3600 })
+	now := unixtime.Now()
+	parentID, err := mtid.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		renewal    renewalrepo.Renewal
+		expExpires unixtime.UnixTime
+		expScope   string
+		expError   bool
+	}{
+		{
+			name: "shifted",
+			renewal: renewalrepo.Renewal{
+				AuthTime:     now - 100,
+				TokenCreated: now - 100,
+				Restrictions: restrictions.Restrictions{{ExpiresAt: now + 10}},
+			},
+			expExpires: now + 110,
+		},
+		{
+			name: "capped by max total lifetime",
+			renewal: renewalrepo.Renewal{
+				AuthTime:     now - 900,
+				TokenCreated: now - 500,
+				Restrictions: restrictions.Restrictions{{ExpiresAt: now + 10}},
+			},
+			expExpires: now + 100,
+		},
+		{
+			name: "no expiration",
+			renewal: renewalrepo.Renewal{
+				AuthTime:     now - 100,
+				TokenCreated: now - 100,
+			},
+			expExpires: now + 900,
+		},
+		{
+			name: "max total lifetime reached",
+			renewal: renewalrepo.Renewal{
+				AuthTime:     now - 1000,
+				TokenCreated: now - 100,
+				Restrictions: restrictions.Restrictions{{ExpiresAt: now + 10}},
+			},
+			expError: true,
+		},
+		{
+			name: "tightened to parent",
+			renewal: renewalrepo.Renewal{
+				AuthTime:     now - 100,
+				TokenCreated: now - 100,
+				ParentID:     parentID,
+				Restrictions: restrictions.Restrictions{
+					{
+						ExpiresAt:   now + 10,
+						Restriction: api.Restriction{Scope: "openid profile"},
+					},
+				},
+				ParentRestrictions: restrictions.Restrictions{
+					{
+						ExpiresAt:   now + 50,
+						Restriction: api.Restriction{Scope: "openid"},
+					},
+				},
+			},
+			expExpires: now + 50,
+			expScope:   "openid",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				rs, errRes := successorRestrictions(log.StandardLogger(), test.renewal)
+				if test.expError {
+					if errRes == nil {
+						t.Fatal("expected an error response")
+					}
+					return
+				}
+				if errRes != nil {
+					t.Fatalf("unexpected error response: %+v", errRes.Response)
+				}
+				if len(rs) != 1 {
+					t.Fatalf("expected exactly one restriction, got %d", len(rs))
+				}
+				// allow for the clock to tick during the test
+				if diff := rs[0].ExpiresAt - test.expExpires; diff < 0 || diff > 1 {
+					t.Errorf("expected exp %d, got %d", test.expExpires, rs[0].ExpiresAt)
+				}
+				if test.expScope != "" && rs[0].Scope != test.expScope {
+					t.Errorf("expected scope '%s', got '%s'", test.expScope, rs[0].Scope)
+				}
+			},
+		)
+	}
+}
+
+func TestCheckNotSuspended(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      renewalrepo.RenewalInfo
+		expStatus int
+	}{
+		{
+			name: "not suspended",
+			info: renewalrepo.RenewalInfo{},
+		},
+		{
+			name:      "mytoken suspended",
+			info:      renewalrepo.RenewalInfo{Suspended: true},
+			expStatus: fiber.StatusForbidden,
+		},
+		{
+			name:      "parent suspended",
+			info:      renewalrepo.RenewalInfo{ParentSuspended: true},
+			expStatus: fiber.StatusForbidden,
+		},
+		{
+			name:      "mytoken and parent suspended",
+			info:      renewalrepo.RenewalInfo{Suspended: true, ParentSuspended: true},
+			expStatus: fiber.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				res := checkNotSuspended(test.info)
+				if test.expStatus == 0 {
+					if res != nil {
+						t.Fatalf("unexpected error response: %+v", res.Response)
+					}
+					return
+				}
+				if res == nil {
+					t.Fatal("expected an error response")
+				}
+				if res.Status != test.expStatus {
+					t.Errorf("expected status %d, got %d", test.expStatus, res.Status)
+				}
+				if apiErr, ok := res.Response.(api.Error); !ok || apiErr.Error != model.ErrorStrTokenSuspended {
+					t.Errorf("expected a '%s' error, got %+v", model.ErrorStrTokenSuspended, res.Response)
+				}
+			},
+		)
+	}
+}
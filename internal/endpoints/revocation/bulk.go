@@ -0,0 +1,158 @@
+package revocation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/api/v0"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	helper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/endpoints/revocation/pkg"
+	"github.com/oidc-mytoken/server/internal/endpoints/stepup"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	pkg2 "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytokenPkg "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/rotation"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+	"github.com/oidc-mytoken/server/internal/utils/cookies"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// HandleBulkRevoke handles requests to revoke all mytokens of a user that match a filter; unless dry_run is
+// explicitly set to false, the matching mytokens are only returned, but not revoked
+func HandleBulkRevoke(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle bulk revocation request")
+	req := pkg.BulkRevocationRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if err := req.Filter.Validate(); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	clientMetadata := ctxutils.ClientMetaData(ctx)
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
+		rlog, nil, mt, clientMetadata, api.CapabilityRevokeAnyToken,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	var authContext string
+	if req.Recursive && !req.IsDryRun() {
+		if authContext, errRes = stepup.RequireStepUp(rlog, nil, mt.ID); errRes != nil {
+			return errRes
+		}
+	}
+	res := pkg.BulkRevocationResponse{
+		DryRun:    req.IsDryRun(),
+		Recursive: req.Recursive,
+		Mytokens:  []*tree.MytokenEntry{},
+	}
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			matched, err := bulkRevoke(rlog, tx, req, mt, clientMetadata, authContext)
+			if err != nil {
+				return err
+			}
+			res.Mytokens = matched
+			if usedRestriction != nil {
+				if err = usedRestriction.UsedOther(rlog, tx, mt.ID); err != nil {
+					return err
+				}
+			}
+			res.TokenUpdate, err = rotation.RotateMytokenAfterOtherForResponse(
+				rlog, tx, req.Mytoken.JWT, mt, *clientMetadata, req.Mytoken.OriginalTokenType,
+			)
+			return err
+		},
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	var cake []*fiber.Cookie
+	if res.TokenUpdate != nil {
+		cake = []*fiber.Cookie{cookies.MytokenCookie(res.TokenUpdate.Mytoken)}
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: res,
+		Cookies:  cake,
+	}
+}
+
+func bulkRevoke(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, req pkg.BulkRevocationRequest, authToken *mytokenPkg.Mytoken,
+	clientMetadata *api.ClientMetaData, authContext string,
+) (matched []*tree.MytokenEntry, err error) {
+	tokens, err := tree.AllTokensWithCapabilities(rlog, tx, authToken.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The mytoken used for authorization is never revoked by a bulk revocation; if the revocation is recursive
+	// this also applies to its parents
+	protected := map[string]bool{authToken.ID.Hash(): true}
+	if req.Recursive {
+		for id := range ancestors(tokens, authToken.ID) {
+			protected[id] = true
+		}
+	}
+	matched = []*tree.MytokenEntry{}
+	for _, t := range tokens {
+		if protected[t.ID.Hash()] || !req.Filter.Matches(t) {
+			continue
+		}
+		matched = append(matched, &t.MytokenEntry)
+	}
+	if req.IsDryRun() {
+		return
+	}
+	for _, t := range matched {
+		if err = helper.RevokeMT(rlog, tx, t.ID, req.Recursive); err != nil {
+			return
+		}
+		if err = eventService.LogEvent(
+			rlog, tx, pkg2.MTEvent{
+				Event:          api.EventRevokedOtherToken,
+				MTID:           authToken.ID,
+				Comment:        fmt.Sprintf("mom_id: %s (bulk revocation)", t.MOMID),
+				AuthContext:    authContext,
+				ClientMetaData: *clientMetadata,
+			},
+		); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func ancestors(tokens []*tree.MytokenEntryWithCapabilities, id mtid.MTID) map[string]bool {
+	parents := make(map[string]mtid.MTID, len(tokens))
+	for _, t := range tokens {
+		parents[t.ID.Hash()] = t.ParentID
+	}
+	found := make(map[string]bool)
+	current := id.Hash()
+	for {
+		p, ok := parents[current]
+		if !ok || !p.HashValid() || found[p.Hash()] {
+			return found
+		}
+		current = p.Hash()
+		found[current] = true
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"path"
+
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+// BulkRevocationRequest is a request to revoke all mytokens of a user that match a RevocationFilter
+type BulkRevocationRequest struct {
+	Mytoken   universalmytoken.UniversalMytoken `json:"mytoken"`
+	Filter    RevocationFilter                  `json:"filter"`
+	Recursive bool                              `json:"recursive,omitempty"`
+	// DryRun indicates that the matching mytokens should only be returned, but not revoked; defaults to true
+	DryRun *bool `json:"dry_run,omitempty"`
+}
+
+// IsDryRun checks if this BulkRevocationRequest is a dry run
+func (r BulkRevocationRequest) IsDryRun() bool {
+	return r.DryRun == nil || *r.DryRun
+}
+
+// RevocationFilter is a filter for selecting mytokens that should be revoked; a mytoken matches if it matches all
+// given conditions
+type RevocationFilter struct {
+	// IP matches mytokens created from this ip, subnet, or host
+	IP string `json:"ip,omitempty"`
+	// Name matches mytokens with a name matching this pattern; the pattern syntax is the one of path.Match
+	Name string `json:"name,omitempty"`
+	// IssuedBefore matches mytokens created before this time
+	IssuedBefore unixtime.UnixTime `json:"issued_before,omitempty"`
+	// Capability matches mytokens that have this capability
+	Capability string `json:"capability,omitempty"`
+}
+
+// Validate checks that the RevocationFilter has at least one condition and that all conditions are valid
+func (f RevocationFilter) Validate() error {
+	if f.IP == "" && f.Name == "" && f.IssuedBefore == 0 && f.Capability == "" {
+		return errors.New("filter must contain at least one condition")
+	}
+	if _, err := path.Match(f.Name, ""); err != nil {
+		return errors.Wrap(err, "invalid name pattern")
+	}
+	return nil
+}
+
+// Matches checks if a mytoken matches this RevocationFilter
+func (f RevocationFilter) Matches(t *tree.MytokenEntryWithCapabilities) bool {
+	if f.IP != "" && !iputils.IPIsIn(t.IP, []string{f.IP}) {
+		return false
+	}
+	if f.Name != "" {
+		if !t.Name.Valid {
+			return false
+		}
+		if ok, _ := path.Match(f.Name, t.Name.String); !ok {
+			return false
+		}
+	}
+	if f.IssuedBefore != 0 && t.CreatedAt >= f.IssuedBefore {
+		return false
+	}
+	if f.Capability != "" && !t.Capabilities.Has(api.NewCapability(f.Capability)) {
+		return false
+	}
+	return true
+}
+
+// BulkRevocationResponse is the response to a BulkRevocationRequest; it reports the mytokens that match the filter
+// and were (or would be, for a dry run) revoked
+type BulkRevocationResponse struct {
+	DryRun      bool                 `json:"dry_run"`
+	Recursive   bool                 `json:"recursive"`
+	Mytokens    []*tree.MytokenEntry `json:"mytokens"`
+	TokenUpdate *my.MytokenResponse  `json:"token_update,omitempty"`
+}
@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/tree"
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+)
+
+func TestRevocationFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    RevocationFilter
+		expectErr bool
+	}{
+		{
+			name:      "empty",
+			filter:    RevocationFilter{},
+			expectErr: true,
+		},
+		{
+			name:   "ip",
+			filter: RevocationFilter{IP: "192.0.2.0/24"},
+		},
+		{
+			name:   "name pattern",
+			filter: RevocationFilter{Name: "ci-*"},
+		},
+		{
+			name:   "issued before",
+			filter: RevocationFilter{IssuedBefore: 1700000000},
+		},
+		{
+			name:   "capability",
+			filter: RevocationFilter{Capability: "AT"},
+		},
+		{
+			name:      "invalid name pattern",
+			filter:    RevocationFilter{Name: "ci-["},
+			expectErr: true,
+		},
+		{
+			name: "invalid name pattern with other conditions",
+			filter: RevocationFilter{
+				IP:   "192.0.2.1",
+				Name: "[",
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				err := test.filter.Validate()
+				if test.expectErr && err == nil {
+					t.Error("expected an error, but got none")
+				}
+				if !test.expectErr && err != nil {
+					t.Errorf("expected no error, but got: %s", err)
+				}
+			},
+		)
+	}
+}
+
+func TestRevocationFilter_Matches(t *testing.T) {
+	cache.InitCache()
+	token := &tree.MytokenEntryWithCapabilities{
+		MytokenEntry: tree.MytokenEntry{
+			MytokenEntry: api.MytokenEntry{
+				ClientMetaData: api.ClientMetaData{IP: "192.0.2.10"},
+			},
+			Name:      db.NewNullString("ci-runner"),
+			CreatedAt: 1700000000,
+		},
+		Capabilities: api.Capabilities{api.CapabilityAT},
+	}
+	unnamed := &tree.MytokenEntryWithCapabilities{
+		MytokenEntry: tree.MytokenEntry{
+			MytokenEntry: api.MytokenEntry{
+				ClientMetaData: api.ClientMetaData{IP: "192.0.2.10"},
+			},
+			CreatedAt: 1700000000,
+		},
+	}
+	tests := []struct {
+		name     string
+		filter   RevocationFilter
+		token    *tree.MytokenEntryWithCapabilities
+		expected bool
+	}{
+		{
+			name:     "same ip",
+			filter:   RevocationFilter{IP: "192.0.2.10"},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "other ip",
+			filter:   RevocationFilter{IP: "192.0.2.11"},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "ip in subnet",
+			filter:   RevocationFilter{IP: "192.0.2.0/24"},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "ip not in subnet",
+			filter:   RevocationFilter{IP: "198.51.100.0/24"},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "exact name",
+			filter:   RevocationFilter{Name: "ci-runner"},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "name pattern",
+			filter:   RevocationFilter{Name: "ci-*"},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "name pattern not matching",
+			filter:   RevocationFilter{Name: "laptop-*"},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "name pattern on unnamed token",
+			filter:   RevocationFilter{Name: "*"},
+			token:    unnamed,
+			expected: false,
+		},
+		{
+			name:     "issued before",
+			filter:   RevocationFilter{IssuedBefore: 1700000001},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "issued at the given time",
+			filter:   RevocationFilter{IssuedBefore: 1700000000},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "issued after",
+			filter:   RevocationFilter{IssuedBefore: 1600000000},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "has capability",
+			filter:   RevocationFilter{Capability: api.CapabilityAT.Name},
+			token:    token,
+			expected: true,
+		},
+		{
+			name:     "does not have capability",
+			filter:   RevocationFilter{Capability: api.CapabilitySettings.Name},
+			token:    token,
+			expected: false,
+		},
+		{
+			name:     "unnamed token without capabilities",
+			filter:   RevocationFilter{Capability: api.CapabilityAT.Name},
+			token:    unnamed,
+			expected: false,
+		},
+		{
+			name: "all conditions match",
+			filter: RevocationFilter{
+				IP:           "192.0.2.0/24",
+				Name:         "ci-*",
+				IssuedBefore: 1700000001,
+				Capability:   api.CapabilityAT.Name,
+			},
+			token:    token,
+			expected: true,
+		},
+		{
+			name: "one condition does not match",
+			filter: RevocationFilter{
+				IP:           "192.0.2.0/24",
+				Name:         "ci-*",
+				IssuedBefore: 1600000000,
+				Capability:   api.CapabilityAT.Name,
+			},
+			token:    token,
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := test.filter.Matches(test.token); got != test.expected {
+					t.Errorf("expected %v, but got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	helper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/shorttokenrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/stepup"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/mytoken"
@@ -53,48 +54,25 @@ func HandleRevoke(ctx *fiber.Ctx) *model.Response {
 		}
 	}
 	if req.MOMID != "" {
-		var res *model.Response
-		_ = db.Transact(
-			rlog, func(tx *sqlx.Tx) error {
-				metadata := ctxutils.ClientMetaData(ctx)
-				token, err := universalmytoken.Parse(rlog, req.Token)
-				if err != nil {
-					res = model.ErrorToBadRequestErrorResponse(err)
-					return err
-				}
-				authToken, err := mytokenPkg.ParseJWT(token.JWT)
-				if err != nil {
-					res = model.ErrorToBadRequestErrorResponse(err)
-					return err
-				}
-				errRes := revokeByID(rlog, tx, req, authToken, metadata)
-				if errRes != nil {
-					res = errRes
-					return errors.New("rollback")
-				}
-				tokenUpdate, err := rotation.RotateMytokenAfterOtherForResponse(
-					rlog, tx, token.JWT, authToken, *metadata, token.OriginalTokenType,
-				)
-				if err != nil {
-					res = model.ErrorToInternalServerErrorResponse(err)
-					return err
-				}
-				if tokenUpdate != nil {
-					res = &model.Response{
-						Status: fiber.StatusOK,
-						Response: pkg.OnlyTokenUpdateRes{
-							TokenUpdate: tokenUpdate,
-						},
-						Cookies: []*fiber.Cookie{cookies.MytokenCookie(tokenUpdate.Mytoken)},
-					}
-				}
-				return nil
-			},
-		)
-		if res != nil {
-			return res
+		token, err := universalmytoken.Parse(rlog, req.Token)
+		if err != nil {
+			return model.ErrorToBadRequestErrorResponse(err)
+		}
+		authToken, err := mytokenPkg.ParseJWT(token.JWT)
+		if err != nil {
+			return model.ErrorToBadRequestErrorResponse(err)
+		}
+		var authContext string
+		// Revoking a whole tree of another mytoken is dangerous, so it requires a passkey step-up for the
+		// authorizing mytoken if the user registered a passkey, also for requests from the cli or other clients;
+		// revoking the passed mytoken itself and non-recursive revocations do not require a step-up
+		if req.Recursive {
+			var errRes *model.Response
+			if authContext, errRes = stepup.RequireStepUp(rlog, nil, authToken.ID); errRes != nil {
+				return errRes
+			}
 		}
-		return &model.Response{Status: fiber.StatusNoContent}
+		return RevokeByMOMID(rlog, req, token, authToken, ctxutils.ClientMetaData(ctx), authContext)
 	}
 	errRes := revokeAnyToken(rlog, nil, req.Token, req.OIDCIssuer, req.Recursive)
 	if errRes != nil {
@@ -119,10 +97,49 @@ func HandleRevoke(ctx *fiber.Ctx) *model.Response {
 	return &model.Response{Status: fiber.StatusNoContent}
 }
 
+// RevokeByMOMID revokes the mytoken with the mom_id given in the request; the passed mytoken is used for
+// authorization and is rotated if needed; the auth context is recorded in the revocation event
+func RevokeByMOMID(
+	rlog log.Ext1FieldLogger, req api.RevocationRequest, token universalmytoken.UniversalMytoken,
+	authToken *mytokenPkg.Mytoken, clientMetadata *api.ClientMetaData, authContext string,
+) *model.Response {
+	var res *model.Response
+	_ = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			errRes := revokeByID(rlog, tx, req, authToken, clientMetadata, authContext)
+			if errRes != nil {
+				res = errRes
+				return errors.New("rollback")
+			}
+			tokenUpdate, err := rotation.RotateMytokenAfterOtherForResponse(
+				rlog, tx, token.JWT, authToken, *clientMetadata, token.OriginalTokenType,
+			)
+			if err != nil {
+				res = model.ErrorToInternalServerErrorResponse(err)
+				return err
+			}
+			if tokenUpdate != nil {
+				res = &model.Response{
+					Status: fiber.StatusOK,
+					Response: pkg.OnlyTokenUpdateRes{
+						TokenUpdate: tokenUpdate,
+					},
+					Cookies: []*fiber.Cookie{cookies.MytokenCookie(tokenUpdate.Mytoken)},
+				}
+			}
+			return nil
+		},
+	)
+	if res != nil {
+		return res
+	}
+	return &model.Response{Status: fiber.StatusNoContent}
+}
+
 func revokeByID(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, req api.RevocationRequest,
 	authToken *mytokenPkg.Mytoken,
-	clientMetadata *api.ClientMetaData,
+	clientMetadata *api.ClientMetaData, authContext string,
 ) (errRes *model.Response) {
 	rollback := errors.New("rollback")
 	_ = db.RunWithinTransaction(
@@ -169,6 +186,7 @@ func revokeByID(
 					Event:          api.EventRevokedOtherToken,
 					MTID:           authToken.ID,
 					Comment:        fmt.Sprintf("mom_id: %s", req.MOMID),
+					AuthContext:    authContext,
 					ClientMetaData: *clientMetadata,
 				},
 			); err != nil {
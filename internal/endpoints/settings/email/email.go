@@ -1,9 +1,12 @@
 package email
 
 import (
+	"fmt"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/utils"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/config"
@@ -11,6 +14,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/actions"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings"
+	"github.com/oidc-mytoken/server/internal/endpoints/stepup"
 	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
@@ -24,13 +28,22 @@ import (
 	"github.com/oidc-mytoken/server/internal/utils/auth"
 	"github.com/oidc-mytoken/server/internal/utils/cookies"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	"github.com/oidc-mytoken/server/internal/utils/logger"
 )
 
 // MailSettingsInfoResponse is a type for the response for listing mail settings
 type MailSettingsInfoResponse struct {
 	api.MailSettingsInfoResponse
-	TokenUpdate *my.MytokenResponse `json:"token_update,omitempty"`
+	Language           string              `json:"language"`
+	SupportedLanguages []string            `json:"supported_languages"`
+	TokenUpdate        *my.MytokenResponse `json:"token_update,omitempty"`
+}
+
+// UpdateMailSettingsRequest is a type for requests to update the mail settings
+type UpdateMailSettingsRequest struct {
+	api.UpdateMailSettingsRequest
+	Language string `json:"language,omitempty"`
 }
 
 // SetTokenUpdate implements the pkg.TokenUpdatableResponse interface
@@ -57,6 +70,8 @@ func HandleGet(ctx *fiber.Ctx) *model.Response {
 					EmailVerified:  info.MailVerified,
 					PreferHTMLMail: info.PreferHTMLMail,
 				},
+				Language:           info.Lang(),
+				SupportedLanguages: i18n.Languages(),
 			}, nil
 		}, false,
 	)
@@ -64,7 +79,7 @@ func HandleGet(ctx *fiber.Ctx) *model.Response {
 
 func changeEmailAddress(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, email string,
-	clientMetaData *api.ClientMetaData,
+	clientMetaData *api.ClientMetaData, authContext string,
 ) error {
 	return db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
@@ -84,19 +99,19 @@ func changeEmailAddress(
 					Event:          api.EventEmailChanged,
 					MTID:           mtID,
 					Comment:        email,
+					AuthContext:    authContext,
 					ClientMetaData: *clientMetaData,
 				},
 			); err != nil {
 				return err
 			}
-			notifier.SendTemplateEmail(
-				email, mailtemplates.SubjectVerifyMail, mailInfo.PreferHTMLMail,
+			return notifier.SendTemplateEmail(
+				rlog, tx, mtID, mailInfo, i18n.Translate(mailInfo.Lang(), mailtemplates.SubjectVerifyMail),
 				mailtemplates.TemplateVerifyMail, map[string]any{
 					"issuer": config.Get().IssuerURL,
 					"link":   verificationURL,
 				},
 			)
-			return nil
 		},
 	)
 }
@@ -130,17 +145,41 @@ func changePreferredMimeType(
 	)
 }
 
+func changeLanguage(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, language string,
+	clientMetaData *api.ClientMetaData,
+) error {
+	return db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			if err := userrepo.SetLanguage(rlog, tx, mtID, language); err != nil {
+				return err
+			}
+			return eventService.LogEvent(
+				rlog, tx, pkg.MTEvent{
+					Event:          pkg.EventLanguageChanged,
+					Comment:        language,
+					MTID:           mtID,
+					ClientMetaData: *clientMetaData,
+				},
+			)
+		},
+	)
+}
+
 // HandlePut handles PUT requests to the email settings endpoint, i.e. it updates email settings
 func HandlePut(ctx *fiber.Ctx) *model.Response {
 	rlog := logger.GetRequestLogger(ctx)
 	rlog.Debug("Handle update email settings request")
-	var req api.UpdateMailSettingsRequest
+	var req UpdateMailSettingsRequest
 	if err := ctx.BodyParser(&req); err != nil {
 		return model.ErrorToBadRequestErrorResponse(err)
 	}
-	if req.PreferHTMLMail == nil && req.EmailAddress == "" {
+	if req.PreferHTMLMail == nil && req.EmailAddress == "" && req.Language == "" {
 		return model.BadRequestErrorResponse("no request parameter given")
 	}
+	if req.Language != "" && !utils.StringInSlice(req.Language, i18n.Languages()) {
+		return model.BadRequestErrorResponse(fmt.Sprintf("unsupported language '%s'", req.Language))
+	}
 	var reqMytoken universalmytoken.UniversalMytoken
 	mt, errRes := auth.RequireValidMytoken(rlog, nil, &reqMytoken, ctx)
 	if errRes != nil {
@@ -152,6 +191,12 @@ func HandlePut(ctx *fiber.Ctx) *model.Response {
 	if errRes != nil {
 		return errRes
 	}
+	var authContext string
+	if req.EmailAddress != "" {
+		if authContext, errRes = stepup.RequireStepUp(rlog, nil, mt.ID); errRes != nil {
+			return errRes
+		}
+	}
 	var tokenUpdate *my.MytokenResponse
 	clientMetaData := ctxutils.ClientMetaData(ctx)
 	if err := db.Transact(
@@ -161,8 +206,15 @@ func HandlePut(ctx *fiber.Ctx) *model.Response {
 					return err
 				}
 			}
+			if req.Language != "" {
+				if err := changeLanguage(rlog, tx, mt.ID, req.Language, clientMetaData); err != nil {
+					return err
+				}
+			}
 			if req.EmailAddress != "" {
-				if err := changeEmailAddress(rlog, tx, mt.ID, req.EmailAddress, clientMetaData); err != nil {
+				if err := changeEmailAddress(
+					rlog, tx, mt.ID, req.EmailAddress, clientMetaData, authContext,
+				); err != nil {
 					return err
 				}
 			}
@@ -26,39 +26,52 @@ func HandleListGrants(ctx *fiber.Ctx) *model.Response {
 
 	return settings.HandleSettingsHelper(
 		ctx, nil, &reqMytoken, api.CapabilityGrantsRead, &api.EventGrantsListed, "", fiber.StatusOK,
-		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
-			grants, err := grantrepo.Get(rlog, tx, mt.ID)
-			if err != nil {
-				return nil, model.ErrorToInternalServerErrorResponse(err)
-			}
-			return &request.GrantTypeInfoResponse{
-				GrantTypeInfoResponse: api.GrantTypeInfoResponse{
-					GrantTypes: grants,
-				},
-			}, nil
-		}, false,
+		listGrantsCallback(rlog), false,
 	)
 }
 
+// ListGrants returns a list of enabled/disabled grant types for the user of an already validated mytoken
+func ListGrants(
+	rlog log.Ext1FieldLogger, mt *mytoken.Mytoken, reqMytoken *universalmytoken.UniversalMytoken,
+	clientMetadata *api.ClientMetaData,
+) *model.Response {
+	return settings.HandleSettingsHelperForMytoken(
+		rlog, nil, mt, reqMytoken, clientMetadata, api.CapabilityGrantsRead, &api.EventGrantsListed, "",
+		fiber.StatusOK, listGrantsCallback(rlog), false,
+	)
+}
+
+func listGrantsCallback(
+	rlog log.Ext1FieldLogger,
+) func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+	return func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+		grants, err := grantrepo.Get(rlog, tx, mt.ID)
+		if err != nil {
+			return nil, model.ErrorToInternalServerErrorResponse(err)
+		}
+		return &request.GrantTypeInfoResponse{
+			GrantTypeInfoResponse: api.GrantTypeInfoResponse{
+				GrantTypes: grants,
+			},
+		}, nil
+	}
+}
+
 // HandleEnableGrant handles requests to enable a grant type
 func HandleEnableGrant(ctx *fiber.Ctx) *model.Response {
 	rlog := logger.GetRequestLogger(ctx)
 	rlog.Debug("Handle enable grant type request")
-	return handleEditGrant(rlog, ctx, grantrepo.Enable, api.EventGrantEnabled, fiber.StatusCreated)
+	return handleEditGrant(rlog, ctx, true)
 }
 
 // HandleDisableGrant handles requests to disable a grant type
 func HandleDisableGrant(ctx *fiber.Ctx) *model.Response {
 	rlog := logger.GetRequestLogger(ctx)
 	rlog.Debug("Handle disable grant type request")
-	return handleEditGrant(rlog, ctx, grantrepo.Disable, api.EventGrantDisabled, fiber.StatusNoContent)
+	return handleEditGrant(rlog, ctx, false)
 }
 
-func handleEditGrant(
-	rlog log.Ext1FieldLogger, ctx *fiber.Ctx,
-	dbCallBack func(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID, grant model.GrantType) error,
-	evt api.Event, okStatus int,
-) *model.Response {
+func handleEditGrant(rlog log.Ext1FieldLogger, ctx *fiber.Ctx, enable bool) *model.Response {
 	req := request.GrantTypeRequest{GrantType: -1}
 	if err := ctx.BodyParser(&req); err != nil {
 		return model.ErrorToBadRequestErrorResponse(err)
@@ -68,13 +81,44 @@ func handleEditGrant(
 	}
 	rlog.Trace("Parsed grant type request")
 
+	dbCallBack, evt, okStatus := editGrantParameters(enable)
 	return settings.HandleSettingsHelper(
 		ctx, nil, &req.Mytoken, api.CapabilityGrants, &evt, req.GrantType.String(), okStatus,
-		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
-			if err := dbCallBack(rlog, tx, mt.ID, req.GrantType); err != nil {
-				return nil, model.ErrorToInternalServerErrorResponse(err)
-			}
-			return nil, nil
-		}, false,
+		editGrantCallback(rlog, dbCallBack, req.GrantType), false,
 	)
 }
+
+// EditGrant enables or disables a grant type for the user of an already validated mytoken
+func EditGrant(
+	rlog log.Ext1FieldLogger, mt *mytoken.Mytoken, reqMytoken *universalmytoken.UniversalMytoken,
+	clientMetadata *api.ClientMetaData, grantType model.GrantType, enable bool,
+) *model.Response {
+	if !grantType.Valid() {
+		return model.BadRequestErrorResponse("no valid 'grant_type' found")
+	}
+	dbCallBack, evt, okStatus := editGrantParameters(enable)
+	return settings.HandleSettingsHelperForMytoken(
+		rlog, nil, mt, reqMytoken, clientMetadata, api.CapabilityGrants, &evt, grantType.String(), okStatus,
+		editGrantCallback(rlog, dbCallBack, grantType), false,
+	)
+}
+
+type editGrantDBCallback func(rlog log.Ext1FieldLogger, tx *sqlx.Tx, myid mtid.MTID, grant model.GrantType) error
+
+func editGrantParameters(enable bool) (editGrantDBCallback, api.Event, int) {
+	if enable {
+		return grantrepo.Enable, api.EventGrantEnabled, fiber.StatusCreated
+	}
+	return grantrepo.Disable, api.EventGrantDisabled, fiber.StatusNoContent
+}
+
+func editGrantCallback(
+	rlog log.Ext1FieldLogger, dbCallBack editGrantDBCallback, grantType model.GrantType,
+) func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+	return func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+		if err := dbCallBack(rlog, tx, mt.ID, grantType); err != nil {
+			return nil, model.ErrorToInternalServerErrorResponse(err)
+		}
+		return nil, nil
+	}
+}
@@ -1,15 +1,15 @@
 package pkg
 
 import (
-	"github.com/oidc-mytoken/api/v0"
-
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/sshrepo"
 	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 )
 
 // SSHInfoResponse is a type for the response about a user's ssh keys
 type SSHInfoResponse struct {
-	api.SSHInfoResponse
-	TokenUpdate *my.MytokenResponse `json:"token_update,omitempty"`
+	GrantEnabled bool                 `json:"grant_enabled"`
+	SSHKeyInfo   []sshrepo.SSHKeyInfo `json:"ssh_keys"`
+	TokenUpdate  *my.MytokenResponse  `json:"token_update,omitempty"`
 }
 
 // SetTokenUpdate implements the pkg.TokenUpdatableResponse interface
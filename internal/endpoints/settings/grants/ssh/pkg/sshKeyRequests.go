@@ -3,6 +3,7 @@ package pkg
 import (
 	"github.com/oidc-mytoken/api/v0"
 
+	"github.com/oidc-mytoken/server/internal/model/sshkey"
 	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
 )
@@ -13,9 +14,14 @@ type SSHKeyDeleteRequest struct {
 	Mytoken universalmytoken.UniversalMytoken `json:"mytoken" xml:"mytoken" form:"mytoken"`
 }
 
-// SSHKeyAddRequest is a type for a request to add an ssh key
+// SSHKeyAddRequest is a type for a request to add an ssh key; if CA is set the ssh key is trusted as a user
+// certificate authority and all certificates signed by it can be used; KeyRestrictions restrict the usage of the ssh
+// key itself
 type SSHKeyAddRequest struct {
 	api.SSHKeyAddRequest
-	Mytoken      universalmytoken.UniversalMytoken `json:"mytoken" xml:"mytoken" form:"mytoken"`
-	Restrictions restrictions.Restrictions         `json:"restrictions" form:"restrictions" xml:"restrictions"`
+	Mytoken         universalmytoken.UniversalMytoken `json:"mytoken" xml:"mytoken" form:"mytoken"`
+	Restrictions    restrictions.Restrictions         `json:"restrictions" form:"restrictions" xml:"restrictions"`
+	CA              bool                              `json:"ca" form:"ca" xml:"ca"`
+	Principals      []string                          `json:"principals" form:"principals" xml:"principals"`
+	KeyRestrictions sshkey.Restrictions               `json:"key_restrictions" xml:"key_restrictions"`
 }
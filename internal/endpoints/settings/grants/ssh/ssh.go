@@ -2,6 +2,9 @@ package ssh
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +24,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/polling"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/model/profiled"
+	"github.com/oidc-mytoken/server/internal/model/sshkey"
 	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
 	"github.com/oidc-mytoken/server/internal/oidc/authcode"
@@ -40,7 +44,7 @@ func HandleGetSSHInfo(ctx *fiber.Ctx) *model.Response {
 	return settings.HandleSettingsHelper(
 		ctx, nil, &reqMytoken, api.CapabilitySSHGrantRead, &api.EventSSHKeyListed, "", fiber.StatusOK,
 		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
-			info, err := sshrepo.GetAllSSHInfo(rlog, tx, mt.ID)
+			info, err := sshrepo.GetAllSSHInfoWithHistory(rlog, tx, mt.ID)
 			_, err = db.ParseError(err)
 			if err != nil {
 				rlog.Errorf("%s", errorfmt.Full(err))
@@ -52,10 +56,8 @@ func HandleGetSSHInfo(ctx *fiber.Ctx) *model.Response {
 				return nil, model.ErrorToInternalServerErrorResponse(err)
 			}
 			return &request.SSHInfoResponse{
-				SSHInfoResponse: api.SSHInfoResponse{
-					GrantEnabled: grantEnabled,
-					SSHKeyInfo:   info,
-				},
+				GrantEnabled: grantEnabled,
+				SSHKeyInfo:   info,
 			}, nil
 		}, false,
 	)
@@ -131,6 +133,15 @@ func handleAddSSHKey(ctx *fiber.Ctx) *model.Response {
 	if err != nil {
 		return model.BadRequestErrorResponse("could not parse ssh public key")
 	}
+	if _, isCert := sshKey.(*gossh.Certificate); isCert {
+		return model.BadRequestErrorResponse("ssh certificates cannot be added; add the public key of the ca instead")
+	}
+	if errRes := checkPrincipals(req); errRes != nil {
+		return errRes
+	}
+	if errRes := checkKeyRestrictions(req.KeyRestrictions); errRes != nil {
+		return errRes
+	}
 	sshKeyFP := gossh.FingerprintSHA256(sshKey)
 	if len(req.Capabilities) == 0 {
 		req.Capabilities = api.Capabilities{api.CapabilityAT}
@@ -144,6 +155,40 @@ func handleAddSSHKey(ctx *fiber.Ctx) *model.Response {
 	)
 }
 
+func checkPrincipals(req request.SSHKeyAddRequest) *model.Response {
+	if len(req.Principals) == 0 {
+		return nil
+	}
+	if !req.CA {
+		return model.BadRequestErrorResponse("'principals' can only be given for a certificate authority")
+	}
+	for _, p := range req.Principals {
+		if p == "" || strings.Contains(p, ",") {
+			return model.BadRequestErrorResponse(fmt.Sprintf("invalid principal '%s'", p))
+		}
+	}
+	return nil
+}
+
+func checkKeyRestrictions(r sshkey.Restrictions) *model.Response {
+	for _, ip := range r.AllowedIPs {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return model.BadRequestErrorResponse(fmt.Sprintf("invalid ip or subnet '%s' in 'allowed_ips'", ip))
+			}
+		}
+	}
+	for _, reqType := range r.AllowedRequests {
+		if !ssh.IsRequestType(reqType) {
+			return model.BadRequestErrorResponse(fmt.Sprintf("unknown ssh request '%s' in 'allowed_requests'", reqType))
+		}
+	}
+	if r.ExpiresAt != 0 && r.Expired() {
+		return model.BadRequestErrorResponse("'expires_at' must be in the future")
+	}
+	return nil
+}
+
 func handleAddSSHSettingsCallback(
 	rlog log.Ext1FieldLogger, ctx *fiber.Ctx, req *request.SSHKeyAddRequest,
 	sshKeyFP string,
@@ -209,7 +254,10 @@ func handleAddSSHSettingsCallback(
 		return nil, res
 	}
 	authRes := res.Response.(api.AuthCodeFlowResponse)
-	if err = transfercoderepo.LinkPollingCodeToSSHKey(rlog, tx, authRes.PollingCode, sshKeyFP); err != nil {
+	if err = transfercoderepo.LinkPollingCodeToSSHKey(
+		rlog, tx, authRes.PollingCode, sshKeyFP, req.CA, sshrepo.JoinPrincipals(req.Principals),
+		req.KeyRestrictions,
+	); err != nil {
 		rlog.Errorf("%s", errorfmt.Full(err))
 		return nil, model.ErrorToInternalServerErrorResponse(err)
 	}
@@ -263,11 +311,14 @@ func handlePollingCode(ctx *fiber.Ctx) *model.Response {
 	}
 	name := extractSSHKeyNameFromMTName(mtName.String)
 	data := sshrepo.SSHInfoIn{
-		MTID:           mt.ID,
-		Name:           db.NewNullString(name),
-		KeyFingerprint: status.SSHKeyFingerprint.String,
-		UserHash:       userHash,
-		EncryptedMT:    encryptedMT,
+		MTID:            mt.ID,
+		Name:            db.NewNullString(name),
+		KeyFingerprint:  status.SSHKeyFingerprint.String,
+		UserHash:        userHash,
+		EncryptedMT:     encryptedMT,
+		CA:              status.SSHKeyCA,
+		Principals:      status.SSHPrincipals,
+		KeyRestrictions: status.SSHKeyRestrictions,
 	}
 	if err = sshrepo.Insert(rlog, nil, data); err != nil {
 		rlog.Errorf("%s", errorfmt.Full(err))
@@ -0,0 +1,245 @@
+package passkeys
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webauthnrepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/settings"
+	"github.com/oidc-mytoken/server/internal/endpoints/stepup"
+	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	"github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/internal/utils/webauthn"
+)
+
+// rpName is the relying party name shown by authenticators
+const rpName = "mytoken"
+
+// ListResponse is the response to a request to list the registered passkeys
+type ListResponse struct {
+	Passkeys    []webauthnrepo.Credential `json:"passkeys"`
+	TokenUpdate *my.MytokenResponse       `json:"token_update,omitempty"`
+}
+
+// SetTokenUpdate implements the pkg.TokenUpdatableResponse interface
+func (res *ListResponse) SetTokenUpdate(tokenUpdate *my.MytokenResponse) {
+	res.TokenUpdate = tokenUpdate
+}
+
+// CreationOptions are the options the browser needs to start a WebAuthn registration ceremony
+type CreationOptions struct {
+	Challenge          string              `json:"challenge"`
+	RPID               string              `json:"rp_id"`
+	RPName             string              `json:"rp_name"`
+	UserID             string              `json:"user_id"`
+	UserName           string              `json:"user_name"`
+	Algorithms         []int               `json:"algorithms"`
+	ExcludeCredentials []string            `json:"exclude_credentials,omitempty"`
+	Timeout            int64               `json:"timeout"`
+	TokenUpdate        *my.MytokenResponse `json:"token_update,omitempty"`
+}
+
+// SetTokenUpdate implements the pkg.TokenUpdatableResponse interface
+func (res *CreationOptions) SetTokenUpdate(tokenUpdate *my.MytokenResponse) {
+	res.TokenUpdate = tokenUpdate
+}
+
+// RegisterRequest is the request to finish the registration of a passkey
+type RegisterRequest struct {
+	Mytoken    universalmytoken.UniversalMytoken `json:"mytoken"`
+	Challenge  string                            `json:"challenge"`
+	Name       string                            `json:"name"`
+	Credential webauthn.RegistrationResponse     `json:"credential"`
+}
+
+// DeleteRequest is the request to delete a passkey
+type DeleteRequest struct {
+	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+	ID      uint64                            `json:"id"`
+}
+
+// webAuthnUserID returns a stable opaque user handle for the user of a mytoken
+func webAuthnUserID(mt *mytoken.Mytoken) string {
+	h := sha256.Sum256([]byte(mt.OIDCIssuer + " " + mt.OIDCSubject))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// HandleList handles requests to list the registered passkeys of a user
+func HandleList(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle list passkeys request")
+	var reqMytoken universalmytoken.UniversalMytoken
+	return settings.HandleSettingsHelper(
+		ctx, nil, &reqMytoken, api.CapabilitySettingsRead, &pkg.EventPasskeysListed, "", fiber.StatusOK,
+		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+			creds, err := webauthnrepo.GetCredentials(rlog, tx, mt.ID)
+			if err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			if creds == nil {
+				creds = []webauthnrepo.Credential{}
+			}
+			return &ListResponse{Passkeys: creds}, nil
+		}, false,
+	)
+}
+
+// HandleRegisterBegin handles requests to start the registration of a new passkey; if the user already has a
+// passkey, a step-up is required
+func HandleRegisterBegin(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle passkey registration begin request")
+	var reqMytoken universalmytoken.UniversalMytoken
+	return settings.HandleSettingsHelper(
+		ctx, nil, &reqMytoken, api.CapabilitySettings, &api.EventUnknown, "", fiber.StatusOK,
+		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+			if _, errRes := stepup.RequireStepUp(rlog, tx, mt.ID); errRes != nil {
+				return nil, errRes
+			}
+			rp, err := stepup.RelyingParty()
+			if err != nil {
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			challenge, err := webauthn.NewChallenge()
+			if err != nil {
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			creds, err := webauthnrepo.GetCredentials(rlog, tx, mt.ID)
+			if err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			options := &CreationOptions{
+				Challenge:  challenge,
+				RPID:       rp.ID,
+				RPName:     rpName,
+				UserID:     webAuthnUserID(mt),
+				UserName:   fmt.Sprintf("%s (%s)", mt.OIDCSubject, mt.OIDCIssuer),
+				Algorithms: webauthn.SupportedAlgorithms,
+				Timeout:    stepup.ChallengeLifetime * 1000,
+			}
+			for _, c := range creds {
+				options.ExcludeCredentials = append(options.ExcludeCredentials, c.CredentialID)
+			}
+			if err = webauthnrepo.InsertChallenge(
+				rlog, tx, challenge, webauthnrepo.PurposeRegister, &mt.ID, nil, stepup.ChallengeLifetime,
+			); err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			return options, nil
+		}, false,
+	)
+}
+
+// HandleRegisterFinish handles requests to finish the registration of a new passkey
+func HandleRegisterFinish(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle passkey registration finish request")
+	var req RegisterRequest
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if req.Challenge == "" {
+		return model.BadRequestErrorResponse("required parameter 'challenge' missing")
+	}
+	return settings.HandleSettingsHelper(
+		ctx, nil, &req.Mytoken, api.CapabilitySettings, &api.EventUnknown, "", fiber.StatusNoContent,
+		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+			binding, found, err := webauthnrepo.PopChallenge(rlog, tx, req.Challenge, webauthnrepo.PurposeRegister)
+			if err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			if !found || binding.MTID.Hash() != mt.ID.Hash() {
+				return nil, model.BadRequestErrorResponse("unknown or expired challenge")
+			}
+			rp, err := stepup.RelyingParty()
+			if err != nil {
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			publicKey, signCount, err := rp.VerifyRegistration(req.Credential, req.Challenge)
+			if err != nil {
+				return nil, model.ErrorToBadRequestErrorResponse(err)
+			}
+			if err = webauthnrepo.InsertCredential(
+				rlog, tx, mt.ID, req.Credential.CredentialID, publicKey, signCount, req.Name,
+			); err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			if err = eventService.LogEvent(
+				rlog, tx, pkg.MTEvent{
+					Event:          pkg.EventPasskeyAdded,
+					Comment:        req.Name,
+					MTID:           mt.ID,
+					ClientMetaData: *ctxutils.ClientMetaData(ctx),
+				},
+			); err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			return nil, nil
+		}, false,
+	)
+}
+
+// HandleDelete handles requests to delete a passkey; this requires a step-up
+func HandleDelete(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle delete passkey request")
+	var req DeleteRequest
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if req.ID == 0 {
+		return model.BadRequestErrorResponse("required parameter 'id' missing")
+	}
+	return settings.HandleSettingsHelper(
+		ctx, nil, &req.Mytoken, api.CapabilitySettings, &api.EventUnknown, "", fiber.StatusNoContent,
+		func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *model.Response) {
+			authContext, errRes := stepup.RequireStepUp(rlog, tx, mt.ID)
+			if errRes != nil {
+				return nil, errRes
+			}
+			found, err := webauthnrepo.DeleteCredential(rlog, tx, mt.ID, req.ID)
+			if err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			if !found {
+				return nil, &model.Response{
+					Status:   fiber.StatusNotFound,
+					Response: model.BadRequestError("passkey not found"),
+				}
+			}
+			if err = eventService.LogEvent(
+				rlog, tx, pkg.MTEvent{
+					Event:          pkg.EventPasskeyRemoved,
+					Comment:        fmt.Sprintf("id: %d", req.ID),
+					MTID:           mt.ID,
+					AuthContext:    authContext,
+					ClientMetaData: *ctxutils.ClientMetaData(ctx),
+				},
+			); err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return nil, model.ErrorToInternalServerErrorResponse(err)
+			}
+			return nil, nil
+		}, false,
+	)
+}
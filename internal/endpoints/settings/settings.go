@@ -6,6 +6,7 @@ import (
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/utils"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
@@ -62,10 +63,45 @@ func HandleSettingsHelper(
 			mt, errRes := auth.RequireValidMytoken(rlog, tx, reqMytoken, ctx)
 			if errRes != nil {
 				res = errRes
+				// Don't roll back, so an automated response to suspicious activity is kept
+				return nil
+			}
+			res = HandleSettingsHelperForMytoken(
+				rlog, tx, mt, reqMytoken, ctxutils.ClientMetaData(ctx), requiredCapability, logEvent, eventComment,
+				okStatus, callback, tokenGoneAfterCallback,
+			)
+			if res.Status >= 400 {
 				return errors.New("rollback")
 			}
+			return nil
+		},
+	); err != nil && res == nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		res = serverModel.ErrorToInternalServerErrorResponse(err)
+	}
+	return res
+}
+
+// HandleSettingsHelperForMytoken is like HandleSettingsHelper, but for an already validated mytoken; this allows
+// settings requests from other sources than http requests
+func HandleSettingsHelperForMytoken(
+	rlog log.Ext1FieldLogger,
+	tx *sqlx.Tx,
+	mt *mytoken.Mytoken,
+	reqMytoken *universalmytoken.UniversalMytoken,
+	clientMetadata *api.ClientMetaData,
+	requiredCapability api.Capability,
+	logEvent *api.Event,
+	eventComment string,
+	okStatus int,
+	callback func(tx *sqlx.Tx, mt *mytoken.Mytoken) (my.TokenUpdatableResponse, *serverModel.Response),
+	tokenGoneAfterCallback bool,
+) *serverModel.Response {
+	var res *serverModel.Response
+	if err := db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
 			usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
-				rlog, tx, mt, ctxutils.ClientMetaData(ctx), requiredCapability,
+				rlog, tx, mt, clientMetadata, requiredCapability,
 			)
 			if errRes != nil {
 				res = errRes
@@ -88,7 +124,7 @@ func HandleSettingsHelper(
 			}
 			var rollback bool
 			res, rollback = mytokenutils.DoAfterRequestThingsOther(
-				rlog, tx, res, mt, *ctxutils.ClientMetaData(ctx),
+				rlog, tx, res, mt, *clientMetadata,
 				*logEvent, eventComment, usedRestriction, reqMytoken.JWT, reqMytoken.OriginalTokenType,
 			)
 			if rollback {
@@ -0,0 +1,23 @@
+package pkg
+
+import (
+	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+)
+
+// SSHCertificateRequest is a request to obtain a short-lived ssh user certificate for an ssh public key
+type SSHCertificateRequest struct {
+	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+	SSHKey  string                            `json:"ssh_key"`
+	// Lifetime is the requested lifetime of the certificate in seconds; if omitted the server's default is used
+	Lifetime int64 `json:"lifetime,omitempty"`
+}
+
+// SSHCertificateResponse is the response to a SSHCertificateRequest
+type SSHCertificateResponse struct {
+	SSHCertificate string              `json:"ssh_certificate"`
+	Principals     []string            `json:"principals"`
+	ValidAfter     int64               `json:"valid_after"`
+	ValidBefore    int64               `json:"valid_before"`
+	TokenUpdate    *my.MytokenResponse `json:"token_update,omitempty"`
+}
@@ -0,0 +1,191 @@
+package sshcert
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/endpoints/sshcert/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	pkg2 "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
+	"github.com/oidc-mytoken/server/internal/mytoken/rotation"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+	"github.com/oidc-mytoken/server/internal/utils/cookies"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// clockSkew is subtracted from the start of a certificate's validity to account for ssh servers with a slightly wrong
+// clock
+const clockSkew = time.Minute
+
+// defaultExtensions are the extensions set in issued certificates; these are the same as used by ssh-keygen
+var defaultExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// HandleSSHCertificate handles requests to issue a short-lived ssh user certificate
+func HandleSSHCertificate(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle ssh certificate request")
+	req := pkg.SSHCertificateRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if req.SSHKey == "" {
+		return model.BadRequestErrorResponse("required parameter 'ssh_key' is missing")
+	}
+	sshKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(req.SSHKey))
+	if err != nil {
+		return model.BadRequestErrorResponse("could not parse ssh public key")
+	}
+	if _, isCert := sshKey.(*gossh.Certificate); isCert {
+		return model.BadRequestErrorResponse("'ssh_key' must be a public key, not a certificate")
+	}
+	if req.Lifetime < 0 {
+		return model.BadRequestErrorResponse("'lifetime' must not be negative")
+	}
+	clientMetadata := ctxutils.ClientMetaData(ctx)
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	usedRestriction, errRes := auth.RequireCapabilityAndRestrictionOther(
+		rlog, nil, mt, clientMetadata, model.CapabilitySSHCertificate,
+	)
+	if errRes != nil {
+		return errRes
+	}
+	cert, err := issueCertificate(
+		sshKey, mt, usedRestriction, req.Lifetime, config.Get().Features.SSH.UserCertificates,
+	)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	res := pkg.SSHCertificateResponse{
+		SSHCertificate: string(gossh.MarshalAuthorizedKey(cert)),
+		Principals:     cert.ValidPrincipals,
+		ValidAfter:     int64(cert.ValidAfter),
+		ValidBefore:    int64(cert.ValidBefore),
+	}
+	if err = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			if usedRestriction != nil {
+				if err = usedRestriction.UsedOther(rlog, tx, mt.ID); err != nil {
+					return err
+				}
+			}
+			if err = eventService.LogEvent(
+				rlog, tx, pkg2.MTEvent{
+					Event:          pkg2.EventSSHCertificateIssued,
+					MTID:           mt.ID,
+					Comment:        fmt.Sprintf("serial: %d", cert.Serial),
+					ClientMetaData: *clientMetadata,
+				},
+			); err != nil {
+				return err
+			}
+			res.TokenUpdate, err = rotation.RotateMytokenAfterOtherForResponse(
+				rlog, tx, req.Mytoken.JWT, mt, *clientMetadata, req.Mytoken.OriginalTokenType,
+			)
+			return err
+		},
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	var cake []*fiber.Cookie
+	if res.TokenUpdate != nil {
+		cake = []*fiber.Cookie{cookies.MytokenCookie(res.TokenUpdate.Mytoken)}
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: res,
+		Cookies:  cake,
+	}
+}
+
+// certificateValidity returns the validity period of a certificate; the requested lifetime is limited by the
+// configured maximum lifetime and the certificate never outlives the mytoken or the used restriction
+func certificateValidity(
+	mt *mytoken.Mytoken, usedRestriction *restrictions.Restriction, lifetime int64,
+	conf config.SSHUserCertificatesConf,
+) (validAfter, validBefore uint64) {
+	if lifetime == 0 {
+		lifetime = conf.DefaultLifetime
+	}
+	if lifetime > conf.MaxLifetime {
+		lifetime = conf.MaxLifetime
+	}
+	now := time.Now()
+	validAfter = uint64(now.Add(-clockSkew).Unix())
+	validBefore = uint64(now.Unix() + lifetime)
+	if mt.ExpiresAt != 0 && uint64(mt.ExpiresAt) < validBefore {
+		validBefore = uint64(mt.ExpiresAt)
+	}
+	if usedRestriction != nil && usedRestriction.ExpiresAt != 0 && uint64(usedRestriction.ExpiresAt) < validBefore {
+		validBefore = uint64(usedRestriction.ExpiresAt)
+	}
+	return
+}
+
+// certificatePrincipal returns the principal of a certificate for the user of the passed mytoken by filling in the
+// configured principal format
+func certificatePrincipal(format string, mt *mytoken.Mytoken) string {
+	var issuerHost string
+	if u, err := url.Parse(mt.OIDCIssuer); err == nil {
+		issuerHost = u.Host
+	}
+	return strings.NewReplacer(
+		"{sub}", mt.OIDCSubject,
+		"{issuer}", mt.OIDCIssuer,
+		"{issuer_host}", issuerHost,
+	).Replace(format)
+}
+
+func issueCertificate(
+	sshKey gossh.PublicKey, mt *mytoken.Mytoken, usedRestriction *restrictions.Restriction, lifetime int64,
+	conf config.SSHUserCertificatesConf,
+) (*gossh.Certificate, error) {
+	var serialBytes [8]byte
+	if _, err := rand.Read(serialBytes[:]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	validAfter, validBefore := certificateValidity(mt, usedRestriction, lifetime, conf)
+	cert := &gossh.Certificate{
+		Key:             sshKey,
+		Serial:          binary.BigEndian.Uint64(serialBytes[:]),
+		CertType:        gossh.UserCert,
+		KeyId:           fmt.Sprintf("mytoken:%s:%s@%s", mt.ID.Hash(), mt.OIDCSubject, mt.OIDCIssuer),
+		ValidPrincipals: []string{certificatePrincipal(conf.Principal, mt)},
+		ValidAfter:      validAfter,
+		ValidBefore:     validBefore,
+		Permissions: gossh.Permissions{
+			Extensions: defaultExtensions,
+		},
+	}
+	if err := cert.SignCert(rand.Reader, conf.CAKey); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,53 @@
+package sshcert
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+)
+
+func TestCertificatePrincipal(t *testing.T) {
+	mt := &mytoken.Mytoken{
+		Mytoken: api.Mytoken{
+			OIDCIssuer:  "https://op.example.com/realms/a",
+			OIDCSubject: "user",
+		},
+	}
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:     "default",
+			format:   "{sub}@{issuer}",
+			expected: "user@https://op.example.com/realms/a",
+		},
+		{
+			name:     "issuer host",
+			format:   "{sub}@{issuer_host}",
+			expected: "user@op.example.com",
+		},
+		{
+			name:     "subject only",
+			format:   "{sub}",
+			expected: "user",
+		},
+		{
+			name:     "prefix",
+			format:   "oidc-{sub}",
+			expected: "oidc-user",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := certificatePrincipal(test.format, mt); got != test.expected {
+					t.Errorf("expected '%s', but got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
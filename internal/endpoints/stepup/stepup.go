@@ -0,0 +1,309 @@
+package stepup
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webauthnrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	"github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/internal/utils/webauthn"
+)
+
+// ChallengeLifetime is the time in seconds a WebAuthn challenge can be used
+const ChallengeLifetime = 300
+
+// AssertionOptions are the options the browser needs to start a WebAuthn authentication ceremony
+type AssertionOptions struct {
+	Challenge        string   `json:"challenge"`
+	RPID             string   `json:"rp_id"`
+	Timeout          int64    `json:"timeout"`
+	AllowCredentials []string `json:"allow_credentials,omitempty"`
+}
+
+// BeginRequest is the request to start a step-up; if a consent code is given the step-up is done for the
+// authorization flow of that consent code, otherwise for the passed mytoken
+type BeginRequest struct {
+	ConsentCode string                            `json:"consent_code,omitempty"`
+	Mytoken     universalmytoken.UniversalMytoken `json:"mytoken,omitempty"`
+}
+
+// FinishRequest is the request to finish a step-up
+type FinishRequest struct {
+	BeginRequest
+	Challenge  string                     `json:"challenge"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// RelyingParty returns the webauthn.RelyingParty of this mytoken instance
+func RelyingParty() (webauthn.RelyingParty, error) {
+	return webauthn.NewRelyingParty(config.Get().IssuerURL)
+}
+
+// RequireStepUp checks if a WebAuthn step-up is required for the passed mytoken and if so, that a valid step-up was
+// done. A step-up is required if the user has registered a passkey, independent of how the request was made; otherwise
+// the step-up could be circumvented by using the mytoken outside the web interface. The returned auth context should
+// be recorded in the events of the request.
+func RequireStepUp(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (
+	authContext string, errRes *model.Response,
+) {
+	if !config.Get().Features.WebInterface.WebAuthn.Enabled {
+		return "", nil
+	}
+	if err := db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			creds, err := webauthnrepo.GetCredentials(rlog, tx, mtID)
+			if err != nil {
+				return err
+			}
+			if len(creds) == 0 {
+				return nil
+			}
+			valid, err := webauthnrepo.HasValidStepUp(rlog, tx, mtID)
+			if err != nil {
+				return err
+			}
+			if !valid {
+				errRes = &model.Response{
+					Status: fiber.StatusForbidden,
+					Response: model.StepUpRequiredError(
+						"This action requires a confirmation with one of your passkeys; confirm it for this mytoken " +
+							"at the step_up_endpoint or do it in the web interface",
+					),
+				}
+				return nil
+			}
+			authContext = pkg.AuthContextWebAuthn
+			return nil
+		},
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return "", model.ErrorToInternalServerErrorResponse(err)
+	}
+	return
+}
+
+// HandleBegin handles requests to start a step-up and returns the AssertionOptions
+func HandleBegin(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle step-up begin request")
+	var req BeginRequest
+	if len(ctx.Body()) > 0 {
+		if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+			return model.ErrorToBadRequestErrorResponse(err)
+		}
+	}
+	rp, err := RelyingParty()
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	options := AssertionOptions{
+		Challenge: challenge,
+		RPID:      rp.ID,
+		Timeout:   ChallengeLifetime * 1000,
+	}
+	if req.ConsentCode != "" {
+		oState := state.NewState(state.ConsentCodeFromStr(req.ConsentCode).GetState())
+		if _, err = authcodeinforepo.GetAuthFlowInfoByState(rlog, nil, oState); err != nil {
+			if _, err = db.ParseError(err); err != nil {
+				rlog.Errorf("%s", errorfmt.Full(err))
+				return model.ErrorToInternalServerErrorResponse(err)
+			}
+			return model.BadRequestErrorResponse("unknown consent code")
+		}
+		// The user is not known before the OP login, so the passkey must be a discoverable credential
+		if err = webauthnrepo.InsertChallenge(
+			rlog, nil, challenge, webauthnrepo.PurposeStepUp, nil, oState, ChallengeLifetime,
+		); err != nil {
+			rlog.Errorf("%s", errorfmt.Full(err))
+			return model.ErrorToInternalServerErrorResponse(err)
+		}
+		return &model.Response{
+			Status:   fiber.StatusOK,
+			Response: options,
+		}
+	}
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	if err = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			creds, err := webauthnrepo.GetCredentials(rlog, tx, mt.ID)
+			if err != nil {
+				return err
+			}
+			if len(creds) == 0 {
+				errRes = model.BadRequestErrorResponse("no passkey registered")
+				return errors.New("rollback")
+			}
+			for _, c := range creds {
+				options.AllowCredentials = append(options.AllowCredentials, c.CredentialID)
+			}
+			return webauthnrepo.InsertChallenge(
+				rlog, tx, challenge, webauthnrepo.PurposeStepUp, &mt.ID, nil, ChallengeLifetime,
+			)
+		},
+	); err != nil {
+		if errRes != nil {
+			return errRes
+		}
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	return &model.Response{
+		Status:   fiber.StatusOK,
+		Response: options,
+	}
+}
+
+// HandleFinish handles requests to finish a step-up by verifying the WebAuthn assertion
+func HandleFinish(ctx *fiber.Ctx) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.Debug("Handle step-up finish request")
+	var req FinishRequest
+	if err := json.Unmarshal(ctx.Body(), &req); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	if req.Challenge == "" {
+		return model.BadRequestErrorResponse("required parameter 'challenge' missing")
+	}
+	rp, err := RelyingParty()
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	var errRes *model.Response
+	if err = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			binding, found, err := webauthnrepo.PopChallenge(rlog, tx, req.Challenge, webauthnrepo.PurposeStepUp)
+			if err != nil {
+				return err
+			}
+			if !found {
+				errRes = model.BadRequestErrorResponse("unknown or expired challenge")
+				return errors.New("rollback")
+			}
+			// Error responses are returned before anything is written, so they are committed: The challenge is used
+			// up anyway and an automated response to suspicious activity must be kept
+			if binding.State != nil {
+				errRes, err = finishForConsent(rlog, tx, rp, req, binding.State)
+			} else {
+				errRes, err = finishForMytoken(rlog, tx, ctx, rp, req, binding.MTID)
+			}
+			return err
+		},
+	); err != nil {
+		if errRes != nil {
+			return errRes
+		}
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if errRes != nil {
+		return errRes
+	}
+	return &model.Response{Status: fiber.StatusNoContent}
+}
+
+func verifyCredential(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, rp webauthn.RelyingParty, req FinishRequest,
+	cred webauthnrepo.Credential,
+) (*model.Response, error) {
+	pk, err := cred.PublicKeyBytes()
+	if err != nil {
+		return nil, err
+	}
+	signCount, err := rp.VerifyAssertion(req.Credential, req.Challenge, pk, cred.SignCount)
+	if err != nil {
+		rlog.WithError(err).Debug("passkey assertion could not be verified")
+		return &model.Response{
+			Status:   fiber.StatusForbidden,
+			Response: model.ErrorWithErrorDescription(api.ErrorStrInvalidGrant, err),
+		}, nil
+	}
+	return nil, webauthnrepo.CredentialUsed(rlog, tx, cred.CredentialID, signCount)
+}
+
+func finishForConsent(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, rp webauthn.RelyingParty, req FinishRequest, boundState *state.State,
+) (*model.Response, error) {
+	oState := state.NewState(state.ConsentCodeFromStr(req.ConsentCode).GetState())
+	if req.ConsentCode == "" || oState.Hash() != boundState.Hash() {
+		return model.BadRequestErrorResponse("challenge was not issued for this consent code"), nil
+	}
+	cred, found, err := webauthnrepo.GetCredential(rlog, tx, req.Credential.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return model.BadRequestErrorResponse("unknown passkey"), nil
+	}
+	if errRes, err := verifyCredential(rlog, tx, rp, req, cred); errRes != nil || err != nil {
+		return errRes, err
+	}
+	return nil, authcodeinforepo.SetStepUp(rlog, tx, oState, cred.UserID)
+}
+
+func finishForMytoken(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, ctx *fiber.Ctx, rp webauthn.RelyingParty, req FinishRequest,
+	boundMTID mtid.MTID,
+) (*model.Response, error) {
+	mt, errRes := auth.RequireValidMytoken(rlog, tx, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes, nil
+	}
+	if mt.ID.Hash() != boundMTID.Hash() {
+		return model.BadRequestErrorResponse("challenge was not issued for this mytoken"), nil
+	}
+	creds, err := webauthnrepo.GetCredentials(rlog, tx, mt.ID)
+	if err != nil {
+		return nil, err
+	}
+	var cred *webauthnrepo.Credential
+	for i, c := range creds {
+		if c.CredentialID == req.Credential.CredentialID {
+			cred = &creds[i]
+			break
+		}
+	}
+	if cred == nil {
+		return model.BadRequestErrorResponse("unknown passkey"), nil
+	}
+	if errRes, err = verifyCredential(rlog, tx, rp, req, *cred); errRes != nil || err != nil {
+		return errRes, err
+	}
+	if err = webauthnrepo.InsertStepUp(
+		rlog, tx, mt.ID, config.Get().Features.WebInterface.WebAuthn.StepUpLifetime,
+	); err != nil {
+		return nil, err
+	}
+	return nil, eventService.LogEvent(
+		rlog, tx, pkg.MTEvent{
+			Event:          pkg.EventStepUp,
+			Comment:        cred.Name.String,
+			MTID:           mt.ID,
+			AuthContext:    pkg.AuthContextWebAuthn,
+			ClientMetaData: *ctxutils.ClientMetaData(ctx),
+		},
+	)
+}
@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/universalmytoken"
+)
+
+// SuspensionRequest is a request to suspend or resume a mytoken
+type SuspensionRequest struct {
+	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+	// MOMID is the mom_id of the mytoken that should be suspended or resumed; if omitted the passed mytoken itself
+	// is suspended
+	MOMID     mtid.MOMID `json:"mom_id"`
+	Recursive bool       `json:"recursive,omitempty"`
+}
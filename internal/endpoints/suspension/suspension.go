@@ -0,0 +1,174 @@
+package suspension
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	helper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/endpoints/suspension/pkg"
+	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	pkg2 "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/mytoken/rotation"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+	"github.com/oidc-mytoken/server/internal/utils/cookies"
+	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// HandleSuspend handles requests to suspend a mytoken
+func HandleSuspend(ctx *fiber.Ctx) *model.Response {
+	return handleSuspension(ctx, true)
+}
+
+// HandleResume handles requests to resume a suspended mytoken
+func HandleResume(ctx *fiber.Ctx) *model.Response {
+	return handleSuspension(ctx, false)
+}
+
+func handleSuspension(ctx *fiber.Ctx, suspend bool) *model.Response {
+	rlog := logger.GetRequestLogger(ctx)
+	rlog.WithField("suspend", suspend).Debug("Handle suspension request")
+	req := pkg.SuspensionRequest{}
+	if err := errors.WithStack(json.Unmarshal(ctx.Body(), &req)); err != nil {
+		return model.ErrorToBadRequestErrorResponse(err)
+	}
+	self := !req.MOMID.HashValid()
+	if errRes := checkSelfSuspension(self, suspend); errRes != nil {
+		return errRes
+	}
+	clientMetadata := ctxutils.ClientMetaData(ctx)
+	mt, errRes := auth.RequireValidMytoken(rlog, nil, &req.Mytoken, ctx)
+	if errRes != nil {
+		return errRes
+	}
+	var res *model.Response
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			target := mt.ID
+			if !self {
+				target = req.MOMID.MTID
+				if res = requireMayManageSuspension(rlog, tx, mt, target, clientMetadata); res != nil {
+					return errors.New("rollback")
+				}
+			}
+			usedRestriction, errRes := auth.RequireUsableRestrictionOther(rlog, tx, mt, clientMetadata)
+			if errRes != nil {
+				res = errRes
+				return errors.New("rollback")
+			}
+			if err := setSuspension(rlog, tx, target, req.Recursive, suspend, self, clientMetadata); err != nil {
+				return err
+			}
+			if usedRestriction != nil {
+				if err := usedRestriction.UsedOther(rlog, tx, mt.ID); err != nil {
+					return err
+				}
+			}
+			if self {
+				// A suspended mytoken is not rotated
+				return nil
+			}
+			tokenUpdate, err := rotation.RotateMytokenAfterOtherForResponse(
+				rlog, tx, req.Mytoken.JWT, mt, *clientMetadata, req.Mytoken.OriginalTokenType,
+			)
+			if err != nil {
+				return err
+			}
+			if tokenUpdate != nil {
+				res = &model.Response{
+					Status: fiber.StatusOK,
+					Response: my.OnlyTokenUpdateRes{
+						TokenUpdate: tokenUpdate,
+					},
+					Cookies: []*fiber.Cookie{cookies.MytokenCookie(tokenUpdate.Mytoken)},
+				}
+			}
+			return nil
+		},
+	); err != nil && res == nil {
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if res != nil {
+		return res
+	}
+	return &model.Response{Status: fiber.StatusNoContent}
+}
+
+// checkSelfSuspension checks that a mytoken only suspends itself; a suspended mytoken cannot be used to resume itself
+func checkSelfSuspension(self, suspend bool) *model.Response {
+	if self && !suspend {
+		return model.BadRequestErrorResponse("a suspended mytoken cannot resume itself; 'mom_id' is required")
+	}
+	return nil
+}
+
+// requireMayManageSuspension checks that a mytoken may suspend or resume another mytoken; this is the case if it is
+// a parent of the other mytoken or has the capability to revoke any mytoken of the user
+func requireMayManageSuspension(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken, target mtid.MTID,
+	clientMetadata *api.ClientMetaData,
+) *model.Response {
+	isParent, err := helper.MOMIDHasParent(rlog, tx, target.Hash(), mt.ID)
+	if err != nil {
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if !isParent && !mt.Capabilities.Has(api.CapabilityRevokeAnyToken) {
+		return &model.Response{
+			Status: fiber.StatusForbidden,
+			Response: api.Error{
+				Error: api.ErrorStrInsufficientCapabilities,
+				ErrorDescription: fmt.Sprintf(
+					"The provided token is neither a parent of the token to be suspended or resumed"+
+						" nor does it have the '%s' capability", api.CapabilityRevokeAnyToken.Name,
+				),
+			},
+		}
+	}
+	return auth.RequireMytokensForSameUser(rlog, tx, target, mt.ID)
+}
+
+func setSuspension(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, target mtid.MTID, recursive, suspend, self bool,
+	clientMetadata *api.ClientMetaData,
+) error {
+	setter := helper.ResumeMT
+	event := pkg2.EventResumed
+	if suspend {
+		setter = helper.SuspendMT
+		event = pkg2.EventSuspended
+	}
+	if err := setter(rlog, tx, target, recursive); err != nil {
+		return err
+	}
+	return eventService.LogEvent(
+		rlog, tx, pkg2.MTEvent{
+			Event:          event,
+			MTID:           target,
+			Comment:        suspensionComment(recursive, self),
+			ClientMetaData: *clientMetadata,
+		},
+	)
+}
+
+// suspensionComment returns the comment for the event logged when a mytoken is suspended or resumed
+func suspensionComment(recursive, self bool) string {
+	comment := "by another mytoken"
+	if self {
+		comment = "by itself"
+	}
+	if recursive {
+		comment += " (including subtokens)"
+	}
+	return comment
+}
@@ -0,0 +1,63 @@
+package suspension
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckSelfSuspension(t *testing.T) {
+	tests := []struct {
+		name      string
+		self      bool
+		suspend   bool
+		expStatus int
+	}{
+		{name: "suspend itself", self: true, suspend: true},
+		{name: "resume itself", self: true, suspend: false, expStatus: fiber.StatusBadRequest},
+		{name: "suspend other", self: false, suspend: true},
+		{name: "resume other", self: false, suspend: false},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				res := checkSelfSuspension(test.self, test.suspend)
+				if test.expStatus == 0 {
+					if res != nil {
+						t.Fatalf("unexpected error response: %+v", res.Response)
+					}
+					return
+				}
+				if res == nil {
+					t.Fatal("expected an error response")
+				}
+				if res.Status != test.expStatus {
+					t.Errorf("expected status %d, got %d", test.expStatus, res.Status)
+				}
+			},
+		)
+	}
+}
+
+func TestSuspensionComment(t *testing.T) {
+	tests := []struct {
+		name      string
+		recursive bool
+		self      bool
+		expected  string
+	}{
+		{name: "other", expected: "by another mytoken"},
+		{name: "self", self: true, expected: "by itself"},
+		{name: "other recursive", recursive: true, expected: "by another mytoken (including subtokens)"},
+		{name: "self recursive", recursive: true, self: true, expected: "by itself (including subtokens)"},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := suspensionComment(test.recursive, test.self); got != test.expected {
+					t.Errorf("expected '%s', got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
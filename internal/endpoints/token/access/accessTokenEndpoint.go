@@ -2,6 +2,7 @@ package access
 
 import (
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
@@ -10,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/accesstokenrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/cryptstore"
@@ -22,6 +24,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/internal/mytoken/rotation"
 	"github.com/oidc-mytoken/server/internal/oidc/oidcreqres"
+	provider2 "github.com/oidc-mytoken/server/internal/oidc/provider"
 	"github.com/oidc-mytoken/server/internal/oidc/refresh"
 	"github.com/oidc-mytoken/server/internal/utils"
 	"github.com/oidc-mytoken/server/internal/utils/auth"
@@ -104,6 +107,8 @@ func HandleAccessTokenRefresh(
 	var retAudiences []string
 	if err := db.Transact(
 		rlog, func(tx *sqlx.Tx) error {
+			// The refresh token is locked until the transaction ends, so concurrent requests (also on other nodes)
+			// cannot use a refresh token that is rotated by the OP in the meantime
 			rt, rtFound, dbErr := cryptstore.GetRefreshToken(rlog, tx, mt.ID, req.Mytoken.JWT)
 			if dbErr != nil {
 				return dbErr
@@ -115,46 +120,74 @@ func HandleAccessTokenRefresh(
 				}
 				return errors.New("rollback")
 			}
+			// Use the client that obtained the refresh token
+			if provider, dbErr = provider2.ForMytoken(rlog, tx, provider, mt.ID); dbErr != nil {
+				return dbErr
+			}
 
 			scopes, auds := parseScopesAndAudienceToUse(
 				req.Scope, strings.Split(req.Audience, " "), usedRestriction, provider.Scopes(),
 			)
-			opRes, oidcErrRes, err := refresh.DoFlowAndUpdateDB(
-				rlog, tx, provider, mt.ID, req.Mytoken.JWT, rt, scopes, auds,
-			)
-			if err != nil {
-				return err
-			}
-			if oidcErrRes != nil {
-				errRes = &model.Response{
-					Status:   oidcErrRes.Status,
-					Response: model.OIDCError(oidcErrRes.Error, oidcErrRes.ErrorDescription),
+			var cacheKey string
+			eventComment := "Used grant_type mytoken"
+			if atCacheConf := config.Get().Features.AccessTokenCache; atCacheConf.Enabled {
+				cacheKey = accesstokenrepo.CacheKey(utils.SplitIgnoreEmpty(scopes, " "), auds)
+				cached, err := accesstokenrepo.GetCached(rlog, tx, mt, cacheKey, atCacheConf.MinRemainingLifetime)
+				if err != nil {
+					return err
+				}
+				if cached != nil {
+					oidcRes = &oidcreqres.OIDCTokenResponse{
+						AccessToken: cached.Token,
+						TokenType:   "Bearer",
+						ExpiresIn:   int64(time.Until(cached.ExpiresAt).Seconds()),
+						Scopes:      strings.Join(cached.Scopes, " "),
+					}
+					retScopes = oidcRes.Scopes
+					retAudiences = cached.Audiences
+					eventComment = "Used grant_type mytoken; returned cached access token"
 				}
-				return errors.New("rollback")
-			}
-			oidcRes = opRes
-
-			retScopes = oidcRes.Scopes
-			if retScopes == "" {
-				retScopes = scopes
-			}
-			retAudiences, _ = jwtutils.GetAudiencesFromJWT(rlog, oidcRes.AccessToken)
-			at := accesstokenrepo.AccessToken{
-				Token:     oidcRes.AccessToken,
-				IP:        networkData.IP,
-				Comment:   req.Comment,
-				Mytoken:   mt,
-				Scopes:    utils.SplitIgnoreEmpty(retScopes, " "),
-				Audiences: retAudiences,
 			}
+			if oidcRes == nil {
+				opRes, oidcErrRes, err := refresh.DoFlowAndUpdateDB(
+					rlog, tx, provider, mt.ID, req.Mytoken.JWT, rt, scopes, auds,
+				)
+				if err != nil {
+					return err
+				}
+				if oidcErrRes != nil {
+					errRes = &model.Response{
+						Status:   oidcErrRes.Status,
+						Response: model.OIDCError(oidcErrRes.Error, oidcErrRes.ErrorDescription),
+					}
+					return errors.New("rollback")
+				}
+				oidcRes = opRes
 
-			if err = at.Store(rlog, tx); err != nil {
-				return err
+				retScopes = oidcRes.Scopes
+				if retScopes == "" {
+					retScopes = scopes
+				}
+				retAudiences, _ = jwtutils.GetAudiencesFromJWT(rlog, oidcRes.AccessToken)
+				at := accesstokenrepo.AccessToken{
+					Token:     oidcRes.AccessToken,
+					IP:        networkData.IP,
+					Comment:   req.Comment,
+					Mytoken:   mt,
+					Scopes:    utils.SplitIgnoreEmpty(retScopes, " "),
+					Audiences: retAudiences,
+					ExpiresIn: oidcRes.ExpiresIn,
+					CacheKey:  cacheKey,
+				}
+				if err = at.Store(rlog, tx); err != nil {
+					return err
+				}
 			}
+			var err error
 			if err = eventService.LogEvent(
 				rlog, tx, pkg.MTEvent{
 					Event:          api.EventATCreated,
-					Comment:        "Used grant_type mytoken",
+					Comment:        eventComment,
 					MTID:           mt.ID,
 					ClientMetaData: networkData,
 				},
@@ -47,18 +47,40 @@ func (r AuthCodeFlowRequest) MarshalJSON() ([]byte, error) {
 	return jsonpatch.MergePatch(base, attrs)
 }
 
+// storedProfiles holds the names of the profiles used for a request; they are only persisted in the database and
+// never read from a client's request
+type storedProfiles struct {
+	Profiles []string `json:"profiles,omitempty"`
+}
+
 // Scan implements the sql.Scanner interface
 func (r *AuthCodeFlowRequest) Scan(src interface{}) error {
 	v, ok := src.([]byte)
 	if !ok {
 		return errors.New("bad []byte type assertion")
 	}
-	return errors.WithStack(json.Unmarshal(v, r))
+	if err := json.Unmarshal(v, r); err != nil {
+		return errors.WithStack(err)
+	}
+	var profiles storedProfiles
+	if err := json.Unmarshal(v, &profiles); err != nil {
+		return errors.WithStack(err)
+	}
+	r.Profiles = profiles.Profiles
+	return nil
 }
 
 // Value implements the driver.Valuer interface
 func (r AuthCodeFlowRequest) Value() (driver.Value, error) { // skipcq: CRT-P0003
 	r.IncludedProfiles = nil // skipcq: RVV-B0006
 	v, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	profiles, err := json.Marshal(storedProfiles{Profiles: r.Profiles})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	v, err = jsonpatch.MergePatch(v, profiles)
 	return v, errors.WithStack(err)
 }
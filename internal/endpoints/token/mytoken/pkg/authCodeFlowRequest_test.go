@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAuthCodeFlowRequest_ClientProfilesIgnored(t *testing.T) {
+	var req AuthCodeFlowRequest
+	if err := json.Unmarshal(
+		[]byte(`{"issuer":"https://op.example.com","profiles":["privileged"]}`), &req,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Profiles) != 0 {
+		t.Errorf("expected the profiles sent by the client to be ignored, but got %v", req.Profiles)
+	}
+}
+
+func TestAuthCodeFlowRequest_ValueScan(t *testing.T) {
+	var req AuthCodeFlowRequest
+	if err := json.Unmarshal([]byte(`{"issuer":"https://op.example.com"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	req.Profiles = []string{"web", "group/ci"}
+	v, err := req.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored AuthCodeFlowRequest
+	if err = stored.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Profiles, req.Profiles) {
+		t.Errorf("expected profiles %v, but got %v", req.Profiles, stored.Profiles)
+	}
+	if stored.Issuer != req.Issuer {
+		t.Errorf("expected issuer '%s', but got '%s'", req.Issuer, stored.Issuer)
+	}
+}
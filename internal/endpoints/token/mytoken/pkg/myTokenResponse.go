@@ -13,6 +13,7 @@ type MytokenResponse struct {
 	MytokenType         model.ResponseType        `json:"mytoken_type"`
 	Restrictions        restrictions.Restrictions `json:"restrictions,omitempty"`
 	TokenUpdate         *MytokenResponse          `json:"token_update,omitempty"`
+	model.SubtokenLimits
 }
 
 // OnlyTokenUpdateRes is a response that contains only a TokenUpdate and is used when a rotating mytoken was used but
@@ -34,6 +34,11 @@ func doTokenInfoList(
 			if err != nil && !errors.Is(err, sql.ErrNoRows) {
 				return err
 			}
+			if req.Details {
+				if err = tree.AddDetails(rlog, tx, mt.ID, tokenList); err != nil {
+					return err
+				}
+			}
 			if usedRestriction == nil {
 				return nil
 			}
@@ -70,6 +75,13 @@ func HandleTokenInfoList(
 	if errRes != nil {
 		return errRes
 	}
+	if req.Details {
+		// The details reveal the capabilities and restrictions of all mytokens, i.e. the information of a tokeninfo
+		// introspection for each of them
+		if errRes = auth.RequireCapability(rlog, tx, api.CapabilityTokeninfo, mt, clientMetadata); errRes != nil {
+			return errRes
+		}
+	}
 	tokenList, tokenUpdate, err := doTokenInfoList(rlog, tx, req, mt, clientMetadata, usedRestriction)
 	if err != nil {
 		rlog.Errorf("%s", errorfmt.Full(err))
@@ -57,6 +57,10 @@ func doTokenInfoNotifications(
 				if err != nil {
 					return err
 				}
+				res.Deliveries, err = notificationsrepo.GetDeliveriesForMT(rlog, tx, id)
+				if err != nil {
+					return err
+				}
 			}
 			if usedRestriction == nil {
 				return nil
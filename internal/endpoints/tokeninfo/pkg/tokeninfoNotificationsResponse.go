@@ -3,6 +3,7 @@ package pkg
 import (
 	"github.com/oidc-mytoken/api/v0"
 
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
 	my "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 )
 
@@ -11,4 +12,7 @@ type TokeninfoNotificationsResponse struct {
 	// on update check api.TokeninfoNotificationsResponse
 	api.TokeninfoNotificationsResponse
 	TokenUpdate *my.MytokenResponse `json:"token_update,omitempty"`
+	// Deliveries holds the delivery status of the notifications sent for the token; only set if the notifications
+	// for a single token were requested
+	Deliveries []notificationsrepo.Delivery `json:"deliveries,omitempty"`
 }
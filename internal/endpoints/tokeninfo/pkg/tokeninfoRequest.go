@@ -12,4 +12,6 @@ type TokenInfoRequest struct {
 	api.TokenInfoRequest
 	Action  model.TokeninfoAction             `json:"action"`
 	Mytoken universalmytoken.UniversalMytoken `json:"mytoken"`
+	// Details indicates that the entries of a list_mytokens response should include the tree.MytokenDetails
+	Details bool `json:"details,omitempty"`
 }
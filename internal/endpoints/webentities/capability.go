@@ -6,6 +6,8 @@ import (
 	"github.com/jinzhu/copier"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/utils"
+
+	"github.com/oidc-mytoken/server/internal/model"
 )
 
 // WebCapability is type for representing api.Capability in the consent screen
@@ -44,7 +46,7 @@ func init() {
 	}
 	capabilitiesByLevel := make(map[int][]webCapability)
 	var maxLevel int
-	for _, c := range api.AllCapabilities {
+	for _, c := range model.AllCapabilities() {
 		level := strings.Count(c.Name, ":")
 		cs, ok := capabilitiesByLevel[level]
 		if !ok {
@@ -139,6 +141,8 @@ var warningCapabilities = []string{
 	api.CapabilityListMT.Name,
 	api.CapabilitySettingsRead.Name,
 	api.CapabilitySSHGrant.Name,
+	model.CapabilitySSHCertificate.Name,
+	model.CapabilityRenewal.Name,
 	api.CapabilityRevokeAnyToken.Name,
 	api.CapabilityHistoryAnyToken.Name,
 	api.CapabilityManageMTs.Name,
@@ -173,6 +177,26 @@ func (c webCapability) getDangerLevel() int {
 	return c.getIntClass()
 }
 
+// HasHighDangerCapability checks if one of the passed capabilities has the highest danger level
+func HasHighDangerCapability(capabilities api.Capabilities) bool {
+	for _, c := range capabilities {
+		if (webCapability{Capability: c}).getDangerLevel() == intClassDanger {
+			return true
+		}
+	}
+	return false
+}
+
+// HighDangerCapabilities returns the names of all capabilities with the highest danger level
+func HighDangerCapabilities() (names []string) {
+	for _, c := range model.AllCapabilities() {
+		if (webCapability{Capability: c}).getDangerLevel() == intClassDanger {
+			names = append(names, c.Name)
+		}
+	}
+	return
+}
+
 // ColorClass returns the html class for coloring this Capability
 // skipcq: CRT-P0003
 func (c webCapability) ColorClass() string {
@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/jobrepo"
+	"github.com/oidc-mytoken/server/internal/utils/backoff"
+)
+
+// Handler executes a job; payload is the json encoded payload the job was enqueued with
+type Handler func(rlog log.Ext1FieldLogger, payload []byte) error
+
+type jobType struct {
+	handler Handler
+	// interval is the interval in which a recurring job is run; it is 0 for non-recurring jobs
+	interval time.Duration
+}
+
+// JobTypeDBCleanup is the job type for the db cleanup
+const JobTypeDBCleanup = "db_cleanup"
+
+// leadershipName is the name of the leadership for scheduling recurring jobs
+const leadershipName = "scheduler"
+
+// maxRetryInterval is the maximum time in seconds after which a failed job is retried
+const maxRetryInterval = 60 * 60
+
+var (
+	types     = make(map[string]jobType)
+	typesLock sync.RWMutex
+	nodeID    string
+	leader    atomic.Bool
+	startOnce sync.Once
+)
+
+// Register registers a Handler for a job type
+func Register(t string, h Handler) {
+	register(t, jobType{handler: h})
+}
+
+// RegisterRecurring registers a Handler for a job type that is run every interval; only the current leader schedules
+// recurring jobs, but they can be executed by any instance
+func RegisterRecurring(t string, interval time.Duration, h Handler) {
+	register(
+		t, jobType{
+			handler:  h,
+			interval: interval,
+		},
+	)
+}
+
+func register(t string, jt jobType) {
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	types[t] = jt
+}
+
+func getType(t string) (jt jobType, ok bool) {
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	jt, ok = types[t]
+	return
+}
+
+// Enqueue enqueues a job of the passed type; the job is run at runAt or as soon as possible if runAt is the zero time
+func Enqueue(rlog log.Ext1FieldLogger, tx *sqlx.Tx, t string, payload any, runAt time.Time) error {
+	return jobrepo.Enqueue(rlog, tx, t, payload, runAt)
+}
+
+// IsLeader returns true if this instance currently is the leader that schedules recurring jobs
+func IsLeader() bool {
+	return leader.Load()
+}
+
+// NodeID returns the id of this instance used for leader election
+func NodeID() string {
+	return nodeID
+}
+
+// Start starts the leader election and the worker that executes due jobs
+func Start() {
+	startOnce.Do(
+		func() {
+			if config.Get().DB.EnableScheduledCleanup {
+				RegisterRecurring(
+					JobTypeDBCleanup, 24*time.Hour, func(rlog log.Ext1FieldLogger, _ []byte) error {
+						return db.Cleanup(rlog)
+					},
+				)
+			}
+			hostname, _ := os.Hostname()
+			nodeID = fmt.Sprintf("%s-%s", hostname, utils.RandASCIIString(16))
+			conf := config.Get().Server.Jobs
+			go loop(time.Duration(conf.LeaderLease)*time.Second/3, electAndSchedule)
+			go loop(time.Duration(conf.PollInterval)*time.Second, runDueJobs)
+		},
+	)
+}
+
+func loop(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	for {
+		fn()
+		<-ticker.C
+	}
+}
+
+func electAndSchedule() {
+	logger := log.StandardLogger()
+	isLeader, err := jobrepo.AcquireLeadership(
+		logger, nil, leadershipName, nodeID, config.Get().Server.Jobs.LeaderLease,
+	)
+	if err != nil {
+		logger.WithError(err).Error("error acquiring job runner leadership")
+		isLeader = false
+	}
+	if wasLeader := leader.Swap(isLeader); wasLeader != isLeader {
+		logger.WithField("leader", isLeader).Info("Job runner leadership changed")
+	}
+	if !isLeader {
+		return
+	}
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	for t, jt := range types {
+		if jt.interval == 0 {
+			continue
+		}
+		if err = jobrepo.ScheduleRecurring(logger, nil, t, int64(jt.interval/time.Second)); err != nil {
+			logger.WithError(err).WithField("job_type", t).Error("error scheduling recurring job")
+		}
+	}
+}
+
+func runDueJobs() {
+	logger := log.StandardLogger()
+	conf := config.Get().Server.Jobs
+	for {
+		claim := utils.RandASCIIString(64)
+		jobs, err := jobrepo.Claim(logger, nil, claim, conf.BatchSize, conf.VisibilityTimeout)
+		if err != nil {
+			logger.WithError(err).Error("error claiming jobs")
+			return
+		}
+		for _, j := range jobs {
+			runJob(logger, claim, j)
+		}
+		if len(jobs) < conf.BatchSize {
+			return
+		}
+	}
+}
+
+func runJob(logger log.Ext1FieldLogger, claim string, j jobrepo.ClaimedJob) {
+	logger = logger.WithField("job", j.ID).WithField("job_type", j.Type)
+	logger.Debug("Running job")
+	jt, ok := getType(j.Type)
+	var jobErr error
+	if ok {
+		jobErr = execute(logger, jt.handler, []byte(j.Payload))
+	} else {
+		// The job might be known to another instance, e.g. during an update
+		jobErr = errors.New("unknown job type")
+	}
+	if jobErr == nil {
+		if err := jobrepo.MarkDone(logger, nil, j.ID, claim); err != nil {
+			logger.WithError(err).Error("error updating job")
+		}
+		return
+	}
+	logger.WithError(jobErr).Warn("error running job")
+	retryIn := retryInterval(j.Attempts, ok && jt.interval > 0)
+	if retryIn == nil {
+		logger.Error("giving up running job")
+	}
+	if err := jobrepo.MarkFailed(logger, nil, j.ID, claim, errors.Cause(jobErr).Error(), retryIn); err != nil {
+		logger.WithError(err).Error("error updating job")
+	}
+}
+
+// execute runs the handler and turns a panic into an error, so a failing job does not bring down the instance
+func execute(logger log.Ext1FieldLogger, h Handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h(logger, payload)
+}
+
+// retryInterval returns the time in seconds after which a job that failed attempts times is retried; the interval is
+// doubled with each attempt. Recurring jobs are not retried, since they run again anyway; also if the maximum number
+// of attempts is reached, nil is returned.
+func retryInterval(attempts int, recurring bool) *int64 {
+	if recurring {
+		return nil
+	}
+	conf := config.Get().Server.Jobs
+	return backoff.RetryInterval(attempts, conf.MaxAttempts, conf.PollInterval, maxRetryInterval)
+}
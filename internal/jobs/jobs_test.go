@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestRetryInterval(t *testing.T) {
+	conf := &config.Get().Server.Jobs
+	original := *conf
+	t.Cleanup(func() { *conf = original })
+	conf.MaxAttempts = 5
+	conf.PollInterval = 5
+	tests := []struct {
+		attempts  int
+		recurring bool
+		expected  *int64
+	}{
+		{attempts: 1, expected: int64Ptr(5)},
+		{attempts: 2, expected: int64Ptr(10)},
+		{attempts: 4, expected: int64Ptr(40)},
+		{attempts: 5, expected: nil},
+		{attempts: 1, recurring: true, expected: nil},
+	}
+	for _, test := range tests {
+		got := retryInterval(test.attempts, test.recurring)
+		if (got == nil) != (test.expected == nil) || (got != nil && *got != *test.expected) {
+			t.Errorf(
+				"For %d attempts (recurring: %v) expected %v, but got %v", test.attempts, test.recurring,
+				test.expected, got,
+			)
+		}
+	}
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
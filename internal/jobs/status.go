@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/jobrepo"
+)
+
+// recentJobs is the number of most recent jobs included in the Status
+const recentJobs = 50
+
+// Status holds information about the state of the job runner
+type Status struct {
+	Node      string                   `json:"node"`
+	IsLeader  bool                     `json:"is_leader"`
+	Leader    *jobrepo.Leader          `json:"leader,omitempty"`
+	Types     []jobrepo.TypeStatistics `json:"types"`
+	Recurring []jobrepo.RecurringJob   `json:"recurring"`
+	Recent    []jobrepo.Job            `json:"recent"`
+}
+
+// GetStatus returns the Status of the job runner
+func GetStatus(rlog log.Ext1FieldLogger) (*Status, error) {
+	status := &Status{
+		Node:     NodeID(),
+		IsLeader: IsLeader(),
+	}
+	if err := db.Transact(
+		rlog, func(tx *sqlx.Tx) (err error) {
+			if status.Leader, err = jobrepo.GetLeader(rlog, tx, leadershipName); err != nil {
+				return
+			}
+			if status.Types, err = jobrepo.GetStatistics(rlog, tx); err != nil {
+				return
+			}
+			if status.Recurring, err = jobrepo.GetRecurring(rlog, tx); err != nil {
+				return
+			}
+			status.Recent, err = jobrepo.GetRecent(rlog, tx, recentJobs)
+			return
+		},
+	); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -70,3 +70,36 @@ func ErrorWithErrorDescription(e string, err error) api.Error {
 		ErrorDescription: errorfmt.Error(err),
 	}
 }
+
+// ErrorStrQuotaExceeded is the error string returned if a configured quota is exceeded
+const ErrorStrQuotaExceeded = "quota_exceeded"
+
+// QuotaExceededError creates an Error for exceeded quotas
+func QuotaExceededError(errorDescription string) api.Error {
+	return api.Error{
+		Error:            ErrorStrQuotaExceeded,
+		ErrorDescription: errorDescription,
+	}
+}
+
+// ErrorStrTokenSuspended is the error string returned if a suspended mytoken is used
+const ErrorStrTokenSuspended = "token_suspended"
+
+// TokenSuspendedError creates an Error for the usage of suspended mytokens
+func TokenSuspendedError(errorDescription string) api.Error {
+	return api.Error{
+		Error:            ErrorStrTokenSuspended,
+		ErrorDescription: errorDescription,
+	}
+}
+
+// ErrorStrStepUpRequired is the error string returned if a request requires a WebAuthn step-up that was not done
+const ErrorStrStepUpRequired = "step_up_required"
+
+// StepUpRequiredError creates an Error for requests that require a WebAuthn step-up
+func StepUpRequiredError(errorDescription string) api.Error {
+	return api.Error{
+		Error:            ErrorStrStepUpRequired,
+		ErrorDescription: errorDescription,
+	}
+}
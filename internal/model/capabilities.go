@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/oidc-mytoken/api/v0"
+)
+
+// Capabilities that are only known to the server
+var (
+	CapabilitySSHCertificate = api.Capability{
+		Name:        "ssh_certificate",
+		Description: "Allows obtaining short-lived SSH user certificates.",
+	}
+	CapabilityRenewal = api.Capability{
+		Name:        "renewal",
+		Description: "Allows requesting the renewal of this mytoken; a renewal must be approved by the owner.",
+	}
+)
+
+// allCapabilities holds the capabilities of the api together with the server specific ones; the list of the api
+// package is copied and not modified
+var allCapabilities = append(
+	append(api.Capabilities{}, api.AllCapabilities...),
+	CapabilitySSHCertificate, CapabilityRenewal,
+)
+
+// AllCapabilities returns all capabilities supported by this server, including the server specific ones
+func AllCapabilities() api.Capabilities {
+	return allCapabilities
+}
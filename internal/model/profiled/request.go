@@ -1,7 +1,10 @@
 package profiled
 
 import (
+	"encoding/json"
+
 	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/db/profilerepo"
@@ -17,6 +20,8 @@ type GeneralMytokenRequest struct {
 	Rotation     *Rotation          `json:"rotation,omitempty"`
 	GrantType    model.GrantType    `json:"grant_type"`
 	ResponseType model.ResponseType `json:"response_type"`
+	Profiles     []string           `json:"-"`
+	model.SubtokenLimits
 }
 
 // NewGeneralMytokenRequest creates a GeneralMytokenRequest with default values
@@ -47,5 +52,15 @@ func (r *GeneralMytokenRequest) UnmarshalJSON(bytes []byte) error {
 	}
 	r.ResponseType = model.NewResponseType(p.ResponseType)
 	r.GrantType = model.NewGrantType(p.GrantType)
-	return nil
+	// The profile parser drops the names of included profiles, but they are needed to select the client used
+	// with the provider; only the included profiles are used, since the parser already resolved them, i.e. they are
+	// known to the server
+	var profileNames struct {
+		Include api.IncludedProfiles `json:"include"`
+	}
+	if err = json.Unmarshal(bytes, &profileNames); err != nil {
+		return errors.WithStack(err)
+	}
+	r.Profiles = profileNames.Include
+	return errors.WithStack(json.Unmarshal(bytes, &r.SubtokenLimits))
 }
@@ -0,0 +1,57 @@
+package sshkey
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/oidc-mytoken/utils/unixtime"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+// Restrictions restricts the usage of a single ssh key independent of the restrictions of the mytoken linked to it
+type Restrictions struct {
+	AllowedIPs      []string          `json:"allowed_ips,omitempty"`
+	AllowedRequests []string          `json:"allowed_requests,omitempty"`
+	ExpiresAt       unixtime.UnixTime `json:"expires_at,omitempty"`
+}
+
+// Empty checks if no restrictions are set
+func (r Restrictions) Empty() bool {
+	return len(r.AllowedIPs) == 0 && len(r.AllowedRequests) == 0 && r.ExpiresAt == 0
+}
+
+// Expired checks if the ssh key is expired
+func (r Restrictions) Expired() bool {
+	return r.ExpiresAt != 0 && r.ExpiresAt <= unixtime.Now()
+}
+
+// IPAllowed checks if the ssh key can be used from the passed ip
+func (r Restrictions) IPAllowed(ip string) bool {
+	return len(r.AllowedIPs) == 0 || iputils.IPIsIn(ip, r.AllowedIPs)
+}
+
+// RequestAllowed checks if the ssh key can be used for the passed ssh request type
+func (r Restrictions) RequestAllowed(requestType string) bool {
+	return len(r.AllowedRequests) == 0 || utils.StringInSlice(requestType, r.AllowedRequests)
+}
+
+// Scan implements the sql.Scanner interface.
+func (r *Restrictions) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	val := src.([]uint8)
+	return errors.WithStack(json.Unmarshal(val, r))
+}
+
+// Value implements the driver.Valuer interface
+func (r Restrictions) Value() (driver.Value, error) {
+	if r.Empty() {
+		return nil, nil
+	}
+	v, err := json.Marshal(r)
+	return v, errors.WithStack(err)
+}
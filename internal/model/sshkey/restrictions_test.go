@@ -0,0 +1,79 @@
+package sshkey
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/utils/unixtime"
+
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+)
+
+func TestRestrictions(t *testing.T) {
+	cache.InitCache()
+	tests := []struct {
+		name        string
+		r           Restrictions
+		ip          string
+		requestType string
+		usable      bool
+	}{
+		{
+			name:        "Empty",
+			ip:          "192.168.0.1",
+			requestType: "AT",
+			usable:      true,
+		},
+		{
+			name:        "IP in subnet",
+			r:           Restrictions{AllowedIPs: []string{"10.0.0.0/8"}},
+			ip:          "10.1.2.3",
+			requestType: "AT",
+			usable:      true,
+		},
+		{
+			name:        "IP not allowed",
+			r:           Restrictions{AllowedIPs: []string{"10.0.0.0/8", "192.168.0.2"}},
+			ip:          "192.168.0.1",
+			requestType: "AT",
+			usable:      false,
+		},
+		{
+			name:        "Request allowed",
+			r:           Restrictions{AllowedRequests: []string{"AT", "introspect"}},
+			ip:          "192.168.0.1",
+			requestType: "introspect",
+			usable:      true,
+		},
+		{
+			name:        "Request not allowed",
+			r:           Restrictions{AllowedRequests: []string{"AT"}},
+			ip:          "192.168.0.1",
+			requestType: "MT",
+			usable:      false,
+		},
+		{
+			name:        "Not expired",
+			r:           Restrictions{ExpiresAt: unixtime.InSeconds(60)},
+			ip:          "192.168.0.1",
+			requestType: "AT",
+			usable:      true,
+		},
+		{
+			name:        "Expired",
+			r:           Restrictions{ExpiresAt: unixtime.InSeconds(-60)},
+			ip:          "192.168.0.1",
+			requestType: "AT",
+			usable:      false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				usable := !test.r.Expired() && test.r.IPAllowed(test.ip) && test.r.RequestAllowed(test.requestType)
+				if usable != test.usable {
+					t.Errorf("Expected usable to be %v, but got %v", test.usable, usable)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+// SubtokenLimits holds limits on the subtokens that can be created from a mytoken; a nil value means unlimited
+type SubtokenLimits struct {
+	// MaxSubtokenDepth is the maximum number of subtoken levels below a mytoken
+	MaxSubtokenDepth *uint64 `json:"max_subtoken_depth,omitempty"`
+	// MaxDirectChildren is the maximum number of direct subtokens of a mytoken
+	MaxDirectChildren *uint64 `json:"max_direct_children,omitempty"`
+}
+
+// Unlimited checks if these SubtokenLimits do not limit subtokens at all
+func (l SubtokenLimits) Unlimited() bool {
+	return l.MaxSubtokenDepth == nil && l.MaxDirectChildren == nil
+}
+
+// AllowsSubtokens checks if these SubtokenLimits allow the creation of any subtoken
+func (l SubtokenLimits) AllowsSubtokens() bool {
+	return l.MaxSubtokenDepth == nil || *l.MaxSubtokenDepth > 0
+}
+
+// AllowsMoreChildren checks if these SubtokenLimits allow the creation of another direct subtoken if there are
+// already the passed number of direct subtokens
+func (l SubtokenLimits) AllowsMoreChildren(children uint64) bool {
+	return l.MaxDirectChildren == nil || children < *l.MaxDirectChildren
+}
+
+// Tighten returns the SubtokenLimits for a subtoken of a mytoken with these SubtokenLimits; the requested limits are
+// tightened, so a subtoken never has less restrictive limits than its parent. The returned bool indicates if the
+// requested limits were already at least as tight as needed.
+func (l SubtokenLimits) Tighten(requested SubtokenLimits) (SubtokenLimits, bool) {
+	var parentDepth *uint64
+	if l.MaxSubtokenDepth != nil {
+		d := uint64(0)
+		if *l.MaxSubtokenDepth > 0 {
+			d = *l.MaxSubtokenDepth - 1
+		}
+		parentDepth = &d
+	}
+	depth, depthOK := tightenLimit(parentDepth, requested.MaxSubtokenDepth)
+	children, childrenOK := tightenLimit(l.MaxDirectChildren, requested.MaxDirectChildren)
+	return SubtokenLimits{
+		MaxSubtokenDepth:  depth,
+		MaxDirectChildren: children,
+	}, depthOK && childrenOK
+}
+
+func tightenLimit(parent, requested *uint64) (*uint64, bool) {
+	if parent == nil {
+		return requested, true
+	}
+	if requested == nil || *requested > *parent {
+		p := *parent
+		return &p, requested == nil
+	}
+	return requested, true
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"strconv"
+	"testing"
+)
+
+func uint64Ptr(i uint64) *uint64 {
+	return &i
+}
+
+func limitStr(l *uint64) string {
+	if l == nil {
+		return "unlimited"
+	}
+	return strconv.FormatUint(*l, 10)
+}
+
+func checkLimit(t *testing.T, name string, a, exp *uint64) {
+	if (a == nil) != (exp == nil) || (a != nil && *a != *exp) {
+		t.Errorf("Expected %s to be '%s', but got '%s'", name, limitStr(exp), limitStr(a))
+	}
+}
+
+func TestSubtokenLimits_Tighten(t *testing.T) {
+	tests := []struct {
+		name      string
+		parent    SubtokenLimits
+		requested SubtokenLimits
+		expected  SubtokenLimits
+		ok        bool
+	}{
+		{
+			name:     "Unlimited",
+			expected: SubtokenLimits{},
+			ok:       true,
+		},
+		{
+			name:      "Unlimited parent",
+			requested: SubtokenLimits{MaxSubtokenDepth: uint64Ptr(2), MaxDirectChildren: uint64Ptr(3)},
+			expected:  SubtokenLimits{MaxSubtokenDepth: uint64Ptr(2), MaxDirectChildren: uint64Ptr(3)},
+			ok:        true,
+		},
+		{
+			name:     "Inherit",
+			parent:   SubtokenLimits{MaxSubtokenDepth: uint64Ptr(2), MaxDirectChildren: uint64Ptr(3)},
+			expected: SubtokenLimits{MaxSubtokenDepth: uint64Ptr(1), MaxDirectChildren: uint64Ptr(3)},
+			ok:       true,
+		},
+		{
+			name:      "Tighter",
+			parent:    SubtokenLimits{MaxSubtokenDepth: uint64Ptr(3), MaxDirectChildren: uint64Ptr(3)},
+			requested: SubtokenLimits{MaxSubtokenDepth: uint64Ptr(1), MaxDirectChildren: uint64Ptr(1)},
+			expected:  SubtokenLimits{MaxSubtokenDepth: uint64Ptr(1), MaxDirectChildren: uint64Ptr(1)},
+			ok:        true,
+		},
+		{
+			name:      "Not tighter",
+			parent:    SubtokenLimits{MaxSubtokenDepth: uint64Ptr(1), MaxDirectChildren: uint64Ptr(2)},
+			requested: SubtokenLimits{MaxSubtokenDepth: uint64Ptr(1), MaxDirectChildren: uint64Ptr(5)},
+			expected:  SubtokenLimits{MaxSubtokenDepth: uint64Ptr(0), MaxDirectChildren: uint64Ptr(2)},
+			ok:        false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				tightened, ok := test.parent.Tighten(test.requested)
+				if ok != test.ok {
+					t.Errorf("Expected ok to be '%v', but got '%v'", test.ok, ok)
+				}
+				checkLimit(t, "max_subtoken_depth", tightened.MaxSubtokenDepth, test.expected.MaxSubtokenDepth)
+				checkLimit(t, "max_direct_children", tightened.MaxDirectChildren, test.expected.MaxDirectChildren)
+			},
+		)
+	}
+}
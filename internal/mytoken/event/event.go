@@ -15,6 +15,7 @@ func LogEvent(rlog log.Ext1FieldLogger, tx *sqlx.Tx, event pkg.MTEvent) error {
 		Event:          event.Event,
 		Comment:        event.Comment,
 		MTID:           event.MTID,
+		AuthContext:    event.AuthContext,
 		ClientMetaData: event.ClientMetaData,
 	}).Store(rlog, tx); err != nil {
 		return err
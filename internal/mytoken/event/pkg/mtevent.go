@@ -8,8 +8,28 @@ import (
 
 // MTEvent is type for mytoken events
 type MTEvent struct {
-	Event   api.Event
-	Comment string
-	MTID    mtid.MTID
+	Event       api.Event
+	Comment     string
+	MTID        mtid.MTID
+	AuthContext string
 	api.ClientMetaData
 }
+
+// AuthContextWebAuthn is the auth context value of events that were authorized with a WebAuthn step-up
+const AuthContextWebAuthn = "webauthn"
+
+// Events that are only known to the server
+var (
+	EventSuspended            = api.NewEvent("suspended")
+	EventResumed              = api.NewEvent("resumed")
+	EventSSHCertificateIssued = api.NewEvent("ssh_certificate_issued")
+	EventLanguageChanged      = api.NewEvent("language_changed")
+	EventRenewalRequested     = api.NewEvent("renewal_requested")
+	EventRenewalApproved      = api.NewEvent("renewal_approved")
+	EventRenewalCancelled     = api.NewEvent("renewal_cancelled")
+	EventRenewed              = api.NewEvent("renewed")
+	EventPasskeysListed       = api.NewEvent("passkeys_listed")
+	EventPasskeyAdded         = api.NewEvent("passkey_added")
+	EventPasskeyRemoved       = api.NewEvent("passkey_removed")
+	EventStepUp               = api.NewEvent("step_up")
+)
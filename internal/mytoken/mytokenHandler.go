@@ -103,8 +103,9 @@ func HandleMytokenFromTransferCode(ctx *fiber.Ctx) *model.Response {
 				Capabilities: mt.Capabilities,
 				MOMID:        mt.ID.Hash(),
 			},
-			MytokenType:  token.OriginalTokenType,
-			Restrictions: mt.Restrictions,
+			MytokenType:    token.OriginalTokenType,
+			Restrictions:   mt.Restrictions,
+			SubtokenLimits: mt.SubtokenLimits,
 		},
 	}
 
@@ -163,8 +164,29 @@ func HandleMytokenFromMytokenReq(
 		return errorResponse
 	}
 	var tokenUpdate *response.MytokenResponse
+	var errRes *model.Response
 	if err := db.Transact(
 		rlog, func(tx *sqlx.Tx) (err error) {
+			if parent.MaxDirectChildren != nil {
+				var children uint64
+				children, err = dbhelper.CountChildren(rlog, tx, parent.ID)
+				if err != nil {
+					return
+				}
+				if !parent.AllowsMoreChildren(children) {
+					errRes = &model.Response{
+						Status: fiber.StatusForbidden,
+						Response: api.Error{
+							Error: api.ErrorStrUsageRestricted,
+							ErrorDescription: fmt.Sprintf(
+								"the mytoken already has the maximum number of %d direct subtokens",
+								*parent.MaxDirectChildren,
+							),
+						},
+					}
+					return errors.New(errResPlaceholder)
+				}
+			}
 			if usedRestriction != nil {
 				if err = usedRestriction.UsedOther(rlog, tx, parent.ID); err != nil {
 					return
@@ -207,6 +229,12 @@ func HandleMytokenFromMytokenReq(
 			)
 		},
 	); err != nil {
+		if errRes != nil {
+			return errRes
+		}
+		if errRes, ok := mytokenrepo.QuotaExceededErrorResponse(err); ok {
+			return errRes
+		}
 		rlog.Errorf("%s", errorfmt.Full(err))
 		return model.ErrorToInternalServerErrorResponse(err)
 	}
@@ -257,6 +285,19 @@ func createMytokenEntry(
 	if len(c) == 0 {
 		return nil, model.BadRequestErrorResponse("mytoken to be issued cannot have any of the requested capabilities")
 	}
+	if !parent.AllowsSubtokens() {
+		return nil, &model.Response{
+			Status: fiber.StatusForbidden,
+			Response: api.Error{
+				Error:            api.ErrorStrUsageRestricted,
+				ErrorDescription: "the mytoken's max_subtoken_depth does not allow the creation of further subtokens",
+			},
+		}
+	}
+	limits, ok := parent.SubtokenLimits.Tighten(req.SubtokenLimits)
+	if !ok && req.FailOnRestrictionsNotTighter {
+		return nil, model.BadRequestErrorResponse("requested subtoken limits are not tighter than the original limits")
+	}
 	var rot *api.Rotation
 	if req.Rotation != nil {
 		rot = &req.Rotation.Rotation
@@ -268,6 +309,7 @@ func createMytokenEntry(
 	if err != nil {
 		return nil, model.ErrorToInternalServerErrorResponse(err)
 	}
+	mt.SubtokenLimits = limits
 	mte := mytokenrepo.NewMytokenEntry(mt, req.GeneralMytokenRequest.Name, networkData)
 	encryptionKey, _, err := encryptionkeyrepo.GetEncryptionKey(rlog, nil, parent.ID, req.Mytoken.JWT)
 	if err != nil {
@@ -315,7 +357,11 @@ func RevokeMytoken(
 			if count > 0 {
 				return nil
 			}
-			revoke.RefreshToken(rlog, p, rt)
+			rtProvider, err := provider2.ForRefreshToken(rlog, tx, p, rtID)
+			if err != nil {
+				return err
+			}
+			revoke.RefreshToken(rlog, rtProvider, rt)
 			return cryptstore.DeleteCrypted(rlog, tx, rtID)
 		},
 	)
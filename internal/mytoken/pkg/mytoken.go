@@ -38,7 +38,8 @@ type Mytoken struct {
 	ID           mtid.MTID                 `json:"jti"`
 	Restrictions restrictions.Restrictions `json:"restrictions,omitempty"`
 	Rotation     *api.Rotation             `json:"rotation,omitempty"`
-	jwt          string
+	model.SubtokenLimits
+	jwt string
 }
 
 // ToUniversalMytoken returns a universalmytoken.UniversalMytoken for this Mytoken
@@ -206,7 +207,8 @@ func (mt *Mytoken) toTokenResponse() response.MytokenResponse {
 			Rotation:     mt.Rotation,
 			MOMID:        mt.ID.Hash(),
 		},
-		Restrictions: mt.Restrictions,
+		Restrictions:   mt.Restrictions,
+		SubtokenLimits: mt.SubtokenLimits,
 	}
 }
 
@@ -427,6 +427,28 @@ func (r *Restrictions) GetNotBefore() unixtime.UnixTime {
 	return nbf
 }
 
+// Shift returns a copy of the Restrictions where all time-based restrictions are moved by diff seconds; unset times
+// stay unset
+func (r Restrictions) Shift(diff unixtime.UnixTime) Restrictions {
+	if r == nil {
+		return nil
+	}
+	shifted := make(Restrictions, len(r))
+	for i, rr := range r {
+		s := *rr
+		if s.NotBefore != 0 {
+			s.NotBefore += diff
+			s.Restriction.NotBefore = int64(s.NotBefore)
+		}
+		if s.ExpiresAt != 0 {
+			s.ExpiresAt += diff
+			s.Restriction.ExpiresAt = int64(s.ExpiresAt)
+		}
+		shifted[i] = &s
+	}
+	return shifted
+}
+
 // GetScopes returns the union of all scopes, i.e. all scopes that must be requested at the issuer
 func (r *Restrictions) GetScopes() (scopes []string) {
 	for _, rr := range *r {
@@ -475,7 +497,12 @@ func (r *Restrictions) EnforceMaxLifetime(issuer string) (changed bool) {
 	if maxLifetime == 0 {
 		return
 	}
-	exp := unixtime.InSeconds(maxLifetime)
+	return r.EnforceMaxExpiresAt(unixtime.InSeconds(maxLifetime))
+}
+
+// EnforceMaxExpiresAt ensures that no restriction expires after the passed time. Returns true if the restrictions
+// were changed.
+func (r *Restrictions) EnforceMaxExpiresAt(exp unixtime.UnixTime) (changed bool) {
 	if len(*r) == 0 {
 		*r = append(*r, &Restriction{ExpiresAt: exp})
 		changed = true
@@ -484,7 +511,6 @@ func (r *Restrictions) EnforceMaxLifetime(issuer string) (changed bool) {
 	for _, rr := range *r {
 		if rr.ExpiresAt == 0 || rr.ExpiresAt > exp {
 			rr.ExpiresAt = exp
-			// (*r)[i] = rr
 			changed = true
 		}
 	}
@@ -1627,6 +1627,37 @@ func TestRestrictions_GetNotBefore(t *testing.T) {
 	}
 }
 
+func TestRestrictions_Shift(t *testing.T) {
+	r := Restrictions{
+		{NotBefore: 100, ExpiresAt: 200},
+		{ExpiresAt: 300},
+		{NotBefore: 400},
+	}
+	expected := Restrictions{
+		{NotBefore: 150, ExpiresAt: 250},
+		{ExpiresAt: 350},
+		{NotBefore: 450},
+	}
+	shifted := r.Shift(50)
+	if len(shifted) != len(expected) {
+		t.Fatalf("Expected %d restrictions, but got %d", len(expected), len(shifted))
+	}
+	for i, e := range expected {
+		s := shifted[i]
+		if s.NotBefore != e.NotBefore || s.ExpiresAt != e.ExpiresAt {
+			t.Errorf(
+				"Expected nbf %d and exp %d, but got %d and %d", e.NotBefore, e.ExpiresAt, s.NotBefore, s.ExpiresAt,
+			)
+		}
+		if s.Restriction.NotBefore != int64(e.NotBefore) || s.Restriction.ExpiresAt != int64(e.ExpiresAt) {
+			t.Errorf("Inlined api times not shifted: got %d and %d", s.Restriction.NotBefore, s.Restriction.ExpiresAt)
+		}
+	}
+	if r[0].NotBefore != 100 || r[0].ExpiresAt != 200 {
+		t.Errorf("Original restrictions were modified")
+	}
+}
+
 func TestRestriction_hash(t *testing.T) {
 	r := Restriction{
 		NotBefore: 1599939600,
@@ -31,6 +31,41 @@ func (r Restrictions) ToUsedRestrictions(rlog log.Ext1FieldLogger, tx *sqlx.Tx,
 	return
 }
 
+// UsageCount holds how often a restriction of a mytoken was used
+type UsageCount struct {
+	MTID            string `db:"MT_id"`
+	RestrictionHash string `db:"restriction_hash"`
+	UsagesAT        *int64 `db:"usages_AT"`
+	UsagesOther     *int64 `db:"usages_other"`
+}
+
+// ToUsedRestrictionsFromUsageCounts turns a Restrictions into a slice of UsedRestriction like ToUsedRestrictions, but
+// the usage counts are looked up in the passed usage counts of the mytoken, which are indexed by restriction hash,
+// instead of being queried for each restriction
+func (r Restrictions) ToUsedRestrictionsFromUsageCounts(usages map[string]UsageCount) ([]UsedRestriction, error) {
+	var ur []UsedRestriction
+	for _, rr := range r {
+		hash, err := rr.hash()
+		if err != nil {
+			return nil, err
+		}
+		u := UsedRestriction{
+			Restriction:     *rr,
+			UsagesATDone:    usages[string(hash)].UsagesAT,
+			UsagesOtherDone: usages[string(hash)].UsagesOther,
+		}
+		if u.UsagesATDone == nil {
+			legacyHash, err := rr.legacyHash()
+			if err != nil {
+				return nil, err
+			}
+			u.UsagesATDone = usages[string(legacyHash)].UsagesAT
+		}
+		ur = append(ur, u)
+	}
+	return ur, nil
+}
+
 // ToUsedRestriction turns a Restriction into an UsedRestriction
 func (r Restriction) ToUsedRestriction(rlog log.Ext1FieldLogger, tx *sqlx.Tx, id mtid.MTID) (UsedRestriction, error) {
 	ur := UsedRestriction{
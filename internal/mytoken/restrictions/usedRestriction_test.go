@@ -0,0 +1,47 @@
+package restrictions
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/utils"
+)
+
+func TestRestrictions_ToUsedRestrictionsFromUsageCounts(t *testing.T) {
+	used := &Restriction{Restriction: api.Restriction{Scope: "openid", UsagesAT: utils.NewInt64(10)}}
+	legacy := &Restriction{Restriction: api.Restriction{Scope: "profile", UsagesAT: utils.NewInt64(5)}}
+	unused := &Restriction{Restriction: api.Restriction{Scope: "email", UsagesOther: utils.NewInt64(3)}}
+	usedHash, err := used.hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyHash, err := legacy.legacyHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages := map[string]UsageCount{
+		string(usedHash): {
+			UsagesAT:    utils.NewInt64(4),
+			UsagesOther: utils.NewInt64(2),
+		},
+		string(legacyHash): {UsagesAT: utils.NewInt64(1)},
+	}
+	ur, err := Restrictions{used, legacy, unused}.ToUsedRestrictionsFromUsageCounts(usages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ur) != 3 {
+		t.Fatalf("Expected 3 used restrictions, but got %d", len(ur))
+	}
+	check := func(name string, got *int64, exp *int64) {
+		if (got == nil) != (exp == nil) || (got != nil && *got != *exp) {
+			t.Errorf("%s: expected '%v', but got '%v'", name, exp, got)
+		}
+	}
+	check("used AT", ur[0].UsagesATDone, utils.NewInt64(4))
+	check("used other", ur[0].UsagesOtherDone, utils.NewInt64(2))
+	check("legacy AT", ur[1].UsagesATDone, utils.NewInt64(1))
+	check("legacy other", ur[1].UsagesOtherDone, nil)
+	check("unused AT", ur[2].UsagesATDone, nil)
+	check("unused other", ur[2].UsagesOtherDone, nil)
+}
@@ -0,0 +1,102 @@
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	pkg2 "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/notifier/pkg"
+	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
+)
+
+// chatDetail is a single line in the details of a chat message
+type chatDetail struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type chatDetails []chatDetail
+
+func (d *chatDetails) add(lang, key, value string) {
+	if value == "" {
+		return
+	}
+	*d = append(*d, chatDetail{Key: i18n.Translate(lang, key), Value: value})
+}
+
+// SendChatNotification queues a templated chat message to the passed pkg.ChatTarget for delivery through the
+// relevant notification server; the message is sent in the passed language. Webhook urls are queued encrypted.
+func SendChatNotification(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, target pkg.ChatTarget, lang, subject, template string,
+	binding map[string]any,
+) error {
+	binding["title"] = subject
+	target, err := target.Encrypted(config.Get().Features.Notifications.Chat.Webhook.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	return notificationsrepo.EnqueueChatNotification(
+		rlog, tx, mtID, subject, pkg.ChatNotificationRequest{
+			Target:      target,
+			Template:    template,
+			BindingData: binding,
+			Language:    lang,
+		},
+	)
+}
+
+// userLanguage returns the preferred language of the user of a mytoken
+func userLanguage(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID) (string, error) {
+	info, err := userrepo.GetMail(rlog, tx, mtID)
+	if err != nil {
+		return "", err
+	}
+	return info.Lang(), nil
+}
+
+func sendChatNotificationForEvent(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, n notificationsrepo.NotificationInfoBase,
+	target pkg.ChatTarget, notificationClassName string, clientData *api.ClientMetaData, e *pkg2.MTEvent,
+	additionalData model.KeyValues,
+) error {
+	lang, err := userLanguage(rlog, tx, mtID)
+	if err != nil {
+		return err
+	}
+	tokenName, err := mytokenrepohelper.GetMTName(rlog, tx, mtID)
+	if err != nil {
+		return err
+	}
+	var details chatDetails
+	details.add(lang, "mail.table.token_name", tokenName.String)
+	details.add(lang, "mail.table.mom_id", mtID.Hash())
+	details.add(lang, "mail.table.notification_reason", notificationClassName)
+	if e != nil {
+		details.add(lang, "mail.table.event", e.Event.String())
+		details.add(lang, "mail.table.comment", e.Comment)
+	}
+	details.add(lang, "mail.table.ip", clientData.IP)
+	details.add(lang, "mail.table.location", geoip.Country(clientData.IP))
+	details.add(lang, "mail.table.user_agent", clientData.UserAgent)
+	for _, kv := range additionalData {
+		details = append(details, chatDetail{Key: kv.Key, Value: fmt.Sprintf("%v", kv.Value)})
+	}
+	return SendChatNotification(
+		rlog, tx, mtID, target, lang, i18n.Translatef(lang, "mail.subject.notification", notificationClassName),
+		"notification", map[string]any{
+			"details":        details,
+			"management-url": routes.NotificationManagementURL(n.ManagementCode),
+		},
+	)
+}
@@ -0,0 +1,205 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/actions"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
+)
+
+const digestTimeFormat = "2006-01-02 15:04:05 MST"
+
+func sendDueDigests(logger log.Ext1FieldLogger, _ []byte) error {
+	logger.Trace("Checking for digests to send")
+	for {
+		var done bool
+		if err := db.Transact(
+			logger, func(tx *sqlx.Tx) error {
+				entries, err := notificationsrepo.PopDueDigest(logger, tx)
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					done = true
+					return nil
+				}
+				return sendDigest(logger, tx, entries)
+			},
+		); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+type digestToken struct {
+	mtID    mtid.MTID
+	entries []notificationsrepo.DigestEntry
+}
+
+// groupDigestEntries groups the entries of a digest by mytoken, keeping the order in which the mytokens first occur
+func groupDigestEntries(entries []notificationsrepo.DigestEntry) []*digestToken {
+	var tokens []*digestToken
+	byMT := make(map[string]*digestToken)
+	for _, e := range entries {
+		t, ok := byMT[e.MTID.Hash()]
+		if !ok {
+			t = &digestToken{mtID: e.MTID}
+			byMT[e.MTID.Hash()] = t
+			tokens = append(tokens, t)
+		}
+		t.entries = append(t.entries, e)
+	}
+	return tokens
+}
+
+// sendDigest sends one mail summarizing all passed entries; all entries must belong to the same notification
+// subscription
+func sendDigest(logger log.Ext1FieldLogger, tx *sqlx.Tx, entries []notificationsrepo.DigestEntry) error {
+	n := entries[0].NotificationInfoBase
+	logger = logger.WithField("notification_id", n.NotificationID)
+	emailInfo, err := userrepo.GetMailForUser(logger, tx, n.UID)
+	if err != nil {
+		return err
+	}
+	if !emailInfo.Mail.Valid || !emailInfo.MailVerified {
+		logger.Debug("dropping notification digest, because the email address is not verified")
+		return nil
+	}
+	lang := emailInfo.Lang()
+	var tokensBinding []map[string]any
+	for _, t := range groupDigestEntries(entries) {
+		tb, err := digestTokenBindingData(logger, tx, t, lang)
+		if err != nil {
+			return err
+		}
+		tokensBinding = append(tokensBinding, tb)
+	}
+	bindingData := map[string]any{
+		"management-url": routes.NotificationManagementURL(n.ManagementCode),
+		"tokens":         tokensBinding,
+	}
+	subject := i18n.Translatef(lang, "mail.subject.digest", len(entries))
+	logger.WithField("number_entries", len(entries)).Debug("sending notification digest")
+	// A digest is not sent for a single mytoken, therefore it is not linked to one
+	return SendTemplateEmail(logger, tx, mtid.MTID{}, emailInfo, subject, "notification-digest", bindingData)
+}
+
+func digestTokenBindingData(
+	logger log.Ext1FieldLogger, tx *sqlx.Tx, t *digestToken, lang string,
+) (map[string]any, error) {
+	name, err := mytokenrepohelper.GetMTName(logger, tx, t.mtID)
+	// The mytoken might not exist anymore
+	found, err := db.ParseError(err)
+	if err != nil {
+		return nil, err
+	}
+	binding := map[string]any{
+		"mom_id": t.mtID.Hash(),
+	}
+	if name.Valid {
+		binding["token-name"] = name.String
+	}
+	if found {
+		if err = addDigestTokenActions(logger, tx, t.mtID, binding); err != nil {
+			return nil, err
+		}
+	}
+	var entries []map[string]any
+	rows := make([][]string, len(t.entries))
+	for i, e := range t.entries {
+		entry := digestEntryBindingData(e)
+		entries = append(entries, entry)
+		rows[i] = []string{
+			entry["time"].(string),
+			e.Class,
+			fmt.Sprintf("%v", entry["event"]),
+			fmt.Sprintf("%v", entry["ip"]),
+			fmt.Sprintf("%v", entry["details"]),
+		}
+	}
+	binding["entries"] = entries
+	buf := bytes.NewBufferString("")
+	fPrintTable(
+		buf, []string{
+			i18n.Translate(lang, "mail.table.time"),
+			i18n.Translate(lang, "mail.table.notification_reason"),
+			i18n.Translate(lang, "mail.table.event"),
+			i18n.Translate(lang, "mail.table.ip"),
+			i18n.Translate(lang, "mail.table.details"),
+		}, rows,
+	)
+	binding["txt-table"] = buf.String()
+	return binding, nil
+}
+
+// addDigestTokenActions adds the action urls for a mytoken of a digest to the binding data; a mytoken can always be
+// re-created and a suspended one can also be resumed
+func addDigestTokenActions(logger log.Ext1FieldLogger, tx *sqlx.Tx, id mtid.MTID, binding map[string]any) error {
+	recreateURL, err := actions.CreateRecreateToken(logger, tx, id)
+	if err != nil {
+		return err
+	}
+	binding["recreate-url"] = recreateURL
+	suspended, err := mytokenrepohelper.CheckTokenSuspended(logger, tx, id)
+	if err != nil {
+		return err
+	}
+	if suspended {
+		resumeURL, err := actions.CreateResumeToken(logger, tx, id)
+		if err != nil {
+			return err
+		}
+		binding["resume-url"] = resumeURL
+	}
+	return nil
+}
+
+func digestEntryBindingData(e notificationsrepo.DigestEntry) map[string]any {
+	entry := map[string]any{
+		"time":               e.Created.UTC().Format(digestTimeFormat),
+		"notification-class": e.Class,
+		"event":              "",
+		"ip":                 "",
+		"details":            "",
+	}
+	if ip, ok := e.Data[notificationsrepo.DigestDataKeyIP].(string); ok {
+		entry["ip"] = ip
+		entry["country"] = geoip.Country(ip)
+	}
+	if ua, ok := e.Data[notificationsrepo.DigestDataKeyUserAgent].(string); ok {
+		entry["user-agent"] = ua
+	}
+	if event, ok := e.Data[notificationsrepo.DigestDataKeyEvent].(string); ok {
+		entry["event"] = event
+	}
+	var details string
+	if comment, ok := e.Data[notificationsrepo.DigestDataKeyComment].(string); ok && comment != "" {
+		details = comment
+	}
+	if additionalData, ok := e.Data[notificationsrepo.DigestDataKeyAdditionalData].([]any); ok {
+		for _, kv := range additionalData {
+			if kv, ok := kv.(map[string]any); ok {
+				if details != "" {
+					details += "; "
+				}
+				details += fmt.Sprintf("%v: %v", kv["key"], kv["value"])
+			}
+		}
+	}
+	entry["details"] = details
+	return entry
+}
@@ -1,11 +1,16 @@
 package notifier
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/httpclient"
+	"github.com/oidc-mytoken/utils/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -13,6 +18,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
 	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
+	"github.com/oidc-mytoken/server/internal/jws"
 	"github.com/oidc-mytoken/server/internal/model"
 	pkg2 "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
@@ -21,10 +27,13 @@ import (
 	"github.com/oidc-mytoken/server/internal/notifier/server/mailing"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 )
 
 type notifierClient interface {
-	SendEmailRequest(req pkg.EmailNotificationRequest)
+	SendEmailRequest(req pkg.EmailNotificationRequest) error
+	SendChatRequest(req pkg.ChatNotificationRequest) error
 }
 
 var notifier notifierClient
@@ -42,9 +51,11 @@ func Init() {
 		initIntegraded()
 	}
 	initScheduler()
+	initQueueWorker()
 }
 
 func initStandalone(serverURL string) {
+	jws.LoadOIDCSigningKey()
 	notifier = standaloneNotifier{
 		serverAddress: serverURL,
 		paths:         server.ServerPaths.Prefix(serverURL),
@@ -61,49 +72,105 @@ type standaloneNotifier struct {
 }
 type integratedNotifier struct{}
 
-// SendEmailRequest sends a pkg.EmailNotificationRequest to the standalone notifier server
-func (n standaloneNotifier) SendEmailRequest(req pkg.EmailNotificationRequest) {
-	_, err := httpclient.Do().R().
-		SetBody(req).
-		Post(n.paths.Email)
+// authToken creates a short-lived jwt signed with the OIDC signing key that authenticates a request with the passed
+// body to the standalone notifier server
+func (n standaloneNotifier) authToken(body []byte) (string, error) {
+	now := time.Now()
+	claims := pkg.RequestClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    config.Get().IssuerURL,
+			Audience:  n.serverAddress,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(pkg.RequestTokenLifetime).Unix(),
+			Id:        utils.RandASCIIString(64),
+		},
+		BodyHash: hashutils.SHA512Str(body),
+	}
+	token, err := jwt.NewWithClaims(jwt.GetSigningMethod(config.Get().Signing.OIDC.Alg.String()), claims).
+		SignedString(jws.GetSigningKey(jws.KeyUsageOIDCSigning))
+	return token, errors.WithStack(err)
+}
+
+// SendEmailRequest sends a pkg.EmailNotificationRequest to the standalone notifier server; the request was only
+// delivered if no error is returned
+func (n standaloneNotifier) SendEmailRequest(req pkg.EmailNotificationRequest) error {
+	return n.post(n.paths.Email, req)
+}
+
+// SendChatRequest sends a pkg.ChatNotificationRequest to the standalone notifier server; the request was only
+// delivered if no error is returned
+func (n standaloneNotifier) SendChatRequest(req pkg.ChatNotificationRequest) error {
+	return n.post(n.paths.Chat, req)
+}
+
+// post sends an authenticated request with the passed json body to the standalone notifier server
+func (n standaloneNotifier) post(path string, req any) error {
+	body, err := json.Marshal(req)
 	if err != nil {
-		log.WithError(err).Error("error while sending notification request to notifier server")
+		return errors.WithStack(err)
 	}
+	token, err := n.authToken(body)
+	if err != nil {
+		return err
+	}
+	res, err := httpclient.Do().R().
+		SetAuthToken(token).
+		SetHeader(fiber.HeaderContentType, fiber.MIMEApplicationJSON).
+		SetBody(body).
+		Post(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if res.IsError() {
+		return errors.Errorf("notifier server responded with status %d: %s", res.StatusCode(), res.String())
+	}
+	return nil
 }
 
 // SendEmailRequest sends a pkg.EmailNotificationRequest to the integrated notification server
-func (integratedNotifier) SendEmailRequest(req pkg.EmailNotificationRequest) {
-	_ = server.HandleEmailRequest(req)
+func (integratedNotifier) SendEmailRequest(req pkg.EmailNotificationRequest) error {
+	return server.HandleEmailRequest(req)
+}
+
+// SendChatRequest sends a pkg.ChatNotificationRequest to the integrated notification server
+func (integratedNotifier) SendChatRequest(req pkg.ChatNotificationRequest) error {
+	return server.HandleChatRequest(req)
 }
 
-// SendTemplateEmail sends a templated email through the relevant notification server
-func SendTemplateEmail(to, subject string, preferHTML bool, template string, binding any) {
-	// skipcq GO-E1007
-	go func() {
-		req := pkg.EmailNotificationRequest{
-			To:          to,
+// SendTemplateEmail queues a templated email to the user with the passed userrepo.MailInfo for delivery through the
+// relevant notification server; the email is sent in the user's language
+func SendTemplateEmail(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, mailInfo userrepo.MailInfo, subject, template string,
+	binding any,
+) error {
+	return notificationsrepo.EnqueueNotification(
+		rlog, tx, mtID, subject, pkg.EmailNotificationRequest{
+			To:          mailInfo.Mail.String,
 			Subject:     subject,
-			PreferHTML:  preferHTML,
+			PreferHTML:  mailInfo.PreferHTMLMail,
 			Template:    template,
 			BindingData: binding,
-		}
-		notifier.SendEmailRequest(req)
-	}()
+			Language:    mailInfo.Lang(),
+		},
+	)
 }
 
-// SendICSMail sends an ics calendar invite via email through the relevant notification server
-func SendICSMail(to, subject, text string, attachments ...mailing.Attachment) {
-	// skipcq GO-E1007
-	go func() {
-		req := pkg.EmailNotificationRequest{
-			To:          to,
+// SendICSMail queues an ics calendar invite via email to the user with the passed userrepo.MailInfo for delivery
+// through the relevant notification server
+func SendICSMail(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, mailInfo userrepo.MailInfo, subject, text string,
+	attachments ...mailing.Attachment,
+) error {
+	return notificationsrepo.EnqueueNotification(
+		rlog, tx, mtID, subject, pkg.EmailNotificationRequest{
+			To:          mailInfo.Mail.String,
 			Subject:     subject,
 			Text:        text,
 			Attachments: attachments,
 			ICSInvite:   true,
-		}
-		notifier.SendEmailRequest(req)
-	}()
+			Language:    mailInfo.Lang(),
+		},
+	)
 }
 
 // SendNotificationsForEvent sends all relevant notifications for an event through the relevant notification server,
@@ -139,11 +206,11 @@ func SendNotificationsForSubClass(
 		return err
 	}
 	rlog.WithField("number_all_notifications", len(allNotifications)).Trace("found notifications for token")
-	var notifications []api.NotificationInfoBase
+	var notifications []notificationsrepo.NotificationInfoBase
 	for _, n := range allNotifications {
 		thisNC := api.NewNotificationClass(n.Class)
 		if thisNC.Contains(nc) {
-			notifications = append(notifications, n.NotificationInfoBase.NotificationInfoBase)
+			notifications = append(notifications, n.NotificationInfoBase)
 		}
 	}
 	if len(notifications) == 0 {
@@ -166,14 +233,34 @@ func SendNotificationsForSubClass(
 
 func sendNotificationsForNotificationInfos(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID,
-	notifications []api.NotificationInfoBase, notificationClassName string,
+	notifications []notificationsrepo.NotificationInfoBase, notificationClassName string,
 	clientData *api.ClientMetaData,
 	e *pkg2.MTEvent, additionalData model.KeyValues,
 ) error {
 	mailAlreadySent := false
+	chatsAlreadySent := make(map[pkg.ChatTarget]bool)
 	for _, n := range notifications {
+		if target := n.Chat(); target != nil && target.Deliverable() && !chatsAlreadySent[*target] {
+			chatsAlreadySent[*target] = true
+			rlog.Debug("sending chat notification")
+			if err := sendChatNotificationForEvent(
+				rlog, tx, mtID, n, *target, notificationClassName, clientData, e, additionalData,
+			); err != nil {
+				return err
+			}
+		}
 		switch n.Type {
 		case api.NotificationTypeMail:
+			if n.Digest != "" && n.Digest != notificationsrepo.DigestImmediate {
+				rlog.WithField("digest", n.Digest).Debug("adding notification to digest")
+				if err := notificationsrepo.AddDigestEntry(
+					rlog, tx, n, mtID, notificationClassName,
+					digestEntryData(clientData, e, additionalData),
+				); err != nil {
+					return err
+				}
+				continue
+			}
 			if !mailAlreadySent {
 				mailAlreadySent = true
 				emailInfo, err := userrepo.GetMail(rlog, tx, mtID)
@@ -190,6 +277,7 @@ func sendNotificationsForNotificationInfos(
 				if err != nil {
 					return err
 				}
+				lang := emailInfo.Lang()
 				bindingData := map[string]any{
 					"management-url": routes.NotificationManagementURL(n.ManagementCode),
 				}
@@ -210,19 +298,19 @@ func sendNotificationsForNotificationInfos(
 				} else {
 					tableData := map[string]string{}
 					if tokenName.Valid {
-						tableData["Mytoken Name"] = tokenName.String
+						tableData[i18n.Translate(lang, "mail.table.token_name")] = tokenName.String
 					}
-					tableData["Mytoken Mom ID"] = mtID.Hash()
-					tableData["IP"] = clientData.IP
-					tableData["User-Agent"] = clientData.UserAgent
+					tableData[i18n.Translate(lang, "mail.table.mom_id")] = mtID.Hash()
+					tableData[i18n.Translate(lang, "mail.table.ip")] = clientData.IP
+					tableData[i18n.Translate(lang, "mail.table.user_agent")] = clientData.UserAgent
 					if country := geoip.Country(clientData.IP); country != "" {
-						tableData["Location"] = country
+						tableData[i18n.Translate(lang, "mail.table.location")] = country
 					}
-					tableData["Notification Reason"] = notificationClassName
+					tableData[i18n.Translate(lang, "mail.table.notification_reason")] = notificationClassName
 
 					if e != nil {
-						tableData["Event"] = e.Event.String()
-						tableData["Comment"] = e.Comment
+						tableData[i18n.Translate(lang, "mail.table.event")] = e.Event.String()
+						tableData[i18n.Translate(lang, "mail.table.comment")] = e.Comment
 					}
 					for _, kv := range additionalData {
 						tableData[kv.Key] = fmt.Sprintf("%v", kv.Value)
@@ -231,10 +319,13 @@ func sendNotificationsForNotificationInfos(
 					bindingData["txt-table"] = txtTable
 				}
 				rlog.Debug("sending notification mail")
-				SendTemplateEmail(
-					emailInfo.Mail.String, fmt.Sprintf("mytoken notification: %s", notificationClassName),
-					emailInfo.PreferHTMLMail, "notification", bindingData,
-				)
+				if err = SendTemplateEmail(
+					rlog, tx, mtID, emailInfo,
+					i18n.Translatef(lang, "mail.subject.notification", notificationClassName),
+					"notification", bindingData,
+				); err != nil {
+					return err
+				}
 
 			}
 		case api.NotificationTypeWebsocket:
@@ -244,3 +335,18 @@ func sendNotificationsForNotificationInfos(
 	}
 	return nil
 }
+
+func digestEntryData(clientData *api.ClientMetaData, e *pkg2.MTEvent, additionalData model.KeyValues) map[string]any {
+	data := map[string]any{
+		notificationsrepo.DigestDataKeyIP:        clientData.IP,
+		notificationsrepo.DigestDataKeyUserAgent: clientData.UserAgent,
+	}
+	if e != nil {
+		data[notificationsrepo.DigestDataKeyEvent] = e.Event.String()
+		data[notificationsrepo.DigestDataKeyComment] = e.Comment
+	}
+	if additionalData != nil {
+		data[notificationsrepo.DigestDataKeyAdditionalData] = additionalData
+	}
+	return data
+}
@@ -0,0 +1,120 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
+	"github.com/oidc-mytoken/server/internal/notifier/pkg"
+	"github.com/oidc-mytoken/server/internal/utils/backoff"
+)
+
+const (
+	queueBatchSize = 50
+	// queueLease is the time in seconds for which claimed notifications are reserved for delivery by this instance
+	queueLease = 5 * 60
+)
+
+func initQueueWorker() {
+	ticker := time.NewTicker(time.Duration(config.Get().Features.Notifications.Queue.PollInterval) * time.Second)
+	go func() {
+		for range ticker.C {
+			deliverQueuedNotifications()
+		}
+	}()
+}
+
+func deliverQueuedNotifications() {
+	logger := log.StandardLogger()
+	for {
+		notifications, err := notificationsrepo.ClaimQueuedNotifications(
+			logger, nil, utils.RandASCIIString(64), queueBatchSize, queueLease,
+		)
+		if err != nil {
+			logger.WithError(err).Error("error claiming queued notifications")
+			return
+		}
+		for _, n := range notifications {
+			deliverQueuedNotification(logger, n)
+		}
+		if len(notifications) < queueBatchSize {
+			return
+		}
+	}
+}
+
+func deliverQueuedNotification(logger log.Ext1FieldLogger, n notificationsrepo.QueuedNotification) {
+	logger = logger.WithField("queued_notification", n.ID)
+	permanent, deliveryErr := sendQueuedNotification(n)
+	if deliveryErr == nil {
+		if err := notificationsrepo.MarkNotificationDelivered(logger, nil, n.ID); err != nil {
+			logger.WithError(err).Error("error updating queued notification")
+		}
+		return
+	}
+	if permanent {
+		logger.WithError(deliveryErr).Error("queued notification cannot be delivered")
+		if err := notificationsrepo.MarkNotificationFailed(logger, nil, n.ID, deliveryErr.Error(), nil); err != nil {
+			logger.WithError(err).Error("error updating queued notification")
+		}
+		return
+	}
+	logger.WithError(deliveryErr).Warn("error delivering queued notification")
+	retryIn := retryInterval(n.Attempts + 1)
+	if retryIn == nil {
+		logger.Error("giving up delivering queued notification")
+	}
+	if err := notificationsrepo.MarkNotificationFailed(
+		logger, nil, n.ID, errors.Cause(deliveryErr).Error(), retryIn,
+	); err != nil {
+		logger.WithError(err).Error("error updating queued notification")
+	}
+}
+
+// sendQueuedNotification sends a queued notification to the notifier server depending on its type; if the
+// notification cannot be parsed, permanent is true and the delivery must not be retried
+func sendQueuedNotification(n notificationsrepo.QueuedNotification) (permanent bool, err error) {
+	// The schedule id is used by the notifier to not send the notification twice if only the acknowledgement got lost
+	scheduleID := fmt.Sprintf("queue:%d", n.ID)
+	switch n.Type {
+	case notificationsrepo.QueueTypeChat:
+		var req pkg.ChatNotificationRequest
+		if err = json.Unmarshal([]byte(n.Request), &req); err != nil {
+			return true, errors.WithStack(err)
+		}
+		if req.Target, err = req.Target.Decrypted(
+			config.Get().Features.Notifications.Chat.Webhook.EncryptionKey,
+		); err != nil {
+			return true, err
+		}
+		if req.ScheduleID == "" {
+			req.ScheduleID = scheduleID
+		}
+		return false, notifier.SendChatRequest(req)
+	case notificationsrepo.QueueTypeMail, "":
+		var req pkg.EmailNotificationRequest
+		if err = json.Unmarshal([]byte(n.Request), &req); err != nil {
+			return true, errors.WithStack(err)
+		}
+		if req.ScheduleID == "" {
+			req.ScheduleID = scheduleID
+		}
+		return false, notifier.SendEmailRequest(req)
+	default:
+		return true, errors.Errorf("unknown queued notification type '%s'", n.Type)
+	}
+}
+
+// retryInterval returns the time in seconds after which a notification that failed attempts times is retried; the
+// interval is doubled with each attempt up to the configured maximum. If the maximum number of attempts is reached,
+// nil is returned.
+func retryInterval(attempts int) *int {
+	conf := config.Get().Features.Notifications.Queue
+	return backoff.RetryInterval(attempts, conf.MaxAttempts, conf.RetryInterval, conf.MaxRetryInterval)
+}
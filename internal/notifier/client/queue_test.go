@@ -0,0 +1,34 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestRetryInterval(t *testing.T) {
+	conf := &config.Get().Features.Notifications.Queue
+	conf.MaxAttempts = 5
+	conf.RetryInterval = 60
+	conf.MaxRetryInterval = 200
+	tests := []struct {
+		attempts int
+		expected *int
+	}{
+		{attempts: 1, expected: intPtr(60)},
+		{attempts: 2, expected: intPtr(120)},
+		{attempts: 3, expected: intPtr(200)},
+		{attempts: 4, expected: intPtr(200)},
+		{attempts: 5, expected: nil},
+	}
+	for _, test := range tests {
+		got := retryInterval(test.attempts)
+		if (got == nil) != (test.expected == nil) || (got != nil && *got != *test.expected) {
+			t.Errorf("For %d attempts expected %v, but got %v", test.attempts, test.expected, got)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
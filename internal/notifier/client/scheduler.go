@@ -10,59 +10,78 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/renewalrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
 	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
 	"github.com/oidc-mytoken/server/internal/endpoints/actions"
+	"github.com/oidc-mytoken/server/internal/jobs"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/notifier/pkg"
 	"github.com/oidc-mytoken/server/internal/server/routes"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 )
 
+// Job types of the jobs run by the notifier client
+const (
+	JobTypeScheduledNotifications = "scheduled_notifications"
+	JobTypeNotificationDigests    = "notification_digests"
+)
+
+// scheduledNotificationsBatchSize is the maximum number of scheduled notifications handled within one transaction
+const scheduledNotificationsBatchSize = 50
+
 func initScheduler() {
-	ticker := time.NewTicker(time.Minute)
-	go func() {
-		for range ticker.C {
-			checkingForDueNotifications()
-		}
-	}()
+	jobs.RegisterRecurring(JobTypeScheduledNotifications, time.Minute, sendDueNotifications)
+	jobs.RegisterRecurring(JobTypeNotificationDigests, time.Minute, sendDueDigests)
 }
 
-func checkingForDueNotifications() {
-	logger := log.StandardLogger()
+func sendDueNotifications(logger log.Ext1FieldLogger, _ []byte) error {
 	logger.Trace("Checking for notifications to send")
-	var abort bool
 	for {
+		var count int
 		if err := db.Transact(
 			logger, func(tx *sqlx.Tx) error {
-				n, err := notificationsrepo.PopOneScheduledNotification(logger, tx)
+				notifications, err := notificationsrepo.PopDueScheduledNotifications(
+					logger, tx, scheduledNotificationsBatchSize,
+				)
 				if err != nil {
-					log.WithError(err).Error("error popping scheduled notification")
 					return err
 				}
-				if n == nil {
-					abort = true
-					return nil
+				count = len(notifications)
+				for _, n := range notifications {
+					if err = handleDueNotification(logger, tx, n); err != nil {
+						return err
+					}
 				}
-				return handleDueNotification(logger, tx, n)
+				return nil
 			},
 		); err != nil {
-			break
+			return err
 		}
-		if abort {
-			logger.Trace("No notifications due")
-			break
+		if count < scheduledNotificationsBatchSize {
+			return nil
 		}
 	}
 }
 
 func handleDueNotification(logger log.Ext1FieldLogger, tx *sqlx.Tx, n *notificationsrepo.ScheduledNotification) error {
 	logger.Trace("Got a notification")
+	if target := n.Chat(); target != nil && target.Deliverable() {
+		if err := handleDueChatNotification(logger, tx, n, *target); err != nil {
+			return err
+		}
+	}
 	switch n.Type {
 	case api.NotificationTypeMail:
 		return handleDueMailNotification(logger, tx, n)
 	case api.NotificationTypeWebsocket:
 		// NYI
 		return nil
+	case pkg.NotificationTypeChat:
+		return nil
 	default:
 		return errors.New("unknown notification type")
 	}
@@ -86,6 +105,7 @@ func handleDueMailNotification(
 	var subject string
 	var template string
 	var bindingData map[string]any
+	lang := emailInfo.Lang()
 	switch n.Class {
 	case notificationsrepo.ScheduleClassExp:
 		exp_, ok := n.AdditionalInfo[notificationsrepo.AdditionalInfoKeyExpiresAt].(float64)
@@ -93,21 +113,9 @@ func handleDueMailNotification(
 			logger.Error("'expires_at' missing or wrong time in scheduled notification of class 'exp'")
 			return nil
 		}
+		// Expiration warnings are time-critical and therefore never collected in a digest
 		exp := unixtime.UnixTime(exp_)
-		diff := time.Until(exp.Time())
-		var diffStr string
-		if diff < 24*time.Hour {
-			diff = diff.Round(time.Hour)
-			diffStr = fmt.Sprintf("%d hours", diff/time.Hour)
-		} else {
-			diff = diff.Round(24 * time.Hour)
-			diffStr = fmt.Sprintf("%d days", diff/(24*time.Hour))
-		}
-		var quotedName string
-		if name.Valid {
-			quotedName = fmt.Sprintf(" '%s'", name.String)
-		}
-		subject = fmt.Sprintf("mytoken%s expires in %s", quotedName, diffStr)
+		subject = expirationSubject(lang, name.String, exp)
 		template = "notification-exp"
 		recreateURL, err := actions.CreateRecreateToken(logger, tx, n.MTID)
 		if err != nil {
@@ -124,6 +132,9 @@ func handleDueMailNotification(
 			"recreate-url":                   recreateURL,
 			"unsubscribe-exp-this-token-url": unsubscribeURL,
 		}
+		if err = addRenewalURL(logger, tx, n.MTID, exp, bindingData); err != nil {
+			return err
+		}
 		if emailInfo.MailVerified {
 			bindingData["token-name"] = name.String
 			bindingData["mom_id"] = n.MTID.Hash()
@@ -131,18 +142,99 @@ func handleDueMailNotification(
 		} else {
 			tableData := map[string]string{}
 			if name.Valid {
-				tableData["Mytoken Name"] = name.String
+				tableData[i18n.Translate(lang, "mail.table.token_name")] = name.String
 			}
-			tableData["Mytoken Mom ID"] = n.MTID.Hash()
-			tableData["Expires"] = exp.Time().String()
+			tableData[i18n.Translate(lang, "mail.table.mom_id")] = n.MTID.Hash()
+			tableData[i18n.Translate(lang, "mail.table.expires")] = exp.Time().String()
 			txtTable := generateSimpleTable(nil, tableData)
 			bindingData["txt-table"] = txtTable
 		}
 	default:
 		return nil
 	}
-	SendTemplateEmail(
-		emailInfo.Mail.String, subject, emailInfo.PreferHTMLMail, template, bindingData,
+	return SendTemplateEmail(logger, tx, n.MTID, emailInfo, subject, template, bindingData)
+}
+
+func handleDueChatNotification(
+	logger log.Ext1FieldLogger, tx *sqlx.Tx, n *notificationsrepo.ScheduledNotification, target pkg.ChatTarget,
+) error {
+	if n.Class != notificationsrepo.ScheduleClassExp {
+		return nil
+	}
+	exp_, ok := n.AdditionalInfo[notificationsrepo.AdditionalInfoKeyExpiresAt].(float64)
+	if !ok {
+		logger.Error("'expires_at' missing or wrong time in scheduled notification of class 'exp'")
+		return nil
+	}
+	exp := unixtime.UnixTime(exp_)
+	lang, err := userLanguage(logger, tx, n.MTID)
+	if err != nil {
+		return err
+	}
+	name, err := mytokenrepohelper.GetMTName(logger, tx, n.MTID)
+	if err != nil {
+		return err
+	}
+	recreateURL, err := actions.CreateRecreateToken(logger, tx, n.MTID)
+	if err != nil {
+		return err
+	}
+	unsubscribeURL, err := actions.GetUnsubscribeScheduled(logger, tx, n.MTID, n.NotificationID)
+	if err != nil {
+		return err
+	}
+	var details chatDetails
+	details.add(lang, "mail.table.token_name", name.String)
+	details.add(lang, "mail.table.mom_id", n.MTID.Hash())
+	details.add(lang, "mail.table.expires", exp.Time().String())
+	bindingData := map[string]any{
+		"details":                        details,
+		"management-url":                 routes.NotificationManagementURL(n.ManagementCode),
+		"recreate-url":                   recreateURL,
+		"unsubscribe-exp-this-token-url": unsubscribeURL,
+	}
+	if err = addRenewalURL(logger, tx, n.MTID, exp, bindingData); err != nil {
+		return err
+	}
+	return SendChatNotification(
+		logger, tx, n.MTID, target, lang, expirationSubject(lang, name.String, exp), "notification-exp", bindingData,
 	)
+}
+
+// addRenewalURL adds an url for approving the renewal of a mytoken to the binding data of an expiration
+// notification, if a service requested a renewal that is not yet approved and the mytoken did not yet expire
+func addRenewalURL(
+	logger log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, exp unixtime.UnixTime, bindingData map[string]any,
+) error {
+	if !config.Get().Features.TokenRenewal.Enabled || exp <= unixtime.Now() {
+		return nil
+	}
+	info, found, err := renewalrepo.Get(logger, tx, mtID)
+	if err != nil || !found || info.Approved.Valid {
+		return err
+	}
+	renewalURL, err := actions.CreateApproveRenewal(logger, tx, mtID, exp)
+	if err != nil {
+		return err
+	}
+	bindingData["renewal-url"] = renewalURL
 	return nil
 }
+
+// expirationSubject returns the localized subject of an expiration notification for a mytoken with the passed name
+func expirationSubject(lang, tokenName string, exp unixtime.UnixTime) string {
+	diff := time.Until(exp.Time())
+	var diffStr string
+	if diff < 24*time.Hour {
+		diff = diff.Round(time.Hour)
+		diffStr = i18n.Translatef(lang, "mail.duration.hours", diff/time.Hour)
+	} else {
+		diff = diff.Round(24 * time.Hour)
+		diffStr = i18n.Translatef(lang, "mail.duration.days", diff/(24*time.Hour))
+	}
+	var quotedName string
+	if tokenName != "" {
+		quotedName = fmt.Sprintf(" '%s'", tokenName)
+	}
+	return i18n.Translatef(lang, "mail.subject.expiration", quotedName, diffStr)
+}
@@ -0,0 +1,82 @@
+package notifier
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/notifier/server/mailing/mailtemplates"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
+)
+
+// SuspiciousActivityInfo holds information about a detected suspicious activity and the action taken
+type SuspiciousActivityInfo struct {
+	Reason   string
+	Action   string
+	LinkText string
+	Link     string
+}
+
+// SendSuspiciousActivityMail informs the user via email about a suspicious activity of a mytoken and the automated
+// action taken; this mail is sent independently of the user's notification subscriptions, but requires a verified
+// email address
+func SendSuspiciousActivityMail(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, clientData *api.ClientMetaData,
+	info SuspiciousActivityInfo,
+) error {
+	if notifier == nil {
+		return errors.New("notifications not enabled")
+	}
+	emailInfo, err := userrepo.GetMail(rlog, tx, mtID)
+	if err != nil {
+		return err
+	}
+	if !emailInfo.Mail.Valid {
+		return errors.New("no email set for user")
+	}
+	if !emailInfo.MailVerified {
+		return errors.New("notification email not verified")
+	}
+	tokenName, err := mytokenrepohelper.GetMTName(rlog, tx, mtID)
+	if err != nil {
+		return err
+	}
+	lang := emailInfo.Lang()
+	bindingData := map[string]any{
+		"link":      info.Link,
+		"link-text": info.LinkText,
+	}
+	if emailInfo.PreferHTMLMail {
+		bindingData["ip"] = clientData.IP
+		bindingData["user-agent"] = clientData.UserAgent
+		bindingData["country"] = geoip.Country(clientData.IP)
+		bindingData["mom_id"] = mtID.Hash()
+		bindingData["token-name"] = tokenName.String
+		bindingData["reason"] = info.Reason
+		bindingData["action"] = info.Action
+	} else {
+		tableData := map[string]string{}
+		if tokenName.Valid {
+			tableData[i18n.Translate(lang, "mail.table.token_name")] = tokenName.String
+		}
+		tableData[i18n.Translate(lang, "mail.table.mom_id")] = mtID.Hash()
+		tableData[i18n.Translate(lang, "mail.table.ip")] = clientData.IP
+		tableData[i18n.Translate(lang, "mail.table.user_agent")] = clientData.UserAgent
+		if country := geoip.Country(clientData.IP); country != "" {
+			tableData[i18n.Translate(lang, "mail.table.location")] = country
+		}
+		tableData[i18n.Translate(lang, "mail.table.reason")] = info.Reason
+		tableData[i18n.Translate(lang, "mail.table.action")] = info.Action
+		bindingData["txt-table"] = generateSimpleTable(nil, tableData)
+	}
+	rlog.Debug("sending suspicious activity mail")
+	return SendTemplateEmail(
+		rlog, tx, mtID, emailInfo, i18n.Translate(lang, mailtemplates.SubjectSuspiciousActivity),
+		mailtemplates.TemplateSuspiciousActivity, bindingData,
+	)
+}
@@ -0,0 +1,18 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// RequestTokenLifetime is the lifetime of the jwt that authenticates a request to a standalone notifier server
+const RequestTokenLifetime = time.Minute
+
+// RequestClaims holds the claims of the jwt that authenticates a request from the mytoken server to a standalone
+// notifier server; the jwt is signed with the server's OIDC signing key and bound to the request body through the
+// body hash
+type RequestClaims struct {
+	jwt.StandardClaims
+	BodyHash string `json:"body_hash"`
+}
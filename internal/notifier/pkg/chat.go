@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"crypto/subtle"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+// Kinds of chat targets
+const (
+	ChatKindMatrix  = "matrix"
+	ChatKindWebhook = "webhook"
+)
+
+// NotificationTypeChat is the notification type for notifications that are only posted to a chat
+const NotificationTypeChat = "chat"
+
+var matrixRoomRegex = regexp.MustCompile(`^[!#][^:\s]+:[^\s]+$`)
+
+// ChatTarget describes where chat notifications are posted to; either a matrix room (id or alias) or the url of an
+// incoming webhook.
+// Whoever invited the bot to a matrix room is not necessarily the subscriber, so a matrix room only receives
+// notifications after the subscriber confirmed it with the verification code the bot posted to the room.
+type ChatTarget struct {
+	Kind             string `json:"kind"`
+	Room             string `json:"room,omitempty"`
+	URL              string `json:"url,omitempty"`
+	Verified         bool   `json:"verified,omitempty"`
+	VerificationCode string `json:"verification_code,omitempty"`
+}
+
+const verificationCodeLength = 24
+
+// ChatNotificationRequest holds a request to post a chat notification
+type ChatNotificationRequest struct {
+	Target      ChatTarget `json:"target"`
+	Template    string     `json:"template"`
+	BindingData any        `json:"binding_data,omitempty"`
+	ScheduleID  string     `json:"schedule_id,omitempty"`
+	Language    string     `json:"language,omitempty"`
+}
+
+// Validate checks that the ChatTarget is well-formed and that its kind is enabled in the passed
+// config.ChatNotificationConf
+func (t ChatTarget) Validate(conf config.ChatNotificationConf) error {
+	if !conf.Enabled {
+		return errors.New("chat notifications are not supported")
+	}
+	switch t.Kind {
+	case ChatKindMatrix:
+		if !conf.Matrix.Enabled {
+			return errors.New("matrix chat targets are not supported")
+		}
+		if !matrixRoomRegex.MatchString(t.Room) {
+			return errors.New("invalid matrix room; must be a room id or alias, e.g. '#room:example.com'")
+		}
+	case ChatKindWebhook:
+		if !conf.Webhook.Enabled {
+			return errors.New("webhook chat targets are not supported")
+		}
+		u, err := url.Parse(t.URL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return errors.New("invalid webhook url; must be an https url")
+		}
+		if err = iputils.CheckPublicHost(u.Hostname()); err != nil {
+			return errors.Wrap(err, "invalid webhook url")
+		}
+		if len(conf.Webhook.AllowedHosts) > 0 &&
+			!utils.StringInSlice(strings.ToLower(u.Hostname()), conf.Webhook.AllowedHosts) {
+			return errors.Errorf("webhooks on host '%s' are not allowed", u.Hostname())
+		}
+	default:
+		return errors.New("unknown chat target kind; must be one of 'matrix', 'webhook'")
+	}
+	return nil
+}
+
+// RequiresVerification returns if the ChatTarget must be confirmed before notifications are posted to it; only
+// matrix rooms are verified, because a webhook url is a secret only known to someone with access to the chat
+func (t ChatTarget) RequiresVerification() bool {
+	return t.Kind == ChatKindMatrix
+}
+
+// Deliverable returns if notifications can be posted to the ChatTarget
+func (t ChatTarget) Deliverable() bool {
+	return !t.RequiresVerification() || t.Verified
+}
+
+// PrepareVerification resets the verification state of a ChatTarget set by a user; a matrix room gets a new
+// verification code and is unverified until the code is confirmed with Verify
+func (t *ChatTarget) PrepareVerification() {
+	t.Verified = false
+	t.VerificationCode = ""
+	if t.RequiresVerification() {
+		t.VerificationCode = utils.RandASCIIString(verificationCodeLength)
+	}
+}
+
+// Verify checks the passed code against the verification code of the ChatTarget and marks it as verified if it
+// matches
+func (t *ChatTarget) Verify(code string) bool {
+	if t.VerificationCode == "" || subtle.ConstantTimeCompare([]byte(code), []byte(t.VerificationCode)) != 1 {
+		return false
+	}
+	t.Verified = true
+	t.VerificationCode = ""
+	return true
+}
+
+// Encrypted returns a copy of the ChatTarget in which the url of a webhook is encrypted with the passed key; the url
+// is a secret and therefore must only be stored encrypted
+func (t ChatTarget) Encrypted(key string) (ChatTarget, error) {
+	if t.Kind != ChatKindWebhook {
+		return t, nil
+	}
+	encrypted, err := cryptutils.AES256Encrypt(t.URL, key)
+	if err != nil {
+		return t, err
+	}
+	t.URL = encrypted
+	return t, nil
+}
+
+// Decrypted returns a copy of the ChatTarget in which the url of a webhook that was encrypted with Encrypted is
+// decrypted with the passed key
+func (t ChatTarget) Decrypted(key string) (ChatTarget, error) {
+	if t.Kind != ChatKindWebhook {
+		return t, nil
+	}
+	decrypted, err := cryptutils.AES256Decrypt(t.URL, key)
+	if err != nil {
+		return t, err
+	}
+	t.URL = decrypted
+	return t, nil
+}
+
+// Masked returns a copy of the ChatTarget that can be shown to users; the path of a webhook url and the verification
+// code are secrets and therefore removed
+func (t ChatTarget) Masked() ChatTarget {
+	t.VerificationCode = ""
+	if t.Kind != ChatKindWebhook {
+		return t
+	}
+	if u, err := url.Parse(t.URL); err == nil {
+		t.URL = u.Scheme + "://" + u.Host + "/***"
+	}
+	return t
+}
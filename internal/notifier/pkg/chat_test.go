@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestChatTarget_Validate(t *testing.T) {
+	conf := config.ChatNotificationConf{
+		Enabled: true,
+		Matrix:  config.MatrixConf{Enabled: true},
+		Webhook: config.ChatWebhookConf{
+			Enabled:      true,
+			AllowedHosts: []string{"hooks.example.com"},
+		},
+	}
+	tests := []struct {
+		name    string
+		target  ChatTarget
+		anyHost bool
+		valid   bool
+	}{
+		{name: "room alias", target: ChatTarget{Kind: ChatKindMatrix, Room: "#ops:example.com"}, valid: true},
+		{name: "room id", target: ChatTarget{Kind: ChatKindMatrix, Room: "!abc:example.com"}, valid: true},
+		{name: "room without server", target: ChatTarget{Kind: ChatKindMatrix, Room: "#ops"}},
+		{name: "room with url", target: ChatTarget{Kind: ChatKindMatrix, URL: "https://hooks.example.com/x"}},
+		{
+			name:   "webhook",
+			target: ChatTarget{Kind: ChatKindWebhook, URL: "https://hooks.example.com/services/x"},
+			valid:  true,
+		},
+		{name: "webhook http", target: ChatTarget{Kind: ChatKindWebhook, URL: "http://hooks.example.com/x"}},
+		{name: "webhook other host", target: ChatTarget{Kind: ChatKindWebhook, URL: "https://localhost/x"}},
+		{name: "unknown kind", target: ChatTarget{Kind: "irc", Room: "#ops:example.com"}},
+		{
+			name:    "webhook without allowed hosts",
+			target:  ChatTarget{Kind: ChatKindWebhook, URL: "https://hooks.example.com/services/x"},
+			anyHost: true,
+			valid:   true,
+		},
+		{
+			name:    "webhook loopback without allowed hosts",
+			target:  ChatTarget{Kind: ChatKindWebhook, URL: "https://127.0.0.1/x"},
+			anyHost: true,
+		},
+		{
+			name:    "webhook link-local without allowed hosts",
+			target:  ChatTarget{Kind: ChatKindWebhook, URL: "https://169.254.169.254/x"},
+			anyHost: true,
+		},
+	}
+	anyHostConf := conf
+	anyHostConf.Webhook.AllowedHosts = nil
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				c := conf
+				if test.anyHost {
+					c = anyHostConf
+				}
+				err := test.target.Validate(c)
+				if test.valid && err != nil {
+					t.Errorf("Expected target to be valid, but got: %s", err)
+				}
+				if !test.valid && err == nil {
+					t.Error("Expected target to be invalid")
+				}
+			},
+		)
+	}
+}
+
+func TestChatTarget_Masked(t *testing.T) {
+	target := ChatTarget{Kind: ChatKindWebhook, URL: "https://hooks.example.com/services/secret"}
+	expected := "https://hooks.example.com/***"
+	if got := target.Masked().URL; got != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, got)
+	}
+}
+
+func TestChatTarget_Encrypted(t *testing.T) {
+	key := "01234567890123456789012345678901"
+	target := ChatTarget{Kind: ChatKindWebhook, URL: "https://hooks.example.com/services/secret"}
+	encrypted, err := target.Encrypted(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted.URL, "secret") {
+		t.Errorf("Expected url to be encrypted, but got '%s'", encrypted.URL)
+	}
+	decrypted, err := encrypted.Decrypted(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != target {
+		t.Errorf("Expected '%+v', but got '%+v'", target, decrypted)
+	}
+	if _, err = encrypted.Decrypted("another key that is long enough!"); err == nil {
+		t.Error("Expected decryption with another key to fail")
+	}
+	room := ChatTarget{Kind: ChatKindMatrix, Room: "#ops:example.com"}
+	if encryptedRoom, err := room.Encrypted(key); err != nil || encryptedRoom != room {
+		t.Errorf("Expected matrix target to be unchanged, but got '%+v': %v", encryptedRoom, err)
+	}
+}
+
+func TestChatTarget_Verify(t *testing.T) {
+	room := ChatTarget{
+		Kind:     ChatKindMatrix,
+		Room:     "#ops:example.com",
+		Verified: true,
+	}
+	room.PrepareVerification()
+	if room.Verified || room.VerificationCode == "" || room.Deliverable() {
+		t.Fatalf("Expected a user-set room to be unverified with a verification code, but got '%+v'", room)
+	}
+	if masked := room.Masked(); masked.VerificationCode != "" {
+		t.Errorf("Expected the verification code to be masked, but got '%s'", masked.VerificationCode)
+	}
+	code := room.VerificationCode
+	if room.Verify("wrong") || room.Verify("") || room.Deliverable() {
+		t.Error("Expected verification with a wrong code to fail")
+	}
+	if !room.Verify(code) || !room.Deliverable() || room.VerificationCode != "" {
+		t.Errorf("Expected verification with the posted code to succeed, but got '%+v'", room)
+	}
+	if room.Verify(code) {
+		t.Error("Expected a used verification code to be invalid")
+	}
+
+	webhook := ChatTarget{Kind: ChatKindWebhook, URL: "https://hooks.example.com/services/secret"}
+	webhook.PrepareVerification()
+	if webhook.VerificationCode != "" || !webhook.Deliverable() {
+		t.Errorf("Expected a webhook to be usable without verification, but got '%+v'", webhook)
+	}
+}
@@ -15,4 +15,5 @@ type EmailNotificationRequest struct {
 	ICSInvite   bool                 `json:"ics_invite,omitempty"`
 	Attachments []mailing.Attachment `json:"attachments,omitempty"`
 	ScheduleID  string               `json:"schedule_id,omitempty"`
+	Language    string               `json:"language,omitempty"`
 }
@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"crypto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/notifier/pkg"
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+)
+
+// AuthConf holds the configuration for authenticating requests from the mytoken server
+type AuthConf struct {
+	Issuer        string `yaml:"issuer"`
+	URL           string `yaml:"url"`
+	PublicKeyFile string `yaml:"public_key_file"`
+}
+
+type authenticator struct {
+	issuer    string
+	audience  string
+	publicKey crypto.PublicKey
+}
+
+var auth *authenticator
+
+func initAuth(conf AuthConf) error {
+	if conf.Issuer == "" || conf.URL == "" || conf.PublicKeyFile == "" {
+		return errors.New("mytoken_server.issuer, mytoken_server.url, and mytoken_server.public_key_file must be set")
+	}
+	data, err := os.ReadFile(conf.PublicKeyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var pk crypto.PublicKey
+	pk, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		pk, err = jwt.ParseECPublicKeyFromPEM(data)
+		if err != nil {
+			return errors.New("could not parse mytoken server public key; must be a pem encoded RSA or EC key")
+		}
+	}
+	auth = &authenticator{
+		issuer:    conf.Issuer,
+		audience:  conf.URL,
+		publicKey: pk,
+	}
+	return nil
+}
+
+func (a *authenticator) keyFunc(t *jwt.Token) (interface{}, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		return a.publicKey, nil
+	default:
+		return nil, errors.Errorf("unexpected signing method '%s'", t.Method.Alg())
+	}
+}
+
+// verify verifies that a request was sent by the mytoken server, i.e. that the request carries a valid jwt signed by
+// the mytoken server that is bound to this request's body and was not used before
+func (a *authenticator) verify(authHeader string, body []byte) error {
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" || token == authHeader {
+		return errors.New("no bearer token")
+	}
+	claims := &pkg.RequestClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, a.keyFunc); err != nil {
+		return errors.WithStack(err)
+	}
+	if !claims.VerifyIssuer(a.issuer, true) {
+		return errors.New("invalid issuer")
+	}
+	if !claims.VerifyAudience(a.audience, true) {
+		return errors.New("invalid audience")
+	}
+	if claims.IssuedAt == 0 || claims.ExpiresAt == 0 ||
+		time.Unix(claims.ExpiresAt, 0).Sub(time.Unix(claims.IssuedAt, 0)) > pkg.RequestTokenLifetime {
+		return errors.New("invalid token lifetime")
+	}
+	if claims.BodyHash != hashutils.SHA512Str(body) {
+		return errors.New("body hash does not match")
+	}
+	if claims.Id == "" {
+		return errors.New("no jti")
+	}
+	if found, err := cache.Get(cache.NotifierRequestIDs, claims.Id, &struct{}{}); err != nil {
+		return err
+	} else if found {
+		return errors.New("token replayed")
+	}
+	return cache.Set(
+		cache.NotifierRequestIDs, claims.Id, struct{}{}, time.Until(time.Unix(claims.ExpiresAt, 0))+time.Minute,
+	)
+}
+
+func authenticate(ctx *fiber.Ctx) error {
+	if err := auth.verify(ctx.Get(fiber.HeaderAuthorization), ctx.Body()); err != nil {
+		log.WithError(err).Warn("rejected unauthenticated notifier request")
+		return fiber.NewError(fiber.StatusUnauthorized, "request could not be authenticated")
+	}
+	return ctx.Next()
+}
@@ -0,0 +1,206 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/oidc-mytoken/utils/httpclient"
+	utils2 "github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/notifier/pkg"
+	"github.com/oidc-mytoken/server/internal/notifier/server/mailing/mailtemplates"
+	"github.com/oidc-mytoken/server/internal/utils/webhookclient"
+)
+
+var chatConf config.ChatNotificationConf
+
+func initChat(conf config.ChatNotificationConf) {
+	chatConf = conf
+	if conf.Enabled {
+		mailtemplates.Init()
+	}
+}
+
+// HandleChatRequest handles a pkg.ChatNotificationRequest
+func HandleChatRequest(req pkg.ChatNotificationRequest) error {
+	log.WithField("kind", req.Target.Kind).WithField("template", req.Template).Info("Handling chat request")
+	return deduplicated(
+		req.ScheduleID, func() error {
+			if err := req.Target.Validate(chatConf); err != nil {
+				return err
+			}
+			text, err := mailtemplates.Chat(req.Template, req.Language, req.BindingData)
+			if err != nil {
+				return err
+			}
+			switch req.Target.Kind {
+			case pkg.ChatKindMatrix:
+				txnID := req.ScheduleID
+				if txnID == "" {
+					txnID = utils2.RandASCIIString(32)
+				}
+				err = postToMatrix(req.Target.Room, text, txnID)
+			case pkg.ChatKindWebhook:
+				err = postToWebhook(req.Target.URL, text)
+			}
+			if err != nil {
+				log.WithError(err).Error("error while posting chat message")
+			}
+			return err
+		},
+	)
+}
+
+// matrixRoomID resolves a room alias to the room id; room ids are returned unchanged
+func matrixRoomID(room string) (string, error) {
+	if !strings.HasPrefix(room, "#") {
+		return room, nil
+	}
+	var resolved struct {
+		RoomID string `json:"room_id"`
+	}
+	res, err := httpclient.Do().R().
+		SetAuthToken(chatConf.Matrix.AccessToken).
+		SetResult(&resolved).
+		Get(
+			utils2.CombineURLPath(
+				chatConf.Matrix.Homeserver, "/_matrix/client/v3/directory/room", url.PathEscape(room),
+			),
+		)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if res.IsError() || resolved.RoomID == "" {
+		return "", errors.Errorf("could not resolve matrix room alias: status %d: %s", res.StatusCode(), res.String())
+	}
+	return resolved.RoomID, nil
+}
+
+// matrixMembership returns if the bot has joined the room with the passed id or has a pending invite for it
+func matrixMembership(roomID string) (joined, invited bool, err error) {
+	var joinedRooms struct {
+		JoinedRooms []string `json:"joined_rooms"`
+	}
+	res, err := httpclient.Do().R().
+		SetAuthToken(chatConf.Matrix.AccessToken).
+		SetResult(&joinedRooms).
+		Get(utils2.CombineURLPath(chatConf.Matrix.Homeserver, "/_matrix/client/v3/joined_rooms"))
+	if err != nil {
+		return false, false, errors.WithStack(err)
+	}
+	if res.IsError() {
+		return false, false, errors.Errorf(
+			"could not get joined matrix rooms: status %d: %s", res.StatusCode(), res.String(),
+		)
+	}
+	if utils2.StringInSlice(roomID, joinedRooms.JoinedRooms) {
+		return true, false, nil
+	}
+	// Pending invites are only available through sync; the filter limits the response to the room's invite state
+	filter, err := json.Marshal(
+		map[string]any{
+			"account_data": map[string]any{"not_types": []string{"*"}},
+			"presence":     map[string]any{"not_types": []string{"*"}},
+			"room": map[string]any{
+				"rooms":        []string{roomID},
+				"account_data": map[string]any{"not_types": []string{"*"}},
+				"ephemeral":    map[string]any{"not_types": []string{"*"}},
+				"state":        map[string]any{"not_types": []string{"*"}},
+				"timeline":     map[string]any{"limit": 0},
+			},
+		},
+	)
+	if err != nil {
+		return false, false, errors.WithStack(err)
+	}
+	var sync struct {
+		Rooms struct {
+			Invite map[string]json.RawMessage `json:"invite"`
+		} `json:"rooms"`
+	}
+	res, err = httpclient.Do().R().
+		SetAuthToken(chatConf.Matrix.AccessToken).
+		SetQueryParam("filter", string(filter)).
+		SetQueryParam("timeout", "0").
+		SetResult(&sync).
+		Get(utils2.CombineURLPath(chatConf.Matrix.Homeserver, "/_matrix/client/v3/sync"))
+	if err != nil {
+		return false, false, errors.WithStack(err)
+	}
+	if res.IsError() {
+		return false, false, errors.Errorf(
+			"could not get matrix invites: status %d: %s", res.StatusCode(), res.String(),
+		)
+	}
+	_, invited = sync.Rooms.Invite[roomID]
+	return false, invited, nil
+}
+
+// postToMatrix posts text to a matrix room. The bot only posts to rooms it was invited to, so it cannot be used to
+// spam arbitrary public rooms; a pending invite is accepted by joining the room. The txnID makes retries idempotent.
+func postToMatrix(room, text, txnID string) error {
+	roomID, err := matrixRoomID(room)
+	if err != nil {
+		return err
+	}
+	joined, invited, err := matrixMembership(roomID)
+	if err != nil {
+		return err
+	}
+	if !joined {
+		if !invited {
+			return errors.Errorf("the bot was not invited to matrix room '%s'", room)
+		}
+		res, err := httpclient.Do().R().
+			SetAuthToken(chatConf.Matrix.AccessToken).
+			SetBody(map[string]any{}).
+			Post(utils2.CombineURLPath(chatConf.Matrix.Homeserver, "/_matrix/client/v3/join", url.PathEscape(roomID)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if res.IsError() {
+			return errors.Errorf("could not join matrix room: status %d: %s", res.StatusCode(), res.String())
+		}
+	}
+	res, err := httpclient.Do().R().
+		SetAuthToken(chatConf.Matrix.AccessToken).
+		SetBody(
+			map[string]string{
+				"msgtype": "m.notice",
+				"body":    text,
+			},
+		).
+		Put(
+			utils2.CombineURLPath(
+				chatConf.Matrix.Homeserver, "/_matrix/client/v3/rooms", url.PathEscape(roomID),
+				"send/m.room.message", url.PathEscape(txnID),
+			),
+		)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if res.IsError() {
+		return errors.Errorf("could not send matrix message: status %d: %s", res.StatusCode(), res.String())
+	}
+	return nil
+}
+
+// postToWebhook posts text to a Slack-compatible incoming webhook; Mattermost and others accept the same payload.
+// Webhook urls are user supplied, so they are never posted to internal addresses.
+func postToWebhook(webhookURL, text string) error {
+	res, err := webhookclient.Do().R().
+		SetBody(map[string]string{"text": text}).
+		Post(webhookURL)
+	if err != nil {
+		// The error contains the url, which is a secret
+		return errors.New("could not reach webhook")
+	}
+	if res.IsError() {
+		return errors.Errorf("webhook responded with status %d", res.StatusCode())
+	}
+	return nil
+}
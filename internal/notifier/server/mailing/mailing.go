@@ -142,7 +142,7 @@ type MailSender interface {
 
 // TemplateMailSender is an interface for types that can send template mails
 type TemplateMailSender interface {
-	SendTemplate(to, subject, template string, binding any) error
+	SendTemplate(to, subject, template, lang string, binding any) error
 	MailSender
 }
 
@@ -166,7 +166,7 @@ func (noopSender) Send(_, _, _ string, _ ...Attachment) error {
 }
 
 // SendTemplate implements the TemplateMailSender interface
-func (noopSender) SendTemplate(_, _, _ string, _ any) error {
+func (noopSender) SendTemplate(_, _, _, _ string, _ any) error {
 	return nil
 }
 
@@ -188,8 +188,8 @@ func (plainTextMailSender) Send(to, subject, text string, attachments ...Attachm
 }
 
 // SendTemplate implements the TemplateMailSender interface
-func (s plainTextMailSender) SendTemplate(to, subject, template string, binding any) error {
-	text, err := mailtemplates.Text(template, binding)
+func (s plainTextMailSender) SendTemplate(to, subject, template, lang string, binding any) error {
+	text, err := mailtemplates.Text(template, lang, binding)
 	if err != nil {
 		return err
 	}
@@ -214,8 +214,8 @@ func (htmlMailSender) Send(to, subject, text string, attachments ...Attachment)
 }
 
 // SendTemplate implements the TemplateMailSender interface
-func (s htmlMailSender) SendTemplate(to, subject, template string, binding any) error {
-	text, err := mailtemplates.HTML(template, binding)
+func (s htmlMailSender) SendTemplate(to, subject, template, lang string, binding any) error {
+	text, err := mailtemplates.HTML(template, lang, binding)
 	if err != nil {
 		return err
 	}
@@ -5,6 +5,9 @@ import (
 	"embed"
 	"io/fs"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/gofiber/template/mustache/v2"
 	"github.com/pkg/errors"
@@ -14,14 +17,16 @@ import (
 	"github.com/oidc-mytoken/server/internal/utils/fileio"
 )
 
-// Subjects
+// Message keys of the subjects
 const (
-	SubjectVerifyMail = "mytoken notifications - Verify email"
+	SubjectVerifyMail         = "mail.subject.verify_mail"
+	SubjectSuspiciousActivity = "mail.subject.suspicious_activity"
 )
 
 // TemplateNames
 const (
-	TemplateVerifyMail = "verify_mail"
+	TemplateVerifyMail         = "verify_mail"
+	TemplateSuspiciousActivity = "suspicious_activity"
 )
 
 //go:embed templates
@@ -29,6 +34,10 @@ var _templates embed.FS
 var templates fs.FS
 
 var engine *mustache.Engine
+var initOnce sync.Once
+
+// overwritten holds the names of the templates that are overwritten in the overwrite dir
+var overwritten map[string]bool
 
 func init() {
 	var err error
@@ -38,32 +47,78 @@ func init() {
 	}
 }
 
-// Init initializes the mail templates
+// Init initializes the mail templates; the templates are only loaded once, so it can be called by all users of
+// the templates
 func Init() {
-	overWriteDir := config.Get().Features.Notifications.Mail.OverwriteDir
-	engine = mustache.NewFileSystem(
-		fileio.NewLocalAndOtherSearcherFilesystem(overWriteDir, http.FS(templates)),
-		".mustache",
+	initOnce.Do(
+		func() {
+			overWriteDir := config.Get().Features.Notifications.Mail.OverwriteDir
+			engine = mustache.NewFileSystem(
+				fileio.NewLocalAndOtherSearcherFilesystem(overWriteDir, http.FS(templates)),
+				".mustache",
+			)
+			if err := engine.Load(); err != nil {
+				log.WithError(err).Fatal()
+			}
+			overwritten = overwrittenTemplates(overWriteDir)
+		},
 	)
-	if err := engine.Load(); err != nil {
-		log.WithError(err).Fatal()
+}
+
+// overwrittenTemplates returns the names of the templates that are present in the passed overwrite dir
+func overwrittenTemplates(dir string) map[string]bool {
+	names := make(map[string]bool)
+	if dir == "" {
+		return names
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.WithError(err).Warn("could not read mail templates overwrite dir")
+		return names
+	}
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".mustache"); ok && !e.IsDir() {
+			names[name] = true
+		}
 	}
+	return names
 }
 
-func render(name, suffix string, bindData any) (string, error) {
+// templateName returns the name of the template to render; if a localized variant of the template for the passed
+// language exists, e.g. 'verify_mail.de.html', it is used instead, unless the base template is overwritten and the
+// localized one is not, so an included translation does not shadow a customized template
+func templateName(name, lang, suffix string) string {
+	template := name + suffix
+	if lang == "" {
+		return template
+	}
+	localized := name + "." + lang + suffix
+	if engine.Templates[localized] == nil || (overwritten[template] && !overwritten[localized]) {
+		return template
+	}
+	return localized
+}
+
+// render renders the template with the passed name and suffix in the passed language
+func render(name, lang, suffix string, bindData any) (string, error) {
 	var buf bytes.Buffer
-	if err := engine.Render(&buf, name+suffix, bindData); err != nil {
+	if err := engine.Render(&buf, templateName(name, lang, suffix), bindData); err != nil {
 		return "", errors.WithStack(err)
 	}
 	return buf.String(), nil
 }
 
-// HTML renders a html-suffix file
-func HTML(name string, bindData any) (string, error) {
-	return render(name, ".html", bindData)
+// HTML renders a html-suffix file in the passed language
+func HTML(name, lang string, bindData any) (string, error) {
+	return render(name, lang, ".html", bindData)
+}
+
+// Text renders a txt-suffix file in the passed language
+func Text(name, lang string, bindData any) (string, error) {
+	return render(name, lang, ".txt", bindData)
 }
 
-// Text renders a txt-suffix file
-func Text(name string, bindData any) (string, error) {
-	return render(name, ".txt", bindData)
+// Chat renders a chat-suffix file in the passed language
+func Chat(name, lang string, bindData any) (string, error) {
+	return render(name, lang, ".chat", bindData)
 }
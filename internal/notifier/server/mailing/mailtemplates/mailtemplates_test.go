@@ -0,0 +1,88 @@
+package mailtemplates
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/template/mustache/v2"
+
+	"github.com/oidc-mytoken/server/internal/utils/fileio"
+)
+
+func TestTemplateName(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"verify_mail.html.mustache",
+		"notification.html.mustache",
+		"notification.de.html.mustache",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("custom"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine = mustache.NewFileSystem(fileio.NewLocalAndOtherSearcherFilesystem(dir, http.FS(templates)), ".mustache")
+	if err := engine.Load(); err != nil {
+		t.Fatal(err)
+	}
+	overwritten = overwrittenTemplates(dir)
+	t.Cleanup(
+		func() {
+			engine = nil
+			overwritten = nil
+		},
+	)
+
+	tests := []struct {
+		name     string
+		template string
+		lang     string
+		expected string
+	}{
+		{
+			name:     "no language",
+			template: "verify_mail",
+			expected: "verify_mail.html",
+		},
+		{
+			name:     "included translation",
+			template: "suspicious_activity",
+			lang:     "de",
+			expected: "suspicious_activity.de.html",
+		},
+		{
+			name:     "unknown language",
+			template: "suspicious_activity",
+			lang:     "es",
+			expected: "suspicious_activity.html",
+		},
+		{
+			name:     "overwritten base template",
+			template: "verify_mail",
+			lang:     "de",
+			expected: "verify_mail.html",
+		},
+		{
+			name:     "overwritten base and localized template",
+			template: "notification",
+			lang:     "de",
+			expected: "notification.de.html",
+		},
+		{
+			name:     "overwritten base template and included translation for other language",
+			template: "notification",
+			lang:     "fr",
+			expected: "notification.html",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := templateName(test.template, test.lang, ".html"); got != test.expected {
+					t.Errorf("expected '%s', but got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
@@ -17,11 +17,13 @@ import (
 // ServerPaths holds the server paths
 var ServerPaths = Paths{
 	Email: "/email",
+	Chat:  "/chat",
 }
 
 // Paths holds the server paths
 type Paths struct {
 	Email string
+	Chat  string
 }
 
 // Prefix prefixes all values in Paths with the specified prefix by url-combining them
@@ -40,63 +42,71 @@ func (p Paths) Prefix(prefix string) (out Paths) {
 	return
 }
 
-// InitStandalone initializes a standalone notifier server
-func InitStandalone(mailConf config.MailNotificationConf) {
-	initCommon(mailConf)
+// InitStandalone initializes a standalone notifier server; only requests authenticated as described by the passed
+// AuthConf are accepted
+func InitStandalone(mailConf config.MailNotificationConf, chatConf config.ChatNotificationConf, authConf AuthConf) {
+	if err := initAuth(authConf); err != nil {
+		log.WithError(err).Fatal("could not initialize authentication of mytoken server requests")
+	}
+	initCommon(mailConf, chatConf)
 	cache.SetCache(cache.NewInternalCache(3 * time.Minute))
 	startServer()
 }
 
 // InitIntegrated initializes the integrated notifier "server"
 func InitIntegrated() {
-	initCommon(config.Get().Features.Notifications.Mail)
+	initCommon(config.Get().Features.Notifications.Mail, config.Get().Features.Notifications.Chat)
 }
 
-func initCommon(mailConf config.MailNotificationConf) {
+func initCommon(mailConf config.MailNotificationConf, chatConf config.ChatNotificationConf) {
 	mailing.Init(mailConf)
+	initChat(chatConf)
 	// TODO at this place we would spin up ws
 }
 
 // HandleEmailRequest handles a pkg.EmailNotificationRequest
 func HandleEmailRequest(req pkg.EmailNotificationRequest) error {
 	log.WithField("req", req).Info("Handling email request")
-	sID := req.ScheduleID
-	returnError := func(err error) error {
-		return err
+	return deduplicated(req.ScheduleID, func() error { return sendEmail(req) })
+}
+
+// deduplicated calls send unless a request with the same schedule id was already handled successfully; this way a
+// notification is not sent twice if only the acknowledgement got lost
+func deduplicated(sID string, send func() error) error {
+	if sID == "" {
+		return send()
 	}
-	if sID != "" {
-		if found, err := cache.Get(cache.ScheduledNotifications, sID, &struct{}{}); err == nil && found {
-			return nil
-		} else {
-			returnError = func(err error) error {
-				if err == nil {
-					return cache.Set(cache.ScheduledNotifications, sID, struct{}{})
-				}
-				return err
-			}
-		}
+	if found, err := cache.Get(cache.ScheduledNotifications, sID, &struct{}{}); err == nil && found {
+		return nil
 	}
+	if err := send(); err != nil {
+		return err
+	}
+	return cache.Set(cache.ScheduledNotifications, sID, struct{}{})
+}
+
+func sendEmail(req pkg.EmailNotificationRequest) error {
 	if req.ICSInvite {
 		if err := mailing.ICSMailSender.Send(req.To, req.Subject, req.Text, req.Attachments...); err != nil {
 			log.WithError(err).Error("error while sending ics mail invite")
-			return returnError(err)
+			return err
 		}
-		return returnError(nil)
+		return nil
 	}
 	sender := mailing.PlainTextMailSender
 	if req.PreferHTML {
 		sender = mailing.HTMLMailSender
 	}
 	if req.Template != "" {
-		if err := sender.SendTemplate(req.To, req.Subject, req.Template, req.BindingData); err != nil {
+		if err := sender.SendTemplate(req.To, req.Subject, req.Template, req.Language, req.BindingData); err != nil {
 			log.WithError(err).Error("error while sending templated mail")
-			return returnError(err)
+			return err
 		}
-		return returnError(nil)
+		return nil
 	}
 	if err := sender.Send(req.To, req.Subject, req.Text, req.Attachments...); err != nil {
 		log.WithError(err).Error("error while sending mail")
-		return returnError(err)
+		return err
 	}
-	return returnError(nil)
+	return nil
 }
@@ -26,6 +26,7 @@ func startServer() {
 	server.Use(recover.New())
 	server.Use(helmet.New())
 	server.Use(requestid.New())
+	server.Use(authenticate)
 
 	server.Post(
 		ServerPaths.Email, func(ctx *fiber.Ctx) error {
@@ -39,5 +40,17 @@ func startServer() {
 			return ctx.Status(fiber.StatusNoContent).Send(nil)
 		},
 	)
+	server.Post(
+		ServerPaths.Chat, func(ctx *fiber.Ctx) error {
+			var req pkg.ChatNotificationRequest
+			if err := ctx.BodyParser(&req); err != nil {
+				return err
+			}
+			if err := HandleChatRequest(req); err != nil {
+				return err
+			}
+			return ctx.Status(fiber.StatusNoContent).Send(nil)
+		},
+	)
 	log.WithError(server.Listen(":40111")).Fatal()
 }
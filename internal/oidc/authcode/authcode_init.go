@@ -13,6 +13,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/clientregistry"
 	response "github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
@@ -33,7 +34,10 @@ func GetAuthorizationURL(
 	pkceCode := pkce.NewS256PKCE(utils.RandASCIIString(44))
 	if err := db.RunWithinTransaction(
 		rlog, tx, func(tx *sqlx.Tx) error {
-			return authcodeinforepo.SetCodeVerifier(rlog, tx, oState, pkceCode.Verifier())
+			if err := authcodeinforepo.SetCodeVerifier(rlog, tx, oState, pkceCode.Verifier()); err != nil {
+				return err
+			}
+			return authcodeinforepo.SetClientID(rlog, tx, oState, provider.ClientID())
 		},
 	); err != nil {
 		return "", err
@@ -69,7 +73,9 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, req *response.AuthCodeFlowRequest) *model
 	}
 	req.Restrictions.ReplaceThisIP(ctx.IP())
 	req.Restrictions.ClearUnsupportedKeys()
-	p := provider2.GetProvider(req.Issuer)
+	p := provider2.GetProviderForRequest(
+		req.Issuer, req.Restrictions.GetScopes(), req.Restrictions.GetAudiences(), req.Profiles,
+	)
 	if p == nil {
 		return &model.Response{
 			Status:   fiber.StatusBadRequest,
@@ -82,6 +88,11 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, req *response.AuthCodeFlowRequest) *model
 		return model.BadRequestErrorResponse("token would already be expired")
 	}
 
+	client, errRes := clientregistry.VerifyAttestation(rlog, ctx)
+	if errRes != nil {
+		return errRes
+	}
+
 	oState, consentCode := state.CreateState()
 	authFlowInfo := authcodeinforepo.AuthFlowInfo{
 		AuthFlowInfoOut: authcodeinforepo.AuthFlowInfoOut{
@@ -89,6 +100,9 @@ func StartAuthCodeFlow(ctx *fiber.Ctx, req *response.AuthCodeFlowRequest) *model
 			AuthCodeFlowRequest: *req,
 		},
 	}
+	if client != nil {
+		authFlowInfo.RegisteredClient = client.ClientID
+	}
 	res := api.AuthCodeFlowResponse{
 		ConsentURI: utils.CombineURLPath(routes.ConsentEndpoint, consentCode.String()),
 	}
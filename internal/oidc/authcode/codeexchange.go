@@ -16,21 +16,27 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/accesstokenrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/authcodeinforepo/state"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/transfercoderepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/refreshtokenrepo"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/userrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/webauthnrepo"
 	"github.com/oidc-mytoken/server/internal/db/notificationsrepo"
 	"github.com/oidc-mytoken/server/internal/db/profilerepo"
+	"github.com/oidc-mytoken/server/internal/endpoints/webentities"
 	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
 	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/mytoken/restrictions"
 	"github.com/oidc-mytoken/server/internal/oidc/oidcreqres"
 	provider2 "github.com/oidc-mytoken/server/internal/oidc/provider"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 	"github.com/oidc-mytoken/server/internal/oidc/userinfo"
 	"github.com/oidc-mytoken/server/internal/server/httpstatus"
 	"github.com/oidc-mytoken/server/internal/server/routes"
@@ -48,7 +54,7 @@ func CodeExchange(
 	if errRes != nil {
 		return errRes, ""
 	}
-	p, errRes := fetchProvider(authInfo.Issuer)
+	p, errRes := fetchProvider(authInfo.Issuer, authInfo.ClientID)
 	if errRes != nil {
 		return errRes, ""
 	}
@@ -73,8 +79,12 @@ func CodeExchange(
 		}
 		return errRes, additionlErrHTML
 	}
+	authContext, errRes := requireStepUp(rlog, authInfo, iutils.GetStringFromAnyMap(userInfos, "sub"))
+	if errRes != nil {
+		return errRes, ""
+	}
 	ste, restrictionsWhereOK, errRes := storeTokenInDatabase(
-		rlog, oState, authInfo, enforcedRestrictions, oidcTokenRes, userInfos, networkData,
+		rlog, oState, authInfo, enforcedRestrictions, oidcTokenRes, userInfos, networkData, authContext,
 	)
 	if errRes != nil {
 		return errRes, ""
@@ -101,8 +111,8 @@ func fetchAuthInfo(rlog log.Ext1FieldLogger, oState *state.State) (*authcodeinfo
 	return nil, model.ErrorToInternalServerErrorResponse(err)
 }
 
-func fetchProvider(issuer string) (model.Provider, *model.Response) {
-	p := provider2.GetProvider(issuer)
+func fetchProvider(issuer, clientID string) (model.Provider, *model.Response) {
+	p := provider2.GetProviderWithClient(issuer, clientID)
 	if p == nil {
 		return nil, &model.Response{
 			Status:   fiber.StatusBadRequest,
@@ -123,11 +133,18 @@ func exchangeCodeForToken(
 	params.Set("redirect_uri", routes.RedirectURI)
 	params.Set("client_id", p.ClientID())
 
+	if !providerhealth.Allow(p.Issuer()) {
+		return nil, &model.Response{
+			Status:   fiber.StatusServiceUnavailable,
+			Response: model.OIDCError("temporarily_unavailable", "the OpenID provider is currently unavailable"),
+		}
+	}
 	httpRes, err := p.AddClientAuthentication(httpclient.Do().R(), p.Endpoints().Token).
 		SetFormDataFromValues(params).
 		SetResult(&oidcreqres.OIDCTokenResponse{}).
 		SetError(&oidcreqres.OIDCErrorResponse{}).
 		Post(p.Endpoints().Token)
+	providerhealth.RecordTokenRequest(p.Issuer(), providerhealth.IsUpstreamFailure(httpRes, err))
 	if err != nil {
 		rlog.Errorf("%s", errorfmt.Full(err))
 		return nil, model.ErrorToInternalServerErrorResponse(err)
@@ -181,6 +198,9 @@ func fetchUserInfos(rlog log.Ext1FieldLogger, p model.Provider, oidcTokenRes *oi
 		"email",
 		"email_verified",
 	}
+	if quotasConf := provider2.GetQuotasByIssuer(p.Issuer()); quotasConf.EntitlementsClaim != "" {
+		attrs = append(attrs, quotasConf.EntitlementsClaim)
+	}
 	enforcedRestrictionsConf := provider2.GetEnforcedRestrictionsByIssuer(p.Issuer())
 	if enforcedRestrictionsConf.Enabled {
 		for endpoint, claimName := range enforcedRestrictionsConf.ClaimSources {
@@ -202,19 +222,50 @@ func fetchUserInfos(rlog log.Ext1FieldLogger, p model.Provider, oidcTokenRes *oi
 	return userInfos, nil
 }
 
+// requireStepUp checks that a WebAuthn step-up was done on the consent screen if capabilities with the highest danger
+// level are requested by a user that registered a passkey; the returned auth context is recorded in the creation event
+func requireStepUp(rlog log.Ext1FieldLogger, authInfo *authcodeinforepo.AuthFlowInfoOut, oidcSub string) (
+	string, *model.Response,
+) {
+	if !config.Get().Features.WebInterface.WebAuthn.Enabled ||
+		!webentities.HasHighDangerCapability(authInfo.Capabilities.Capabilities) {
+		return "", nil
+	}
+	info, err := webauthnrepo.GetUserCredentialsInfo(rlog, nil, oidcSub, authInfo.Issuer)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return "", model.ErrorToInternalServerErrorResponse(err)
+	}
+	if info.Credentials == 0 {
+		return "", nil
+	}
+	if authInfo.StepUpUID != info.UserID {
+		return "", &model.Response{
+			Status: fiber.StatusForbidden,
+			Response: model.StepUpRequiredError(
+				"The requested capabilities must be confirmed with one of your passkeys on the consent screen",
+			),
+		}
+	}
+	return pkg.AuthContextWebAuthn, nil
+}
+
 func storeTokenInDatabase(
 	rlog log.Ext1FieldLogger, oState *state.State, authInfo *authcodeinforepo.AuthFlowInfoOut,
 	enforcedRestrictions string, oidcTokenRes *oidcreqres.OIDCTokenResponse, userInfos map[string]any,
-	networkData api.ClientMetaData,
+	networkData api.ClientMetaData, authContext string,
 ) (*mytokenrepo.MytokenEntry, bool, *model.Response) {
 	var ste *mytokenrepo.MytokenEntry
 	var restrictionsWhereOK bool
 	err := db.Transact(
 		rlog, func(tx *sqlx.Tx) error {
 			var err error
+			if err = storeUserEntitlements(rlog, tx, authInfo.Issuer, userInfos); err != nil {
+				return err
+			}
 			ste, restrictionsWhereOK, err = createMytokenEntry(
 				rlog, tx, authInfo, enforcedRestrictions, oidcTokenRes.RefreshToken,
-				iutils.GetStringFromAnyMap(userInfos, "sub"), networkData,
+				iutils.GetStringFromAnyMap(userInfos, "sub"), networkData, authContext,
 			)
 			if err != nil {
 				return err
@@ -237,6 +288,9 @@ func storeTokenInDatabase(
 		},
 	)
 	if err != nil {
+		if errRes, ok := mytokenrepo.QuotaExceededErrorResponse(err); ok {
+			return nil, restrictionsWhereOK, errRes
+		}
 		rlog.Errorf("%s", errorfmt.Full(err))
 		return nil, restrictionsWhereOK, model.ErrorToInternalServerErrorResponse(err)
 	}
@@ -273,6 +327,13 @@ func updateUserMailInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mytokenID mtid.MT
 	if _, err = db.ParseError(err); err != nil {
 		return err
 	}
+	// If the user did not choose a language, the language from the OP is used
+	locale := iutils.GetStringFromAnyMap(userInfos, "locale")
+	if !mailInfo.Language.Valid && locale != "" && len(locale) <= 16 {
+		if err = userrepo.SetLanguage(rlog, tx, mytokenID, locale); err != nil {
+			return err
+		}
+	}
 	if mailInfo.Mail.Valid {
 		return nil
 	}
@@ -282,6 +343,23 @@ func updateUserMailInfo(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mytokenID mtid.MT
 	return userrepo.SetEmail(rlog, tx, mytokenID, mail, mailVerified)
 }
 
+func storeRTClient(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mytokenID mtid.MTID, clientID string) error {
+	rtID, err := refreshtokenrepo.GetRTID(rlog, tx, mytokenID)
+	if err != nil {
+		return err
+	}
+	return refreshtokenrepo.SetClientID(rlog, tx, rtID, clientID)
+}
+
+func storeUserEntitlements(rlog log.Ext1FieldLogger, tx *sqlx.Tx, issuer string, userInfos map[string]any) error {
+	claim := provider2.GetQuotasByIssuer(issuer).EntitlementsClaim
+	if claim == "" {
+		return nil
+	}
+	entitlements := iutils.GetStringSliceFromAnyMap(userInfos, claim)
+	return userrepo.SetEntitlements(rlog, tx, iutils.GetStringFromAnyMap(userInfos, "sub"), issuer, entitlements)
+}
+
 func generateResponse(
 	rlog log.Ext1FieldLogger, authInfo *authcodeinforepo.AuthFlowInfoOut, ste *mytokenrepo.MytokenEntry,
 	networkData api.ClientMetaData,
@@ -316,7 +394,7 @@ func generateResponse(
 
 func createMytokenEntry(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, authFlowInfo *authcodeinforepo.AuthFlowInfoOut,
-	enforcedRestrictionsTemplate, rt, oidcSub string, networkData api.ClientMetaData,
+	enforcedRestrictionsTemplate, rt, oidcSub string, networkData api.ClientMetaData, authContext string,
 ) (*mytokenrepo.MytokenEntry, bool, error) {
 	var rot *api.Rotation
 	if authFlowInfo.Rotation != nil {
@@ -344,14 +422,21 @@ func createMytokenEntry(
 	if err != nil {
 		return nil, restrictionsWhereOK, err
 	}
+	mt.SubtokenLimits = authFlowInfo.SubtokenLimits
 	mte := mytokenrepo.NewMytokenEntry(mt, authFlowInfo.Name, networkData)
 	mte.Token.AuthTime = unixtime.Now()
+	mte.AuthContext = authContext
 	if err = mte.InitRefreshToken(rt); err != nil {
 		return nil, restrictionsWhereOK, err
 	}
 	if err = mte.Store(rlog, tx, "Used grant_type oidc_flow authorization_code"); err != nil {
 		return nil, restrictionsWhereOK, err
 	}
+	if authFlowInfo.ClientID != "" {
+		if err = storeRTClient(rlog, tx, mte.ID, authFlowInfo.ClientID); err != nil {
+			return nil, restrictionsWhereOK, err
+		}
+	}
 	if err = notificationsrepo.ScheduleExpirationNotificationsIfNeeded(
 		rlog, tx, mte.ID, mte.Token.ExpiresAt, mte.Token.IssuedAt,
 	); err != nil {
@@ -6,13 +6,15 @@ import (
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oidc-mytoken/server/internal/oidc/pkce"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 )
 
-// GetAuthorizationURL creates an authorization url using oidcfed automatic client registration
+// GetAuthorizationURL creates an authorization url using oidcfed automatic client registration or the client id
+// obtained through explicit registration
 func (p OIDCFedProvider) GetAuthorizationURL(
 	rlog log.Ext1FieldLogger, state, pkceChallenge string,
 	scopeRestrictions, audRestrictions []string,
@@ -40,5 +42,23 @@ func (p OIDCFedProvider) GetAuthorizationURL(
 		params["resource"] = audRestrictions
 	}
 
+	if p.explicitClientID != "" {
+		return p.explicitAuthorizationURL(state, strings.Join(scopes, " "), params)
+	}
 	return fedLeafEntity().GetAuthorizationURL(p.Issuer(), routes.RedirectURI, state, strings.Join(scopes, " "), params)
 }
+
+// explicitAuthorizationURL creates a plain authorization url for an explicitly registered client
+func (p OIDCFedProvider) explicitAuthorizationURL(state, scope string, params url.Values) (string, error) {
+	u, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	params.Set("client_id", p.explicitClientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", routes.RedirectURI)
+	params.Set("scope", scope)
+	params.Set("state", state)
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
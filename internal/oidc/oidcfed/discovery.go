@@ -5,17 +5,19 @@ import (
 	"time"
 
 	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	oidfed "github.com/zachmann/go-oidfed/pkg"
 
 	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/endpoints/federation"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 )
 
-var discoverer = oidfed.FilterableVerifiedChainsOPDiscoverer{
-	Filters: []oidfed.OPDiscoveryFilter{
-		oidfed.OPDiscoveryFilterSupportedGrantTypesIncludes("refresh_token"),
-		oidfed.OPDiscoveryFilterSupportedScopesIncludes("offline_access"),
-	},
+var defaultDiscoveryFilters = []oidfed.OPDiscoveryFilter{
+	oidfed.OPDiscoveryFilterSupportedGrantTypesIncludes("refresh_token"),
+	oidfed.OPDiscoveryFilterSupportedScopesIncludes("offline_access"),
 }
 
 var oidcfedIssuers []string
@@ -27,6 +29,9 @@ func Discovery() {
 	if !config.Get().Features.Federation.Enabled {
 		return
 	}
+	// The entity configuration must be initialized first (also after a config reload), since discovery uses its
+	// trust anchors
+	federation.InitEntityConfiguration()
 	discovery()
 	if ticker != nil {
 		ticker.Reset(time.Hour)
@@ -42,10 +47,19 @@ func Discovery() {
 
 func discovery() {
 	log.Debug("Running oidcfed OP discovery")
-	opInfos := discoverer.Discover(config.Get().Features.Federation.TrustAnchors...)
+	discoverer := oidfed.FilterableVerifiedChainsOPDiscoverer{
+		Filters: append(append([]oidfed.OPDiscoveryFilter{}, defaultDiscoveryFilters...), policyFilters()...),
+	}
+	opInfos := discoverer.Discover(fedLeafEntity().TrustAnchors...)
 	tmp := make([]string, len(opInfos))
 	for i, op := range opInfos {
 		tmp[i] = op.Issuer
+		providerhealth.RecordRefresh(op.Issuer, nil)
+	}
+	for _, iss := range oidcfedIssuers {
+		if !utils.StringInSlice(iss, tmp) {
+			providerhealth.RecordRefresh(iss, errors.New("op is no longer discovered in the federation"))
+		}
 	}
 	oidcfedIssuers = tmp
 }
@@ -4,7 +4,6 @@ import (
 	oidfedcache "github.com/zachmann/go-oidfed/pkg/cache"
 
 	"github.com/oidc-mytoken/server/internal/config"
-	"github.com/oidc-mytoken/server/internal/endpoints/federation"
 	"github.com/oidc-mytoken/server/internal/jws"
 	"github.com/oidc-mytoken/server/internal/utils/cache"
 )
@@ -18,5 +17,4 @@ func Init() {
 	jws.LoadOIDCSigningKey()
 	oidfedcache.SetCache(cache.SubCache(cache.FederationLib))
 	Discovery()
-	federation.InitEntityConfiguration()
 }
@@ -8,6 +8,7 @@ import (
 	fed "github.com/zachmann/go-oidfed/pkg"
 
 	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/jws"
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/pkg/oauth2x"
 )
@@ -25,6 +26,9 @@ var defaultOIDCFedAudienceConf = &model.AudienceConf{
 // OIDCFedProvider implements the model.Provider interface for oidc fed
 type OIDCFedProvider struct {
 	*fed.OpenIDProviderMetadata
+	// explicitClientID is the client id obtained through explicit registration; it is empty if automatic
+	// registration is used
+	explicitClientID string
 }
 
 // Name implements the model.Provider interface
@@ -41,7 +45,10 @@ func (p OIDCFedProvider) Issuer() string {
 }
 
 // ClientID implements the model.Provider interface
-func (OIDCFedProvider) ClientID() string {
+func (p OIDCFedProvider) ClientID() string {
+	if p.explicitClientID != "" {
+		return p.explicitClientID
+	}
 	return fedLeafEntity().EntityID
 }
 
@@ -73,8 +80,14 @@ func (OIDCFedProvider) MaxMytokenLifetime() int64 {
 }
 
 // AddClientAuthentication implements the model.Provider interface; it adds a client assertion to the request
-func (OIDCFedProvider) AddClientAuthentication(r *resty.Request, endpoint string) *resty.Request {
-	clientAssertion, err := fedLeafEntity().RequestObjectProducer().ClientAssertion(endpoint)
+func (p OIDCFedProvider) AddClientAuthentication(r *resty.Request, endpoint string) *resty.Request {
+	producer := fedLeafEntity().RequestObjectProducer()
+	if p.explicitClientID != "" {
+		producer = fed.NewRequestObjectProducer(
+			p.explicitClientID, jws.GetSigningKey(jws.KeyUsageOIDCSigning), config.Get().Signing.OIDC.Alg, 60,
+		)
+	}
+	clientAssertion, err := producer.ClientAssertion(endpoint)
 	if err != nil {
 		log.WithError(err).Error()
 		return r
@@ -85,11 +98,24 @@ func (OIDCFedProvider) AddClientAuthentication(r *resty.Request, endpoint string
 	return r.SetFormDataFromValues(params)
 }
 
-// GetOIDCFedProvider returns a OIDCFedProvider implementing model.Provider for the passed issuer url
+// GetOIDCFedProvider returns a OIDCFedProvider implementing model.Provider for the passed issuer url; only OPs that
+// were discovered in the federation are returned. The discovery applies the OP policy, so the policy is checked
+// again with each discovery refresh and not for every request.
 func GetOIDCFedProvider(issuer string) model.Provider {
+	if !issuerInList(issuer, Issuers()) {
+		return nil
+	}
 	meta, err := getOPMetadata(issuer)
 	if err != nil {
 		return nil
 	}
-	return OIDCFedProvider{meta}
+	p := OIDCFedProvider{OpenIDProviderMetadata: meta}
+	if needsExplicitRegistration(meta) {
+		p.explicitClientID, err = explicitClientID(log.StandardLogger(), meta)
+		if err != nil {
+			log.WithError(err).WithField("issuer", issuer).Error("could not obtain client id for op")
+			return nil
+		}
+	}
+	return p
 }
@@ -0,0 +1,122 @@
+package oidcfed
+
+import (
+	"encoding/json"
+
+	"github.com/oidc-mytoken/utils/utils/issuerutils"
+	log "github.com/sirupsen/logrus"
+	fed "github.com/zachmann/go-oidfed/pkg"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+// policyFilters returns the fed.OPDiscoveryFilter that implement the configured OP policy
+func policyFilters() []fed.OPDiscoveryFilter {
+	return []fed.OPDiscoveryFilter{
+		fed.NewOPDiscoveryFilter(issuerAllowed),
+		fed.NewOPDiscoveryFilter(hasRequiredMetadata),
+		fed.NewOPDiscoveryFilter(hasRequiredTrustMarks),
+	}
+}
+
+func issuerInList(issuer string, list []string) bool {
+	for _, i := range list {
+		if issuerutils.CompareIssuerURLs(issuer, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerAllowed checks the OP against the configured allow and deny lists; if no allow list is configured, all OPs
+// that are not denied are allowed
+func issuerAllowed(op *fed.OpenIDProviderMetadata) bool {
+	policy := config.Get().Features.Federation.OPPolicy
+	if issuerInList(op.Issuer, policy.DeniedIssuers) {
+		return false
+	}
+	return len(policy.AllowedIssuers) == 0 || issuerInList(op.Issuer, policy.AllowedIssuers)
+}
+
+func metadataClaimContains(claim any, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []any:
+		for _, vv := range v {
+			if s, ok := vv.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasRequiredMetadata checks that the OP's metadata contains all configured values for the required metadata claims
+func hasRequiredMetadata(op *fed.OpenIDProviderMetadata) bool {
+	required := config.Get().Features.Federation.OPPolicy.RequiredMetadata
+	if len(required) == 0 {
+		return true
+	}
+	data, err := json.Marshal(op)
+	if err != nil {
+		log.WithError(err).Error("could not marshal op metadata")
+		return false
+	}
+	var metadata map[string]any
+	if err = json.Unmarshal(data, &metadata); err != nil {
+		log.WithError(err).Error("could not unmarshal op metadata")
+		return false
+	}
+	for claim, values := range required {
+		for _, v := range values {
+			if !metadataClaimContains(metadata[claim], v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// chainHasTrustMarks checks that the leaf of the fed.TrustChain has valid trust marks for all passed trust mark ids;
+// trust marks are verified against the trust anchor of the chain
+func chainHasTrustMarks(chain fed.TrustChain, trustMarkIDs []string) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	leaf := chain[0]
+	ta := chain[len(chain)-1]
+	for _, id := range trustMarkIDs {
+		var valid bool
+		for i := range leaf.TrustMarks {
+			tm := &leaf.TrustMarks[i]
+			if tm.ID == id && tm.VerifyFederation(&ta.EntityStatementPayload) == nil {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRequiredTrustMarks checks that the OP has all configured trust marks in at least one valid trust chain
+func hasRequiredTrustMarks(op *fed.OpenIDProviderMetadata) bool {
+	required := config.Get().Features.Federation.OPPolicy.RequiredTrustMarks
+	if len(required) == 0 {
+		return true
+	}
+	resolver := fed.TrustResolver{
+		TrustAnchors:   fedLeafEntity().TrustAnchors,
+		StartingEntity: op.Issuer,
+	}
+	for _, chain := range resolver.ResolveToValidChains() {
+		if chainHasTrustMarks(chain, required) {
+			return true
+		}
+	}
+	log.WithField("issuer", op.Issuer).Debug("OP does not have the required trust marks")
+	return false
+}
@@ -0,0 +1,126 @@
+package oidcfed
+
+import (
+	"testing"
+
+	fed "github.com/zachmann/go-oidfed/pkg"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func restoreOPPolicy(t *testing.T) {
+	policy := config.Get().Features.Federation.OPPolicy
+	t.Cleanup(func() { config.Get().Features.Federation.OPPolicy = policy })
+}
+
+func TestIssuerAllowed(t *testing.T) {
+	restoreOPPolicy(t)
+	tests := []struct {
+		name    string
+		policy  config.FederationOPPolicyConf
+		issuer  string
+		allowed bool
+	}{
+		{
+			name:    "No lists",
+			issuer:  "https://op.example.com",
+			allowed: true,
+		},
+		{
+			name:    "Denied",
+			policy:  config.FederationOPPolicyConf{DeniedIssuers: []string{"https://op.example.com/"}},
+			issuer:  "https://op.example.com",
+			allowed: false,
+		},
+		{
+			name:    "Allowed",
+			policy:  config.FederationOPPolicyConf{AllowedIssuers: []string{"https://op.example.com"}},
+			issuer:  "https://op.example.com",
+			allowed: true,
+		},
+		{
+			name:    "Not in allow list",
+			policy:  config.FederationOPPolicyConf{AllowedIssuers: []string{"https://other.example.com"}},
+			issuer:  "https://op.example.com",
+			allowed: false,
+		},
+		{
+			name: "Allowed and denied",
+			policy: config.FederationOPPolicyConf{
+				AllowedIssuers: []string{"https://op.example.com"},
+				DeniedIssuers:  []string{"https://op.example.com"},
+			},
+			issuer:  "https://op.example.com",
+			allowed: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				config.Get().Features.Federation.OPPolicy = test.policy
+				allowed := issuerAllowed(&fed.OpenIDProviderMetadata{Issuer: test.issuer})
+				if allowed != test.allowed {
+					t.Errorf("Expected allowed to be %v, but got %v", test.allowed, allowed)
+				}
+			},
+		)
+	}
+}
+
+func TestHasRequiredMetadata(t *testing.T) {
+	restoreOPPolicy(t)
+	op := &fed.OpenIDProviderMetadata{
+		Issuer:              "https://op.example.com",
+		GrantTypesSupported: []string{"authorization_code", "refresh_token"},
+		ScopesSupported:     []string{"openid", "offline_access"},
+	}
+	tests := []struct {
+		name     string
+		required map[string][]string
+		expected bool
+	}{
+		{
+			name:     "Nothing required",
+			expected: true,
+		},
+		{
+			name: "Required values present",
+			required: map[string][]string{
+				"grant_types_supported": {"refresh_token"},
+				"issuer":                {"https://op.example.com"},
+			},
+			expected: true,
+		},
+		{
+			name:     "Required value missing",
+			required: map[string][]string{"scopes_supported": {"openid", "eduperson_entitlement"}},
+			expected: false,
+		},
+		{
+			name:     "Required claim missing",
+			required: map[string][]string{"code_challenge_methods_supported": {"S256"}},
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				config.Get().Features.Federation.OPPolicy = config.FederationOPPolicyConf{
+					RequiredMetadata: test.required,
+				}
+				if got := hasRequiredMetadata(op); got != test.expected {
+					t.Errorf("Expected %v, but got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestGetOIDCFedProviderNotDiscovered(t *testing.T) {
+	issuers := oidcfedIssuers
+	t.Cleanup(func() { oidcfedIssuers = issuers })
+	oidcfedIssuers = []string{"https://op.example.com"}
+	if p := GetOIDCFedProvider("https://other.example.com"); p != nil {
+		t.Errorf("Expected no provider for an op that was not discovered, but got '%s'", p.Issuer())
+	}
+}
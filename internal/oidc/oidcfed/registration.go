@@ -0,0 +1,154 @@
+package oidcfed
+
+import (
+	"time"
+
+	"github.com/oidc-mytoken/utils/httpclient"
+	"github.com/oidc-mytoken/utils/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	fed "github.com/zachmann/go-oidfed/pkg"
+	"github.com/zachmann/go-oidfed/pkg/constants"
+	"github.com/zachmann/go-oidfed/pkg/jwk"
+
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/oidcfedrepo"
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+)
+
+// maxClientCacheDuration is the maximum duration a client id obtained through explicit registration is cached
+const maxClientCacheDuration = time.Hour
+
+// needsExplicitRegistration checks if explicit registration must be used for an OP, i.e. if it does not support
+// automatic registration but explicit registration
+func needsExplicitRegistration(op *fed.OpenIDProviderMetadata) bool {
+	return !utils.StringInSlice(fed.ClientRegistrationTypeAutomatic, op.ClientRegistrationTypesSupported) &&
+		utils.StringInSlice(fed.ClientRegistrationTypeExplicit, op.ClientRegistrationTypesSupported)
+}
+
+// explicitClientID returns the client id for an OP that requires explicit registration; if there is no valid
+// registration yet, mytoken registers at the OP and stores the obtained client id
+func explicitClientID(rlog log.Ext1FieldLogger, op *fed.OpenIDProviderMetadata) (string, error) {
+	var clientID string
+	found, err := cache.Get(cache.FederationClients, op.Issuer, &clientID)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return clientID, nil
+	}
+	reg, err := oidcfedrepo.GetClientRegistration(rlog, nil, op.Issuer)
+	if err != nil {
+		return "", err
+	}
+	if reg == nil {
+		if reg, err = register(rlog, op); err != nil {
+			return "", err
+		}
+	}
+	cacheDuration := maxClientCacheDuration
+	if reg.ExpiresAt.Valid && time.Until(reg.ExpiresAt.Time) < cacheDuration {
+		cacheDuration = time.Until(reg.ExpiresAt.Time)
+	}
+	if err = cache.Set(cache.FederationClients, op.Issuer, reg.ClientID, cacheDuration); err != nil {
+		rlog.WithError(err).Error("could not cache client id")
+	}
+	return reg.ClientID, nil
+}
+
+// register performs an explicit client registration at the passed OP
+func register(rlog log.Ext1FieldLogger, op *fed.OpenIDProviderMetadata) (*oidcfedrepo.ClientRegistration, error) {
+	rlog.WithField("issuer", op.Issuer).Info("Performing explicit client registration")
+	if op.FederationRegistrationEndpoint == "" {
+		return nil, errors.Errorf("op '%s' does not have a federation registration endpoint", op.Issuer)
+	}
+	payload := fedLeafEntity().EntityConfigurationPayload()
+	payload.Audience = op.Issuer
+	requestJWT, err := fedLeafEntity().SignEntityStatement(*payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create explicit registration request")
+	}
+	httpRes, err := httpclient.Do().R().
+		SetHeader("Content-Type", constants.ContentTypeEntityStatement).
+		SetBody(requestJWT).
+		Post(op.FederationRegistrationEndpoint)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if httpRes.IsError() {
+		return nil, errors.Errorf("explicit registration at '%s' failed: %s", op.Issuer, httpRes.String())
+	}
+	res, err := fed.ParseEntityStatement(httpRes.Body())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse explicit registration response")
+	}
+	if err = checkRegistrationResponse(
+		&res.EntityStatementPayload, op.Issuer, fedLeafEntity().EntityID, fedLeafEntity().TrustAnchors,
+	); err != nil {
+		return nil, err
+	}
+	keys, err := trustChainKeys(op.Issuer, res.TrustAnchorID)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Verify(keys) {
+		return nil, errors.New("could not verify signature of explicit registration response")
+	}
+	if res.Metadata == nil || res.Metadata.RelyingParty == nil || res.Metadata.RelyingParty.ClientID == "" {
+		return nil, errors.New("explicit registration response does not contain a client id")
+	}
+	reg := &oidcfedrepo.ClientRegistration{
+		ClientID:  res.Metadata.RelyingParty.ClientID,
+		ExpiresAt: db.NewNullTime(res.ExpiresAt.Time),
+	}
+	if err = oidcfedrepo.StoreClientRegistration(rlog, nil, op.Issuer, reg.ClientID, res.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// checkRegistrationResponse checks the claims of an explicit registration response; it must be issued by the OP for
+// the passed RP and name one of the RP's trust anchors
+func checkRegistrationResponse(
+	res *fed.EntityStatementPayload, opIssuer, rpEntityID string, trustAnchors fed.TrustAnchors,
+) error {
+	if res.Issuer != opIssuer {
+		return errors.Errorf("explicit registration response issued by '%s' instead of '%s'", res.Issuer, opIssuer)
+	}
+	if res.Audience != rpEntityID {
+		return errors.Errorf("explicit registration response is for '%s' instead of '%s'", res.Audience, rpEntityID)
+	}
+	if !res.TimeValid() {
+		return errors.New("explicit registration response is expired or not yet valid")
+	}
+	if !utils.StringInSlice(res.TrustAnchorID, trustAnchors.EntityIDs()) {
+		return errors.Errorf("explicit registration response names unknown trust anchor '%s'", res.TrustAnchorID)
+	}
+	return nil
+}
+
+// trustChainKeys returns the federation entity keys of the OP as published by its superior in a valid trust chain to
+// the passed trust anchor; the OP's self-signed entity configuration alone cannot be used, since anyone controlling
+// the OP's domain could publish other keys there
+func trustChainKeys(opIssuer, trustAnchorID string) (jwk.JWKS, error) {
+	var trustAnchors fed.TrustAnchors
+	for _, ta := range fedLeafEntity().TrustAnchors {
+		if ta.EntityID == trustAnchorID {
+			trustAnchors = append(trustAnchors, ta)
+		}
+	}
+	resolver := fed.TrustResolver{
+		TrustAnchors:   trustAnchors,
+		StartingEntity: opIssuer,
+	}
+	for _, chain := range resolver.ResolveToValidChains() {
+		switch {
+		case len(chain) == 1:
+			// The OP is the trust anchor itself
+			return chain[0].JWKS, nil
+		case len(chain) > 1 && chain[1].Subject == opIssuer:
+			return chain[1].JWKS, nil
+		}
+	}
+	return jwk.JWKS{}, errors.Errorf("no valid trust chain from '%s' to '%s'", opIssuer, trustAnchorID)
+}
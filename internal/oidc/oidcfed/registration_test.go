@@ -0,0 +1,84 @@
+package oidcfed
+
+import (
+	"testing"
+	"time"
+
+	fed "github.com/zachmann/go-oidfed/pkg"
+)
+
+func TestCheckRegistrationResponse(t *testing.T) {
+	const (
+		op = "https://op.example.com"
+		rp = "https://mytoken.example.com"
+		ta = "https://ta.example.com"
+	)
+	trustAnchors := fed.TrustAnchors{{EntityID: ta}}
+	valid := func() fed.EntityStatementPayload {
+		return fed.EntityStatementPayload{
+			Issuer:        op,
+			Subject:       rp,
+			Audience:      rp,
+			IssuedAt:      fed.Unixtime{Time: time.Now().Add(-time.Minute)},
+			ExpiresAt:     fed.Unixtime{Time: time.Now().Add(time.Hour)},
+			TrustAnchorID: ta,
+		}
+	}
+	tests := []struct {
+		name      string
+		modify    func(*fed.EntityStatementPayload)
+		expectErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(*fed.EntityStatementPayload) {},
+		},
+		{
+			name:      "other issuer",
+			modify:    func(p *fed.EntityStatementPayload) { p.Issuer = "https://evil.example.com" },
+			expectErr: true,
+		},
+		{
+			name:      "other audience",
+			modify:    func(p *fed.EntityStatementPayload) { p.Audience = "https://other-rp.example.com" },
+			expectErr: true,
+		},
+		{
+			name:      "no audience",
+			modify:    func(p *fed.EntityStatementPayload) { p.Audience = "" },
+			expectErr: true,
+		},
+		{
+			name:      "unknown trust anchor",
+			modify:    func(p *fed.EntityStatementPayload) { p.TrustAnchorID = "https://other-ta.example.com" },
+			expectErr: true,
+		},
+		{
+			name:      "no trust anchor",
+			modify:    func(p *fed.EntityStatementPayload) { p.TrustAnchorID = "" },
+			expectErr: true,
+		},
+		{
+			name: "expired",
+			modify: func(p *fed.EntityStatementPayload) {
+				p.ExpiresAt = fed.Unixtime{Time: time.Now().Add(-time.Second)}
+			},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				res := valid()
+				test.modify(&res)
+				err := checkRegistrationResponse(&res, op, rp, trustAnchors)
+				if test.expectErr && err == nil {
+					t.Error("expected an error, but got none")
+				}
+				if !test.expectErr && err != nil {
+					t.Errorf("expected no error, but got: %s", err)
+				}
+			},
+		)
+	}
+}
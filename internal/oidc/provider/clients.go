@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/utils/utils"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/refreshtokenrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+)
+
+// clientCovers checks if a client with the passed scopes and audiences can be used to request the passed scopes and
+// audiences; the openid and offline_access scopes are always requested and therefore not checked; if the client has
+// no audiences configured, all audiences are allowed
+func clientCovers(clientScopes, clientAudiences, scopes, audiences []string) bool {
+	for _, s := range scopes {
+		if s == oidc.ScopeOpenID || s == oidc.ScopeOfflineAccess {
+			continue
+		}
+		if !utils.StringInSlice(s, clientScopes) {
+			return false
+		}
+	}
+	return len(clientAudiences) == 0 || utils.IsSubSet(audiences, clientAudiences)
+}
+
+// selectClient selects the client that should be used for a request with the passed scopes, audiences, and
+// profiles; a nil value means that the default client should be used. Clients bound to one of the requested profiles
+// are preferred, then the default client, and then the other additional clients; in all cases the client must
+// cover the requested scopes and audiences. If no client covers the request the default client is used.
+func (p SimpleProvider) selectClient(scopes, audiences, profiles []string) *config.ProviderClientConf {
+	var fallback *config.ProviderClientConf
+	for _, c := range p.Clients {
+		if !clientCovers(c.Scopes, c.Audiences, scopes, audiences) {
+			continue
+		}
+		if len(c.Profiles) > 0 {
+			if len(utils.IntersectSlices(c.Profiles, profiles)) > 0 {
+				return c
+			}
+			continue
+		}
+		if fallback == nil {
+			fallback = c
+		}
+	}
+	if clientCovers(p.ProviderConf.Scopes, nil, scopes, audiences) {
+		return nil
+	}
+	return fallback
+}
+
+// withClient returns a copy of the SimpleProvider that uses the client with the passed client id; if no such
+// additional client exists, the default client is used
+func (p SimpleProvider) withClient(clientID string) SimpleProvider {
+	p.client = nil
+	for _, c := range p.Clients {
+		if c.ClientID == clientID {
+			p.client = c
+			break
+		}
+	}
+	return p
+}
+
+// GetProviderForRequest returns the model.Provider for the passed issuer using the client that should be used for a
+// request with the passed scopes, audiences, and profiles
+func GetProviderForRequest(issuer string, scopes, audiences, profiles []string) model.Provider {
+	p := GetProvider(issuer)
+	if sp, ok := p.(SimpleProvider); ok {
+		sp.client = sp.selectClient(scopes, audiences, profiles)
+		return sp
+	}
+	return p
+}
+
+// GetProviderWithClient returns the model.Provider for the passed issuer using the client with the passed client id
+func GetProviderWithClient(issuer, clientID string) model.Provider {
+	p := GetProvider(issuer)
+	if sp, ok := p.(SimpleProvider); ok && clientID != "" {
+		return sp.withClient(clientID)
+	}
+	return p
+}
+
+// ForRefreshToken returns the passed model.Provider using the client that was used to obtain the refresh token with
+// the passed id
+func ForRefreshToken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, p model.Provider, rtID uint64) (model.Provider, error) {
+	sp, ok := p.(SimpleProvider)
+	if !ok || len(sp.Clients) == 0 {
+		return p, nil
+	}
+	clientID, err := refreshtokenrepo.GetClientID(rlog, tx, rtID)
+	if err != nil {
+		return nil, err
+	}
+	return sp.withClient(clientID), nil
+}
+
+// ForMytoken returns the passed model.Provider using the client that was used to obtain the refresh token linked to
+// the mytoken with the passed id
+func ForMytoken(rlog log.Ext1FieldLogger, tx *sqlx.Tx, p model.Provider, mtID mtid.MTID) (model.Provider, error) {
+	sp, ok := p.(SimpleProvider)
+	if !ok || len(sp.Clients) == 0 {
+		return p, nil
+	}
+	rtID, err := refreshtokenrepo.GetRTID(rlog, tx, mtID)
+	if err != nil {
+		return nil, err
+	}
+	return ForRefreshToken(rlog, tx, p, rtID)
+}
+
+// GetSupportedScopes returns the scopes that can be requested for the passed issuer with any of its clients
+func GetSupportedScopes(issuer string) []string {
+	p := GetProvider(issuer)
+	if p == nil {
+		return nil
+	}
+	sp, ok := p.(SimpleProvider)
+	if !ok {
+		return p.Scopes()
+	}
+	scopes := [][]string{sp.ProviderConf.Scopes}
+	for _, c := range sp.Clients {
+		scopes = append(scopes, c.Scopes)
+	}
+	return utils.SliceUnion(scopes...)
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestSelectClient(t *testing.T) {
+	compute := &config.ProviderClientConf{
+		ClientID:  "compute",
+		Scopes:    []string{"openid", "compute"},
+		Audiences: []string{"https://compute.example.com"},
+	}
+	storage := &config.ProviderClientConf{
+		ClientID: "storage",
+		Scopes:   []string{"openid", "storage"},
+		Profiles: []string{"storage"},
+	}
+	p := SimpleProvider{
+		ProviderConf: &config.ProviderConf{
+			ClientID: "default",
+			Scopes:   []string{"openid", "profile"},
+			Clients:  []*config.ProviderClientConf{compute, storage},
+		},
+	}
+	tests := []struct {
+		name      string
+		scopes    []string
+		audiences []string
+		profiles  []string
+		expected  string
+	}{
+		{
+			name:     "Nothing requested",
+			expected: "default",
+		},
+		{
+			name:     "Default scopes",
+			scopes:   []string{"openid", "offline_access", "profile"},
+			expected: "default",
+		},
+		{
+			name:     "Additional client scope",
+			scopes:   []string{"compute"},
+			expected: "compute",
+		},
+		{
+			name:      "Audience not allowed",
+			scopes:    []string{"compute"},
+			audiences: []string{"https://storage.example.com"},
+			expected:  "default",
+		},
+		{
+			name:     "Profile client",
+			profiles: []string{"storage"},
+			expected: "storage",
+		},
+		{
+			name:     "Profile client needed for scope",
+			scopes:   []string{"storage"},
+			expected: "default",
+		},
+		{
+			name:     "Profile client does not cover scopes",
+			scopes:   []string{"compute"},
+			profiles: []string{"storage"},
+			expected: "compute",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				pp := p
+				pp.client = p.selectClient(test.scopes, test.audiences, test.profiles)
+				if got := pp.ClientID(); got != test.expected {
+					t.Errorf("Expected client '%s', but got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
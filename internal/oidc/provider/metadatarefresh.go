@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/oidc-mytoken/utils/context"
+	"github.com/oidc-mytoken/utils/httpclient"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zachmann/go-oidfed/pkg/jwk"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
+	"github.com/oidc-mytoken/server/pkg/oauth2x"
+)
+
+// stopRefresh stops the refresh goroutine of the previous config, so a reload does not leave it running
+var stopRefresh chan struct{}
+
+// startMetadataRefresh refreshes the metadata of the configured providers and keeps refreshing it periodically
+func startMetadataRefresh(providers []*config.ProviderConf) {
+	if stopRefresh != nil {
+		close(stopRefresh)
+	}
+	stop := make(chan struct{})
+	stopRefresh = stop
+	interval := time.Duration(config.Get().Features.ProviderHealth.RefreshInterval) * time.Second
+	go func() {
+		// The endpoints were obtained when the config was loaded, but not the jwks
+		refreshMetadata(providers)
+		if interval == 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refreshMetadata(providers)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func refreshMetadata(providers []*config.ProviderConf) {
+	log.Debug("Refreshing provider metadata")
+	for _, p := range providers {
+		err := refreshProviderMetadata(p)
+		providerhealth.RecordRefresh(p.Issuer, err)
+		if err != nil {
+			log.WithError(err).WithField("issuer", p.Issuer).Warn("could not refresh provider metadata")
+		}
+	}
+}
+
+func refreshProviderMetadata(p *config.ProviderConf) error {
+	endpoints, err := discoverEndpoints(p.Issuer)
+	if err != nil {
+		return err
+	}
+	if endpoints.JWKSURI == "" {
+		p.SetMetadata(&config.ProviderMetadata{Endpoints: endpoints})
+		return nil
+	}
+	jwks, err := fetchJWKS(endpoints.JWKSURI)
+	if err != nil {
+		// Keep the previous jwks, but use the new endpoints
+		p.SetMetadata(
+			&config.ProviderMetadata{
+				Endpoints: endpoints,
+				JWKS:      p.JWKS(),
+			},
+		)
+		return err
+	}
+	p.SetMetadata(
+		&config.ProviderMetadata{
+			Endpoints: endpoints,
+			JWKS:      jwks,
+		},
+	)
+	return nil
+}
+
+func discoverEndpoints(issuer string) (*oauth2x.Endpoints, error) {
+	oc, err := oauth2x.NewConfig(context.Get(), issuer)
+	if err != nil {
+		return nil, err
+	}
+	return oc.Endpoints()
+}
+
+func fetchJWKS(uri string) (*jwk.JWKS, error) {
+	var jwks jwk.JWKS
+	res, err := httpclient.Do().R().SetResult(&jwks).Get(uri)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if res.IsError() {
+		return nil, errors.Errorf("could not fetch jwks: %s", res.Status())
+	}
+	return &jwks, nil
+}
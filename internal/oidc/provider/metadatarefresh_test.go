@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestRefreshProviderMetadata(t *testing.T) {
+	jwksAvailable := true
+	var srv *httptest.Server
+	srv = httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/.well-known/openid-configuration":
+					_ = json.NewEncoder(w).Encode(
+						map[string]string{
+							"issuer":         srv.URL,
+							"token_endpoint": srv.URL + "/token",
+							"jwks_uri":       srv.URL + "/jwks",
+						},
+					)
+				case "/jwks":
+					if !jwksAvailable {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					_, _ = w.Write([]byte(`{"keys":[]}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+		),
+	)
+	defer srv.Close()
+
+	p := &config.ProviderConf{Issuer: srv.URL}
+	if err := refreshProviderMetadata(p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.Endpoints() == nil || p.Endpoints().Token != srv.URL+"/token" {
+		t.Errorf("unexpected endpoints %+v", p.Endpoints())
+	}
+	jwks := p.JWKS()
+	if jwks == nil {
+		t.Fatal("jwks not refreshed")
+	}
+
+	jwksAvailable = false
+	if err := refreshProviderMetadata(p); err == nil {
+		t.Error("expected error if the jwks cannot be fetched")
+	}
+	if p.JWKS() != jwks {
+		t.Error("previous jwks not kept")
+	}
+	if p.Endpoints() == nil {
+		t.Error("endpoints not kept")
+	}
+}
@@ -15,9 +15,10 @@ func Init() {
 	fileProviderByIssuer = make(map[string]model.Provider)
 	for _, p := range config.Get().Providers {
 		iss0, iss1 := issuerutils.GetIssuerWithAndWithoutSlash(p.Issuer)
-		fileProviderByIssuer[iss0] = SimpleProvider{p}
-		fileProviderByIssuer[iss1] = SimpleProvider{p}
+		fileProviderByIssuer[iss0] = SimpleProvider{ProviderConf: p}
+		fileProviderByIssuer[iss1] = SimpleProvider{ProviderConf: p}
 	}
+	startMetadataRefresh(config.Get().Providers)
 }
 
 // GetProvider returns the model.Provider for a passed issuer
@@ -39,3 +40,15 @@ func GetEnforcedRestrictionsByIssuer(issuer string) (c config.EnforcedRestrictio
 	}
 	return
 }
+
+// GetQuotasByIssuer returns the config.QuotasConf for the passed issuer; OPs discovered through the federation share
+// the federation-wide quotas
+func GetQuotasByIssuer(issuer string) (c config.QuotasConf) {
+	if p, ok := fileProviderByIssuer[issuer]; ok {
+		pp := p.(SimpleProvider)
+		c = pp.Quotas
+	} else if fedConf := config.Get().Features.Federation; fedConf.Enabled {
+		c = fedConf.Quotas
+	}
+	return
+}
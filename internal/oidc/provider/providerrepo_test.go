@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/model"
+)
+
+func TestGetQuotasByIssuer(t *testing.T) {
+	fedConf := config.Get().Features.Federation
+	providers := fileProviderByIssuer
+	t.Cleanup(
+		func() {
+			config.Get().Features.Federation = fedConf
+			fileProviderByIssuer = providers
+		},
+	)
+	static := config.QuotasConf{QuotaConf: config.QuotaConf{MaxActiveMytokens: 10}}
+	federation := config.QuotasConf{QuotaConf: config.QuotaConf{MaxActiveMytokens: 5}}
+	fileProviderByIssuer = map[string]model.Provider{
+		"https://static.example.com": SimpleProvider{ProviderConf: &config.ProviderConf{Quotas: static}},
+	}
+	config.Get().Features.Federation.Quotas = federation
+	tests := []struct {
+		name              string
+		issuer            string
+		federationEnabled bool
+		expected          int
+	}{
+		{
+			name:     "static provider",
+			issuer:   "https://static.example.com",
+			expected: 10,
+		},
+		{
+			name:              "static provider with federation",
+			issuer:            "https://static.example.com",
+			federationEnabled: true,
+			expected:          10,
+		},
+		{
+			name:              "federation provider",
+			issuer:            "https://fed.example.com",
+			federationEnabled: true,
+			expected:          5,
+		},
+		{
+			name:     "unknown provider without federation",
+			issuer:   "https://fed.example.com",
+			expected: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				config.Get().Features.Federation.Enabled = test.federationEnabled
+				if got := GetQuotasByIssuer(test.issuer).MaxActiveMytokens; got != test.expected {
+					t.Errorf("expected max_active_mytokens %d, but got %d", test.expected, got)
+				}
+			},
+		)
+	}
+}
@@ -21,6 +21,7 @@ import (
 // SimpleProvider implements the Provider interface for normal OIDC providers with a registered client
 type SimpleProvider struct {
 	*config.ProviderConf
+	client *config.ProviderClientConf
 }
 
 // Name implements the Provider interface
@@ -35,17 +36,30 @@ func (p SimpleProvider) Issuer() string {
 
 // ClientID implements the Provider interface
 func (p SimpleProvider) ClientID() string {
+	if p.client != nil {
+		return p.client.ClientID
+	}
 	return p.ProviderConf.ClientID
 }
 
+func (p SimpleProvider) clientSecret() string {
+	if p.client != nil {
+		return p.client.ClientSecret
+	}
+	return p.ProviderConf.ClientSecret
+}
+
 // Scopes implements the Provider interface
 func (p SimpleProvider) Scopes() []string {
+	if p.client != nil {
+		return p.client.Scopes
+	}
 	return p.ProviderConf.Scopes
 }
 
 // Endpoints implements the Provider interface
 func (p SimpleProvider) Endpoints() *oauth2x.Endpoints {
-	return p.ProviderConf.Endpoints
+	return p.ProviderConf.Endpoints()
 }
 
 // Audience implements the Provider interface
@@ -60,7 +74,7 @@ func (p SimpleProvider) MaxMytokenLifetime() int64 {
 
 // AddClientAuthentication implements the Provider interface
 func (p SimpleProvider) AddClientAuthentication(r *resty.Request, _ string) *resty.Request {
-	return r.SetBasicAuth(p.ClientID(), p.ClientSecret)
+	return r.SetBasicAuth(p.ClientID(), p.clientSecret())
 }
 
 // GetAuthorizationURL creates an authorization url
@@ -75,7 +89,7 @@ func (p SimpleProvider) GetAuthorizationURL(
 	}
 	oauth2Config := oauth2.Config{
 		ClientID:     p.ClientID(),
-		ClientSecret: p.ClientSecret,
+		ClientSecret: p.clientSecret(),
 		Endpoint:     p.Endpoints().OAuth2(),
 		RedirectURL:  routes.RedirectURI,
 		Scopes:       scopes,
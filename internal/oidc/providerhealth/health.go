@@ -0,0 +1,179 @@
+package providerhealth
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+// Status describes the health of an OpenID provider as observed by this mytoken instance
+type Status struct {
+	Issuer                string  `json:"issuer"`
+	Healthy               bool    `json:"healthy"`
+	LastSuccessfulRefresh int64   `json:"last_successful_refresh,omitempty"`
+	LastRefreshError      string  `json:"last_refresh_error,omitempty"`
+	TokenRequests         int     `json:"token_requests"`
+	TokenErrors           int     `json:"token_errors"`
+	TokenErrorRate        float64 `json:"token_error_rate"`
+	CircuitOpen           bool    `json:"circuit_open"`
+	CircuitOpenUntil      int64   `json:"circuit_open_until,omitempty"`
+}
+
+type tokenRequest struct {
+	time   time.Time
+	failed bool
+}
+
+type providerState struct {
+	lastSuccessfulRefresh time.Time
+	lastRefreshError      string
+	tokenRequests         []tokenRequest
+	consecutiveFailures   int
+	openUntil             time.Time
+	halfOpenProbe         bool
+}
+
+var (
+	mutex  sync.Mutex
+	states = make(map[string]*providerState)
+)
+
+func getState(issuer string) *providerState {
+	s, ok := states[issuer]
+	if !ok {
+		s = &providerState{}
+		states[issuer] = s
+	}
+	return s
+}
+
+func (s *providerState) pruneTokenRequests(now time.Time) {
+	window := time.Duration(config.Get().Features.ProviderHealth.ErrorRateWindow) * time.Second
+	i := 0
+	for i < len(s.tokenRequests) && now.Sub(s.tokenRequests[i].time) > window {
+		i++
+	}
+	s.tokenRequests = s.tokenRequests[i:]
+}
+
+// RecordRefresh records the result of a metadata refresh for the OP with the passed issuer
+func RecordRefresh(issuer string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s := getState(issuer)
+	if err != nil {
+		s.lastRefreshError = err.Error()
+		return
+	}
+	s.lastSuccessfulRefresh = time.Now()
+	s.lastRefreshError = ""
+}
+
+// RecordTokenRequest records the result of a request to the token endpoint of the OP with the passed issuer; failed
+// indicates an upstream failure, i.e. the OP could not be reached or responded with a server error, and not an
+// oidc error response
+func RecordTokenRequest(issuer string, failed bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	s := getState(issuer)
+	s.pruneTokenRequests(now)
+	s.tokenRequests = append(
+		s.tokenRequests, tokenRequest{
+			time:   now,
+			failed: failed,
+		},
+	)
+	s.halfOpenProbe = false
+	if !failed {
+		s.consecutiveFailures = 0
+		s.openUntil = time.Time{}
+		return
+	}
+	s.consecutiveFailures++
+	conf := config.Get().Features.ProviderHealth.CircuitBreaker
+	if conf.Enabled && s.consecutiveFailures >= conf.FailureThreshold {
+		s.openUntil = now.Add(time.Duration(conf.OpenDuration) * time.Second)
+	}
+}
+
+// Allow checks if a request to the OP with the passed issuer is allowed by the circuit breaker; while the circuit is
+// open requests are not allowed; after the circuit was open for the configured duration a single probe request is
+// allowed, the result of this request decides if the circuit is closed again
+func Allow(issuer string) bool {
+	if !config.Get().Features.ProviderHealth.CircuitBreaker.Enabled {
+		return true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := states[issuer]
+	if !ok || s.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(s.openUntil) || s.halfOpenProbe {
+		return false
+	}
+	s.halfOpenProbe = true
+	return true
+}
+
+func (s *providerState) status(issuer string, now time.Time) Status {
+	s.pruneTokenRequests(now)
+	status := Status{
+		Issuer:           issuer,
+		LastRefreshError: s.lastRefreshError,
+		TokenRequests:    len(s.tokenRequests),
+		CircuitOpen:      !s.openUntil.IsZero(),
+	}
+	if !s.lastSuccessfulRefresh.IsZero() {
+		status.LastSuccessfulRefresh = s.lastSuccessfulRefresh.Unix()
+	}
+	if status.CircuitOpen {
+		status.CircuitOpenUntil = s.openUntil.Unix()
+	}
+	for _, r := range s.tokenRequests {
+		if r.failed {
+			status.TokenErrors++
+		}
+	}
+	if status.TokenRequests > 0 {
+		status.TokenErrorRate = float64(status.TokenErrors) / float64(status.TokenRequests)
+	}
+	status.Healthy = !status.CircuitOpen && status.LastRefreshError == ""
+	return status
+}
+
+// Get returns the Status for the OP with the passed issuer
+func Get(issuer string) Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return getState(issuer).status(issuer, time.Now())
+}
+
+// All returns the Status of all known OPs sorted by issuer
+func All() []Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	all := make([]Status, 0, len(states))
+	for issuer, s := range states {
+		all = append(all, s.status(issuer, now))
+	}
+	sort.Slice(
+		all, func(i, j int) bool {
+			return all[i].Issuer < all[j].Issuer
+		},
+	)
+	return all
+}
+
+// IsUpstreamFailure checks if the result of a request to an OP indicates an upstream failure, i.e. the OP could not
+// be reached or responded with a server error
+func IsUpstreamFailure(res *resty.Response, err error) bool {
+	return err != nil || res == nil || res.StatusCode() >= http.StatusInternalServerError
+}
@@ -0,0 +1,48 @@
+package providerhealth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	issuer := "https://op.example.com"
+	threshold := config.Get().Features.ProviderHealth.CircuitBreaker.FailureThreshold
+	for i := 0; i < threshold-1; i++ {
+		RecordTokenRequest(issuer, true)
+	}
+	if !Allow(issuer) {
+		t.Fatal("Expected circuit to be closed below the failure threshold")
+	}
+	RecordTokenRequest(issuer, true)
+	if Allow(issuer) {
+		t.Fatal("Expected circuit to be open after reaching the failure threshold")
+	}
+	status := Get(issuer)
+	if !status.CircuitOpen || status.Healthy {
+		t.Errorf("Expected open circuit and unhealthy status, got %+v", status)
+	}
+	if status.TokenErrors != threshold || status.TokenErrorRate != 1 {
+		t.Errorf("Expected %d token errors with rate 1, got %+v", threshold, status)
+	}
+
+	// Simulate that the open duration passed
+	mutex.Lock()
+	states[issuer].openUntil = time.Now().Add(-time.Second)
+	mutex.Unlock()
+	if !Allow(issuer) {
+		t.Fatal("Expected a probe request to be allowed after the open duration")
+	}
+	if Allow(issuer) {
+		t.Fatal("Expected only a single probe request to be allowed")
+	}
+	RecordTokenRequest(issuer, false)
+	if !Allow(issuer) {
+		t.Fatal("Expected circuit to be closed after a successful probe request")
+	}
+	if status = Get(issuer); status.CircuitOpen || !status.Healthy {
+		t.Errorf("Expected closed circuit and healthy status, got %+v", status)
+	}
+}
@@ -1,6 +1,8 @@
 package refresh
 
 import (
+	"net/http"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/oidc-mytoken/utils/httpclient"
 	"github.com/pkg/errors"
@@ -10,6 +12,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/model"
 	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
 	"github.com/oidc-mytoken/server/internal/oidc/oidcreqres"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 )
 
 // UpdateChangedRT is a function that should update a refresh token, it takes the old value as well as the new one
@@ -30,6 +33,13 @@ func DoFlowAndUpdate(
 	audiences []string,
 	updateFnc UpdateChangedRT,
 ) (*oidcreqres.OIDCTokenResponse, *oidcreqres.OIDCErrorResponse, error) {
+	if !providerhealth.Allow(provider.Issuer()) {
+		return nil, &oidcreqres.OIDCErrorResponse{
+			Error:            "temporarily_unavailable",
+			ErrorDescription: "the OpenID provider is currently unavailable",
+			Status:           http.StatusServiceUnavailable,
+		}, nil
+	}
 	req := oidcreqres.NewRefreshRequest(rt, provider.Audience())
 	req.Scopes = scopes
 	req.Audiences = audiences
@@ -38,6 +48,7 @@ func DoFlowAndUpdate(
 		SetResult(&oidcreqres.OIDCTokenResponse{}).
 		SetError(&oidcreqres.OIDCErrorResponse{}).
 		Post(provider.Endpoints().Token)
+	providerhealth.RecordTokenRequest(provider.Issuer(), providerhealth.IsUpstreamFailure(httpRes, err))
 	if err != nil {
 		return nil, nil, errors.WithStack(err)
 	}
@@ -58,7 +69,9 @@ func DoFlowAndUpdate(
 }
 
 // DoFlowAndUpdateDB uses a refresh token to obtain a new access token; if the refresh token changes, it is
-// updated in the database
+// updated in the database. If the OP rotates refresh tokens, the caller must have read the refresh token with
+// cryptstore.GetRefreshToken within tx, so that it stays locked until the updated refresh token is committed and
+// concurrent requests (also on other nodes) wait for it instead of using the invalidated one.
 func DoFlowAndUpdateDB(
 	rlog log.Ext1FieldLogger, tx *sqlx.Tx, provider model.Provider, tokenID mtid.MTID, mytoken, rt, scopes string,
 	audiences []string,
@@ -0,0 +1,256 @@
+package refresh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/cryptstore"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	"github.com/oidc-mytoken/server/internal/oidc/provider"
+	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
+	"github.com/oidc-mytoken/server/pkg/oauth2x"
+)
+
+// rotatingOP is a token endpoint of an OP that rotates refresh tokens; only the latest refresh token is valid
+type rotatingOP struct {
+	mutex     sync.Mutex
+	currentRT string
+	rotations int
+	// delay is the time the OP takes to answer a request
+	delay time.Duration
+}
+
+func (op *rotatingOP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(op.delay)
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.FormValue("refresh_token") != op.currentRT {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": api.ErrorStrInvalidGrant})
+		return
+	}
+	op.rotations++
+	op.currentRT = fmt.Sprintf("rt-%d", op.rotations)
+	_ = json.NewEncoder(w).Encode(
+		map[string]string{
+			"access_token":  "at",
+			"token_type":    "Bearer",
+			"refresh_token": op.currentRT,
+		},
+	)
+}
+
+func (op *rotatingOP) provider() (provider.SimpleProvider, func()) {
+	srv := httptest.NewServer(op)
+	p := &config.ProviderConf{Issuer: srv.URL}
+	p.SetMetadata(&config.ProviderMetadata{Endpoints: &oauth2x.Endpoints{Token: srv.URL}})
+	return provider.SimpleProvider{ProviderConf: p}, srv.Close
+}
+
+func TestDoFlowAndUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rt        string
+		wantError bool
+	}{
+		{
+			name: "current refresh token",
+			rt:   "rt-0",
+		},
+		{
+			name:      "invalidated refresh token",
+			rt:        "stale",
+			wantError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				op, closeOP := (&rotatingOP{currentRT: "rt-0"}).provider()
+				defer closeOP()
+				var updatedRT string
+				update := func(_ log.Ext1FieldLogger, _ *sqlx.Tx, _ mtid.MTID, newRT, _ string) error {
+					updatedRT = newRT
+					return nil
+				}
+				res, errRes, err := DoFlowAndUpdate(
+					log.StandardLogger(), nil, op, mtid.MTID{}, "mytoken", test.rt, "", nil, update,
+				)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if test.wantError {
+					if errRes == nil || errRes.Error != api.ErrorStrInvalidGrant {
+						t.Errorf("expected invalid_grant error, but got %+v", errRes)
+					}
+					if updatedRT != "" {
+						t.Errorf("refresh token updated to '%s' although the request failed", updatedRT)
+					}
+					return
+				}
+				if errRes != nil {
+					t.Fatalf("unexpected error response: %+v", errRes)
+				}
+				if res.AccessToken != "at" {
+					t.Errorf("unexpected access token '%s'", res.AccessToken)
+				}
+				if updatedRT != "rt-1" {
+					t.Errorf("rotated refresh token not updated, got '%s'", updatedRT)
+				}
+			},
+		)
+	}
+}
+
+// connectTestDB connects to the database given by the MYTOKEN_TEST_DB_* environment variables; the database must
+// have the current mytoken schema. The test is skipped if no database is given.
+func connectTestDB(t *testing.T) {
+	host := os.Getenv("MYTOKEN_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("MYTOKEN_TEST_DB_HOST not set")
+	}
+	db.ConnectConfig(
+		config.DBConf{
+			Hosts:             []string{host},
+			User:              os.Getenv("MYTOKEN_TEST_DB_USER"),
+			Password:          os.Getenv("MYTOKEN_TEST_DB_PASSWORD"),
+			DB:                os.Getenv("MYTOKEN_TEST_DB_DB"),
+			ReconnectInterval: 60,
+		},
+	)
+}
+
+// storeTestRefreshToken stores a mytoken with the passed refresh token through the same procedures used when a
+// mytoken is created
+func storeTestRefreshToken(t *testing.T, rt, jwt string) mtid.MTID {
+	rlog := log.StandardLogger()
+	id, err := mtid.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := cryptutils.RandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtCrypt, err := cryptutils.AESEncrypt(rt, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyCrypt, err := cryptutils.AES256Encrypt(base64.StdEncoding.EncodeToString(key), jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rtID uint64
+	if err = db.Transact(
+		rlog, func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec(`CALL CryptStoreRT_Insert(?,@ID)`, rtCrypt); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := tx.Get(&rtID, `SELECT @ID`); err != nil {
+				return errors.WithStack(err)
+			}
+			if _, err := tx.Exec(
+				`CALL MTokens_Insert(?,?,?,?,?,?,?,?,?,?,?,?)`,
+				"sub", "https://op.example.com", id, 0, mtid.MTID{}, rtID, nil, "192.0.2.1", nil, nil, nil, nil,
+			); err != nil {
+				return errors.WithStack(err)
+			}
+			_, err := tx.Exec(`CALL EncryptionKeysRT_Insert(?,?,?)`, keyCrypt, rtID, id)
+			return errors.WithStack(err)
+		},
+	); err != nil {
+		t.Fatalf("could not store test mytoken: %+v", err)
+	}
+	t.Cleanup(
+		func() {
+			_ = db.Transact(
+				rlog, func(tx *sqlx.Tx) error {
+					if _, err := tx.Exec(`CALL MTokens_Delete(?)`, id); err != nil {
+						return errors.WithStack(err)
+					}
+					return cryptstore.DeleteCrypted(rlog, tx, rtID)
+				},
+			)
+		},
+	)
+	return id
+}
+
+// TestDoFlowAndUpdateDB_ConcurrentRequests runs concurrent requests for the same refresh token the same way the
+// access token endpoint does; the refresh token is locked through EncryptionKeys_GetRTKeyForMT, so the requests must
+// wait for each other and each one must use the refresh token rotated by the previous one.
+func TestDoFlowAndUpdateDB_ConcurrentRequests(t *testing.T) {
+	connectTestDB(t)
+	rlog := log.StandardLogger()
+	const jwt = "mytoken"
+	const requests = 5
+	rop := &rotatingOP{
+		currentRT: "rt-0",
+		delay:     100 * time.Millisecond,
+	}
+	op, closeOP := rop.provider()
+	defer closeOP()
+	id := storeTestRefreshToken(t, rop.currentRT, jwt)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Transact(
+				rlog, func(tx *sqlx.Tx) error {
+					rt, found, err := cryptstore.GetRefreshToken(rlog, tx, id, jwt)
+					if err != nil {
+						return err
+					}
+					if !found {
+						return errors.New("refresh token not found")
+					}
+					_, errRes, err := DoFlowAndUpdateDB(rlog, tx, op, id, jwt, rt, "", nil)
+					if err != nil {
+						return err
+					}
+					if errRes != nil {
+						return errors.Errorf("unexpected error response: %s", errRes.Error)
+					}
+					return nil
+				},
+			)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("request failed: %+v", err)
+		}
+	}
+	rop.mutex.Lock()
+	defer rop.mutex.Unlock()
+	if rop.rotations != requests {
+		t.Errorf("expected %d rotations, got %d", requests, rop.rotations)
+	}
+	rt, _, err := cryptstore.GetRefreshToken(rlog, nil, id, jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt != rop.currentRT {
+		t.Errorf("expected the latest refresh token '%s' in the database, got '%s'", rop.currentRT, rt)
+	}
+}
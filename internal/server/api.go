@@ -5,15 +5,21 @@ import (
 	"github.com/oidc-mytoken/utils/utils"
 
 	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/endpoints/clientregistry"
 	"github.com/oidc-mytoken/server/internal/endpoints/guestmode"
 	"github.com/oidc-mytoken/server/internal/endpoints/notification"
 	"github.com/oidc-mytoken/server/internal/endpoints/notification/calendar"
 	"github.com/oidc-mytoken/server/internal/endpoints/profiles"
+	"github.com/oidc-mytoken/server/internal/endpoints/renewal"
 	"github.com/oidc-mytoken/server/internal/endpoints/revocation"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings/email"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings/grants"
 	"github.com/oidc-mytoken/server/internal/endpoints/settings/grants/ssh"
+	"github.com/oidc-mytoken/server/internal/endpoints/settings/passkeys"
+	"github.com/oidc-mytoken/server/internal/endpoints/sshcert"
+	"github.com/oidc-mytoken/server/internal/endpoints/stepup"
+	"github.com/oidc-mytoken/server/internal/endpoints/suspension"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/access"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken"
 	"github.com/oidc-mytoken/server/internal/endpoints/tokeninfo"
@@ -34,6 +40,19 @@ func addAPIvXRoutes(s fiber.Router, version int) {
 	s.Post(apiPaths.AccessTokenEndpoint, toFiberHandler(access.HandleAccessTokenEndpoint))
 	if config.Get().Features.TokenRevocation.Enabled {
 		s.Post(apiPaths.RevocationEndpoint, toFiberHandler(revocation.HandleRevoke))
+		s.Post(utils.CombineURLPath(apiPaths.RevocationEndpoint, "bulk"), toFiberHandler(revocation.HandleBulkRevoke))
+	}
+	if config.Get().Features.TokenSuspension.Enabled {
+		s.Post(apiPaths.SuspensionEndpoint, toFiberHandler(suspension.HandleSuspend))
+		s.Delete(apiPaths.SuspensionEndpoint, toFiberHandler(suspension.HandleResume))
+	}
+	if config.Get().Features.TokenRenewal.Enabled {
+		s.Post(apiPaths.RenewalEndpoint, toFiberHandler(renewal.HandleRegister))
+		s.Delete(apiPaths.RenewalEndpoint, toFiberHandler(renewal.HandleCancel))
+		s.Post(utils.CombineURLPath(apiPaths.RenewalEndpoint, "collect"), toFiberHandler(renewal.HandleCollect))
+	}
+	if config.Get().Features.SSH.UserCertificates.Enabled {
+		s.Post(apiPaths.SSHCertificateEndpoint, toFiberHandler(sshcert.HandleSSHCertificate))
 	}
 	if config.Get().Features.TransferCodes.Enabled {
 		s.Post(apiPaths.TokenTransferEndpoint, toFiberHandler(mytoken.HandleCreateTransferCodeForExistingMytoken))
@@ -52,7 +71,17 @@ func addAPIvXRoutes(s fiber.Router, version int) {
 		s.Post(sshGrantPath, toFiberHandler(ssh.HandlePost))
 		s.Delete(sshGrantPath, toFiberHandler(ssh.HandleDeleteSSHKey))
 	}
+	if config.Get().Features.WebInterface.WebAuthn.Enabled {
+		passkeyPath := utils.CombineURLPath(apiPaths.UserSettingEndpoint, "passkeys")
+		s.Get(passkeyPath, toFiberHandler(passkeys.HandleList))
+		s.Post(utils.CombineURLPath(passkeyPath, "options"), toFiberHandler(passkeys.HandleRegisterBegin))
+		s.Post(passkeyPath, toFiberHandler(passkeys.HandleRegisterFinish))
+		s.Delete(passkeyPath, toFiberHandler(passkeys.HandleDelete))
+		s.Post(utils.CombineURLPath(apiPaths.StepUpEndpoint, "options"), toFiberHandler(stepup.HandleBegin))
+		s.Post(apiPaths.StepUpEndpoint, toFiberHandler(stepup.HandleFinish))
+	}
 	addProfileEndpointRoutes(s, apiPaths)
+	addClientRegistryRoutes(s, apiPaths)
 	if config.Get().Features.Notifications.AnyEnabled {
 		if config.Get().Features.Notifications.ICS.Enabled {
 			s.Get(apiPaths.CalendarEndpoint, toFiberHandler(calendar.HandleList))
@@ -79,6 +108,24 @@ func addAPIvXRoutes(s fiber.Router, version int) {
 			utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "nc"),
 			toFiberHandler(notification.HandleNotificationUpdateClasses),
 		)
+		s.Put(
+			utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "digest"),
+			toFiberHandler(notification.HandleNotificationUpdateDigest),
+		)
+		if config.Get().Features.Notifications.Chat.Enabled {
+			s.Put(
+				utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "chat"),
+				toFiberHandler(notification.HandleNotificationUpdateChatTarget),
+			)
+			s.Delete(
+				utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "chat"),
+				toFiberHandler(notification.HandleNotificationDeleteChatTarget),
+			)
+			s.Post(
+				utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "chat", "verify"),
+				toFiberHandler(notification.HandleNotificationVerifyChatTarget),
+			)
+		}
 		s.Post(
 			utils.CombineURLPath(apiPaths.NotificationEndpoint, ":code", "token"),
 			toFiberHandler(notification.HandleNotificationAddToken),
@@ -117,6 +164,19 @@ func addProfileEndpointRoutes(r fiber.Router, apiPaths paths.APIPaths) {
 	addProfileDeleteRoute(r, apiPaths, "rotation", profiles.HandleDeleteRotation)
 }
 
+func addClientRegistryRoutes(r fiber.Router, apiPaths paths.APIPaths) {
+	if !config.Get().Features.ClientRegistry.Enabled {
+		return
+	}
+	clientPath := utils.CombineURLPath(apiPaths.ClientRegistryEndpoint, ":client_id")
+	admin := returnClientRegistryAdminBasicMiddleware()
+	r.Get(apiPaths.ClientRegistryEndpoint, admin, toFiberHandler(clientregistry.HandleList))
+	r.Post(apiPaths.ClientRegistryEndpoint, admin, toFiberHandler(clientregistry.HandleAdd))
+	r.Get(clientPath, admin, toFiberHandler(clientregistry.HandleGet))
+	r.Put(clientPath, admin, toFiberHandler(clientregistry.HandleUpdate))
+	r.Delete(clientPath, admin, toFiberHandler(clientregistry.HandleDelete))
+}
+
 func addProfileGetRoute(r fiber.Router, apiPaths paths.APIPaths, profileTypePath string, handler fiber.Handler) {
 	r.Get(utils.CombineURLPath(apiPaths.ProfilesEndpoint, profileTypePath), handler)
 	r.Get(utils.CombineURLPath(apiPaths.ProfilesEndpoint, ":group", profileTypePath), handler)
@@ -41,7 +41,7 @@ func handleError(ctx *fiber.Ctx, err error) error {
 
 func handleErrorHTML(ctx *fiber.Ctx, code int, msg string) error {
 	var err error
-	errorTemplateData := map[string]interface{}{
+	errorTemplateData := fiber.Map{
 		"empty-navbar": true,
 		"msg":          msg,
 	}
@@ -19,6 +19,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/endpoints/webentities"
 	"github.com/oidc-mytoken/server/internal/utils/cache"
 	"github.com/oidc-mytoken/server/internal/utils/cookies"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	"github.com/oidc-mytoken/server/internal/utils/templating"
 )
 
@@ -29,7 +30,7 @@ func handleIndex(ctx *fiber.Ctx) error {
 	return ctx.Render("sites/home", binding, templating.LayoutMain)
 }
 
-func homeBindingData() map[string]interface{} {
+func homeBindingData() fiber.Map {
 	var providers []map[string]any
 	for _, p := range configurationEndpoint.SupportedProviders() {
 		pp := make(map[string]any, 2)
@@ -38,7 +39,7 @@ func homeBindingData() map[string]interface{} {
 		pp["fed"] = p.OIDCFed
 		providers = append(providers, pp)
 	}
-	bindingData := map[string]interface{}{
+	bindingData := fiber.Map{
 		templating.MustacheKeyLoggedIn:        true,
 		templating.MustacheKeyRestrictionsGUI: true,
 		templating.MustacheKeyHome:            true,
@@ -78,6 +79,7 @@ func homeBindingData() map[string]interface{} {
 		}
 		bindingData[templating.MustacheKeyNotificationsMailEnabled] = config.Get().Features.Notifications.Mail.Enabled
 		bindingData[templating.MustacheKeyNotificationsCalendarEnabled] = config.Get().Features.Notifications.ICS.Enabled
+		bindingData[templating.MustacheKeyNotificationsChatEnabled] = config.Get().Features.Notifications.Chat.Enabled
 	}
 	return bindingData
 }
@@ -175,7 +177,7 @@ func handleHome(ctx *fiber.Ctx) error {
 
 func handleViewCalendar(ctx *fiber.Ctx) error {
 	return ctx.Render(
-		"sites/calendar", map[string]any{
+		"sites/calendar", fiber.Map{
 			"calendar-view":                   true,
 			templating.MustacheKeyEmptyNavbar: true,
 		}, templating.LayoutMain,
@@ -213,7 +215,7 @@ func handleSettings(ctx *fiber.Ctx) error {
 		}
 		g.EmbedBody = embed.String()
 	}
-	binding := map[string]interface{}{
+	binding := fiber.Map{
 		templating.MustacheKeyGrants:            grants,
 		templating.MustacheKeyLoggedIn:          true,
 		templating.MustacheKeySettings:          true,
@@ -229,12 +231,27 @@ func handleSettings(ctx *fiber.Ctx) error {
 		binding[templating.MustacheSubNotifications] = true
 		binding[templating.MustacheKeyNotificationsMailEnabled] = config.Get().Features.Notifications.Mail.Enabled
 		binding[templating.MustacheKeyNotificationsCalendarEnabled] = config.Get().Features.Notifications.ICS.Enabled
+		binding[templating.MustacheKeyLanguages] = languagesBindingData()
+	}
+	if config.Get().Features.WebInterface.WebAuthn.Enabled {
+		binding[templating.MustacheKeyPasskeys] = true
 	}
 	return ctx.Render("sites/settings", binding, templating.LayoutMain)
 }
 
+func languagesBindingData() []map[string]string {
+	languages := make([]map[string]string, len(i18n.Languages()))
+	for i, lang := range i18n.Languages() {
+		languages[i] = map[string]string{
+			"code": lang,
+			"name": i18n.Translate(lang, i18n.KeyLanguageName),
+		}
+	}
+	return languages
+}
+
 func handleNativeCallback(ctx *fiber.Ctx) error {
-	binding := map[string]interface{}{
+	binding := fiber.Map{
 		templating.MustacheKeyEmptyNavbar: true,
 		templating.MustacheKeyApplication: ctx.Query("application"),
 	}
@@ -242,7 +259,7 @@ func handleNativeCallback(ctx *fiber.Ctx) error {
 }
 
 func handleNativeConsentAbortCallback(ctx *fiber.Ctx) error {
-	binding := map[string]interface{}{
+	binding := fiber.Map{
 		templating.MustacheKeyEmptyNavbar: true,
 		templating.MustacheKeyApplication: ctx.Query("application"),
 	}
@@ -251,7 +268,7 @@ func handleNativeConsentAbortCallback(ctx *fiber.Ctx) error {
 
 func handlePrivacy(ctx *fiber.Ctx) error {
 	so := config.Get().ServiceOperator
-	binding := map[string]interface{}{
+	binding := fiber.Map{
 		templating.MustacheKeyEmptyNavbar:    true,
 		templating.MustacheKeyName:           so.Name,
 		templating.MustacheKeyHomepage:       so.Homepage,
@@ -263,11 +280,12 @@ func handlePrivacy(ctx *fiber.Ctx) error {
 
 func handleNotificationManagement(ctx *fiber.Ctx) error {
 	return ctx.Render(
-		"sites/manage-notification", map[string]any{
-			"notification-management":                  true,
-			"empty-navbar":                             true,
-			templating.MustacheSubNewNotificationModal: true,
-			templating.MustacheKeyNotificationClasses:  webentities.AllWebNotificationClass(),
+		"sites/manage-notification", fiber.Map{
+			"notification-management":                      true,
+			"empty-navbar":                                 true,
+			templating.MustacheSubNewNotificationModal:     true,
+			templating.MustacheKeyNotificationClasses:      webentities.AllWebNotificationClass(),
+			templating.MustacheKeyNotificationsChatEnabled: config.Get().Features.Notifications.Chat.Enabled,
 			templating.MustacheKeyCollapse: map[string]bool{
 				"NotificationManagement": true,
 			},
@@ -1,11 +1,13 @@
 package healthcheck
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/oidc-mytoken/utils/httpclient"
 	"github.com/oidc-mytoken/utils/utils"
 	log "github.com/sirupsen/logrus"
@@ -14,7 +16,9 @@ import (
 
 	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/versionrepo"
+	"github.com/oidc-mytoken/server/internal/jobs"
 	"github.com/oidc-mytoken/server/internal/model/version"
+	"github.com/oidc-mytoken/server/internal/oidc/providerhealth"
 	"github.com/oidc-mytoken/server/internal/server/routes"
 )
 
@@ -27,6 +31,12 @@ func Start() {
 	httpServer.Get(
 		"", handleHealthCheck,
 	)
+	// The job status reveals internals (e.g. error messages of failed jobs), therefore it requires authentication
+	if len(config.Get().Server.Healthcheck.Admins) > 0 {
+		httpServer.Get(
+			"/jobs", adminBasicMiddleware(), handleJobStatus,
+		)
+	}
 	addr := fmt.Sprintf(":%d", config.Get().Server.Healthcheck.Port)
 	log.Infof("Healthcheck endpoint started on %s", addr)
 	go func() {
@@ -43,14 +53,24 @@ type status struct {
 }
 
 type componentsStatus struct {
-	ServerUp        bool `json:"server_up"`
-	ServerReachable bool `json:"server_reachable"`
-	Database        bool `json:"database_up"`
-	Cache           bool `json:"cache_up"`
+	ServerUp        bool                    `json:"server_up"`
+	ServerReachable bool                    `json:"server_reachable"`
+	Database        bool                    `json:"database_up"`
+	Cache           bool                    `json:"cache_up"`
+	Providers       []providerhealth.Status `json:"providers"`
+}
+
+func (c componentsStatus) providersHealthy() bool {
+	for _, p := range c.Providers {
+		if !p.Healthy {
+			return false
+		}
+	}
+	return true
 }
 
 func (c componentsStatus) healthy() bool {
-	return c.ServerUp && c.ServerReachable && c.Database && c.Cache
+	return c.ServerUp && c.ServerReachable && c.Database && c.Cache && c.providersHealthy()
 }
 func (c componentsStatus) operational() bool {
 	return c.ServerUp && c.ServerReachable && c.Database
@@ -64,12 +84,33 @@ func handleHealthCheck(ctx *fiber.Ctx) error {
 	return ctx.JSON(state)
 }
 
+func adminBasicMiddleware() fiber.Handler {
+	return basicauth.New(
+		basicauth.Config{
+			Authorizer: func(user string, pw string) bool {
+				expected, ok := config.Get().Server.Healthcheck.Admins[user]
+				return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(pw)) == 1
+			},
+		},
+	)
+}
+
+func handleJobStatus(ctx *fiber.Ctx) error {
+	status, err := jobs.GetStatus(log.StandardLogger())
+	if err != nil {
+		log.WithError(err).Error("error obtaining job status")
+		return ctx.SendStatus(fiber.StatusServiceUnavailable)
+	}
+	return ctx.JSON(status)
+}
+
 func healthcheck() status {
 	components := componentsStatus{
 		ServerUp:        true,
 		ServerReachable: checkServer(),
 		Database:        checkDB(),
 		Cache:           checkCache(),
+		Providers:       providerhealth.All(),
 	}
 	return status{
 		Healthy:     components.healthy(),
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/subtle"
 	"embed"
 	"io/fs"
 	"net/http"
@@ -25,8 +26,10 @@ import (
 	"github.com/oidc-mytoken/server/internal/server/paths"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
 	"github.com/oidc-mytoken/server/internal/utils/fileio"
+	"github.com/oidc-mytoken/server/internal/utils/i18n"
 	"github.com/oidc-mytoken/server/internal/utils/iputils"
 	loggerUtils "github.com/oidc-mytoken/server/internal/utils/logger"
+	"github.com/oidc-mytoken/server/internal/utils/templating"
 )
 
 //go:embed web/static
@@ -69,6 +72,29 @@ func addMiddlewares(s fiber.Router) {
 	addHelmetMiddleware(s)
 	addStaticFiles(s)
 	addCompressMiddleware(s)
+	addLanguageMiddleware(s)
+}
+
+// addLanguageMiddleware binds the language negotiated from the Accept-Language header and a translation lambda to
+// all rendered templates
+func addLanguageMiddleware(s fiber.Router) {
+	s.Use(
+		func(ctx *fiber.Ctx) error {
+			lang := ctx.AcceptsLanguages(i18n.Languages()...)
+			if lang == "" {
+				lang = i18n.DefaultLanguage()
+			}
+			if err := ctx.Bind(
+				fiber.Map{
+					templating.MustacheKeyLanguage:  lang,
+					templating.MustacheKeyTranslate: i18n.Lambda(lang),
+				},
+			); err != nil {
+				return err
+			}
+			return ctx.Next()
+		},
+	)
 }
 
 func addLoggerMiddleware(s fiber.Router) {
@@ -202,3 +228,14 @@ func returnGroupBasicMiddleware() fiber.Handler {
 		},
 	)
 }
+
+func returnClientRegistryAdminBasicMiddleware() fiber.Handler {
+	return basicauth.New(
+		basicauth.Config{
+			Authorizer: func(user string, pw string) bool {
+				expected, ok := config.Get().Features.ClientRegistry.Admins[user]
+				return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(pw)) == 1
+			},
+		},
+	)
+}
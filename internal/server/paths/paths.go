@@ -20,16 +20,21 @@ const WellknownOpenIDFederation = "/.well-known/openid-federation"
 
 func defaultAPIPaths(api string) APIPaths {
 	return APIPaths{
-		MytokenEndpoint:       utils.CombineURLPath(api, "/token/my"),
-		AccessTokenEndpoint:   utils.CombineURLPath(api, "/token/access"),
-		TokenInfoEndpoint:     utils.CombineURLPath(api, "/tokeninfo"),
-		RevocationEndpoint:    utils.CombineURLPath(api, "/token/revoke"),
-		TokenTransferEndpoint: utils.CombineURLPath(api, "/token/transfer"),
-		UserSettingEndpoint:   utils.CombineURLPath(api, "/settings"),
-		ProfilesEndpoint:      utils.CombineURLPath(api, "/pt"),
-		GuestModeOP:           utils.CombineURLPath(api, "/guests"),
-		NotificationEndpoint:  utils.CombineURLPath(api, "/notifications"),
-		CalendarEndpoint:      utils.CombineURLPath(api, "/notifications/calendars"),
+		MytokenEndpoint:        utils.CombineURLPath(api, "/token/my"),
+		AccessTokenEndpoint:    utils.CombineURLPath(api, "/token/access"),
+		TokenInfoEndpoint:      utils.CombineURLPath(api, "/tokeninfo"),
+		RevocationEndpoint:     utils.CombineURLPath(api, "/token/revoke"),
+		SuspensionEndpoint:     utils.CombineURLPath(api, "/token/suspension"),
+		RenewalEndpoint:        utils.CombineURLPath(api, "/token/renewal"),
+		SSHCertificateEndpoint: utils.CombineURLPath(api, "/token/ssh-certificate"),
+		TokenTransferEndpoint:  utils.CombineURLPath(api, "/token/transfer"),
+		UserSettingEndpoint:    utils.CombineURLPath(api, "/settings"),
+		ProfilesEndpoint:       utils.CombineURLPath(api, "/pt"),
+		GuestModeOP:            utils.CombineURLPath(api, "/guests"),
+		NotificationEndpoint:   utils.CombineURLPath(api, "/notifications"),
+		CalendarEndpoint:       utils.CombineURLPath(api, "/notifications/calendars"),
+		StepUpEndpoint:         utils.CombineURLPath(api, "/step-up"),
+		ClientRegistryEndpoint: utils.CombineURLPath(api, "/admin/clients"),
 	}
 }
 
@@ -42,11 +47,15 @@ func init() {
 		other: GeneralPaths{
 			ConfigurationEndpoint:          WellknownMytokenConfiguration,
 			FederationEndpoint:             WellknownOpenIDFederation,
+			FederationFetchEndpoint:        "/federation/fetch",
+			FederationListEndpoint:         "/federation/list",
+			FederationResolveEndpoint:      "/federation/resolve",
 			OIDCRedirectEndpoint:           "/redirect",
 			JWKSEndpoint:                   "/jwks",
 			ConsentEndpoint:                "/c",
 			Privacy:                        "/privacy",
 			CalendarEndpoint:               "/calendars",
+			CalDAVEndpoint:                 "/caldav",
 			ActionsEndpoint:                "/actions",
 			NotificationManagementEndpoint: "/notifications",
 		},
@@ -62,27 +71,36 @@ type paths struct {
 type GeneralPaths struct {
 	ConfigurationEndpoint          string
 	FederationEndpoint             string
+	FederationFetchEndpoint        string
+	FederationListEndpoint         string
+	FederationResolveEndpoint      string
 	OIDCRedirectEndpoint           string
 	JWKSEndpoint                   string
 	ConsentEndpoint                string
 	Privacy                        string
 	CalendarEndpoint               string
+	CalDAVEndpoint                 string
 	ActionsEndpoint                string
 	NotificationManagementEndpoint string
 }
 
 // APIPaths holds all api route paths
 type APIPaths struct {
-	MytokenEndpoint       string
-	AccessTokenEndpoint   string
-	TokenInfoEndpoint     string
-	RevocationEndpoint    string
-	TokenTransferEndpoint string
-	UserSettingEndpoint   string
-	ProfilesEndpoint      string
-	GuestModeOP           string
-	NotificationEndpoint  string
-	CalendarEndpoint      string
+	MytokenEndpoint        string
+	AccessTokenEndpoint    string
+	TokenInfoEndpoint      string
+	RevocationEndpoint     string
+	SuspensionEndpoint     string
+	RenewalEndpoint        string
+	SSHCertificateEndpoint string
+	TokenTransferEndpoint  string
+	UserSettingEndpoint    string
+	ProfilesEndpoint       string
+	GuestModeOP            string
+	NotificationEndpoint   string
+	CalendarEndpoint       string
+	StepUpEndpoint         string
+	ClientRegistryEndpoint string
 }
 
 // GetCurrentAPIPaths returns the api paths for the most recent major version
@@ -16,6 +16,7 @@ var (
 	RedirectURI                    string
 	ConsentEndpoint                string
 	CalendarDownloadEndpoint       string
+	CalDAVEndpoint                 string
 	ActionsEndpoint                string
 	NotificationManagementEndpoint string
 	ConfigEndpoint                 string
@@ -27,6 +28,7 @@ func Init() {
 	RedirectURI = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.OIDCRedirectEndpoint)
 	ConsentEndpoint = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.ConsentEndpoint)
 	CalendarDownloadEndpoint = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.CalendarEndpoint)
+	CalDAVEndpoint = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.CalDAVEndpoint)
 	ActionsEndpoint = utils.CombineURLPath(config.Get().IssuerURL, generalPaths.ActionsEndpoint)
 	NotificationManagementEndpoint = utils.CombineURLPath(
 		config.Get().IssuerURL,
@@ -78,6 +78,9 @@ func initTemplateEngine() {
 func Init() {
 	initTemplateEngine()
 	serverConfig.ProxyHeader = config.Get().Server.ProxyHeader
+	if calDAVEnabled() {
+		serverConfig.RequestMethods = append(append([]string{}, fiber.DefaultMethods...), calendar.CalDAVMethods...)
+	}
 	server = fiber.New(serverConfig)
 	addMiddlewares(server)
 	addRoutes(server)
@@ -89,7 +92,7 @@ func Init() {
 			) != "" {
 				ctx.Status(fiber.StatusNotFound)
 				return ctx.Render(
-					"sites/404", map[string]interface{}{
+					"sites/404", fiber.Map{
 						"empty-navbar": true,
 					}, "layouts/main",
 				)
@@ -112,6 +115,11 @@ func addRoutes(s fiber.Router) {
 	s.Get(paths.WellknownOpenIDConfiguration, toFiberHandler(configuration.HandleConfiguration))
 	if config.Get().Features.Federation.Enabled {
 		s.Get(generalPaths.FederationEndpoint, federation.HandleEntityConfiguration)
+		if config.Get().Features.Federation.Authority.Enabled {
+			s.Get(generalPaths.FederationFetchEndpoint, federation.HandleFetch)
+			s.Get(generalPaths.FederationListEndpoint, federation.HandleSubordinateListing)
+			s.Get(generalPaths.FederationResolveEndpoint, federation.HandleResolve)
+		}
 	}
 	s.Get(generalPaths.JWKSEndpoint, endpoints.HandleJWKS)
 	s.Get(generalPaths.OIDCRedirectEndpoint, redirect.HandleOIDCRedirect)
@@ -123,9 +131,29 @@ func addRoutes(s fiber.Router) {
 	s.Get(generalPaths.Privacy, handlePrivacy)
 	s.Get(utils.CombineURLPath(generalPaths.CalendarEndpoint, ":id"), calendar.HandleGetICS)
 	s.Get(generalPaths.ActionsEndpoint, actions.HandleActions)
+	if calDAVEnabled() {
+		addCalDAVRoutes(s)
+	}
 	addAPIRoutes(s)
 }
 
+func calDAVEnabled() bool {
+	return config.Get().Features.Notifications.ICS.Enabled && config.Get().Features.Notifications.ICS.CalDAV.Enabled
+}
+
+func addCalDAVRoutes(s fiber.Router) {
+	collectionPath := utils.CombineURLPath(paths.GetGeneralPaths().CalDAVEndpoint, ":id")
+	for _, p := range []string{collectionPath, utils.CombineURLPath(collectionPath, ":resource")} {
+		s.Options(p, calendar.HandleCalDAVOptions)
+		s.Get(p, calendar.HandleCalDAVGet)
+		s.Add(calendar.MethodPropfind, p, calendar.HandleCalDAVPropfind)
+		s.Add(calendar.MethodReport, p, calendar.HandleCalDAVReport)
+		for _, m := range calendar.CalDAVWriteMethods {
+			s.Add(m, p, calendar.HandleCalDAVReadOnly)
+		}
+	}
+}
+
 func addWebRoutes(s fiber.Router) {
 	generalPaths := paths.GetGeneralPaths()
 	s.Get("/", handleIndex)
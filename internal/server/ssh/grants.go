@@ -0,0 +1,52 @@
+package ssh
+
+import (
+	"encoding/json"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/endpoints/settings/grants"
+	"github.com/oidc-mytoken/server/internal/endpoints/settings/grants/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+)
+
+func handleListGrants(s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle list grants from ssh")
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	umt := mt.ToUniversalMytoken()
+	return writeRes(s, grants.ListGrants(rlog, mt, &umt, clientMetaData))
+}
+
+func handleEditGrant(reqData []byte, s ssh.Session, enable bool) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.WithField("enable", enable).Debug("Handle edit grant from ssh")
+	req, errRes := parseEditGrantRequest(reqData)
+	if errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	if errRes = auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	umt := mt.ToUniversalMytoken()
+	return writeRes(s, grants.EditGrant(rlog, mt, &umt, clientMetaData, req.GrantType, enable))
+}
+
+// parseEditGrantRequest parses the request data of an enable-grant or disable-grant request; the request must
+// contain a valid grant type
+func parseEditGrantRequest(reqData []byte) (pkg.GrantTypeRequest, *model.Response) {
+	req := pkg.GrantTypeRequest{GrantType: -1}
+	if len(reqData) > 0 {
+		if err := errors.WithStack(json.Unmarshal(reqData, &req)); err != nil {
+			return req, model.ErrorToBadRequestErrorResponse(err)
+		}
+	}
+	if !req.GrantType.Valid() {
+		return req, model.BadRequestErrorResponse("no valid 'grant_type' found")
+	}
+	return req, nil
+}
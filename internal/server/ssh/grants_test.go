@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/oidc-mytoken/server/internal/model"
+)
+
+func TestParseEditGrantRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		expected  model.GrantType
+		expStatus int
+	}{
+		{name: "ssh", data: `{"grant_type":"ssh"}`, expected: model.GrantTypeSSH},
+		{name: "no data", data: "", expStatus: fiber.StatusBadRequest},
+		{name: "no grant type", data: `{}`, expStatus: fiber.StatusBadRequest},
+		{name: "unknown grant type", data: `{"grant_type":"password"}`, expStatus: fiber.StatusBadRequest},
+		{name: "invalid json", data: `{"grant_type":`, expStatus: fiber.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				req, errRes := parseEditGrantRequest([]byte(test.data))
+				if test.expStatus == 0 {
+					if errRes != nil {
+						t.Fatalf("unexpected error response: %+v", errRes.Response)
+					}
+					if req.GrantType != test.expected {
+						t.Errorf("expected grant type %d, got %d", test.expected, req.GrantType)
+					}
+					return
+				}
+				if errRes == nil {
+					t.Fatal("expected an error response")
+				}
+				if errRes.Status != test.expStatus {
+					t.Errorf("expected status %d, got %d", test.expStatus, errRes.Status)
+				}
+			},
+		)
+	}
+}
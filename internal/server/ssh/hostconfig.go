@@ -24,5 +24,6 @@ func entryName(name string) string {
 
 // CreateHostConfigEntry creates an ssh config host entry for the passed ssh username and name
 func CreateHostConfigEntry(sshUser, name string) string {
-	return fmt.Sprintf(hostEntryTemplate, entryName(name), config.Get().Host, 2222, sshUser)
+	sshConf := config.Get().Features.SSH
+	return fmt.Sprintf(hostEntryTemplate, entryName(name), sshConf.AdvertisedHost, sshConf.AdvertisedPort, sshUser)
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/oidc-mytoken/api/v0"
 	"github.com/oidc-mytoken/utils/utils/ternary"
 
+	"github.com/oidc-mytoken/server/internal/config"
 	"github.com/oidc-mytoken/server/internal/endpoints/token/mytoken/pkg"
 	"github.com/oidc-mytoken/server/internal/model"
 	mytoken2 "github.com/oidc-mytoken/server/internal/mytoken"
@@ -15,6 +16,18 @@ import (
 )
 
 func handleSSHMytoken(reqData []byte, s ssh.Session) error {
+	return _handleSSHMytoken(reqData, s, false)
+}
+
+// handleSSHTransferCode creates a new mytoken from the request and returns a transfer code for it
+func handleSSHTransferCode(reqData []byte, s ssh.Session) error {
+	if !config.Get().Features.TransferCodes.Enabled {
+		return writeErrRes(s, model.BadRequestErrorResponse("transfer codes are not enabled on this instance"))
+	}
+	return _handleSSHMytoken(reqData, s, true)
+}
+
+func _handleSSHMytoken(reqData []byte, s ssh.Session, transferCode bool) error {
 	ctx := s.Context()
 	req := pkg.NewMytokenRequest()
 	req.GrantType = model.GrantTypeMytoken
@@ -27,6 +40,10 @@ func handleSSHMytoken(reqData []byte, s ssh.Session) error {
 		IP:        ctx.Value("ip").(string),
 		UserAgent: ctx.Value("user_agent").(string),
 	}
+	if transferCode {
+		req.ResponseType = model.ResponseTypeTransferCode
+		req.MaxTokenLen = 0
+	}
 	req.Mytoken = ctx.Value("mytoken").(*mytoken.Mytoken).ToUniversalMytoken()
 	rlog := logger.GetSSHRequestLogger(ctx.Value("session").(string))
 	rlog.Debug("Handle mytoken from ssh")
@@ -40,5 +57,16 @@ func handleSSHMytoken(reqData []byte, s ssh.Session) error {
 		return writeErrRes(s, res)
 	}
 	tokenRes := res.Response.(pkg.MytokenResponse)
+	if transferCode {
+		return writeJSON(
+			s, pkg.TransferCodeResponse{
+				TransferCodeResponse: api.TransferCodeResponse{
+					TransferCode: tokenRes.TransferCode,
+					ExpiresIn:    tokenRes.ExpiresIn,
+				},
+				MytokenType: model.ResponseTypeTransferCode,
+			},
+		)
+	}
 	return writeString(s, ternary.IfNotEmptyOr(tokenRes.Mytoken, tokenRes.TransferCode))
 }
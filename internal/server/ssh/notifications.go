@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"encoding/json"
+
+	"github.com/gliderlabs/ssh"
+
+	"github.com/oidc-mytoken/server/internal/endpoints/notification"
+	"github.com/oidc-mytoken/server/internal/endpoints/notification/calendar"
+	"github.com/oidc-mytoken/server/internal/endpoints/notification/pkg"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+)
+
+func handleListNotifications(s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle list notifications from ssh")
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	umt := mt.ToUniversalMytoken()
+	return writeRes(s, notification.ListNotifications(rlog, mt, &umt, clientMetaData))
+}
+
+func handleSubscribeNotification(reqData []byte, s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle subscribe notification from ssh")
+	var req pkg.SubscribeNotificationRequest
+	if len(reqData) > 0 {
+		if err := json.Unmarshal(reqData, &req); err != nil {
+			return err
+		}
+	}
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	req.Mytoken = mt.ToUniversalMytoken()
+	return writeRes(s, notification.Subscribe(rlog, mt, req, clientMetaData))
+}
+
+func handleListCalendars(s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle list calendars from ssh")
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	umt := mt.ToUniversalMytoken()
+	return writeRes(s, calendar.ListCalendars(rlog, mt, &umt, clientMetaData))
+}
+
+type calendarRequest struct {
+	Name string `json:"name"`
+}
+
+// handleCalendar writes the ics of a calendar of the user to the ssh session
+func handleCalendar(reqData []byte, s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle get calendar from ssh")
+	var req calendarRequest
+	if len(reqData) > 0 {
+		if err := json.Unmarshal(reqData, &req); err != nil {
+			return err
+		}
+	}
+	if req.Name == "" {
+		return writeErrRes(s, model.BadRequestErrorResponse("required parameter 'name' is missing"))
+	}
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	info, errRes := calendar.GetICSByName(rlog, mt.ID, req.Name)
+	if errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	return writeString(s, info.ICS)
+}
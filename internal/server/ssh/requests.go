@@ -0,0 +1,106 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/gofiber/fiber/v2"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/utils"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/sshrepo"
+	"github.com/oidc-mytoken/server/internal/model"
+	"github.com/oidc-mytoken/server/internal/model/sshkey"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/logger"
+)
+
+// Additional ssh request types that are not (yet) part of the api
+const (
+	sshRequestRevoke                = "revoke"
+	sshRequestTransferCode          = "transfer-code"
+	sshRequestListNotifications     = "list-notifications"
+	sshRequestSubscribeNotification = "subscribe-notification"
+	sshRequestListCalendars         = "list-calendars"
+	sshRequestCalendar              = "calendar"
+	sshRequestListGrants            = "list-grants"
+	sshRequestEnableGrant           = "enable-grant"
+	sshRequestDisableGrant          = "disable-grant"
+)
+
+var allRequestTypes = []string{
+	api.SSHRequestMytoken,
+	api.SSHRequestAccessToken,
+	api.SSHRequestTokenInfoIntrospect,
+	api.SSHRequestTokenInfoHistory,
+	api.SSHRequestTokenInfoSubtokens,
+	api.SSHRequestTokenInfoListMytokens,
+	sshRequestRevoke,
+	sshRequestTransferCode,
+	sshRequestListNotifications,
+	sshRequestSubscribeNotification,
+	sshRequestListCalendars,
+	sshRequestCalendar,
+	sshRequestListGrants,
+	sshRequestEnableGrant,
+	sshRequestDisableGrant,
+}
+
+// IsRequestType checks if the passed string is a supported ssh request type
+func IsRequestType(requestType string) bool {
+	return utils.StringInSlice(requestType, allRequestTypes)
+}
+
+// sessionInfo returns the mytoken, the client metadata, and a logger for an ssh session
+func sessionInfo(s ssh.Session) (*mytoken.Mytoken, *api.ClientMetaData, log.Ext1FieldLogger) {
+	ctx := s.Context()
+	mt := ctx.Value("mytoken").(*mytoken.Mytoken)
+	clientMetaData := &api.ClientMetaData{
+		IP:        ctx.Value("ip").(string),
+		UserAgent: ctx.Value("user_agent").(string),
+	}
+	rlog := logger.GetSSHRequestLogger(ctx.Value("session").(string))
+	return mt, clientMetaData, rlog
+}
+
+// writeRes writes a model.Response to the ssh session; error responses are written as an error message, successful
+// responses are written as json if they have a body
+func writeRes(s ssh.Session, res *model.Response) error {
+	if res.Status >= 400 {
+		return writeErrRes(s, res)
+	}
+	if res.Response == nil {
+		return nil
+	}
+	return writeJSON(s, res.Response)
+}
+
+// checkAndLogRequest checks that the ssh key used for this session may be used for the passed request type and logs
+// the request in the ssh key's history
+func checkAndLogRequest(s ssh.Session, requestType string) *model.Response {
+	if !IsRequestType(requestType) {
+		// Unknown requests are rejected later with a help message
+		return nil
+	}
+	ctx := s.Context()
+	_, clientMetaData, rlog := sessionInfo(s)
+	keyRestrictions := ctx.Value("key_restrictions").(sshkey.Restrictions)
+	if !keyRestrictions.RequestAllowed(requestType) {
+		return &model.Response{
+			Status: fiber.StatusForbidden,
+			Response: api.Error{
+				Error:            api.ErrorStrAccessDenied,
+				ErrorDescription: fmt.Sprintf("this ssh key cannot be used for '%s' requests", requestType),
+			},
+		}
+	}
+	if err := sshrepo.LogEvent(
+		rlog, nil, ctx.Value("ssh_key_id").(string), requestType, clientMetaData.IP, clientMetaData.UserAgent,
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oidc-mytoken/api/v0"
+)
+
+func TestIsRequestType(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestType string
+		expected    bool
+	}{
+		{name: "mytoken", requestType: api.SSHRequestMytoken, expected: true},
+		{name: "revoke", requestType: sshRequestRevoke, expected: true},
+		{name: "transfer code", requestType: sshRequestTransferCode, expected: true},
+		{name: "list notifications", requestType: sshRequestListNotifications, expected: true},
+		{name: "subscribe notification", requestType: sshRequestSubscribeNotification, expected: true},
+		{name: "list calendars", requestType: sshRequestListCalendars, expected: true},
+		{name: "calendar", requestType: sshRequestCalendar, expected: true},
+		{name: "list grants", requestType: sshRequestListGrants, expected: true},
+		{name: "enable grant", requestType: sshRequestEnableGrant, expected: true},
+		{name: "disable grant", requestType: sshRequestDisableGrant, expected: true},
+		{name: "empty", requestType: "", expected: false},
+		{name: "unknown", requestType: "delete-everything", expected: false},
+		{name: "case sensitive", requestType: "Revoke", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := IsRequestType(test.requestType); got != test.expected {
+					t.Errorf("expected %v, got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestHelpErrorListsAllRequestTypes(t *testing.T) {
+	supported := helpError[strings.Index(helpError, "Supported actions are:"):]
+	for _, requestType := range allRequestTypes {
+		if !strings.Contains(supported, requestType) {
+			t.Errorf("help message does not list request type '%s'", requestType)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ssh
+
+import (
+	"encoding/json"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/oidc-mytoken/api/v0"
+
+	"github.com/oidc-mytoken/server/internal/endpoints/revocation"
+	mytoken2 "github.com/oidc-mytoken/server/internal/mytoken"
+	"github.com/oidc-mytoken/server/internal/utils/auth"
+)
+
+// handleRevoke revokes the mytoken linked to the ssh key or, if a mom_id is given, another mytoken
+func handleRevoke(reqData []byte, s ssh.Session) error {
+	mt, clientMetaData, rlog := sessionInfo(s)
+	rlog.Debug("Handle revocation from ssh")
+	req := api.RevocationRequest{}
+	if len(reqData) > 0 {
+		if err := json.Unmarshal(reqData, &req); err != nil {
+			return err
+		}
+	}
+	if errRes := auth.RequireMytokenNotRevoked(rlog, nil, mt, clientMetaData); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	umt := mt.ToUniversalMytoken()
+	if req.MOMID != "" {
+		return writeRes(s, revocation.RevokeByMOMID(rlog, req, umt, mt, clientMetaData, ""))
+	}
+	if errRes := mytoken2.RevokeMytoken(rlog, nil, mt.ID, umt.JWT, req.Recursive, mt.OIDCIssuer); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+	return nil
+}
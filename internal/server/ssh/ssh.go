@@ -82,6 +82,10 @@ func _handleSSHSession(s ssh.Session) (err error) {
 		}
 	}
 
+	if errRes := checkAndLogRequest(s, reqType); errRes != nil {
+		return writeErrRes(s, errRes)
+	}
+
 	switch reqType {
 	case api.SSHRequestMytoken:
 		return handleSSHMytoken(req, s)
@@ -95,6 +99,24 @@ func _handleSSHSession(s ssh.Session) (err error) {
 		return handleSubtokens(s)
 	case api.SSHRequestTokenInfoListMytokens:
 		return handleListMytokens(s)
+	case sshRequestRevoke:
+		return handleRevoke(req, s)
+	case sshRequestTransferCode:
+		return handleSSHTransferCode(req, s)
+	case sshRequestListNotifications:
+		return handleListNotifications(s)
+	case sshRequestSubscribeNotification:
+		return handleSubscribeNotification(req, s)
+	case sshRequestListCalendars:
+		return handleListCalendars(s)
+	case sshRequestCalendar:
+		return handleCalendar(req, s)
+	case sshRequestListGrants:
+		return handleListGrants(s)
+	case sshRequestEnableGrant:
+		return handleEditGrant(req, s, true)
+	case sshRequestDisableGrant:
+		return handleEditGrant(req, s, false)
 	default:
 		return errors.New(fmt.Sprintf("Unknown request\n%s", helpError))
 	}
@@ -102,5 +124,7 @@ func _handleSSHSession(s ssh.Session) (err error) {
 
 const helpError = `Syntax for a request is:
 	$ ssh <host_info> <action> [<mime_type> <data>]
+Supported actions are: MT, AT, introspect, history, list-subtokens, list-all-mytokens, revoke, transfer-code,
+list-notifications, subscribe-notification, list-calendars, calendar, list-grants, enable-grant, disable-grant
 See https://mytoken-docs.data.kit.edu/start/ssh/#using-the-ssh-grant for more information.
 `
@@ -3,10 +3,12 @@ package ssh
 import (
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/gliderlabs/ssh"
 	"github.com/pires/go-proxyproto"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	gossh "golang.org/x/crypto/ssh"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/oidc-mytoken/server/internal/db/dbrepo/sshrepo"
 	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
 	"github.com/oidc-mytoken/server/internal/utils/hashutils"
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
 	"github.com/oidc-mytoken/server/internal/utils/logger"
 )
 
@@ -22,6 +25,11 @@ func checkPubKey(ctx ssh.Context, key ssh.PublicKey) bool {
 	rlog := logger.GetSSHRequestLogger(sessionID)
 	sshUser := ctx.User()
 	sshUserHash := hashutils.SHA3_512Str([]byte(sshUser))
+	cert, isCert := key.(*gossh.Certificate)
+	if isCert {
+		// Certificates are linked to the mytoken through the ca that signed them
+		key = cert.SignatureKey
+	}
 	sshKeyFP := gossh.FingerprintSHA256(key)
 	ip := ctx.RemoteAddr().String()
 	if addr, ok := ctx.RemoteAddr().(*net.TCPAddr); ok {
@@ -34,6 +42,7 @@ func checkPubKey(ctx ssh.Context, key ssh.PublicKey) bool {
 			"key_fp":     sshKeyFP,
 			"ip":         ip,
 			"user_agent": userAgent,
+			"cert":       isCert,
 		},
 	).Debug("Check ssh pub key")
 
@@ -46,6 +55,30 @@ func checkPubKey(ctx ssh.Context, key ssh.PublicKey) bool {
 		log.WithField("user_hash", sshUserHash).WithField("key_fp", sshKeyFP).Trace("SSH grant not enabled")
 		return false
 	}
+	if info.KeyRestrictions.Expired() {
+		log.WithField("user_hash", sshUserHash).WithField("key_fp", sshKeyFP).Debug("ssh key expired")
+		return false
+	}
+	if !info.KeyRestrictions.IPAllowed(ip) {
+		log.WithField("user_hash", sshUserHash).WithField("key_fp", sshKeyFP).WithField("ip", ip).Debug(
+			"ssh key not allowed from this ip",
+		)
+		return false
+	}
+	if isCert != info.CA {
+		log.WithField("user_hash", sshUserHash).WithField("key_fp", sshKeyFP).Trace(
+			"ssh key must be used as certificate authority if and only if it was added as one",
+		)
+		return false
+	}
+	if isCert {
+		if err = checkCertificate(cert, sshUser, ip, info.AllowedPrincipals()); err != nil {
+			log.WithField("user_hash", sshUserHash).WithField("key_fp", sshKeyFP).WithError(err).Debug(
+				"invalid ssh certificate",
+			)
+			return false
+		}
+	}
 	mt, err := info.Decrypt(sshUser)
 	if err != nil {
 		log.WithField("user_hash", sshUserHash).WithField(
@@ -65,36 +98,74 @@ func checkPubKey(ctx ssh.Context, key ssh.PublicKey) bool {
 	ctx.SetValue("ip", ip)
 	ctx.SetValue("user_agent", userAgent)
 	ctx.SetValue("session", sessionID)
+	ctx.SetValue("ssh_key_id", info.KeyID)
+	ctx.SetValue("key_restrictions", info.KeyRestrictions)
 	return true
 }
 
+const certOptionSourceAddress = "source-address"
+
+// checkCertificate checks that an ssh user certificate is currently valid, can be used from the client's ip, and was
+// issued for one of the allowed principals; if no principals are allowed, the certificate must be issued for the ssh
+// user
+func checkCertificate(cert *gossh.Certificate, sshUser, ip string, allowedPrincipals []string) error {
+	if cert.CertType != gossh.UserCert {
+		return errors.New("not a user certificate")
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("certificate has no principals")
+	}
+	if sourceAddresses, ok := cert.CriticalOptions[certOptionSourceAddress]; ok {
+		if !iputils.IPIsIn(ip, strings.Split(sourceAddresses, ",")) {
+			return errors.New("certificate cannot be used from this ip")
+		}
+	}
+	if len(allowedPrincipals) == 0 {
+		allowedPrincipals = []string{sshUser}
+	}
+	checker := gossh.CertChecker{
+		SupportedCriticalOptions: []string{certOptionSourceAddress},
+	}
+	var err error
+	for _, p := range allowedPrincipals {
+		if err = checker.CheckCert(p, cert); err == nil {
+			return nil
+		}
+	}
+	return errors.WithStack(err)
+}
+
 // Serve starts the ssh server
 func Serve() {
 	ssh.Handle(handleSSHSession)
 
-	log.WithField("port", 2222).Info("starting ssh server")
-	fmt.Println("Starting ssh server on port 2222 ...")
+	sshConf := config.Get().Features.SSH
 	server := &ssh.Server{
-		Addr:             ":2222",
-		MaxTimeout:       30 * time.Second,
-		IdleTimeout:      10 * time.Second,
+		MaxTimeout:       time.Duration(sshConf.MaxTimeout) * time.Second,
+		IdleTimeout:      time.Duration(sshConf.IdleTimeout) * time.Second,
 		PublicKeyHandler: checkPubKey,
 	}
 	if err := server.SetOption(ssh.NoPty()); err != nil {
 		log.WithError(err).Fatal()
 	}
-	for _, k := range config.Get().Features.SSH.PrivateKeys {
+	for _, k := range sshConf.PrivateKeys {
 		server.AddHostKey(k)
 	}
-	ln, err := net.Listen("tcp", server.Addr)
-	if err != nil {
-		log.WithError(err).Fatal()
-	}
-	if config.Get().Features.SSH.UseProxyProtocol {
-		ln = &proxyproto.Listener{
-			Listener:          ln,
-			ReadHeaderTimeout: 1 * time.Second,
+	for _, addr := range sshConf.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.WithError(err).Fatal()
+		}
+		if sshConf.UseProxyProtocol {
+			ln = &proxyproto.Listener{
+				Listener:          ln,
+				ReadHeaderTimeout: 1 * time.Second,
+			}
 		}
+		log.WithField("addr", addr).Info("starting ssh server")
+		fmt.Printf("Starting ssh server on %s ...\n", addr)
+		go func(ln net.Listener) {
+			log.WithError(server.Serve(ln)).Fatal()
+		}(ln)
 	}
-	log.WithError(server.Serve(ln)).Fatal()
 }
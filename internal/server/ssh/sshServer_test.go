@@ -0,0 +1,142 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+)
+
+func newTestCertificate(t *testing.T, modify func(cert *gossh.Certificate)) *gossh.Certificate {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := gossh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, err := gossh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cert := &gossh.Certificate{
+		Key:             userKey,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"alice"},
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+	if modify != nil {
+		modify(cert)
+	}
+	if err = cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCheckCertificate(t *testing.T) {
+	cache.InitCache()
+	tests := []struct {
+		name              string
+		modify            func(cert *gossh.Certificate)
+		sshUser           string
+		allowedPrincipals []string
+		valid             bool
+	}{
+		{
+			name:              "Allowed principal",
+			sshUser:           "randomuser",
+			allowedPrincipals: []string{"bob", "alice"},
+			valid:             true,
+		},
+		{
+			name:              "Principal not allowed",
+			sshUser:           "randomuser",
+			allowedPrincipals: []string{"bob"},
+			valid:             false,
+		},
+		{
+			name:    "SSH user as principal",
+			sshUser: "alice",
+			valid:   true,
+		},
+		{
+			name:    "SSH user not a principal",
+			sshUser: "randomuser",
+			valid:   false,
+		},
+		{
+			name: "No principals",
+			modify: func(cert *gossh.Certificate) {
+				cert.ValidPrincipals = nil
+			},
+			sshUser: "alice",
+			valid:   false,
+		},
+		{
+			name: "Expired",
+			modify: func(cert *gossh.Certificate) {
+				cert.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+			},
+			sshUser: "alice",
+			valid:   false,
+		},
+		{
+			name: "Host certificate",
+			modify: func(cert *gossh.Certificate) {
+				cert.CertType = gossh.HostCert
+			},
+			sshUser: "alice",
+			valid:   false,
+		},
+		{
+			name: "Matching source address",
+			modify: func(cert *gossh.Certificate) {
+				cert.CriticalOptions = map[string]string{certOptionSourceAddress: "10.0.0.0/8,192.168.0.1"}
+			},
+			sshUser: "alice",
+			valid:   true,
+		},
+		{
+			name: "Other source address",
+			modify: func(cert *gossh.Certificate) {
+				cert.CriticalOptions = map[string]string{certOptionSourceAddress: "192.168.0.1"}
+			},
+			sshUser: "alice",
+			valid:   false,
+		},
+		{
+			name: "Unsupported critical option",
+			modify: func(cert *gossh.Certificate) {
+				cert.CriticalOptions = map[string]string{"force-command": "/bin/true"}
+			},
+			sshUser: "alice",
+			valid:   false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				cert := newTestCertificate(t, test.modify)
+				err := checkCertificate(cert, test.sshUser, "10.1.2.3", test.allowedPrincipals)
+				if test.valid && err != nil {
+					t.Errorf("Expected certificate to be valid, but got error: %s", err)
+				}
+				if !test.valid && err == nil {
+					t.Error("Expected certificate to be invalid, but it was accepted")
+				}
+			},
+		)
+	}
+}
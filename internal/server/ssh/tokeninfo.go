@@ -31,7 +31,8 @@ func handleIntrospect(s ssh.Session) error {
 		rlog, func(tx *sqlx.Tx) error {
 			errRes = auth.RequireMytokenNotRevoked(rlog, tx, mt, clientMetaData)
 			if errRes != nil {
-				return errors.New("rollback")
+				// Don't roll back, so an automated response to suspicious activity is kept
+				return nil
 			}
 			res = tokeninfo.HandleTokenInfoIntrospect(rlog, tx, mt, model.ResponseTypeToken, clientMetaData)
 			if res.Status >= 400 {
@@ -63,7 +64,8 @@ func handleHistory(s ssh.Session) error {
 		rlog, func(tx *sqlx.Tx) error {
 			errRes = auth.RequireMytokenNotRevoked(rlog, tx, mt, clientMetaData)
 			if errRes != nil {
-				return errors.New("rollback")
+				// Don't roll back, so an automated response to suspicious activity is kept
+				return nil
 			}
 			res = tokeninfo.HandleTokenInfoHistory(rlog, tx, &pkg.TokenInfoRequest{}, mt, clientMetaData)
 			if res.Status >= 400 {
@@ -95,7 +97,8 @@ func handleSubtokens(s ssh.Session) error {
 		rlog, func(tx *sqlx.Tx) error {
 			errRes = auth.RequireMytokenNotRevoked(rlog, tx, mt, clientMetaData)
 			if errRes != nil {
-				return errors.New("rollback")
+				// Don't roll back, so an automated response to suspicious activity is kept
+				return nil
 			}
 			res = tokeninfo.HandleTokenInfoSubtokens(rlog, tx, &pkg.TokenInfoRequest{}, mt, clientMetaData)
 			if res.Status >= 400 {
@@ -127,7 +130,8 @@ func handleListMytokens(s ssh.Session) error {
 		rlog, func(tx *sqlx.Tx) error {
 			errRes = auth.RequireMytokenNotRevoked(rlog, tx, mt, clientMetaData)
 			if errRes != nil {
-				return errors.New("rollback")
+				// Don't roll back, so an automated response to suspicious activity is kept
+				return nil
 			}
 			res = tokeninfo.HandleTokenInfoList(rlog, tx, &pkg.TokenInfoRequest{}, mt, clientMetaData)
 			if res.Status >= 400 {
@@ -39,3 +39,37 @@ function cancel() {
         contentType: "application/json"
     });
 }
+
+const $stepUpHint = $('#step-up-hint');
+
+function consentCode() {
+    let path = window.location.pathname.replace(/\/+$/, "");
+    return path.substring(path.lastIndexOf("/") + 1);
+}
+
+function updateStepUpHint() {
+    let danger = getCheckedCapabilities().some(c => dangerCapabilities.includes(c));
+    if (danger) {
+        $stepUpHint.removeClass('d-none');
+    } else {
+        $stepUpHint.addClass('d-none');
+    }
+}
+
+function consentStepUp() {
+    stepUp(consentCode(), function () {
+        $('#step-up-btn').addClass('d-none');
+        $('#step-up-done').removeClass('d-none');
+    }, function (msg) {
+        $('#error-modal-msg').text(msg);
+        $('#error-modal').modal();
+    });
+}
+
+$(function () {
+    if ($stepUpHint.length === 0) {
+        return;
+    }
+    discovery(updateStepUpHint);
+    $('.capability-check').on('change', updateStepUpHint);
+})
@@ -172,13 +172,92 @@ $('#select-token-type').on('change', function () {
     }
 })
 
+const $subtokenModal = $('#subtoken-id-modal');
+const $subtokenFormID = $('#subtoken-id');
+const $subtokenParentToken = $('#subtoken-parent-token');
+const $mtSubtokenInfo = $('#mt-subtoken-info');
+
+// subtokenParent is the mytoken from which a subtoken is created; if it is not set a new mytoken is created through
+// the oidc flow
+let subtokenParent = undefined;
+
+function startCreateSubtokenID() {
+    let id = this.id.replace("subtoken-", "");
+    $subtokenFormID.val(id);
+    $subtokenParentToken.val('');
+    $('#subtoken-name').text(tokenDetails[id]['name']);
+    $subtokenModal.modal();
+}
+
+function prepareSubtokenCreation() {
+    let details = tokenDetails[$subtokenFormID.val()];
+    let token = $subtokenParentToken.val();
+    if (details === undefined || token === "") {
+        return;
+    }
+    subtokenParent = token;
+    // a subtoken can only be used as often as its parent can still be used
+    let restrictions = (details['restrictions'] || [{}]).map(function (r) {
+        let restr = $.extend({}, r);
+        if (restr['usages_AT'] !== undefined) {
+            restr['usages_AT'] = Math.max(restr['usages_AT'] - (restr['usages_AT_done'] || 0), 0);
+        }
+        if (restr['usages_other'] !== undefined) {
+            restr['usages_other'] = Math.max(restr['usages_other'] - (restr['usages_other_done'] || 0), 0);
+        }
+        delete restr['usages_AT_done'];
+        delete restr['usages_other_done'];
+        return restr;
+    });
+    fillGUIFromRequestData({
+        "restrictions": restrictions,
+        "rotation": details['rotation'] || {},
+        "capabilities": details['capabilities'] || [],
+    });
+    $(prefixId(`profile-template`, mtPrefix)).val("");
+    $('#mt-subtoken-parent-name').text(details['name']);
+    $mtSubtokenInfo.showB();
+    enableCreateNewMytokenButton();
+    $('#mt-tab').click();
+}
+
+function cancelSubtokenCreation() {
+    subtokenParent = undefined;
+    $mtSubtokenInfo.hideB();
+    if ($mtOIDCIss.val() === "") {
+        disableCreateNewMytokenButtonBecauseOfMissingIssuer();
+    }
+}
+
+$('#mt-subtoken-cancel').on('click', cancelSubtokenCreation);
+
+function sendCreateSubtokenReq(data) {
+    data["grant_type"] = "mytoken";
+    data["mytoken"] = subtokenParent;
+    data = JSON.stringify(data);
+    $.ajax({
+        type: "POST",
+        url: storageGet('mytoken_endpoint'),
+        data: data,
+        success: function (res) {
+            cancelSubtokenCreation();
+            showCreatedMT(res);
+        },
+        error: function (errRes) {
+            let errMsg = getErrorMessage(errRes);
+            mtShowError(errMsg, mtPrefix);
+        },
+        dataType: "json",
+        contentType: "application/json"
+    });
+    mtShowPending(mtPrefix);
+    mtResult.showB();
+    mtConfig.hideB();
+}
+
 function sendCreateMTReq() {
     let data = {
         "name": $('#tokenName').val(),
-        "oidc_issuer": $mtOIDCIss.val(),
-        "grant_type": "oidc_flow",
-        "oidc_flow": "authorization_code",
-        "redirect_type": "native",
         "restrictions": getRestrictionsData(mtPrefix),
         "capabilities": getCheckedCapabilities(mtPrefix),
         "application_name": "mytoken webinterface"
@@ -193,6 +272,14 @@ function sendCreateMTReq() {
     if (rot) {
         data["rotation"] = rot;
     }
+    if (subtokenParent !== undefined) {
+        sendCreateSubtokenReq(data);
+        return;
+    }
+    data["oidc_issuer"] = $mtOIDCIss.val();
+    data["grant_type"] = "oidc_flow";
+    data["oidc_flow"] = "authorization_code";
+    data["redirect_type"] = "native";
     data = JSON.stringify(data);
     $.ajax({
         type: "POST",
@@ -310,27 +397,29 @@ function polling_with_callback(code, interval, okCallback, errCallback) {
 }
 
 
+function showCreatedMT(res) {
+    let token_type = res['mytoken_type'];
+    let token = res['mytoken'];
+    switch (token_type) {
+        case "short_token":
+            tokenTypeBadge(mtPrefix).text("Short Token");
+            break;
+        case "transfer_code":
+            tokenTypeBadge(mtPrefix).text("Transfer Code");
+            token = res['transfer_code'];
+            break;
+        case "token":
+        default:
+            tokenTypeBadge(mtPrefix).text("JWT");
+    }
+    storageSet("tokeninfo_token", token);
+    mtResult.hideB();
+    mtConfig.showB();
+    $('#info-tab').click();
+}
+
 function polling(code, interval) {
-    polling_with_callback(code, interval, function (res) {
-        let token_type = res['mytoken_type'];
-        let token = res['mytoken'];
-        switch (token_type) {
-            case "short_token":
-                tokenTypeBadge(mtPrefix).text("Short Token");
-                break;
-            case "transfer_code":
-                tokenTypeBadge(mtPrefix).text("Transfer Code");
-                token = res['transfer_code'];
-                break;
-            case "token":
-            default:
-                tokenTypeBadge(mtPrefix).text("JWT");
-        }
-        storageSet("tokeninfo_token", token);
-        mtResult.hideB();
-        mtConfig.showB();
-        $('#info-tab').click();
-    }, function (errRes) {
+    polling_with_callback(code, interval, showCreatedMT, function (errRes) {
         let error = errRes.responseJSON['error'];
         let message;
         switch (error) {
@@ -4,6 +4,8 @@ const configElements = [
     "usersettings_endpoint",
     "notifications_endpoint",
     "revocation_endpoint",
+    "step_up_endpoint",
+    "suspension_endpoint",
     "tokeninfo_endpoint",
     "token_transfer_endpoint",
     "providers_supported",
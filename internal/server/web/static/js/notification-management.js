@@ -11,6 +11,8 @@ function loadNotificationManagement(...next) {
         url: `${storageGet('notifications_endpoint')}/${mc}`,
         success: function (res) {
             $('#notifications-msg').html(notificationsToTable([res], false, n => `<button class="btn" type="button" onclick="showDeleteNotificationModal('${mc}')" data-toggle="tooltip" data-placement="right" data-original-title="Delete Notification"><i class="fas fa-trash"></i></button>`));
+            setNotificationDigest(res["notification_type"], res["digest"]);
+            setNotificationChatTarget(res["notification_type"], res["chat_target"]);
             let ncs = res["notification_classes"];
             capabilityChecks().prop("checked", false);
             ncs.forEach(function (nc) {
@@ -121,7 +123,9 @@ $('#btn-save-notification-classes').off('click').on('click', function () {
                 loadNotificationManagement,
                 function () {
                     $('.collapse').collapse('hide');
-                    $('.my-expand').text('Expand');
+                    $('.my-expand').each(function () {
+                        $(this).text($(this).data('expand') || 'Expand');
+                    });
                 }
             );
         },
@@ -182,6 +182,7 @@ function _fillModifyNotification(managementCode) {
     $managementCodeInput.val(managementCode);
     $notificationsTokenTable.html("");
     let n = notificationsMap[managementCode];
+    loadNotificationDelivery(managementCode, n["notification_type"]);
     capabilityChecks(notificationListPrefix).prop("checked", false);
     n["notification_classes"].forEach(function (nc) {
         checkCapability(nc, notificationListPrefix);
@@ -802,6 +803,138 @@ function toggle_subscribe_notification_content(prefix = "") {
 
 enableSaveNotificationClassesButton();
 
+const $notificationDigestSelect = $('#notification-digest-select');
+
+function setNotificationDigest(type, digest) {
+    if (type !== "mail") {
+        $('#notification-digest-details').hideB();
+        return;
+    }
+    $notificationDigestSelect.val(digest || "immediate");
+    $('#notification-digest-details').showB();
+}
+
+function loadNotificationDelivery(managementCode, type) {
+    if (type !== "mail" && type !== "chat") {
+        setNotificationDigest(type);
+        setNotificationChatTarget(type);
+        return;
+    }
+    $.ajax({
+        type: "GET",
+        url: `${storageGet('notifications_endpoint')}/${managementCode}`,
+        success: function (res) {
+            setNotificationDigest(res["notification_type"], res["digest"]);
+            setNotificationChatTarget(res["notification_type"], res["chat_target"]);
+        },
+        error: standardErrorHandler
+    });
+}
+
+const $notificationChatKind = $('#notification-chat-kind');
+const $notificationChatAddress = $('#notification-chat-address');
+
+function setNotificationChatTarget(type, target) {
+    if (type !== "mail" && type !== "chat") {
+        $('#notification-chat-details').hideB();
+        return;
+    }
+    $notificationChatAddress.val("");
+    if (target) {
+        let address = target["kind"] === "matrix" ? target["room"] : target["url"];
+        let unverified = target["kind"] === "matrix" && !target["verified"];
+        $('#notification-chat-current-target').text(`${target["kind"]}: ${address}${unverified ? " (unverified)" : ""}`);
+        $('#notification-chat-current').showB();
+        $('#notification-chat-verification-code').val("");
+        $('#notification-chat-verification').toggleClass('d-none', !unverified);
+    } else {
+        $('#notification-chat-current').hideB();
+        $('#notification-chat-verification').hideB();
+    }
+    // the chat target of a chat notification can only be replaced, not removed
+    $('#btn-remove-notification-chat').toggleClass('d-none', type === "chat");
+    $('#notification-chat-details').showB();
+}
+
+function reloadNotificationChatTarget(mc) {
+    $.ajax({
+        type: "GET",
+        url: `${storageGet('notifications_endpoint')}/${mc}`,
+        success: function (res) {
+            setNotificationChatTarget(res["notification_type"], res["chat_target"]);
+        },
+        error: standardErrorHandler
+    });
+}
+
+$notificationChatKind.on('change', function () {
+    let placeholder = $notificationChatKind.val() === "matrix" ? "#room:example.com" : "https://hooks.example.com/...";
+    $notificationChatAddress.attr("placeholder", placeholder);
+})
+
+$('#btn-save-notification-chat').on('click', function () {
+    let mc = $managementCodeInput.val();
+    let kind = $notificationChatKind.val();
+    let data = {"kind": kind};
+    data[kind === "matrix" ? "room" : "url"] = $notificationChatAddress.val();
+    data = JSON.stringify(data);
+    $.ajax({
+        type: "PUT",
+        data: data,
+        dataType: "json",
+        contentType: "application/json",
+        url: `${storageGet('notifications_endpoint')}/${mc}/chat`,
+        success: function () {
+            reloadNotificationChatTarget(mc);
+        },
+        error: standardErrorHandler
+    });
+})
+
+$('#btn-verify-notification-chat').on('click', function () {
+    let mc = $managementCodeInput.val();
+    let data = JSON.stringify({"code": $('#notification-chat-verification-code').val().trim()});
+    $.ajax({
+        type: "POST",
+        data: data,
+        dataType: "json",
+        contentType: "application/json",
+        url: `${storageGet('notifications_endpoint')}/${mc}/chat/verify`,
+        success: function () {
+            reloadNotificationChatTarget(mc);
+        },
+        error: standardErrorHandler
+    });
+})
+
+$('#btn-remove-notification-chat').on('click', function () {
+    let mc = $managementCodeInput.val();
+    $.ajax({
+        type: "DELETE",
+        dataType: "json",
+        contentType: "application/json",
+        url: `${storageGet('notifications_endpoint')}/${mc}/chat`,
+        success: function () {
+            reloadNotificationChatTarget(mc);
+        },
+        error: standardErrorHandler
+    });
+})
+
+$notificationDigestSelect.on('change', function () {
+    let mc = $managementCodeInput.val();
+    let data = {"digest": $notificationDigestSelect.val()};
+    data = JSON.stringify(data);
+    $.ajax({
+        type: "PUT",
+        data: data,
+        dataType: "json",
+        contentType: "application/json",
+        url: `${storageGet('notifications_endpoint')}/${mc}/digest`,
+        error: standardErrorHandler
+    });
+})
+
 function enableSaveNotificationClassesButton() {
     $('#btn-save-notification-classes').off('click').on('click', function () {
         let mc = $managementCodeInput.val();
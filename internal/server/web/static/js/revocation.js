@@ -67,18 +67,20 @@ function revokeID() {
 
 function _revoke(data, okCallback) {
     data = JSON.stringify(data);
-    $.ajax({
-        type: "POST",
-        data: data,
-        dataType: "json",
-        contentType: "application/json",
-        url: storageGet('revocation_endpoint'),
-        success: function () {
-            okCallback();
-        },
-        error: function (errRes) {
-            $errorModalMsg.text(getErrorMessage(errRes));
-            $errorModal.modal();
-        },
+    withStepUp(function (onError) {
+        $.ajax({
+            type: "POST",
+            data: data,
+            dataType: "json",
+            contentType: "application/json",
+            url: storageGet('revocation_endpoint'),
+            success: function () {
+                okCallback();
+            },
+            error: onError,
+        });
+    }, function (msg) {
+        $errorModalMsg.text(msg);
+        $errorModal.modal();
     });
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ const $preferredMimeTypeHTML = $('#preferred_mimetype_html');
 const $preferredMimeTypeText = $('#preferred_mimetype_txt');
 const $editMailBtn = $('#edit-mail-btn');
 const $saveMailBtn = $('#save-mail-btn');
+const $mailLanguageSelect = $('#mail-language-select');
 
 
 function $calendarTable(prefix = "") {
@@ -42,6 +43,7 @@ function getEmailInfo() {
             } else {
                 $preferredMimeTypeText.prop("checked", true);
             }
+            $mailLanguageSelect.val(res["language"]);
             settingsStatus["email_data_obtained"] = true;
         },
         error: function (errRes) {
@@ -69,16 +71,9 @@ $('input[type=radio][name=preferred_mimetype]').on('change', function () {
     });
 })
 
-$editMailBtn.on('click', function () {
-    $editMailBtn.hideB();
-    $saveMailBtn.showB();
-    $emailInput.prop("disabled", false);
-    $emailInput.select();
-})
-
-function saveMail() {
+$mailLanguageSelect.on('change', function () {
     let data = {
-        "email_address": $emailInput.val()
+        "language": $mailLanguageSelect.val()
     }
     data = JSON.stringify(data);
     $.ajax({
@@ -87,18 +82,45 @@ function saveMail() {
         dataType: "json",
         contentType: "application/json",
         url: storageGet('usersettings_endpoint') + "/email",
-        success: function (res) {
-            $saveMailBtn.hideB();
-            $editMailBtn.showB();
-            $emailVerifiedIcon.hideB();
-            $emailUnverifiedIcon.showB();
-            $emailInput.prop("disabled", true);
-        },
         error: function (errRes) {
             $settingsErrorModalMsg.text(getErrorMessage(errRes));
             $settingsErrorModal.modal();
         },
     });
+})
+
+$editMailBtn.on('click', function () {
+    $editMailBtn.hideB();
+    $saveMailBtn.showB();
+    $emailInput.prop("disabled", false);
+    $emailInput.select();
+})
+
+function saveMail() {
+    let data = {
+        "email_address": $emailInput.val()
+    }
+    data = JSON.stringify(data);
+    withStepUp(function (onError) {
+        $.ajax({
+            type: "PUT",
+            data: data,
+            dataType: "json",
+            contentType: "application/json",
+            url: storageGet('usersettings_endpoint') + "/email",
+            success: function (res) {
+                $saveMailBtn.hideB();
+                $editMailBtn.showB();
+                $emailVerifiedIcon.hideB();
+                $emailUnverifiedIcon.showB();
+                $emailInput.prop("disabled", true);
+            },
+            error: onError,
+        });
+    }, function (msg) {
+        $settingsErrorModalMsg.text(msg);
+        $settingsErrorModal.modal();
+    });
 }
 
 $saveMailBtn.on('click', saveMail)
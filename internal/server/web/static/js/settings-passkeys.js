@@ -0,0 +1,72 @@
+const $passkeysList = $('#passkeys-list');
+const $noPasskeys = $('#no-passkeys');
+const $passkeyNameInput = $('#passkey-name-input');
+
+$(function () {
+    chainFunctions(
+        checkIfLoggedIn,
+        loadPasskeys,
+    );
+})
+
+function showPasskeyError(msg) {
+    $settingsErrorModalMsg.text(msg);
+    $settingsErrorModal.modal();
+}
+
+function loadPasskeys(...next) {
+    $.ajax({
+        type: "GET",
+        url: storageGet('usersettings_endpoint') + "/passkeys",
+        success: function (res) {
+            $passkeysList.find('.passkey-entry').remove();
+            let passkeys = res['passkeys'] || [];
+            if (passkeys.length === 0) {
+                $noPasskeys.showB();
+            } else {
+                $noPasskeys.hideB();
+            }
+            passkeys.forEach(function (p) {
+                let lastUsed = p['last_used'] ? formatTime(p['last_used']) : 'Never';
+                let tr = $('<tr class="passkey-entry">');
+                tr.append($('<td>').text(p['name'] || p['credential_id'].substring(0, 16)));
+                tr.append($('<td>').text(formatTime(p['created'])));
+                tr.append($('<td>').text(lastUsed));
+                let btn = $('<button class="btn" type="button" data-toggle="tooltip" title="Delete Passkey">')
+                    .append('<i class="fas fa-trash"></i>');
+                btn.on('click', function () {
+                    deletePasskey(p['id']);
+                });
+                tr.append($('<td class="text-right">').append(btn));
+                $passkeysList.append(tr);
+            });
+            doNext(...next);
+        },
+        error: function (errRes) {
+            showPasskeyError(getErrorMessage(errRes));
+        },
+    });
+}
+
+function deletePasskey(id) {
+    let data = JSON.stringify({"id": id});
+    withStepUp(function (onError) {
+        $.ajax({
+            type: "DELETE",
+            data: data,
+            contentType: "application/json",
+            url: storageGet('usersettings_endpoint') + "/passkeys",
+            success: function () {
+                loadPasskeys();
+            },
+            error: onError,
+        });
+    }, showPasskeyError);
+}
+
+$('#passkey-register-btn').on('click', function () {
+    registerPasskey($passkeyNameInput.val(), function () {
+        $passkeyNameInput.val("");
+        loadPasskeys();
+    }, showPasskeyError);
+})
@@ -72,8 +72,43 @@ function initSSH(...next) {
 
 const deleteKeyHtml = `<td><a href="#" role="button" onclick="deleteKey(this)"><i class="fas fa-trash-alt text-danger"></i></a></td>`;
 
+let sshKeyHistories = {};
+
 function clearSSHKeyTable() {
     $sshKeyTable.find('tr.key-entry').remove();
+    sshKeyHistories = {};
+}
+
+function keyRestrictionsTitle(r) {
+    let parts = [];
+    if (r['allowed_ips']) {
+        parts.push(`Allowed IPs: ${r['allowed_ips'].join(', ')}`);
+    }
+    if (r['allowed_requests']) {
+        parts.push(`Allowed requests: ${r['allowed_requests'].join(', ')}`);
+    }
+    if (r['expires_at']) {
+        parts.push(`Expires: ${new Date(r['expires_at'] * 1000).toLocaleString()}`);
+    }
+    return parts.join('; ');
+}
+
+function showSSHKeyHistory(keyFP) {
+    const $history = $('#sshHistory');
+    $history.empty();
+    const history = sshKeyHistories[keyFP] || [];
+    if (history.length === 0) {
+        $history.append(`<tr><td colspan="4" class="text-muted text-center">This ssh key was not used yet</td></tr>`);
+    }
+    history.forEach(function (e) {
+        const tr = $('<tr>');
+        tr.append($('<td>').text(new Date(e['time'] * 1000).toLocaleString()));
+        tr.append($('<td>').text(e['request_type']));
+        tr.append($('<td>').text(e['ip']));
+        tr.append($('<td>').text(e['user_agent'] || ''));
+        $history.append(tr);
+    });
+    $('#sshHistoryModal').modal();
 }
 
 function addSSHKeyToTable(key) {
@@ -90,7 +125,19 @@ function addSSHKeyToTable(key) {
         name = '';
     }
     let keyFP = key['ssh_key_fp'];
-    const html = `<tr id="${keyFP}" class="key-entry"><td>${name}</td><td>${keyFP}</td><td>${created}</td><td>${last_used}</td>${deleteKeyHtml}</tr>`;
+    let caBadge = '';
+    if (key['ca']) {
+        let principals = key['principals'] || [];
+        let title = principals.length > 0 ? `Accepted principals: ${principals.join(', ')}` : 'Certificates must be issued for the ssh username';
+        caBadge = ` <span class="badge badge-info" data-toggle="tooltip" title="${title}">CA</span>`;
+    }
+    let restrictedBadge = '';
+    if (key['key_restrictions']) {
+        restrictedBadge = ` <span class="badge badge-warning" data-toggle="tooltip" title="${keyRestrictionsTitle(key['key_restrictions'])}">Restricted</span>`;
+    }
+    sshKeyHistories[keyFP] = key['history'];
+    const historyHtml = `<td><a href="#" role="button" onclick="showSSHKeyHistory('${keyFP}')" data-toggle="tooltip" title="Show history"><i class="fas fa-history"></i></a></td>`;
+    const html = `<tr id="${keyFP}" class="key-entry"><td>${name}${caBadge}${restrictedBadge}</td><td>${keyFP}</td><td>${created}</td><td>${last_used}</td>${historyHtml}${deleteKeyHtml}</tr>`;
     $sshKeyTable.append(html);
 }
 
@@ -104,6 +151,10 @@ $sshKeyFile.on('change', function () {
     fileReader.readAsText(file);
 })
 
+function splitSSHList(value) {
+    return value.split(',').map(p => p.trim()).filter(p => p !== '');
+}
+
 function addSSHKey() {
     let data = {
         "grant_type": "mytoken",
@@ -113,6 +164,29 @@ function addSSHKey() {
         "capabilities": getCheckedCapabilities(),
         "application_name": "mytoken webinterface"
     };
+    if ($('#ssh_key_ca').prop('checked')) {
+        data["ca"] = true;
+        let principals = splitSSHList($('#ssh_principals').val());
+        if (principals.length > 0) {
+            data["principals"] = principals;
+        }
+    }
+    let keyRestrictions = {};
+    let allowedIPs = splitSSHList($('#ssh_allowed_ips').val());
+    if (allowedIPs.length > 0) {
+        keyRestrictions["allowed_ips"] = allowedIPs;
+    }
+    let allowedRequests = splitSSHList($('#ssh_allowed_requests').val());
+    if (allowedRequests.length > 0) {
+        keyRestrictions["allowed_requests"] = allowedRequests;
+    }
+    let expiresAt = $('#ssh_key_expires_at').val();
+    if (expiresAt) {
+        keyRestrictions["expires_at"] = Math.floor(new Date(expiresAt).getTime() / 1000);
+    }
+    if (Object.keys(keyRestrictions).length > 0) {
+        data["key_restrictions"] = keyRestrictions;
+    }
     data = JSON.stringify(data);
     $.ajax({
         type: "POST",
@@ -0,0 +1,65 @@
+const $suspensionModal = $('#suspend-id-modal');
+const $suspensionFormID = $('#suspend-id');
+const $suspensionFormRecursive = $('#suspend-recursive');
+
+function suspensionSupported() {
+    let endpoint = storageGet('suspension_endpoint');
+    return endpoint !== null && endpoint !== undefined && endpoint !== "";
+}
+
+function startSuspensionID() {
+    let id = this.id.replace("suspend-", "");
+    let resume = $(this).attr('suspended') === "true";
+    $suspensionFormID.val(id);
+    $suspensionFormID.data('resume', resume);
+    for (const c of revocationClasses) {
+        if ($(this).hasClass(c)) {
+            $suspensionFormID.addClass(c);
+        } else {
+            $suspensionFormID.removeClass(c);
+        }
+    }
+    let action = resume ? "Resume" : "Suspend";
+    $('#suspend-title').text(`${action} Mytoken`);
+    $('#suspend-submit').text(action);
+    $('#suspend-recursive-label').text(`Also ${action.toLowerCase()} all subtokens`);
+    $('#suspend-question').text(resume ? "Do you want to resume this mytoken? It can be used again afterwards." :
+        "Are you sure you want to suspend this mytoken? A suspended mytoken cannot be used until it is resumed.");
+    $suspensionFormRecursive.prop('checked', false);
+    $suspensionModal.modal();
+}
+
+function suspendOrResumeID() {
+    let id = $suspensionFormID.val();
+    let resume = $suspensionFormID.data('resume');
+    let recursive = $suspensionFormRecursive.is(':checked');
+    let okCallback = function () {
+    };
+    if ($suspensionFormID.hasClass(revocationClassFromSubtokens)) {
+        okCallback = _getSubtokensInfo;
+    } else if ($suspensionFormID.hasClass(revocationClassFromTokenList)) {
+        okCallback = _getListTokenInfo;
+    }
+    _suspension({
+        "mom_id": id,
+        "recursive": recursive,
+    }, resume, okCallback);
+}
+
+function _suspension(data, resume, okCallback) {
+    data = JSON.stringify(data);
+    $.ajax({
+        type: resume ? "DELETE" : "POST",
+        data: data,
+        dataType: "json",
+        contentType: "application/json",
+        url: storageGet('suspension_endpoint'),
+        success: function () {
+            okCallback();
+        },
+        error: function (errRes) {
+            $errorModalMsg.text(getErrorMessage(errRes));
+            $errorModal.modal();
+        },
+    });
+}
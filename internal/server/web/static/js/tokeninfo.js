@@ -5,7 +5,7 @@ const $notificationMOMID = $('#notify-id');
 
 let tokeninfoEndpointToUse;
 
-function _tokeninfo(action, successFnc, errorFnc, token = undefined, mom_id = undefined) {
+function _tokeninfo(action, successFnc, errorFnc, token = undefined, mom_id = undefined, details = false) {
     let data = {
         'action': action
     };
@@ -15,6 +15,9 @@ function _tokeninfo(action, successFnc, errorFnc, token = undefined, mom_id = un
     if (mom_id !== undefined) {
         data['mom_ids'] = [mom_id];
     }
+    if (details) {
+        data['details'] = true;
+    }
     data = JSON.stringify(data);
     $.ajax({
         type: "POST",
@@ -125,6 +128,104 @@ function historyToHTML(events) {
 }
 
 
+function rotationToHTML(rot) {
+    if (rot === undefined || rot === null || (!rot['on_AT'] && !rot['on_other'])) {
+        return '<span class="text-muted">No rotation</span>';
+    }
+    let on = [];
+    if (rot['on_AT']) {
+        on.push('access token requests');
+    }
+    if (rot['on_other']) {
+        on.push('other requests');
+    }
+    let html = `Rotated on ${on.join(' and ')}`;
+    if (rot['lifetime']) {
+        html += `; each rotated token is valid for ${rot['lifetime']} seconds`;
+    }
+    if (rot['auto_revoke']) {
+        html += '; reuse of an old token revokes the mytoken';
+    }
+    return html;
+}
+
+function remainingUsagesToHTML(limit, done) {
+    if (limit === undefined || limit === null) {
+        return '<span class="text-muted">unlimited</span>';
+    }
+    let remaining = Math.max(limit - (done || 0), 0);
+    return `${remaining} / ${limit}`;
+}
+
+function restrictionsToHTML(restrictions) {
+    if (restrictions === undefined || restrictions.length === 0) {
+        return '<span class="text-muted">Unrestricted</span>';
+    }
+    let tableEntries = [];
+    restrictions.forEach(function (r) {
+        let nbf = r['nbf'] ? formatTime(r['nbf']) : '';
+        let exp = r['exp'] ? formatTime(r['exp']) : '';
+        let hosts = escapeHTML((r['hosts'] || []).join(', '));
+        let geoip = escapeHTML((r['geoip_allow'] || []).join(', '));
+        let geoipDisallow = escapeHTML((r['geoip_disallow'] || []).map(c => '!' + c).join(', '));
+        if (geoip !== "" && geoipDisallow !== "") {
+            geoip += ', ';
+        }
+        geoip += geoipDisallow;
+        let entry = '<tr>' +
+            '<td>' + nbf + '</td>' +
+            '<td>' + exp + '</td>' +
+            '<td style="word-break: break-all;">' + escapeHTML(r['scope'] || '') + '</td>' +
+            '<td style="word-break: break-all;">' + escapeHTML((r['audience'] || []).join(', ')) + '</td>' +
+            '<td style="word-break: break-all;">' + hosts + '</td>' +
+            '<td>' + geoip + '</td>' +
+            '<td>' + remainingUsagesToHTML(r['usages_AT'], r['usages_AT_done']) + '</td>' +
+            '<td>' + remainingUsagesToHTML(r['usages_other'], r['usages_other_done']) + '</td>' +
+            '</tr>';
+        tableEntries.push(entry);
+    });
+    return '<table class="table table-hover table-grey">' +
+        '<thead><tr>' +
+        '<th>Not Before</th>' +
+        '<th>Expires</th>' +
+        '<th>Scope</th>' +
+        '<th>Audiences</th>' +
+        '<th>Hosts</th>' +
+        '<th>Countries</th>' +
+        '<th>Remaining AT Usages</th>' +
+        '<th>Remaining Other Usages</th>' +
+        '</tr></thead>' +
+        '<tbody>' +
+        tableEntries.join('') +
+        '</tbody></table>';
+}
+
+function detailsToHTML(details) {
+    let lastUsed = details['last_used'] ? formatTime(details['last_used']) : '<span class="text-muted">Never</span>';
+    let capabilities = (details['capabilities'] || []).map(c => `<span class="badge badge-info mr-1">${escapeHTML(c)}</span>`);
+    if (capabilities.length === 0) {
+        capabilities = ['<span class="text-muted">None</span>'];
+    }
+    return `<h6>Last Used</h6><p>${lastUsed}</p>` +
+        `<h6>Capabilities</h6><p>${capabilities.join('')}</p>` +
+        `<h6>Rotation</h6><p>${rotationToHTML(details['rotation'])}</p>` +
+        `<h6>Restrictions</h6>${restrictionsToHTML(details['restrictions'])}`;
+}
+
+// tokenDetails holds the details of the mytokens in the token list, indexed by their mom_id
+let tokenDetails = {};
+
+function showDetailsForID() {
+    let id = this.id.replace("details-", "");
+    let details = tokenDetails[id];
+    if (details === undefined) {
+        return;
+    }
+    $('#token-details-modal-title').text(`Details of ${details['name']}`);
+    $('#token-details-modal-msg').html(detailsToHTML(details));
+    $('#token-details-modal').modal();
+}
+
 let tokenTreeIDCounter = 1;
 
 function _tokenTreeToHTML(tree, deleteClass, depth, parentID = "0", includeBtns = true, filter_tokens = undefined, filter_out = false) {
@@ -152,6 +253,22 @@ function _tokenTreeToHTML(tree, deleteClass, depth, parentID = "0", includeBtns
     let isExpired = (expires_at !== 0 && new Date(expires_at * 1000) < new Date());
     let historyBtn = `<button id="history-${token['mom_id']}" class="btn ml-2" type="button" onclick="showHistoryForID.call(this)" ${loggedIn ? "" : "disabled"} data-toggle="tooltip" data-placement="right" title="${loggedIn ? 'Event History' : 'Sign in to show event history.'}"><i class="fas fa-history"></i></button>`;
     let deleteBtn = `<button id="revoke-${token['mom_id']}" class="btn ${deleteClass}" type="button" onclick="startRevocateID.call(this)" ${loggedIn ? "" : "disabled"} data-toggle="tooltip" data-placement="right" title="${loggedIn ? 'Revoke Token' : 'Sign in to revoke token.'}"><i class="fas fa-trash"></i></button>`;
+    let suspended = token['suspended'] || false;
+    let suspendBtn = "";
+    if (typeof suspensionSupported === "function" && suspensionSupported()) {
+        let suspendTitle = suspended ? 'Resume Token' : 'Suspend Token';
+        suspendBtn = `<button id="suspend-${token['mom_id']}" class="btn ${deleteClass}" type="button" suspended="${suspended}" onclick="startSuspensionID.call(this)" ${loggedIn && !isExpired ? "" : "disabled"} data-toggle="tooltip" data-placement="right" title="${loggedIn ? suspendTitle : 'Sign in to suspend or resume token.'}"><i class="fas ${suspended ? 'fa-play' : 'fa-pause'}"></i></button>`;
+    }
+    let detailsBtn = "";
+    let subtokenBtn = "";
+    let details = token['details'];
+    if (details !== undefined) {
+        tokenDetails[token['mom_id']] = $.extend({'name': name}, details);
+        detailsBtn = `<button id="details-${token['mom_id']}" class="btn" type="button" onclick="showDetailsForID.call(this)" data-toggle="tooltip" data-placement="right" title="Details"><i class="fas fa-info-circle"></i></button>`;
+        let canCreate = !isExpired && !suspended && (details['capabilities'] || []).includes('create_mytoken');
+        let subtokenTitle = canCreate ? 'Create Subtoken' : 'This mytoken cannot create subtokens.';
+        subtokenBtn = `<button id="subtoken-${token['mom_id']}" class="btn" type="button" onclick="startCreateSubtokenID.call(this)" ${canCreate ? "" : "disabled"} data-toggle="tooltip" data-placement="right" title="${subtokenTitle}"><i class="fas fa-code-branch"></i></button>`;
+    }
     let notificationsBtn = "";
     if (calendar_notifications_supported || email_notifications_supported) {
         notificationsBtn = `<button id="notify-${token['mom_id']}" class="btn ${isExpired ? 'text-muted' : ''}" type="button" onclick="notificationModal.call(this, ${expires_at !== 0})" ${!loggedIn || isExpired ? "disabled" : ""}`;
@@ -160,7 +277,7 @@ function _tokenTreeToHTML(tree, deleteClass, depth, parentID = "0", includeBtns
         }
         notificationsBtn += `><i class="fas fa-bell"></i></butoton>`;
     }
-    tableEntries = `<tr id="${thisID}" parent-id="${parentID}" mom-id="${token['mom_id']}" class="${depth > 0 ? 'd-none' : ''} ${isExpired ? 'text-muted' : ''}"><td class="${hasChildren ? 'token-fold' : ''}${nameClass}"><span style="margin-right: ${1.5 * depth}rem;"></span><i class="mr-2 fas fa-caret-right${hasChildren ? "" : " d-none"}"></i>${name}</td><td>${created}</td><td>${token['ip']}</td><td>${expires}</td><td class="actions-td">${includeBtns ? historyBtn + notificationsBtn + deleteBtn : ""}</td></tr>` + tableEntries;
+    tableEntries = `<tr id="${thisID}" parent-id="${parentID}" mom-id="${token['mom_id']}" class="${depth > 0 ? 'd-none' : ''} ${isExpired ? 'text-muted' : ''}"><td class="${hasChildren ? 'token-fold' : ''}${nameClass}"><span style="margin-right: ${1.5 * depth}rem;"></span><i class="mr-2 fas fa-caret-right${hasChildren ? "" : " d-none"}"></i>${name}${suspended ? ' <span class="badge badge-warning">suspended</span>' : ''}</td><td>${created}</td><td>${token['ip']}</td><td>${expires}</td><td class="actions-td">${includeBtns ? detailsBtn + historyBtn + subtokenBtn + notificationsBtn + suspendBtn + deleteBtn : ""}</td></tr>` + tableEntries;
     return tableEntries
 }
 
@@ -273,6 +390,7 @@ function _getListTokenInfo(token, ...next) {
     tokeninfoEndpointToUse = storageGet("tokeninfo_endpoint");
     _tokeninfo('list_mytokens',
         function (infoRes) {
+            tokenDetails = {};
             listMsg.html(tokenlistToHTML(infoRes['mytokens'], revocationClassFromTokenList));
             activateTokenList();
             listMsg.removeClass('text-danger');
@@ -287,7 +405,7 @@ function _getListTokenInfo(token, ...next) {
             listMsg.text(getErrorMessage(errRes));
             listMsg.addClass('text-danger');
             listCopy.removeClass('d-none');
-        }, token);
+        }, token, undefined, true);
 }
 
 let loadedTokenList = false;
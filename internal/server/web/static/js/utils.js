@@ -38,8 +38,8 @@ $.fn.hideB = function () {
 }
 
 $('.my-expand').on('click', function () {
-    const expand = "Expand";
-    const collapse = "Collapse";
+    const expand = $(this).data('expand') || "Expand";
+    const collapse = $(this).data('collapse') || "Collapse";
     if ($(this).text().trim() === expand) {
         $(this).text(collapse);
     } else {
@@ -69,6 +69,10 @@ function escapeSelector(s) {
     return $.escapeSelector(s)
 }
 
+function escapeHTML(s) {
+    return $('<div>').text(s).html();
+}
+
 function doNext(...next) {
     if (next.length === 0) {
         return;
@@ -0,0 +1,172 @@
+function b64urlEncode(buffer) {
+    let bytes = new Uint8Array(buffer);
+    let str = "";
+    for (const b of bytes) {
+        str += String.fromCharCode(b);
+    }
+    return btoa(str).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function b64urlDecode(str) {
+    str = str.replace(/-/g, "+").replace(/_/g, "/");
+    while (str.length % 4) {
+        str += "=";
+    }
+    return Uint8Array.from(atob(str), c => c.charCodeAt(0));
+}
+
+function webauthnSupported() {
+    return window.PublicKeyCredential !== undefined && navigator.credentials !== undefined;
+}
+
+function isStepUpRequired(errRes) {
+    return errRes.status === 403 && errRes.responseJSON !== undefined &&
+        errRes.responseJSON['error'] === "step_up_required";
+}
+
+function _webauthnError(err, errCallback) {
+    if (errCallback !== undefined) {
+        errCallback(err);
+        return;
+    }
+    console.error(err);
+}
+
+// stepUp performs a passkey confirmation; if consentCode is given, the step-up is done for the authorization flow
+// of that consent code, otherwise for the mytoken of the current session
+function stepUp(consentCode, okCallback, errCallback) {
+    if (!webauthnSupported()) {
+        _webauthnError("Your browser does not support passkeys", errCallback);
+        return;
+    }
+    let data = {};
+    if (consentCode) {
+        data["consent_code"] = consentCode;
+    }
+    $.ajax({
+        type: "POST",
+        data: JSON.stringify(data),
+        dataType: "json",
+        contentType: "application/json",
+        url: storageGet('step_up_endpoint') + "/options",
+        success: function (options) {
+            let publicKey = {
+                challenge: b64urlDecode(options['challenge']),
+                rpId: options['rp_id'],
+                timeout: options['timeout'],
+                userVerification: "required",
+            };
+            if (options['allow_credentials']) {
+                publicKey.allowCredentials = options['allow_credentials'].map(id => ({
+                    type: "public-key",
+                    id: b64urlDecode(id),
+                }));
+            }
+            navigator.credentials.get({publicKey: publicKey}).then(function (cred) {
+                data["challenge"] = options['challenge'];
+                data["credential"] = {
+                    "id": cred.id,
+                    "client_data_json": b64urlEncode(cred.response.clientDataJSON),
+                    "authenticator_data": b64urlEncode(cred.response.authenticatorData),
+                    "signature": b64urlEncode(cred.response.signature),
+                };
+                $.ajax({
+                    type: "POST",
+                    data: JSON.stringify(data),
+                    contentType: "application/json",
+                    url: storageGet('step_up_endpoint'),
+                    success: function () {
+                        okCallback();
+                    },
+                    error: function (errRes) {
+                        _webauthnError(getErrorMessage(errRes), errCallback);
+                    },
+                });
+            }).catch(function (err) {
+                _webauthnError(err.toString(), errCallback);
+            });
+        },
+        error: function (errRes) {
+            _webauthnError(getErrorMessage(errRes), errCallback);
+        },
+    });
+}
+
+// withStepUp calls the passed function and, if the server requires a passkey confirmation, does the step-up and
+// calls the function again; fn gets an error handler that must be used for the ajax request
+function withStepUp(fn, errCallback) {
+    fn(function (errRes) {
+        if (!isStepUpRequired(errRes)) {
+            errCallback(getErrorMessage(errRes));
+            return;
+        }
+        stepUp(undefined, function () {
+            fn(function (errRes) {
+                errCallback(getErrorMessage(errRes));
+            });
+        }, errCallback);
+    });
+}
+
+function registerPasskey(name, okCallback, errCallback) {
+    if (!webauthnSupported()) {
+        errCallback("Your browser does not support passkeys");
+        return;
+    }
+    withStepUp(function (onError) {
+        $.ajax({
+            type: "POST",
+            dataType: "json",
+            url: storageGet('usersettings_endpoint') + "/passkeys/options",
+            success: function (options) {
+                let publicKey = {
+                    challenge: b64urlDecode(options['challenge']),
+                    rp: {id: options['rp_id'], name: options['rp_name']},
+                    user: {
+                        id: b64urlDecode(options['user_id']),
+                        name: options['user_name'],
+                        displayName: options['user_name'],
+                    },
+                    pubKeyCredParams: options['algorithms'].map(alg => ({type: "public-key", alg: alg})),
+                    timeout: options['timeout'],
+                    authenticatorSelection: {
+                        residentKey: "required",
+                        userVerification: "required",
+                    },
+                };
+                if (options['exclude_credentials']) {
+                    publicKey.excludeCredentials = options['exclude_credentials'].map(id => ({
+                        type: "public-key",
+                        id: b64urlDecode(id),
+                    }));
+                }
+                navigator.credentials.create({publicKey: publicKey}).then(function (cred) {
+                    let data = {
+                        "challenge": options['challenge'],
+                        "name": name,
+                        "credential": {
+                            "id": cred.id,
+                            "client_data_json": b64urlEncode(cred.response.clientDataJSON),
+                            "attestation_object": b64urlEncode(cred.response.attestationObject),
+                        },
+                    };
+                    $.ajax({
+                        type: "POST",
+                        data: JSON.stringify(data),
+                        contentType: "application/json",
+                        url: storageGet('usersettings_endpoint') + "/passkeys",
+                        success: function () {
+                            okCallback();
+                        },
+                        error: function (errRes) {
+                            errCallback(getErrorMessage(errRes));
+                        },
+                    });
+                }).catch(function (err) {
+                    errCallback(err.toString());
+                });
+            },
+            error: onError,
+        });
+    }, errCallback);
+}
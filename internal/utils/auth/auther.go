@@ -8,7 +8,6 @@ import (
 	"github.com/oidc-mytoken/api/v0"
 	log "github.com/sirupsen/logrus"
 
-	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
 	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
 	"github.com/oidc-mytoken/server/internal/model"
 	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
@@ -19,7 +18,6 @@ import (
 	provider2 "github.com/oidc-mytoken/server/internal/oidc/provider"
 	"github.com/oidc-mytoken/server/internal/utils/ctxutils"
 	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
-	"github.com/oidc-mytoken/server/internal/utils/iputils"
 )
 
 // RequireGrantType checks that the passed model.GrantType are the same, and returns an error model.Response if not
@@ -88,8 +86,20 @@ func RequireMytokenNotRevoked(
 		}
 	}
 	rlog.Trace("Checked mytoken not revoked")
+	suspended, dbErr := dbhelper.CheckTokenSuspended(rlog, tx, mt.ID)
+	if dbErr != nil {
+		rlog.Errorf("%s", errorfmt.Full(dbErr))
+		return model.ErrorToInternalServerErrorResponse(dbErr)
+	}
+	if suspended {
+		return &model.Response{
+			Status:   fiber.StatusForbidden,
+			Response: model.TokenSuspendedError("the mytoken is suspended"),
+		}
+	}
+	rlog.Trace("Checked mytoken not suspended")
 	checkIPUnusual(rlog, tx, mt.ID, clientData)
-	return nil
+	return checkSuspiciousActivity(rlog, tx, mt, clientData)
 }
 
 // RequireValidMytoken checks the passed universalmytoken.UniversalMytoken and if needed other request parameters like
@@ -192,14 +202,7 @@ func checkIPUnusual(
 	_ = notifier.SendNotificationsForSubClass(
 		rlog, tx, mtID, api.NotificationClassUnusualIPs, clientData, nil,
 		func() (bool, error) {
-			ips, err := eventrepo.GetPreviouslyUsedIPs(rlog, tx, mtID)
-			if err != nil {
-				return false, err
-			}
-			if len(ips) == 0 {
-				return false, nil
-			}
-			return !iputils.IPIsIn(clientData.IP, ips), nil
+			return ipIsUnusual(rlog, tx, mtID, clientData.IP)
 		},
 	)
 }
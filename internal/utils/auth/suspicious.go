@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/oidc-mytoken/api/v0"
+	"github.com/oidc-mytoken/utils/unixtime"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oidc-mytoken/server/internal/config"
+	"github.com/oidc-mytoken/server/internal/db"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/actionrepo"
+	"github.com/oidc-mytoken/server/internal/db/dbrepo/eventrepo"
+	dbhelper "github.com/oidc-mytoken/server/internal/db/dbrepo/mytokenrepo/mytokenrepohelper"
+	"github.com/oidc-mytoken/server/internal/endpoints/actions"
+	"github.com/oidc-mytoken/server/internal/model"
+	eventService "github.com/oidc-mytoken/server/internal/mytoken/event"
+	eventpkg "github.com/oidc-mytoken/server/internal/mytoken/event/pkg"
+	mytoken "github.com/oidc-mytoken/server/internal/mytoken/pkg"
+	"github.com/oidc-mytoken/server/internal/mytoken/pkg/mtid"
+	notifier "github.com/oidc-mytoken/server/internal/notifier/client"
+	"github.com/oidc-mytoken/server/internal/utils/errorfmt"
+	"github.com/oidc-mytoken/server/internal/utils/geoip"
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+func ipIsUnusual(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, ip string) (bool, error) {
+	ips, err := eventrepo.GetPreviouslyUsedIPs(rlog, tx, mtID)
+	if err != nil {
+		return false, err
+	}
+	return isUnusualIP(ip, ips), nil
+}
+
+// isUnusualIP checks if an ip was not used before; if there are no previous usages, no ip is unusual
+func isUnusualIP(ip string, previousIPs []string) bool {
+	return len(previousIPs) > 0 && !iputils.IPIsIn(ip, previousIPs)
+}
+
+func knownCountryCode(code string) bool {
+	return code != "" && code != "-"
+}
+
+// isTravelImpossible checks if two usages that are elapsed seconds apart come from different countries although the
+// minimal travel time has not passed; unknown countries are never considered impossible travel
+func isTravelImpossible(lastCountry, currentCountry string, elapsed unixtime.UnixTime, minTravelTime int) bool {
+	if elapsed >= unixtime.UnixTime(minTravelTime) {
+		return false
+	}
+	if !knownCountryCode(lastCountry) || !knownCountryCode(currentCountry) {
+		return false
+	}
+	return lastCountry != currentCountry
+}
+
+func isImpossibleTravel(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, ip string, minTravelTime int,
+) (bool, error) {
+	last, found, err := eventrepo.GetLastEvent(rlog, tx, mtID)
+	if err != nil || !found {
+		return false, err
+	}
+	elapsed := unixtime.Now() - last.Time
+	if elapsed >= unixtime.UnixTime(minTravelTime) {
+		// Don't look up the countries if not needed
+		return false, nil
+	}
+	return isTravelImpossible(geoip.CountryCode(last.IP), geoip.CountryCode(ip), elapsed, minTravelTime), nil
+}
+
+func isATBurst(rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, maxRequests, window int) (bool, error) {
+	count, err := eventrepo.CountEventsSince(rlog, tx, mtID, api.EventATCreated, window)
+	if err != nil {
+		return false, err
+	}
+	return count >= maxRequests, nil
+}
+
+// detectSuspiciousActivity checks the configured suspicious activity triggers and returns the reason and the
+// configured action for the first trigger that fires
+func detectSuspiciousActivity(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mtID mtid.MTID, clientData *api.ClientMetaData,
+) (reason, action string, err error) {
+	conf := config.Get().Features.SuspiciousActivity
+	var suspicious bool
+	if a := conf.ImpossibleTravel.Action; a != config.SuspiciousActionNone {
+		suspicious, err = isImpossibleTravel(rlog, tx, mtID, clientData.IP, conf.ImpossibleTravel.MinTravelTime)
+		if err != nil {
+			return
+		}
+		if suspicious {
+			return "impossible travel", a, nil
+		}
+	}
+	if a := conf.UnusualIP.Action; a != config.SuspiciousActionNone {
+		suspicious, err = ipIsUnusual(rlog, tx, mtID, clientData.IP)
+		if err != nil {
+			return
+		}
+		if suspicious {
+			return "unusual ip", a, nil
+		}
+	}
+	if a := conf.ATBurst.Action; a != config.SuspiciousActionNone {
+		suspicious, err = isATBurst(rlog, tx, mtID, conf.ATBurst.MaxRequests, conf.ATBurst.Window)
+		if err != nil {
+			return
+		}
+		if suspicious {
+			return fmt.Sprintf(
+				"at least %d access tokens within %d seconds", conf.ATBurst.MaxRequests, conf.ATBurst.Window,
+			), a, nil
+		}
+	}
+	return "", config.SuspiciousActionNone, nil
+}
+
+func respondToSuspiciousActivity(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken, clientData *api.ClientMetaData,
+	reason, action string,
+) error {
+	info := notifier.SuspiciousActivityInfo{
+		Reason: reason,
+	}
+	switch action {
+	case config.SuspiciousActionSuspend:
+		if err := dbhelper.SuspendMT(rlog, tx, mt.ID, false); err != nil {
+			return err
+		}
+		if err := eventService.LogEvent(
+			rlog, tx, eventpkg.MTEvent{
+				Event:          eventpkg.EventSuspended,
+				MTID:           mt.ID,
+				Comment:        fmt.Sprintf("suspicious activity: %s", reason),
+				ClientMetaData: *clientData,
+			},
+		); err != nil {
+			return err
+		}
+		link, err := actions.CreateResumeToken(rlog, tx, mt.ID)
+		if err != nil {
+			return err
+		}
+		info.Action = "The mytoken was suspended"
+		info.LinkText = "If this usage was legit, you can resume the mytoken with the following link:"
+		info.Link = link
+	case config.SuspiciousActionRevokeSubtree:
+		info.Action = "The mytoken and all its subtokens were revoked"
+	case config.SuspiciousActionReauthenticate:
+		link, err := actions.RecreateURL(
+			actionrepo.RecreateData{
+				Name:         db.NewNullString(mt.Name),
+				Issuer:       mt.OIDCIssuer,
+				Restrictions: mt.Restrictions,
+				Capabilities: mt.Capabilities,
+				Rotation:     mt.Rotation,
+				Created:      mt.IssuedAt,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		info.Action = "The mytoken and all its subtokens were revoked, you have to re-authenticate"
+		info.LinkText = "You can re-authenticate and create a new mytoken with the same properties with the " +
+			"following link:"
+		info.Link = link
+	}
+	// The mail must be prepared before the mytoken is revoked
+	if err := notifier.SendSuspiciousActivityMail(rlog, tx, mt.ID, clientData, info); err != nil {
+		rlog.WithError(err).Warn("could not send suspicious activity mail")
+	}
+	if action == config.SuspiciousActionSuspend {
+		return nil
+	}
+	return dbhelper.RevokeMT(rlog, tx, mt.ID, true)
+}
+
+// checkSuspiciousActivity checks a mytoken usage for suspicious activity and applies the configured automated
+// response; if the mytoken cannot be used anymore an error model.Response is returned
+func checkSuspiciousActivity(
+	rlog log.Ext1FieldLogger, tx *sqlx.Tx, mt *mytoken.Mytoken, clientData *api.ClientMetaData,
+) *model.Response {
+	if !config.Get().Features.SuspiciousActivity.Enabled {
+		return nil
+	}
+	reason, action, err := detectSuspiciousActivity(rlog, tx, mt.ID, clientData)
+	if err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if action == config.SuspiciousActionNone {
+		return nil
+	}
+	rlog.WithField("reason", reason).WithField("action", action).Info("Detected suspicious mytoken usage")
+	// The response must be applied within the caller's transaction (if any), because that transaction might already
+	// hold locks on the mytoken
+	if err = db.RunWithinTransaction(
+		rlog, tx, func(tx *sqlx.Tx) error {
+			return respondToSuspiciousActivity(rlog, tx, mt, clientData, reason, action)
+		},
+	); err != nil {
+		rlog.Errorf("%s", errorfmt.Full(err))
+		return model.ErrorToInternalServerErrorResponse(err)
+	}
+	if action == config.SuspiciousActionSuspend {
+		return &model.Response{
+			Status: fiber.StatusForbidden,
+			Response: model.TokenSuspendedError(
+				fmt.Sprintf("mytoken suspended because of suspicious activity: %s", reason),
+			),
+		}
+	}
+	return &model.Response{
+		Status:   fiber.StatusUnauthorized,
+		Response: model.InvalidTokenError(fmt.Sprintf("mytoken revoked because of suspicious activity: %s", reason)),
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/oidc-mytoken/utils/unixtime"
+
+	"github.com/oidc-mytoken/server/internal/utils/cache"
+)
+
+func TestIsUnusualIP(t *testing.T) {
+	cache.InitCache()
+	tests := []struct {
+		name     string
+		ip       string
+		previous []string
+		expected bool
+	}{
+		{
+			name:     "no previous usage",
+			ip:       "192.0.2.1",
+			expected: false,
+		},
+		{
+			name:     "known ip",
+			ip:       "192.0.2.1",
+			previous: []string{"198.51.100.1", "192.0.2.1"},
+			expected: false,
+		},
+		{
+			name:     "unknown ip",
+			ip:       "203.0.113.1",
+			previous: []string{"198.51.100.1", "192.0.2.1"},
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := isUnusualIP(test.ip, test.previous); got != test.expected {
+					t.Errorf("expected %v, but got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestIsTravelImpossible(t *testing.T) {
+	tests := []struct {
+		name           string
+		lastCountry    string
+		currentCountry string
+		elapsed        unixtime.UnixTime
+		expected       bool
+	}{
+		{
+			name:           "same country",
+			lastCountry:    "DE",
+			currentCountry: "DE",
+			elapsed:        10,
+			expected:       false,
+		},
+		{
+			name:           "other country too fast",
+			lastCountry:    "DE",
+			currentCountry: "US",
+			elapsed:        10,
+			expected:       true,
+		},
+		{
+			name:           "other country after travel time",
+			lastCountry:    "DE",
+			currentCountry: "US",
+			elapsed:        3600,
+			expected:       false,
+		},
+		{
+			name:           "unknown last country",
+			lastCountry:    "-",
+			currentCountry: "US",
+			elapsed:        10,
+			expected:       false,
+		},
+		{
+			name:           "unknown current country",
+			lastCountry:    "DE",
+			currentCountry: "",
+			elapsed:        10,
+			expected:       false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				got := isTravelImpossible(test.lastCountry, test.currentCountry, test.elapsed, 3600)
+				if got != test.expected {
+					t.Errorf("expected %v, but got %v", test.expected, got)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,16 @@
+package backoff
+
+// RetryInterval returns the interval after which an operation that failed attempts times is retried: Starting with
+// the initial interval, the interval is doubled with each attempt, but never exceeds maxInterval. If the maximum number
+// of attempts is reached, nil is returned.
+func RetryInterval[T ~int | ~int64](attempts, maxAttempts int, initial, maxInterval T) *T {
+	if attempts >= maxAttempts {
+		return nil
+	}
+	interval := initial
+	for i := 1; i < attempts && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	interval = min(interval, maxInterval)
+	return &interval
+}
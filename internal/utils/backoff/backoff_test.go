@@ -0,0 +1,28 @@
+package backoff
+
+import (
+	"testing"
+)
+
+func TestRetryInterval(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected *int
+	}{
+		{attempts: 1, expected: intPtr(60)},
+		{attempts: 2, expected: intPtr(120)},
+		{attempts: 3, expected: intPtr(200)},
+		{attempts: 4, expected: intPtr(200)},
+		{attempts: 5, expected: nil},
+	}
+	for _, test := range tests {
+		got := RetryInterval(test.attempts, 5, 60, 200)
+		if (got == nil) != (test.expected == nil) || (got != nil && *got != *test.expected) {
+			t.Errorf("For %d attempts expected %v, but got %v", test.attempts, test.expected, got)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
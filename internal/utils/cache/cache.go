@@ -48,6 +48,10 @@ const (
 	FederationOPMetadata
 	ScheduledNotifications
 	IPCache
+	FederationClients
+	NotifierRequestIDs
+	invalidated3
+	FederationResolveResponses
 )
 
 func k(t Type, key string) string {
@@ -28,7 +28,7 @@ func RenderExtendedErrorPage(
 		errorHeading = optionalErrorHeading
 	}
 	return ctx.Status(status).Render(
-		"sites/error", map[string]interface{}{
+		"sites/error", fiber.Map{
 			"empty-navbar":    true,
 			"error-heading":   errorHeading,
 			"msg":             errorMsg,
@@ -41,3 +41,10 @@ func GetMytoken(ctx *fiber.Ctx) (*universalmytoken.UniversalMytoken, bool) {
 	}
 	return &t, true
 }
+
+// IsWebSession checks if the mytoken used for the request is the session mytoken of the web interface, i.e. the one
+// stored in the mytoken cookie
+func IsWebSession(ctx *fiber.Ctx) bool {
+	cookie := ctx.Cookies("mytoken")
+	return cookie != "" && GetMytokenStr(ctx) == cookie
+}
@@ -0,0 +1,125 @@
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oidc-mytoken/server/internal/config"
+)
+
+// KeyLanguageName is the message key for the name of a language in the language itself
+const KeyLanguageName = "language.name"
+
+//go:embed locales
+var _locales embed.FS
+
+type catalog map[string]string
+
+var catalogs = make(map[string]catalog)
+
+// Init loads the message catalogs for all configured languages; messages from a catalog in the overwrite directory
+// take precedence over the included messages, languages that are not included can be added this way
+func Init() {
+	catalogs = make(map[string]catalog)
+	for _, lang := range config.Get().I18n.Languages {
+		c, err := loadCatalog(lang, config.Get().I18n.OverwriteDir)
+		if err != nil {
+			log.WithError(err).WithField("language", lang).Fatal("could not load message catalog")
+		}
+		if len(c) == 0 {
+			log.WithField("language", lang).Warn("no messages found for language")
+		}
+		catalogs[lang] = c
+	}
+}
+
+func loadCatalog(lang, overwriteDir string) (catalog, error) {
+	c := catalog{}
+	data, err := _locales.ReadFile(fmt.Sprintf("locales/%s.yaml", lang))
+	if err == nil {
+		if err = yaml.Unmarshal(data, &c); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if overwriteDir == "" {
+		return c, nil
+	}
+	data, err = os.ReadFile(filepath.Join(overwriteDir, lang+".yaml"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	overwrite := catalog{}
+	if err = yaml.Unmarshal(data, &overwrite); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range overwrite {
+		c[k] = v
+	}
+	return c, nil
+}
+
+// Languages returns the supported languages
+func Languages() []string {
+	return config.Get().I18n.Languages
+}
+
+// DefaultLanguage returns the default language
+func DefaultLanguage() string {
+	return config.Get().I18n.DefaultLanguage
+}
+
+// Match returns the first of the passed language tags that is supported, e.g. 'de' for 'de-AT' if 'de' is
+// supported; if none of the languages is supported, the default language is returned
+func Match(langs ...string) string {
+	supported := Languages()
+	for _, lang := range langs {
+		lang = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+		if lang == "" {
+			continue
+		}
+		primary, _, _ := strings.Cut(lang, "-")
+		for _, s := range supported {
+			if s == lang || s == primary {
+				return s
+			}
+		}
+	}
+	return DefaultLanguage()
+}
+
+// Translate returns the message for the passed key in the passed language; if there is no such message,
+// the message in the default language is used, and if there is none either, the key itself is returned
+func Translate(lang, key string) string {
+	if msg, ok := catalogs[lang][key]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[DefaultLanguage()][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// Translatef returns the message for the passed key in the passed language formatted with the passed arguments
+func Translatef(lang, key string, args ...any) string {
+	return fmt.Sprintf(Translate(lang, key), args...)
+}
+
+// Lambda returns a mustache lambda that translates the message key enclosed in the section into the passed
+// language, e.g. {{#t}}web.nav.settings{{/t}}; the message itself is rendered as a template, so it can use the
+// template's variables
+func Lambda(lang string) func(string, func(string) (string, error)) (string, error) {
+	return func(text string, render func(string) (string, error)) (string, error) {
+		return render(Translate(lang, strings.TrimSpace(text)))
+	}
+}
@@ -0,0 +1,64 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		langs    []string
+		expected string
+	}{
+		{
+			name:     "Nothing",
+			expected: "en",
+		},
+		{
+			name:     "Supported",
+			langs:    []string{"fr"},
+			expected: "fr",
+		},
+		{
+			name:     "Region",
+			langs:    []string{"de_AT"},
+			expected: "de",
+		},
+		{
+			name:     "Unsupported first",
+			langs:    []string{"es-ES", "", "FR-ch"},
+			expected: "fr",
+		},
+		{
+			name:     "Unsupported",
+			langs:    []string{"es"},
+			expected: "en",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				if got := Match(test.langs...); got != test.expected {
+					t.Errorf("Expected '%s', but got '%s'", test.expected, got)
+				}
+			},
+		)
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	Init()
+	for k := range catalogs[DefaultLanguage()] {
+		for _, lang := range Languages() {
+			if _, ok := catalogs[lang][k]; !ok {
+				t.Errorf("Message '%s' missing for language '%s'", k, lang)
+			}
+		}
+	}
+	if got := Translatef("de", "mail.duration.days", 3); got != "3 Tagen" {
+		t.Errorf("Unexpected translation '%s'", got)
+	}
+	if got := Translate("fr", "unknown.key"); got != "unknown.key" {
+		t.Errorf("Expected key for unknown message, but got '%s'", got)
+	}
+}
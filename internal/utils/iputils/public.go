@@ -0,0 +1,31 @@
+package iputils
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IsPublic checks if an ip is a public unicast address, i.e. not a loopback, private, link-local, multicast, or
+// unspecified address
+func IsPublic(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+// CheckPublicHost checks that a user supplied host does not obviously point to a non-public address; the host is
+// not resolved, since the resolved address can change until the host is actually contacted. Therefore, requests to
+// such hosts must additionally be checked when dialing.
+func CheckPublicHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.Errorf("host '%s' is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublic(ip) {
+		return errors.Errorf("host '%s' is not allowed", host)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package iputils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.216.34", public: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{ip: "127.0.0.1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "0.0.0.0"},
+		{ip: "224.0.0.1"},
+		{ip: "::1"},
+		{ip: "fe80::1"},
+		{ip: "fd00::1"},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.ip, func(t *testing.T) {
+				if public := IsPublic(net.ParseIP(test.ip)); public != test.public {
+					t.Errorf("expected IsPublic to be %v, but got %v", test.public, public)
+				}
+			},
+		)
+	}
+}
@@ -42,6 +42,16 @@ const (
 	MustacheKeySubscribeNotifications       = "subscribe-notifications"
 	MustacheKeyNotificationsMailEnabled     = "notifications-mail-enabled"
 	MustacheKeyNotificationsCalendarEnabled = "notifications-calendar-enabled"
+	MustacheKeyNotificationsChatEnabled     = "notifications-chat-enabled"
+	MustacheKeyLanguage                     = "lang"
+	MustacheKeyLanguages                    = "languages"
+	MustacheKeyTranslate                    = "t"
+	MustacheKeyPasskeys                     = "passkeys"
+	MustacheKeyStepUp                       = "step-up"
+	MustacheKeyDangerCapabilities           = "danger-capabilities"
+	MustacheKeyVerifiedClient               = "verified-client"
+	MustacheKeyUnverifiedClient             = "unverified-client"
+	MustacheKeyLogo                         = "logo"
 )
 
 // Keys for sub configs
@@ -139,3 +139,28 @@ func GetBoolFromAnyMap(m map[string]any, key string) bool {
 	b, _ := v.(bool)
 	return b
 }
+
+// GetStringSliceFromAnyMap returns a string slice value from a map[string]any; a single string value is returned as a
+// slice with one element
+func GetStringSliceFromAnyMap(m map[string]any, key string) []string {
+	v, found := m[key]
+	if !found {
+		return nil
+	}
+	switch vv := v.(type) {
+	case string:
+		return []string{vv}
+	case []string:
+		return vv
+	case []any:
+		s := make([]string, 0, len(vv))
+		for _, e := range vv {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	default:
+		return nil
+	}
+}
@@ -61,3 +61,51 @@ func TestSplitIgnoreEmpty(t *testing.T) {
 		)
 	}
 }
+
+func TestGetStringSliceFromAnyMap(t *testing.T) {
+	m := map[string]any{
+		"string":       "a",
+		"string_slice": []string{"a", "b"},
+		"any_slice":    []any{"a", 1, "b"},
+		"other":        42,
+	}
+	tests := []struct {
+		name     string
+		key      string
+		expected []string
+	}{
+		{
+			name:     "Not found",
+			key:      "missing",
+			expected: []string{},
+		},
+		{
+			name:     "String",
+			key:      "string",
+			expected: []string{"a"},
+		},
+		{
+			name:     "String slice",
+			key:      "string_slice",
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "Any slice",
+			key:      "any_slice",
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "Other type",
+			key:      "other",
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				s := GetStringSliceFromAnyMap(m, test.key)
+				checkSlice(t, s, test.expected)
+			},
+		)
+	}
+}
@@ -0,0 +1,174 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/pkg/errors"
+
+	"github.com/oidc-mytoken/server/internal/utils/cryptutils"
+)
+
+// SupportedAlgorithms are the COSE algorithms that are requested for new credentials
+var SupportedAlgorithms = []int{
+	int(webauthncose.AlgES256),
+	int(webauthncose.AlgEdDSA),
+	int(webauthncose.AlgRS256),
+}
+
+// RelyingParty holds the relying party information against which WebAuthn responses are verified
+type RelyingParty struct {
+	ID     string
+	Origin string
+}
+
+// NewRelyingParty creates a new RelyingParty from the issuer url of this instance
+func NewRelyingParty(issuer string) (RelyingParty, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return RelyingParty{}, errors.WithStack(err)
+	}
+	return RelyingParty{
+		ID:     u.Hostname(),
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+// NewChallenge creates a new random challenge
+func NewChallenge() (string, error) {
+	b, err := cryptutils.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RegistrationResponse is the response of the browser to a registration ceremony; all binary values are base64url
+// encoded
+type RegistrationResponse struct {
+	CredentialID      string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// AssertionResponse is the response of the browser to an authentication ceremony; all binary values are base64url
+// encoded
+type AssertionResponse struct {
+	CredentialID      string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+}
+
+func decode(s string) (protocol.URLEncodedBase64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		// Be lenient with padded values
+		b, err = base64.URLEncoding.DecodeString(s)
+	}
+	return b, errors.WithStack(err)
+}
+
+func publicKeyCredential(credentialID string) (protocol.PublicKeyCredential, error) {
+	rawID, err := decode(credentialID)
+	if err != nil {
+		return protocol.PublicKeyCredential{}, err
+	}
+	return protocol.PublicKeyCredential{
+		Credential: protocol.Credential{
+			ID:   base64.RawURLEncoding.EncodeToString(rawID),
+			Type: string(protocol.PublicKeyCredentialType),
+		},
+		RawID: rawID,
+	}, nil
+}
+
+// VerifyRegistration verifies the response of a registration ceremony and returns the COSE encoded public key and the
+// initial signature counter of the new credential. A passkey is used as a second factor, so the authenticator must
+// have verified the user, e.g. with a pin or biometrics; mere presence could be proven by anyone with access to the
+// authenticator.
+func (rp RelyingParty) VerifyRegistration(r RegistrationResponse, challenge string) ([]byte, uint32, error) {
+	if r.CredentialID == "" {
+		return nil, 0, errors.New("credential id missing")
+	}
+	cred, err := publicKeyCredential(r.CredentialID)
+	if err != nil {
+		return nil, 0, err
+	}
+	clientData, err := decode(r.ClientDataJSON)
+	if err != nil {
+		return nil, 0, err
+	}
+	attestationObject, err := decode(r.AttestationObject)
+	if err != nil {
+		return nil, 0, err
+	}
+	parsed, err := protocol.CredentialCreationResponse{
+		PublicKeyCredential: cred,
+		AttestationResponse: protocol.AuthenticatorAttestationResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientData},
+			AttestationObject:     attestationObject,
+		},
+	}.Parse()
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	if err = parsed.Verify(challenge, true, rp.ID, []string{rp.Origin}); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	authData := parsed.Response.AttestationObject.AuthData
+	if !authData.Flags.HasAttestedCredentialData() || len(authData.AttData.CredentialPublicKey) == 0 {
+		return nil, 0, errors.New("no attested credential data")
+	}
+	if !bytes.Equal(authData.AttData.CredentialID, cred.RawID) {
+		return nil, 0, errors.New("credential id does not match the attested credential data")
+	}
+	return authData.AttData.CredentialPublicKey, authData.Counter, nil
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony against the stored COSE encoded public key and
+// signature counter of the credential; the new signature counter is returned
+func (rp RelyingParty) VerifyAssertion(
+	r AssertionResponse, challenge string, publicKey []byte, signCount uint32,
+) (uint32, error) {
+	cred, err := publicKeyCredential(r.CredentialID)
+	if err != nil {
+		return 0, err
+	}
+	clientData, err := decode(r.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := decode(r.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := decode(r.Signature)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: cred,
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientData},
+			AuthenticatorData:     authData,
+			Signature:             sig,
+		},
+	}.Parse()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if err = parsed.Verify(challenge, rp.ID, []string{rp.Origin}, "", true, publicKey); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	// A counter that does not increase indicates a cloned authenticator; authenticators that do not support
+	// counters always report 0
+	newCount := parsed.Response.AuthenticatorData.Counter
+	if (newCount != 0 || signCount != 0) && newCount <= signCount {
+		return 0, errors.New("signature counter did not increase")
+	}
+	return newCount, nil
+}
@@ -0,0 +1,290 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// testFlags are the flags of a valid authenticator data
+const testFlags = byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+
+const flagAttestedCredentialData = byte(protocol.FlagAttestedCredentialData)
+
+var testRP = RelyingParty{
+	ID:     "mytoken.example.com",
+	Origin: "https://mytoken.example.com",
+}
+
+func testAuthenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func testCOSEKey(t *testing.T, key *ecdsa.PublicKey) []byte {
+	data, err := webauthncbor.Marshal(
+		webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  int64(webauthncose.P256),
+			XCoord: key.X.FillBytes(make([]byte, 32)),
+			YCoord: key.Y.FillBytes(make([]byte, 32)),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testAttestedAuthenticatorData(rpID string, flags byte, credentialID, coseKey []byte) []byte {
+	data := testAuthenticatorData(rpID, flags, 3)
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+	data = append(data, credentialID...)
+	return append(data, coseKey...)
+}
+
+func testAttestationObject(t *testing.T, authData []byte) []byte {
+	data, err := webauthncbor.Marshal(
+		map[string]any{
+			"fmt":      "none",
+			"attStmt":  map[string]any{},
+			"authData": authData,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testClientData(t *testing.T, typ, challenge, origin string) []byte {
+	data, err := json.Marshal(
+		protocol.CollectedClientData{Type: protocol.CeremonyType(typ), Challenge: challenge, Origin: origin},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testAssertion(
+	t *testing.T, key *ecdsa.PrivateKey, cd, ad []byte,
+) AssertionResponse {
+	cdHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte{}, ad...), cdHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return AssertionResponse{
+		CredentialID:      base64.RawURLEncoding.EncodeToString([]byte("cred")),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(cd),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(ad),
+		Signature:         base64.RawURLEncoding.EncodeToString(sig),
+	}
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	rp, err := NewRelyingParty("https://mytoken.example.com:8443/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.ID != "mytoken.example.com" {
+		t.Errorf("unexpected rp id '%s'", rp.ID)
+	}
+	if rp.Origin != "https://mytoken.example.com:8443" {
+		t.Errorf("unexpected origin '%s'", rp.Origin)
+	}
+}
+
+func TestRelyingParty_VerifyRegistration(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := testCOSEKey(t, &key.PublicKey)
+	credentialID := []byte("cred")
+	attestedAD := testAttestedAuthenticatorData(testRP.ID, testFlags|flagAttestedCredentialData, credentialID, pk)
+	tests := []struct {
+		name         string
+		credentialID string
+		ad           []byte
+		challenge    string
+		wantErr      bool
+	}{
+		{
+			name:         "valid",
+			credentialID: "cred",
+			ad:           attestedAD,
+			challenge:    "c",
+		},
+		{
+			name:         "wrong challenge",
+			credentialID: "cred",
+			ad:           attestedAD,
+			challenge:    "other",
+			wantErr:      true,
+		},
+		{
+			name:         "other credential id",
+			credentialID: "other",
+			ad:           attestedAD,
+			challenge:    "c",
+			wantErr:      true,
+		},
+		{
+			name:         "no attested credential data flag",
+			credentialID: "cred",
+			ad:           testAttestedAuthenticatorData(testRP.ID, testFlags, credentialID, pk),
+			challenge:    "c",
+			wantErr:      true,
+		},
+		{
+			name:         "no attested credential data",
+			credentialID: "cred",
+			ad:           testAuthenticatorData(testRP.ID, testFlags|flagAttestedCredentialData, 3),
+			challenge:    "c",
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				cd := testClientData(t, string(protocol.CreateCeremony), "c", testRP.Origin)
+				r := RegistrationResponse{
+					CredentialID:      base64.RawURLEncoding.EncodeToString([]byte(test.credentialID)),
+					ClientDataJSON:    base64.RawURLEncoding.EncodeToString(cd),
+					AttestationObject: base64.RawURLEncoding.EncodeToString(testAttestationObject(t, test.ad)),
+				}
+				gotPK, signCount, err := testRP.VerifyRegistration(r, test.challenge)
+				if test.wantErr {
+					if err == nil {
+						t.Error("expected error, but verification succeeded")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !bytes.Equal(gotPK, pk) {
+					t.Error("public key does not match")
+				}
+				if signCount != 3 {
+					t.Errorf("unexpected signature counter %d", signCount)
+				}
+			},
+		)
+	}
+}
+
+func TestRelyingParty_VerifyAssertion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := testCOSEKey(t, &key.PublicKey)
+	tests := []struct {
+		name      string
+		cd        []byte
+		ad        []byte
+		signCount uint32
+		wantErr   bool
+	}{
+		{
+			name: "valid",
+			cd:   testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:   testAuthenticatorData(testRP.ID, testFlags, 5),
+		},
+		{
+			name: "valid without counter",
+			cd:   testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:   testAuthenticatorData(testRP.ID, testFlags, 0),
+		},
+		{
+			name:    "wrong type",
+			cd:      testClientData(t, string(protocol.CreateCeremony), "c", testRP.Origin),
+			ad:      testAuthenticatorData(testRP.ID, testFlags, 5),
+			wantErr: true,
+		},
+		{
+			name:    "wrong origin",
+			cd:      testClientData(t, string(protocol.AssertCeremony), "c", "https://evil.example.com"),
+			ad:      testAuthenticatorData(testRP.ID, testFlags, 5),
+			wantErr: true,
+		},
+		{
+			name:    "wrong rp id",
+			cd:      testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:      testAuthenticatorData("evil.example.com", testFlags, 5),
+			wantErr: true,
+		},
+		{
+			name:    "user not present",
+			cd:      testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:      testAuthenticatorData(testRP.ID, byte(protocol.FlagUserVerified), 5),
+			wantErr: true,
+		},
+		{
+			name:    "user not verified",
+			cd:      testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:      testAuthenticatorData(testRP.ID, byte(protocol.FlagUserPresent), 5),
+			wantErr: true,
+		},
+		{
+			name:      "counter not increased",
+			cd:        testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+			ad:        testAuthenticatorData(testRP.ID, testFlags, 5),
+			signCount: 5,
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				r := testAssertion(t, key, test.cd, test.ad)
+				_, err := testRP.VerifyAssertion(r, "c", pk, test.signCount)
+				if test.wantErr && err == nil {
+					t.Error("expected error, but verification succeeded")
+				}
+				if !test.wantErr && err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			},
+		)
+	}
+}
+
+func TestRelyingParty_VerifyAssertion_InvalidSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := testCOSEKey(t, &other.PublicKey)
+	r := testAssertion(
+		t, key, testClientData(t, string(protocol.AssertCeremony), "c", testRP.Origin),
+		testAuthenticatorData(testRP.ID, testFlags, 1),
+	)
+	if _, err = testRP.VerifyAssertion(r, "c", pk, 0); err == nil {
+		t.Error("expected error for signature of another key")
+	}
+}
@@ -0,0 +1,57 @@
+package webhookclient
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/oidc-mytoken/utils/httpclient"
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+
+	"github.com/oidc-mytoken/server/internal/utils/iputils"
+)
+
+var client *resty.Client
+var clientOnce sync.Once
+
+// dialControl refuses connections to non-public addresses; it is called with the resolved address, so it also
+// covers hosts that resolve to internal addresses and redirects to such hosts
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !iputils.IsPublic(net.ParseIP(host)) {
+		return errors.Errorf("connections to '%s' are not allowed", host)
+	}
+	return nil
+}
+
+func newClient() *resty.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	c := resty.New()
+	c.SetTransport(transport)
+	c.SetCookieJar(nil)
+	c.SetRetryCount(2)
+	c.SetRedirectPolicy(resty.FlexibleRedirectPolicy(3))
+	c.SetTimeout(20 * time.Second)
+	c.SetHeader(fasthttp.HeaderUserAgent, httpclient.Do().Header.Get(fasthttp.HeaderUserAgent))
+	return c
+}
+
+// Do returns the client for requests to user supplied urls, e.g. webhooks. The client only connects to public
+// addresses, so user supplied urls cannot be used to reach internal services.
+func Do() *resty.Client {
+	clientOnce.Do(func() { client = newClient() })
+	return client
+}
@@ -26,6 +26,7 @@ type Endpoints struct {
 	Registration  string `json:"registration_endpoint"`
 	Revocation    string `json:"revocation_endpoint"`
 	Introspection string `json:"introspection_endpoint"`
+	JWKSURI       string `json:"jwks_uri"`
 }
 
 // OAuth2 returns the endpoints as oauth2.Endpoint so it can be used with the oauth2 package